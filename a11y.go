@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+)
+
+// altText is the text alternative of an image for screen readers: the
+// "alt" set for it in photo-slider.meta, or else its title and author.
+func altText(m imageMeta, cfg config) string {
+	if m.alt != "" {
+		return m.alt
+	}
+	title, author := exportText(m.title), exportText(m.author)
+	switch {
+	case !cfg.includeAuthor || author == "":
+		return title
+	case title == "":
+		return author
+	}
+	return msg("a11y.alt", title, author)
+}
+
+// altAttr is the attribute that gives the tile of m its text alternative:
+// alt on images, aria-label on videos and flipbooks.
+func altAttr(attr string, m imageMeta, cfg config) string {
+	return fmt.Sprintf(" %s=\"%s\"", attr, html.EscapeString(altText(m, cfg)))
+}
+
+// writeReducedMotion writes what the page does for viewers who asked their
+// system for less motion, as reduced_motion says: slow scrolls the strip at
+// a quarter of its speed and stops the Ken Burns zoom and flipbooks, pause
+// stops everything. OBS never asks for less motion, so the stream isn't
+// affected; the page embedded on a website is.
+func writeReducedMotion(w *bufio.Writer, cfg config) {
+	if cfg.reducedMotion == "off" {
+		return
+	}
+	selector := "#permas *"
+	if cfg.reducedMotion == "pause" {
+		selector = "#permas, #permas *"
+	}
+	mustWrite(w, "      @media (prefers-reduced-motion: reduce) {\n")
+	mustWrite(w, fmt.Sprintf("        %s {\n", selector))
+	mustWrite(w, "          animation-play-state: paused !important;\n")
+	mustWrite(w, "        }\n")
+	if cfg.reducedMotion == "slow" {
+		// The rows scroll themselves and have to keep going
+		mustWrite(w, "        #permas .row {\n")
+		mustWrite(w, "          animation-play-state: running !important;\n")
+		mustWrite(w, "        }\n")
+	}
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+}
+
+// reducedMotionClient slows the scroll down for reduced_motion=slow, which
+// CSS can't do without knowing every duration. It follows the setting when
+// it changes while the page is open.
+const reducedMotionClient = `    <script>
+      (function () {
+        var reduce = window.matchMedia("(prefers-reduced-motion: reduce)");
+        function apply() {
+          document.querySelectorAll("#permas, #permas .row").forEach(function (el) {
+            el.getAnimations().forEach(function (a) { a.playbackRate = reduce.matches ? 0.25 : 1; });
+          });
+        }
+        window.addEventListener("load", apply);
+        reduce.addEventListener("change", apply);
+      })();
+    </script>
+`
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const maxUploadBytes = 100 << 20
+
+// registerAdmin adds the /admin page, where images can be uploaded, captions
+// edited and images hidden from a phone or another PC.
+func (s *server) registerAdmin(mux *http.ServeMux) {
+	admin := http.NewServeMux()
+	admin.HandleFunc("GET /admin", s.adminPage)
+	admin.HandleFunc("POST /admin/upload", s.adminUpload)
+	admin.HandleFunc("POST /admin/image", s.adminEdit)
+	admin.HandleFunc("POST /admin/queue", s.adminReview)
+	admin.HandleFunc("GET /admin/events", s.adminHub.serveEvents)
+	admin.HandleFunc("GET /admin/thumb/{id}", s.serveAdminThumb)
+	admin.HandleFunc("GET /admin/incoming/{id}", func(w http.ResponseWriter, r *http.Request) {
+		e, err := findQueued(r.PathValue("id"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, e.Path)
+	})
+	admin.HandleFunc("POST /admin/regenerate", func(w http.ResponseWriter, r *http.Request) {
+		s.adminDone(w, r, msg("admin.regenerated"), nil)
+	})
+	// Forms are posted with the browser's saved password, so refuse
+	// requests made by other sites
+	mux.Handle("/admin", s.requireAdmin(http.NewCrossOriginProtection().Handler(admin)))
+	mux.Handle("/admin/", s.requireAdmin(http.NewCrossOriginProtection().Handler(admin)))
+}
+
+// requireAdmin asks for admin_password using HTTP basic auth; any user name
+// is accepted. Without a password the admin page is disabled.
+func (s *server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		password := s.config().adminPassword
+		if password == "" {
+			http.Error(w, msg("admin.disabled", configFile), http.StatusForbidden)
+			return
+		}
+		_, given, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="photo-slider admin"`)
+			http.Error(w, msg("admin.unauthorized"), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type adminImage struct {
+	imageEntry            // as filled into the form
+	Saved      imageEntry // as stored, which the form's changes are based on
+	URL        string
+	Conflicts  []captionConflict
+	Stats      imageStats
+}
+
+// FlagScore is the content filter score of a flagged image.
+func (a adminImage) FlagScore() float64 {
+	if a.Flagged == nil {
+		return 0
+	}
+	return *a.Flagged
+}
+
+func (s *server) adminPage(w http.ResponseWriter, r *http.Request) {
+	s.renderAdmin(w, http.StatusOK, r.URL.Query().Get("msg"), nil)
+}
+
+// renderAdmin writes the admin page. With edited set, its image shows the
+// form as it was posted rather than as it is stored.
+func (s *server) renderAdmin(w http.ResponseWriter, status int, message string, edited *adminImage) {
+	entries, err := listImages(s.config().filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stats, err := loadStats()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	list := make([]adminImage, 0, len(entries))
+	for _, e := range entries {
+		// Twice the height shown, for phone screens
+		image := adminImage{imageEntry: e, Saved: e, URL: "/admin/thumb/" + url.PathEscape(e.ID) + "?h=360", Stats: stats[e.Path]}
+		if edited != nil && edited.ID == e.ID {
+			image.imageEntry, image.Conflicts = edited.imageEntry, edited.Conflicts
+		}
+		list = append(list, image)
+	}
+	queued, err := listQueue()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	queue := make([]adminImage, 0, len(queued))
+	for _, e := range queued {
+		queue = append(queue, adminImage{imageEntry: e, URL: "/admin/incoming/" + url.PathEscape(e.ID)})
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	adminTemplate.Execute(w, map[string]any{
+		"Message": message,
+		"Images":  list,
+		"Queue":   queue,
+	})
+}
+
+func (s *server) adminUpload(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		s.adminDone(w, r, "", errors.New(msg("admin.upload_failed", err)))
+		return
+	}
+	files := r.MultipartForm.File["images"]
+	if len(files) == 0 {
+		s.adminDone(w, r, "", errors.New(msg("admin.no_files")))
+		return
+	}
+	author := strings.TrimSpace(r.FormValue("author"))
+	var saved []string
+	for _, fh := range files {
+		f, err := fh.Open()
+		if err != nil {
+			s.adminDone(w, r, "", err)
+			return
+		}
+		path, err := saveUpload(f, imageFolder, fh.Filename, s.config().limits)
+		f.Close()
+		if err != nil {
+			s.adminDone(w, r, "", fmt.Errorf("%s: %w", fh.Filename, err))
+			return
+		}
+		if author != "" {
+			err := s.updateMetadata(func(md metadata) error {
+				info := md.info(path)
+				_, title := captionFromName(path)
+				info.setCaption(path, author, title)
+				md.set(path, info)
+				return nil
+			})
+			if err != nil {
+				s.adminDone(w, r, "", err)
+				return
+			}
+		}
+		saved = append(saved, filepath.Base(path))
+	}
+	s.adminDone(w, r, msg("admin.uploaded", strings.Join(saved, ", ")), nil)
+}
+
+// saveUpload stores an uploaded image in dir under a name that isn't taken
+// yet. Files that aren't readable images, or are over limits, are refused.
+// Characters Windows doesn't allow in file names are left out of name,
+// which also keeps markup out of the caption taken from it.
+func saveUpload(src io.Reader, dir, name string, limits imageLimits) (string, error) {
+	name = filepath.Base(filepath.Clean("/" + strings.ReplaceAll(name, "\\", "/")))
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"|?*`, r) || r < ' ' {
+			return -1
+		}
+		return r
+	}, name)
+	ext := strings.ToLower(filepath.Ext(name))
+	if _, ok := allowedExt[ext]; !ok || strings.HasPrefix(name, ".") {
+		return "", errors.New(msg("admin.unsupported_type", ext))
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, _, err := imageSize(tmp.Name(), true, limits); err != nil {
+		return "", err
+	}
+
+	path := uniquePath(dir, name)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// adminEdit saves the caption and focal point of an image, or hides or
+// shows it.
+//
+// Several moderators may be editing at once, so a caption is saved as a
+// change to the values the form was loaded with: fields left alone keep
+// what others saved in the meantime. If someone else changed a field to
+// something else, nothing is saved and the form comes back with both
+// versions to choose from.
+func (s *server) adminEdit(w http.ResponseWriter, r *http.Request) {
+	e, err := findImage(s.config().filter, imageID(imageFolder, r.FormValue("path")))
+	if err != nil {
+		s.adminDone(w, r, "", err)
+		return
+	}
+	path := e.Path
+
+	var done string
+	var conflicted *adminImage
+	err = s.updateMetadata(func(md metadata) error {
+		info := md.info(path)
+		switch r.FormValue("action") {
+		case "hide":
+			info.Hidden = true
+			done = msg("admin.hid", path)
+		case "show":
+			info.Hidden = false
+			done = msg("admin.shown", path)
+		default:
+			mine, err := formCaption(r, "")
+			if err != nil {
+				return err
+			}
+			base, err := formCaption(r, "base_")
+			if err != nil {
+				return err
+			}
+			author, title := info.caption(path)
+			saved := captionFields{Author: author, Title: title, Link: info.Link, Focus: info.Focus}
+			merged, conflicts := mergeCaption(base, mine, saved)
+			if len(conflicts) > 0 {
+				conflicted = &adminImage{imageEntry: e, Conflicts: conflicts}
+				conflicted.Author, conflicted.Title, conflicted.Link, conflicted.Focus = merged.Author, merged.Title, merged.Link, merged.Focus
+				return errStaleVersion
+			}
+			info.setCaption(path, merged.Author, merged.Title)
+			info.Link = merged.Link
+			info.Focus = merged.Focus
+			done = msg("admin.saved", path)
+		}
+		md.set(path, info)
+		return nil
+	})
+	if conflicted != nil {
+		s.renderAdmin(w, http.StatusConflict, msg("admin.conflict", path), conflicted)
+		return
+	}
+	if err == nil {
+		s.imageChanged(e.ID)
+	}
+	s.adminDone(w, r, done, err)
+}
+
+// captionFields are the parts of an image's entry edited in its form.
+type captionFields struct {
+	Author, Title, Link string
+	Focus               *focusPoint
+}
+
+// captionConflict is a field that was changed both in a form and, since
+// the form was loaded, by someone else.
+type captionConflict struct {
+	Field string
+	Yours string
+	Saved string
+}
+
+// formCaption reads the caption fields of an image form: the values to
+// save, or with prefix "base_", the ones the form was loaded with.
+func formCaption(r *http.Request, prefix string) (captionFields, error) {
+	focus, err := parseFocus(r.FormValue(prefix+"focus_x"), r.FormValue(prefix+"focus_y"))
+	return captionFields{
+		Author: strings.TrimSpace(r.FormValue(prefix + "author")),
+		Title:  strings.TrimSpace(r.FormValue(prefix + "title")),
+		Link:   strings.TrimSpace(r.FormValue(prefix + "link")),
+		Focus:  focus,
+	}, err
+}
+
+// mergeCaption combines the changes from base to mine with the ones from
+// base to saved. A field both changed to different values is a conflict;
+// it keeps mine in the result.
+func mergeCaption(base, mine, saved captionFields) (captionFields, []captionConflict) {
+	var conflicts []captionConflict
+	// pick reports whether the field takes mine rather than saved
+	pick := func(field, base, mine, saved string) bool {
+		if mine == base || mine == saved {
+			return false
+		}
+		if saved != base {
+			conflicts = append(conflicts, captionConflict{Field: field, Yours: mine, Saved: saved})
+		}
+		return true
+	}
+	out := saved
+	if pick(msg("admin.author"), base.Author, mine.Author, saved.Author) {
+		out.Author = mine.Author
+	}
+	if pick(msg("admin.title_field"), base.Title, mine.Title, saved.Title) {
+		out.Title = mine.Title
+	}
+	if pick(msg("admin.link"), base.Link, mine.Link, saved.Link) {
+		out.Link = mine.Link
+	}
+	if pick(msg("admin.focus"), focusText(base.Focus), focusText(mine.Focus), focusText(saved.Focus)) {
+		out.Focus = mine.Focus
+	}
+	return out, conflicts
+}
+
+// focusText describes a focal point for comparing and showing it.
+func focusText(f *focusPoint) string {
+	if f == nil {
+		return msg("admin.focus_center")
+	}
+	return msg("admin.focus_at", f.X*100, f.Y*100)
+}
+
+// imageChanged tells open admin pages that the image with the given ID
+// was saved, so they show the new version.
+func (s *server) imageChanged(id string) {
+	if e, err := findImage(s.config().filter, id); err == nil {
+		s.adminHub.broadcast(e)
+	}
+}
+
+// adminReview approves or rejects an image waiting for review, saving the
+// caption it was given first.
+func (s *server) adminReview(w http.ResponseWriter, r *http.Request) {
+	e, err := findQueued(imageID(incomingFolder, r.FormValue("path")))
+	if err != nil {
+		s.adminDone(w, r, "", err)
+		return
+	}
+	var done string
+	err = s.updateMetadata(func(md metadata) error {
+		switch r.FormValue("action") {
+		case "reject":
+			done = msg("admin.rejected", e.ID)
+			return reject(s.config(), md, e.Path, r.FormValue("reason"))
+		case "preview":
+			info := md.info(e.Path)
+			info.Preview = !info.Preview
+			md.set(e.Path, info)
+			if info.Preview {
+				done = msg("admin.in_preview", e.ID)
+			} else {
+				done = msg("admin.not_in_preview", e.ID)
+			}
+			return nil
+		}
+		info := md.info(e.Path)
+		info.setCaption(e.Path, strings.TrimSpace(r.FormValue("author")), strings.TrimSpace(r.FormValue("title")))
+		info.Link = strings.TrimSpace(r.FormValue("link"))
+		md.set(e.Path, info)
+		dest, err := approve(s.config(), md, e.Path)
+		done = msg("admin.approved", dest)
+		return err
+	})
+	s.adminDone(w, r, done, err)
+}
+
+// adminDone regenerates the slider after a change (unless the change
+// failed) and goes back to the admin page with a message.
+func (s *server) adminDone(w http.ResponseWriter, r *http.Request, done string, err error) {
+	if err == nil {
+		err = s.regenerate()
+	}
+	if err != nil {
+		done = msg("admin.error", err)
+	}
+	http.Redirect(w, r, "/admin?msg="+url.QueryEscape(done), http.StatusSeeOther)
+}
+
+var adminTemplate = template.Must(template.New("admin").Funcs(template.FuncMap{"msg": msg}).Parse(`<!DOCTYPE html>
+<html>
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>{{msg "admin.title"}}</title>
+    <style>
+      body { font-family: sans-serif; margin: 0 auto; padding: 16px; max-width: 960px; background: #f4f4f4; }
+      form { margin: 0; }
+      .box { background: #fff; border-radius: 8px; padding: 12px; margin-bottom: 16px; }
+      .message { background: #fff3c4; }
+      .images { display: grid; grid-template-columns: repeat(auto-fill, minmax(260px, 1fr)); gap: 16px; }
+      .image img { width: 100%; height: 180px; object-fit: contain; background: #222; border-radius: 4px; }
+      .image.hidden img { opacity: 0.3; }
+      .image.flagged img { filter: blur(24px); }
+      .image.flagged img:hover { filter: none; }
+      .flagged-note { background: #ffe0e0; border-radius: 4px; padding: 6px 8px; margin: 6px 0; font-size: 14px; }
+      .focus { position: relative; cursor: crosshair; }
+      .focus .marker { position: absolute; width: 14px; height: 14px; margin: -9px 0 0 -9px; border: 2px solid #fff; border-radius: 50%; box-shadow: 0 0 0 2px #000; pointer-events: none; display: none; }
+      .image input[type=text], .image input[type=url] { width: 100%; box-sizing: border-box; margin: 4px 0; padding: 6px; }
+      .path { font-size: 12px; color: #666; word-break: break-all; }
+      .stats { font-size: 12px; color: #666; }
+      .conflict { background: #ffe0e0; border-radius: 4px; padding: 6px 8px; margin: 6px 0; font-size: 14px; }
+      .conflict ul { margin: 4px 0; padding-left: 18px; }
+      .changed { background: #e3f2fd; border-radius: 4px; padding: 6px 8px; margin: 6px 0; font-size: 14px; display: none; }
+      button { padding: 6px 12px; }
+    </style>
+  </head>
+  <body>
+    <h1>Photo Slider</h1>
+    {{with .Message}}<div class="box message">{{.}}</div>{{end}}
+    <div class="box">
+      <form method="post" action="/admin/upload" enctype="multipart/form-data">
+        <p><input type="file" name="images" accept="image/*" multiple required></p>
+        <p><input type="text" name="author" placeholder="{{msg "admin.author_optional"}}"></p>
+        <button>{{msg "admin.upload"}}</button>
+      </form>
+    </div>
+    <div class="box">
+      <form method="post" action="/admin/regenerate"><button>{{msg "admin.regenerate"}}</button></form>
+    </div>
+    {{with .Queue}}
+    <h2>{{msg "admin.queue"}}</h2>
+    <div class="images">
+      {{range .}}
+      <div class="box image{{if .Flagged}} flagged{{end}}">
+        <img src="{{.URL}}" loading="lazy" alt="">
+        <div class="path">{{.Path}}</div>
+        {{if .Flagged}}<div class="flagged-note">{{msg "admin.flagged" .FlagScore}}</div>{{end}}
+        <form method="post" action="/admin/queue">
+          <input type="hidden" name="path" value="{{.Path}}">
+          <input type="text" name="author" value="{{.Author}}" placeholder="{{msg "admin.author"}}">
+          <input type="text" name="title" value="{{.Title}}" placeholder="{{msg "admin.title_field"}}">
+          <input type="url" name="link" value="{{.Link}}" placeholder="{{msg "admin.link_optional"}}">
+          <button name="action" value="approve">{{msg "admin.approve"}}</button>
+        </form>
+        <form method="post" action="/admin/queue">
+          <input type="hidden" name="path" value="{{.Path}}">
+          <input type="text" name="reason" placeholder="{{msg "admin.reject_reason"}}">
+          <button name="action" value="reject">{{msg "admin.reject"}}</button>
+        </form>
+        <form method="post" action="/admin/queue">
+          <input type="hidden" name="path" value="{{.Path}}">
+          <button name="action" value="preview">{{if .Preview}}{{msg "admin.preview_leave"}}{{else}}{{msg "admin.preview_show"}}{{end}}</button>
+        </form>
+      </div>
+      {{end}}
+    </div>
+    <h2>{{msg "admin.in_slider"}}</h2>
+    {{end}}
+    <div class="images">
+      {{range .Images}}
+      <div class="box image{{if .Hidden}} hidden{{end}}" data-path="{{.Path}}">
+        <div class="focus" title="{{msg "admin.focus_hint"}}">
+          <img src="{{.URL}}" loading="lazy" alt="">
+          <span class="marker"></span>
+        </div>
+        <div class="path">{{.Path}}{{if .Hidden}} {{msg "admin.hidden"}}{{end}}</div>
+        <div class="stats">{{msg "admin.stats" .Stats.Opens .Stats.LinkClicks}}</div>
+        {{with .Conflicts}}
+        <div class="conflict">
+          {{msg "admin.conflict_intro"}}
+          <ul>{{range .}}<li>{{msg "admin.conflict_field" .Field .Saved .Yours}}</li>{{end}}</ul>
+          {{msg "admin.conflict_save"}} <a href="/admin">{{msg "admin.conflict_reload"}}</a>
+        </div>
+        {{end}}
+        <div class="changed"></div>
+        <form method="post" action="/admin/image">
+          <input type="hidden" name="path" value="{{.Path}}">
+          <input type="hidden" name="version" value="{{.Saved.Version}}">
+          <input type="hidden" name="base_author" value="{{.Saved.Author}}">
+          <input type="hidden" name="base_title" value="{{.Saved.Title}}">
+          <input type="hidden" name="base_link" value="{{.Saved.Link}}">
+          <input type="hidden" name="base_focus_x" value="{{with .Saved.Focus}}{{.X}}{{end}}">
+          <input type="hidden" name="base_focus_y" value="{{with .Saved.Focus}}{{.Y}}{{end}}">
+          <input type="hidden" name="focus_x" value="{{with .Focus}}{{.X}}{{end}}">
+          <input type="hidden" name="focus_y" value="{{with .Focus}}{{.Y}}{{end}}">
+          <input type="text" name="author" value="{{.Author}}" placeholder="{{msg "admin.author"}}">
+          <input type="text" name="title" value="{{.Title}}" placeholder="{{msg "admin.title_field"}}">
+          <input type="url" name="link" value="{{.Link}}" placeholder="{{msg "admin.link_optional"}}">
+          <button name="action" value="save">{{msg "admin.save"}}</button>
+          <button type="button" class="clear-focus">{{msg "admin.clear_focus"}}</button>
+          {{if .Hidden}}<button name="action" value="show">{{msg "admin.show"}}</button>{{else}}<button name="action" value="hide">{{msg "admin.hide"}}</button>{{end}}
+        </form>
+      </div>
+      {{else}}
+      <p>{{msg "admin.empty"}}</p>
+      {{end}}
+    </div>
+    <script>
+      // The focal point is stored as fractions of the image size, so it has
+      // to be mapped to where object-fit: contain draws the image
+      document.querySelectorAll(".focus").forEach(function (frame) {
+        var img = frame.querySelector("img");
+        var marker = frame.querySelector(".marker");
+        var form = frame.parentNode.querySelector("form");
+        function drawn() {
+          var scale = Math.min(img.clientWidth / img.naturalWidth, img.clientHeight / img.naturalHeight);
+          var w = img.naturalWidth * scale, h = img.naturalHeight * scale;
+          return { x: (img.clientWidth - w) / 2, y: (img.clientHeight - h) / 2, w: w, h: h };
+        }
+        function show() {
+          var x = form.focus_x.value, y = form.focus_y.value;
+          if (x === "" || !img.naturalWidth) {
+            marker.style.display = "none";
+            return;
+          }
+          var d = drawn();
+          marker.style.left = d.x + x * d.w + "px";
+          marker.style.top = d.y + y * d.h + "px";
+          marker.style.display = "block";
+        }
+        img.addEventListener("click", function (e) {
+          var d = drawn();
+          var clamp = function (v) { return Math.min(1, Math.max(0, v)).toFixed(3); };
+          form.focus_x.value = clamp((e.offsetX - d.x) / d.w);
+          form.focus_y.value = clamp((e.offsetY - d.y) / d.h);
+          show();
+        });
+        form.querySelector(".clear-focus").addEventListener("click", function () {
+          form.focus_x.value = form.focus_y.value = "";
+          show();
+        });
+        img.addEventListener("load", show);
+        form.addEventListener("focuschange", show);
+        if (img.complete) {
+          show();
+        }
+      });
+
+      // Captions saved by other moderators show up live. Forms nobody has
+      // touched take the new values; in a form being edited they are only
+      // pointed out, and saving merges them with the edit.
+      var edited = {};
+      document.querySelectorAll("form[action='/admin/image']").forEach(function (form) {
+        form.addEventListener("input", function () { edited[form.path.value] = true; });
+        form.querySelector(".clear-focus").addEventListener("click", function () { edited[form.path.value] = true; });
+        form.parentNode.querySelector(".focus img").addEventListener("click", function () { edited[form.path.value] = true; });
+      });
+      document.querySelectorAll(".conflict").forEach(function (c) {
+        edited[c.parentNode.dataset.path] = true;
+      });
+      var events = new EventSource("/admin/events");
+      events.onmessage = function (e) {
+        var image = JSON.parse(e.data);
+        var box = Array.prototype.find.call(document.querySelectorAll(".image[data-path]"), function (b) {
+          return b.dataset.path === image.path;
+        });
+        if (!box) return;
+        var form = box.querySelector("form[action='/admin/image']");
+        if (Number(form.version.value) >= image.version) return;
+        var x = image.focus ? String(image.focus.x) : "", y = image.focus ? String(image.focus.y) : "";
+        var changes = [];
+        [["author", image.author, {{msg "admin.author"}}], ["title", image.title, {{msg "admin.title_field"}}], ["link", image.link, {{msg "admin.link"}}]].forEach(function (f) {
+          if (form["base_" + f[0]].value !== f[1]) changes.push(f[2] + " \u201c" + f[1] + "\u201d");
+        });
+        if (form.base_focus_x.value !== x || form.base_focus_y.value !== y) changes.push({{msg "admin.focus"}});
+        form.version.value = image.version;
+        box.classList.toggle("hidden", image.hidden);
+        if (!edited[image.path]) {
+          form.author.value = form.base_author.value = image.author;
+          form.title.value = form.base_title.value = image.title;
+          form.link.value = form.base_link.value = image.link;
+          form.focus_x.value = form.base_focus_x.value = x;
+          form.focus_y.value = form.base_focus_y.value = y;
+          form.dispatchEvent(new Event("focuschange"));
+          return;
+        }
+        if (changes.length) {
+          var note = box.querySelector(".changed");
+          note.textContent = {{msg "admin.changed"}}.replace("%s", changes.join(", "));
+          note.style.display = "block";
+        }
+      };
+    </script>
+  </body>
+</html>
+`))
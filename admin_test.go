@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testPNG is a small PNG image to upload.
+func testPNG(t *testing.T) []byte {
+	return grayPNG(t, 0)
+}
+
+// grayPNG is a small PNG image of the given gray level. Images of different
+// levels have different content hashes, so they don't share metadata.
+func grayPNG(t *testing.T, level uint8) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 4, 4))
+	for i := range img.Pix {
+		img.Pix[i] = level
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestParseAuthorTitleEscapesMarkup(t *testing.T) {
+	author, title := parseAuthorTitle(`<b>bob</b> - <img src=x onerror=alert(1)>%Tom & "Jerry"`)
+	if want := "&lt;b&gt;bob&lt;/b&gt;"; author != want {
+		t.Errorf("author = %q, want %q", author, want)
+	}
+	if want := "&lt;img src=x onerror=alert(1)&gt;<br>Tom &amp; &#34;Jerry&#34;"; title != want {
+		t.Errorf("title = %q, want %q", title, want)
+	}
+	if _, title := parseAuthorTitle("<script>"); title != "&lt;script&gt;" {
+		t.Errorf("title without author = %q, want it escaped", title)
+	}
+}
+
+func TestCaptionFromNameIsPlainText(t *testing.T) {
+	author, title := captionFromName("images/Tom & Jerry - it's <fine>.png")
+	if author != "Tom & Jerry" || title != "it's <fine>" {
+		t.Errorf("captionFromName = %q, %q", author, title)
+	}
+}
+
+func TestSaveUploadStripsMarkup(t *testing.T) {
+	dir := t.TempDir()
+	limits := imageLimits{maxSide: 16384, maxPixels: 100_000_000}
+	path, err := saveUpload(bytes.NewReader(testPNG(t)), dir, `bob - <img src=x onerror="alert(1)">.png`, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Base(path)
+	if strings.ContainsAny(name, `<>"`) {
+		t.Errorf("saved as %q, which still has markup in it", name)
+	}
+	if want := "bob - img src=x onerror=alert(1).png"; name != want {
+		t.Errorf("saved as %q, want %q", name, want)
+	}
+}
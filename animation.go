@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// animationFolder holds the poster frames and videos made of animated
+// images, see convertAnimations.
+func animationFolder() string {
+	return filepath.Join(cacheFolder, "animations")
+}
+
+// animation is what readAnimation finds out about an animated GIF or WebP
+// without decoding it.
+type animation struct {
+	frames   int
+	duration time.Duration // of one loop, with delays as browsers play them
+}
+
+func (a animation) fps() float64 {
+	if a.duration <= 0 {
+		return 0
+	}
+	return float64(a.frames) / a.duration.Seconds()
+}
+
+// frameDelay is how long a browser shows a frame that asks for delay:
+// delays of 10 ms or less are played as 100 ms, like every browser does, as
+// old GIFs relied on it.
+func frameDelay(delay time.Duration) time.Duration {
+	if delay <= 10*time.Millisecond {
+		return 100 * time.Millisecond
+	}
+	return delay
+}
+
+// readAnimation counts the frames of the GIF or WebP at path and adds up
+// their delays. Still images have one frame.
+func readAnimation(path string) (animation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return animation{}, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	if strings.EqualFold(filepath.Ext(path), ".webp") {
+		return readWebPAnimation(r)
+	}
+	return readGIFAnimation(r)
+}
+
+// readGIFAnimation walks the blocks of a GIF, skipping the image data.
+func readGIFAnimation(r *bufio.Reader) (animation, error) {
+	var header [13]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return animation{}, fmt.Errorf("gif: %w", err)
+	}
+	if !bytes.HasPrefix(header[:], []byte("GIF8")) {
+		return animation{}, errors.New(msg("animation.not_gif"))
+	}
+	if flags := header[10]; flags&0x80 != 0 {
+		if _, err := r.Discard(3 << (flags&7 + 1)); err != nil {
+			return animation{}, fmt.Errorf("gif: %w", err)
+		}
+	}
+	var a animation
+	var delay time.Duration // of the next frame, from its graphic control extension
+	for {
+		block, err := r.ReadByte()
+		if err != nil {
+			return animation{}, fmt.Errorf("gif: %w", err)
+		}
+		switch block {
+		case 0x21: // extension
+			label, err := r.ReadByte()
+			if err != nil {
+				return animation{}, fmt.Errorf("gif: %w", err)
+			}
+			data, err := readGIFSubBlocks(r, label == 0xf9)
+			if err != nil {
+				return animation{}, err
+			}
+			if label == 0xf9 && len(data) >= 3 {
+				delay = time.Duration(binary.LittleEndian.Uint16(data[1:3])) * 10 * time.Millisecond
+			}
+		case 0x2c: // image descriptor
+			var desc [9]byte
+			if _, err := io.ReadFull(r, desc[:]); err != nil {
+				return animation{}, fmt.Errorf("gif: %w", err)
+			}
+			if flags := desc[8]; flags&0x80 != 0 {
+				if _, err := r.Discard(3 << (flags&7 + 1)); err != nil {
+					return animation{}, fmt.Errorf("gif: %w", err)
+				}
+			}
+			if _, err := r.ReadByte(); err != nil { // LZW code size
+				return animation{}, fmt.Errorf("gif: %w", err)
+			}
+			if _, err := readGIFSubBlocks(r, false); err != nil {
+				return animation{}, err
+			}
+			a.frames++
+			a.duration += frameDelay(delay)
+			delay = 0
+		case 0x3b: // trailer
+			return a, nil
+		default:
+			return animation{}, errorf("animation.gif_block", block)
+		}
+	}
+}
+
+// readGIFSubBlocks skips the data sub-blocks up to the next empty one, or
+// with keep returns their content.
+func readGIFSubBlocks(r *bufio.Reader, keep bool) ([]byte, error) {
+	var data []byte
+	for {
+		n, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("gif: %w", err)
+		}
+		if n == 0 {
+			return data, nil
+		}
+		if keep {
+			block := make([]byte, n)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return nil, fmt.Errorf("gif: %w", err)
+			}
+			data = append(data, block...)
+		} else if _, err := r.Discard(int(n)); err != nil {
+			return nil, fmt.Errorf("gif: %w", err)
+		}
+	}
+}
+
+// readWebPAnimation walks the chunks of a WebP file: an animated one has an
+// ANMF chunk per frame, starting with its position, size and duration.
+func readWebPAnimation(r *bufio.Reader) (animation, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return animation{}, fmt.Errorf("webp: %w", err)
+	}
+	if string(header[:4]) != "RIFF" || string(header[8:]) != "WEBP" {
+		return animation{}, errors.New(msg("animation.not_webp"))
+	}
+	var a animation
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err == io.EOF {
+			break
+		} else if err != nil {
+			return animation{}, fmt.Errorf("webp: %w", err)
+		}
+		size := int(binary.LittleEndian.Uint32(chunk[4:]))
+		size += size & 1 // chunks are padded to an even size
+		skip := size
+		if string(chunk[:4]) == "ANMF" && size >= 16 {
+			var frame [16]byte
+			if _, err := io.ReadFull(r, frame[:]); err != nil {
+				return animation{}, fmt.Errorf("webp: %w", err)
+			}
+			ms := int(frame[12]) | int(frame[13])<<8 | int(frame[14])<<16
+			a.frames++
+			a.duration += frameDelay(time.Duration(ms) * time.Millisecond)
+			skip -= len(frame)
+		}
+		if _, err := r.Discard(skip); err != nil {
+			return animation{}, fmt.Errorf("webp: %w", err)
+		}
+	}
+	if a.frames == 0 {
+		a.frames = 1 // a still image
+	}
+	return a, nil
+}
+
+// heavyAnimation is an animated image that is larger or faster than
+// animated_max_megabytes and animated_max_fps allow.
+type heavyAnimation struct {
+	index int // in metas
+	size  int64
+	animation
+}
+
+func (h heavyAnimation) String() string {
+	return fmt.Sprintf("%s, %d frames, %.1fs (%.0f fps)", megabytes(h.size), h.frames, h.duration.Seconds(), h.fps())
+}
+
+// findHeavyAnimations returns the animated GIFs and WebPs of metas that are
+// larger than animated_max_megabytes or play faster than animated_max_fps.
+// A browser source decodes every frame of them at full size, which can
+// stutter the whole scene.
+func findHeavyAnimations(metas []imageMeta, cfg config) []heavyAnimation {
+	var heavy []heavyAnimation
+	for i, m := range metas {
+		ext := strings.ToLower(filepath.Ext(m.relPath))
+		if m.frames > 0 || (ext != ".gif" && ext != ".webp") {
+			continue
+		}
+		info, err := os.Stat(m.relPath)
+		if err != nil {
+			continue
+		}
+		a, err := readAnimation(m.relPath)
+		if err != nil {
+			// validate_images decides about broken files
+			slog.Debug(msg("animation.unreadable", m.relPath, err))
+			continue
+		}
+		tooLarge := cfg.animatedMaxMegabytes == 0 || float64(info.Size()) > cfg.animatedMaxMegabytes*(1<<20)
+		tooFast := cfg.animatedMaxFPS > 0 && a.fps() > float64(cfg.animatedMaxFPS)
+		if a.frames > 1 && (tooLarge || tooFast) {
+			heavy = append(heavy, heavyAnimation{index: i, size: info.Size(), animation: a})
+		}
+	}
+	return heavy
+}
+
+// convertAnimations deals with heavy animations (see findHeavyAnimations)
+// as animated_images says: keep shows them as they are and lists them,
+// poster shows their first frame instead, and video a looping WebM made
+// with ffmpeg, which browsers play far more cheaply. Exports and the
+// gallery keep the original. An animation that can't be converted is shown
+// as it is.
+func convertAnimations(metas []imageMeta, cfg config, failed *imageFailures) error {
+	heavy := findHeavyAnimations(metas, cfg)
+	if len(heavy) == 0 {
+		return nil
+	}
+	if cfg.animatedImages == "keep" {
+		slog.Warn(msg("animation.heavy", countNoun(len(heavy), "count.image")))
+		for _, h := range heavy {
+			slog.Warn(fmt.Sprintf("  %s: %s", metas[h.index].relPath, h))
+		}
+		return nil
+	}
+
+	height := optimizeHeight(cfg)
+	id := fmt.Sprintf("%s|%d|%d", cfg.animatedImages, height, cfg.animatedMaxFPS)
+	errs := make([]error, len(heavy))
+	parallel(msg("progress.animations"), len(heavy), cfg.workers, func(worker, i int) {
+		m := &metas[heavy[i].index]
+		sum := sha256.Sum256([]byte(m.hash + "|" + id))
+		base := filepath.Join(animationFolder(), hex.EncodeToString(sum[:8]))
+		path := base + ".png"
+		if cfg.animatedImages == "video" {
+			path = base + ".webm"
+		}
+		if _, err := os.Stat(path); err != nil {
+			defer traceSpanOn(worker, traceProcessing, "convert animation", "path", m.relPath)()
+			if err := os.MkdirAll(animationFolder(), 0o755); err != nil {
+				errs[i] = errorf("file.create_folder", animationFolder(), err)
+				return
+			}
+			if cfg.animatedImages == "video" {
+				errs[i] = transcodeAnimation(path, *m, heavy[i].animation, height, cfg)
+			} else {
+				errs[i] = writePoster(path, *m, height, cfg)
+			}
+			if errs[i] != nil {
+				return
+			}
+		}
+		if cfg.animatedImages == "video" {
+			m.video = filepath.ToSlash(path)
+		} else {
+			// The poster takes the place of an optimized copy, so it is
+			// watermarked like one
+			m.optimized = filepath.ToSlash(path)
+		}
+	})
+
+	converted := 0
+	for i, h := range heavy {
+		if errs[i] != nil {
+			if err := failed.add(metas[h.index].relPath, "failure.animation", errs[i]); err != nil {
+				return err
+			}
+			continue
+		}
+		converted++
+	}
+	if converted > 0 {
+		slog.Info(msg("animation.converted."+cfg.animatedImages, countNoun(converted, "count.image")))
+	}
+	return nil
+}
+
+// writePoster writes the first frame of m to path as a PNG, scaled down to
+// height. Go reads the first frame of a GIF itself; WebP needs ffmpeg.
+func writePoster(path string, m imageMeta, height int, cfg config) error {
+	if strings.EqualFold(filepath.Ext(m.relPath), ".webp") {
+		return runFFmpeg(path, "-i", m.relPath, "-frames:v", "1", "-vf", scaleFilter(m, height))
+	}
+	img, err := decodeImage(m.relPath, cfg.limits)
+	if err != nil {
+		return err
+	}
+	if b := img.Bounds(); b.Dy() > height {
+		img = scaleImage(img, max(1, b.Dx()*height/b.Dy()), height)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return errorf("file.encode", path, err)
+	}
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+// transcodeAnimation writes m to path as a VP9 WebM without sound, scaled
+// down to height and slowed down to animated_max_fps. Transparency is kept.
+func transcodeAnimation(path string, m imageMeta, a animation, height int, cfg config) error {
+	filter := scaleFilter(m, height)
+	if cfg.animatedMaxFPS > 0 && a.fps() > float64(cfg.animatedMaxFPS) {
+		filter += fmt.Sprintf(",fps=%d", cfg.animatedMaxFPS)
+	}
+	return runFFmpeg(path, "-i", m.relPath, "-an", "-vf", filter, "-c:v", "libvpx-vp9", "-pix_fmt", "yuva420p", "-b:v", "0", "-crf", "36", "-row-mt", "1")
+}
+
+// scaleFilter is the ffmpeg filter that scales m down to height, or keeps
+// its size, at the even width and height the video codec needs.
+func scaleFilter(m imageMeta, height int) string {
+	if m.height > height {
+		return fmt.Sprintf("scale=-2:%d", height&^1)
+	}
+	return "scale=trunc(iw/2)*2:trunc(ih/2)*2"
+}
+
+// runFFmpeg runs ffmpeg with args and path as the output, which only
+// appears once ffmpeg has written all of it.
+func runFFmpeg(path string, args ...string) error {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return errors.New(msg("animation.no_ffmpeg"))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	tmp := strings.TrimSuffix(path, filepath.Ext(path)) + ".tmp" + filepath.Ext(path)
+	cmd := exec.CommandContext(ctx, ffmpeg, append(append([]string{"-v", "error", "-y"}, args...), tmp)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(tmp)
+		if detail := strings.TrimSpace(stderr.String()); detail != "" {
+			err = fmt.Errorf("%w: %s", err, detail)
+		}
+		return errorf("animation.run_ffmpeg", err)
+	}
+	return os.Rename(tmp, path)
+}
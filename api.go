@@ -0,0 +1,407 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// registerAPI adds the REST API for tools such as a Discord bot. Images are
+// identified by their path in their folder, see imageID. Changes only show
+// up in the slider after POST /api/regenerate, so a batch of them causes a
+// single reload.
+func (s *server) registerAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/images", s.apiList)
+	mux.HandleFunc("POST /api/images", s.apiUpload)
+	mux.HandleFunc("PATCH /api/images/{id}", s.apiEdit)
+	mux.HandleFunc("DELETE /api/images/{id}", s.apiDelete)
+	mux.HandleFunc("POST /api/images/{id}/clicks", s.apiClick)
+	mux.HandleFunc("GET /api/stats", s.apiStats)
+	mux.HandleFunc("GET /api/queue", func(w http.ResponseWriter, r *http.Request) {
+		if !requireScope(w, r, scopeModerate) {
+			return
+		}
+		entries, err := listQueue()
+		if err != nil {
+			httpError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, entries)
+	})
+	mux.HandleFunc("POST /api/queue/{id}/approve", s.apiApprove)
+	mux.HandleFunc("POST /api/queue/{id}/reject", s.apiReject)
+	mux.HandleFunc("POST /api/regenerate", func(w http.ResponseWriter, r *http.Request) {
+		if !requireScope(w, r, scopeUpload, scopeModerate, scopeControl) {
+			return
+		}
+		if err := s.regenerate(); err != nil {
+			httpError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// apiList lists the images, all of them or the page and kind the query asks
+// for, see imageQuery. The number of matching images is in X-Total-Count.
+func (s *server) apiList(w http.ResponseWriter, r *http.Request) {
+	if !requireScope(w, r, scopeRead) {
+		return
+	}
+	q, err := parseImageQuery(r.URL.Query())
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var entries []imageEntry
+	if q.status == "pending" {
+		// The queue is for moderators, as in GET /api/queue
+		if !requireScope(w, r, scopeModerate) {
+			return
+		}
+		entries, err = listQueue()
+	} else {
+		entries, err = listImages(s.config().filter)
+	}
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	page, total := q.apply(entries)
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	writeJSON(w, http.StatusOK, page)
+}
+
+// Page sizes of GET /api/images.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// imageQuery is what GET /api/images lists: the images by author (any case)
+// with status "shown", "hidden" or "pending" (waiting for review), or all,
+// sorted by "name" (path), "mtime" (newest first) or "author", one page of
+// limit at a time. Without page and limit, all of them are listed.
+type imageQuery struct {
+	author string
+	status string
+	sort   string
+	page   int // from 1
+	limit  int // 0 for all
+}
+
+func parseImageQuery(values url.Values) (imageQuery, error) {
+	q := imageQuery{author: values.Get("author"), status: values.Get("status"), sort: values.Get("sort"), page: 1}
+	if q.status != "" && q.status != "shown" && q.status != "hidden" && q.status != "pending" {
+		return q, errorf("value.expected", "status", q.status, oneOf("shown", "hidden", "pending"))
+	}
+	if q.sort == "" {
+		q.sort = "name"
+	}
+	if q.sort != "name" && q.sort != "mtime" && q.sort != "author" {
+		return q, errorf("value.expected", "sort", q.sort, oneOf("name", "mtime", "author"))
+	}
+	number := func(key string, most int) (int, error) {
+		v := values.Get(key)
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > most {
+			return 0, errorf("api.invalid_number", key, v, most)
+		}
+		return n, nil
+	}
+	if values.Has("page") || values.Has("limit") {
+		q.limit = defaultPageSize
+	}
+	var err error
+	if values.Has("page") {
+		if q.page, err = number("page", math.MaxInt32); err != nil {
+			return q, err
+		}
+	}
+	if values.Has("limit") {
+		if q.limit, err = number("limit", maxPageSize); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// apply returns the page of entries q asks for, and how many entries match
+// it on all pages.
+func (q imageQuery) apply(entries []imageEntry) ([]imageEntry, int) {
+	out := make([]imageEntry, 0, len(entries))
+	for _, e := range entries {
+		if q.author != "" && !strings.EqualFold(e.Author, q.author) {
+			continue
+		}
+		if q.status == "shown" && e.Hidden || q.status == "hidden" && !e.Hidden {
+			continue
+		}
+		out = append(out, e)
+	}
+	switch q.sort {
+	case "name":
+		slices.SortStableFunc(out, func(a, b imageEntry) int { return strings.Compare(a.Path, b.Path) })
+	case "mtime":
+		modified := make(map[string]time.Time, len(out))
+		for _, e := range out {
+			if info, err := os.Stat(e.Path); err == nil {
+				modified[e.Path] = info.ModTime()
+			}
+		}
+		slices.SortStableFunc(out, func(a, b imageEntry) int {
+			return cmp.Or(modified[b.Path].Compare(modified[a.Path]), strings.Compare(a.Path, b.Path))
+		})
+	case "author":
+		slices.SortStableFunc(out, func(a, b imageEntry) int {
+			return cmp.Or(cmp.Compare(strings.ToLower(a.Author), strings.ToLower(b.Author)), strings.Compare(a.Path, b.Path))
+		})
+	}
+	total := len(out)
+	if q.limit > 0 {
+		start := min((q.page-1)*q.limit, total)
+		out = out[start:min(start+q.limit, total)]
+	}
+	return out, total
+}
+
+// apiUpload adds the image in the "image" field of a multipart form, with
+// optional "author", "title" and "link" fields. With moderation on, the image waits
+// in the queue and the answer is 202 Accepted.
+func (s *server) apiUpload(w http.ResponseWriter, r *http.Request) {
+	if !requireScope(w, r, scopeUpload) {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	f, fh, err := r.FormFile("image")
+	if err != nil {
+		httpError(w, http.StatusBadRequest, msg("api.expected_form", err))
+		return
+	}
+	defer f.Close()
+	cfg := s.config()
+	dir, status := imageFolder, http.StatusCreated
+	if cfg.moderation {
+		dir, status = incomingFolder, http.StatusAccepted
+	}
+	path, err := saveUpload(f, dir, fh.Filename, cfg.limits)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	author, title := captionFromName(path)
+	if v := r.FormValue("author"); v != "" {
+		author = strings.TrimSpace(v)
+	}
+	if v := r.FormValue("title"); v != "" {
+		title = strings.TrimSpace(v)
+	}
+	err = s.updateMetadata(func(md metadata) error {
+		info := md.info(path)
+		info.setCaption(path, author, title)
+		info.Link = strings.TrimSpace(r.FormValue("link"))
+		md.set(path, info)
+		return nil
+	})
+	s.apiImage(w, status, path, err)
+}
+
+// imagePatch is the body of PATCH /api/images/{id}. Fields left out are
+// not changed.
+type imagePatch struct {
+	Author *string     `json:"author"`
+	Title  *string     `json:"title"`
+	Hidden *bool       `json:"hidden"`
+	Link   *string     `json:"link"`
+	Focus  *focusPoint `json:"focus"` // the center clears it
+	Dwell  *float64    `json:"dwell"` // a negative value clears it
+	Alt    *string     `json:"alt"`   // an empty one goes back to the caption
+
+	Version *int `json:"version"` // if set, the change fails unless the image is still at this version
+}
+
+func (s *server) apiEdit(w http.ResponseWriter, r *http.Request) {
+	if !requireScope(w, r, scopeModerate) {
+		return
+	}
+	e, ok := s.apiFind(w, r)
+	if !ok {
+		return
+	}
+	var patch imagePatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		httpError(w, http.StatusBadRequest, msg("api.invalid_json", err))
+		return
+	}
+	focus, err := checkFocus(patch.Focus)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	err = s.updateMetadata(func(md metadata) error {
+		info := md.info(e.Path)
+		if patch.Version != nil && *patch.Version != info.Version {
+			return errStaleVersion
+		}
+		author, title := info.caption(e.Path)
+		if patch.Author != nil {
+			author = strings.TrimSpace(*patch.Author)
+		}
+		if patch.Title != nil {
+			title = strings.TrimSpace(*patch.Title)
+		}
+		info.setCaption(e.Path, author, title)
+		if patch.Hidden != nil {
+			info.Hidden = *patch.Hidden
+		}
+		if patch.Link != nil {
+			info.Link = strings.TrimSpace(*patch.Link)
+		}
+		if patch.Focus != nil {
+			info.Focus = focus
+		}
+		if patch.Dwell != nil {
+			info.Dwell = patch.Dwell
+			if *patch.Dwell < 0 {
+				info.Dwell = nil
+			}
+		}
+		if patch.Alt != nil {
+			info.Alt = strings.TrimSpace(*patch.Alt)
+		}
+		md.set(e.Path, info)
+		return nil
+	})
+	if errors.Is(err, errStaleVersion) {
+		// The image as it is now, to merge the change into
+		s.apiImage(w, http.StatusConflict, e.Path, nil)
+		return
+	}
+	if err == nil {
+		s.imageChanged(e.ID)
+	}
+	s.apiImage(w, http.StatusOK, e.Path, err)
+}
+
+func (s *server) apiDelete(w http.ResponseWriter, r *http.Request) {
+	if !requireScope(w, r, scopeModerate) {
+		return
+	}
+	e, ok := s.apiFind(w, r)
+	if !ok {
+		return
+	}
+	if err := os.Remove(e.Path); err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	err := s.updateMetadata(func(md metadata) error {
+		md.set(e.Path, imageInfo{})
+		return nil
+	})
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) apiApprove(w http.ResponseWriter, r *http.Request) {
+	if !requireScope(w, r, scopeModerate) {
+		return
+	}
+	e, ok := s.apiFindQueued(w, r)
+	if !ok {
+		return
+	}
+	var dest string
+	err := s.updateMetadata(func(md metadata) error {
+		var err error
+		dest, err = approve(s.config(), md, e.Path)
+		return err
+	})
+	s.apiImage(w, http.StatusOK, dest, err)
+}
+
+// apiReject rejects a queued image, with an optional JSON body giving the
+// reason.
+func (s *server) apiReject(w http.ResponseWriter, r *http.Request) {
+	if !requireScope(w, r, scopeModerate) {
+		return
+	}
+	e, ok := s.apiFindQueued(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		httpError(w, http.StatusBadRequest, msg("api.invalid_json", err))
+		return
+	}
+	err := s.updateMetadata(func(md metadata) error {
+		return reject(s.config(), md, e.Path, body.Reason)
+	})
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiFind looks up the image named in the URL, answering 404 if there is
+// none.
+func (s *server) apiFind(w http.ResponseWriter, r *http.Request) (imageEntry, bool) {
+	e, err := findImage(s.config().filter, r.PathValue("id"))
+	return e, lookupOK(w, err)
+}
+
+// apiFindQueued is apiFind for images waiting for review.
+func (s *server) apiFindQueued(w http.ResponseWriter, r *http.Request) (imageEntry, bool) {
+	e, err := findQueued(r.PathValue("id"))
+	return e, lookupOK(w, err)
+}
+
+func lookupOK(w http.ResponseWriter, err error) bool {
+	if errors.Is(err, errNoImage) {
+		httpError(w, http.StatusNotFound, err.Error())
+		return false
+	}
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	return true
+}
+
+// apiImage answers with the image at path as it is now, or with err.
+func (s *server) apiImage(w http.ResponseWriter, status int, path string, err error) {
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var e imageEntry
+	if filepath.Dir(path) == incomingFolder {
+		e, err = findQueued(imageID(incomingFolder, path))
+	} else {
+		// Not filtered: an upload may be excluded from the slider by a pattern
+		e, err = findImage(pathFilter{folders: s.config().filter.folders}, imageID(imageFolder, path))
+	}
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, status, e)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testAPIServer is a server in an empty folder, with an API key of scopes
+// that is returned.
+func testAPIServer(t *testing.T, scopes ...string) (*server, *http.ServeMux, string) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	token := "test.secret"
+	if err := saveKeys([]apiKey{{ID: "test", Name: "test", Hash: hashToken(token), Scopes: scopes}}); err != nil {
+		t.Fatal(err)
+	}
+	s := &server{hub: newEventHub[controlCommand](), adminHub: newEventHub[imageEntry]()}
+	s.cfg = config{includeAuthor: true, linkCaption: "off", limits: imageLimits{maxSide: 16384, maxPixels: 100_000_000}}
+	mux := http.NewServeMux()
+	s.registerAPI(mux)
+	return s, mux, token
+}
+
+// uploadImage posts a PNG named name to /api/images, with the form fields
+// in fields.
+func uploadImage(t *testing.T, mux *http.ServeMux, token, name string, fields map[string]string) imageEntry {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	fw, err := mw.CreateFormFile("image", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(testPNG(t))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/images", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("upload answered %d: %s", rec.Code, rec.Body)
+	}
+	var e imageEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// renderedCaption is the caption markup the page shows for the image at
+// path.
+func renderedCaption(t *testing.T, path string, cfg config) string {
+	t.Helper()
+	md, err := loadMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newImageMeta(path)
+	md.info(path).apply(&m)
+	var b bytes.Buffer
+	w := bufio.NewWriter(&b)
+	writeCaption(w, m, cfg)
+	w.Flush()
+	return b.String()
+}
+
+func TestAPIUploadKeepsMarkupOutOfCaptions(t *testing.T) {
+	s, mux, token := testAPIServer(t, scopeUpload)
+
+	e := uploadImage(t, mux, token, "bob - <img src=x onerror=alert(1)>.png", nil)
+	if caption := renderedCaption(t, e.Path, s.cfg); strings.Contains(caption, "<img") {
+		t.Errorf("caption from the file name has markup in it:\n%s", caption)
+	}
+
+	e = uploadImage(t, mux, token, "plain.png", map[string]string{
+		"author": "<script>alert(1)</script>",
+		"title":  `<img src=x onerror="alert(1)">`,
+	})
+	caption := renderedCaption(t, e.Path, s.cfg)
+	if strings.Contains(caption, "<script") || strings.Contains(caption, "<img") {
+		t.Errorf("caption from the form has markup in it:\n%s", caption)
+	}
+	if !strings.Contains(caption, "&lt;script&gt;alert(1)&lt;/script&gt;") {
+		t.Errorf("caption from the form doesn't show the author as text:\n%s", caption)
+	}
+}
+
+func TestAPIUploadNeedsUploadScope(t *testing.T) {
+	_, mux, token := testAPIServer(t, scopeRead)
+	req := httptest.NewRequest(http.MethodPost, "/api/images", strings.NewReader(""))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("upload with a read key answered %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAPIErrorsAreTranslated(t *testing.T) {
+	_, mux, _ := testAPIServer(t, scopeRead)
+	useLanguage("de")
+	t.Cleanup(func() { useLanguage(defaultLanguage) })
+	req := httptest.NewRequest(http.MethodPost, "/api/regenerate", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if want := "ein API-Schlüssel mit dem Bereich upload, moderate oder control ist nötig"; body["error"] != want {
+		t.Errorf("error = %q, want %q", body["error"], want)
+	}
+}
+
+func TestAPIKnowsImagesApartAcrossFolders(t *testing.T) {
+	s, mux, token := testAPIServer(t, scopeModerate)
+	s.cfg.mixRatio = map[string]int{"fanart": 1}
+	s.cfg.filter.folders = []string{"fanart"}
+	for i, path := range []string{"images/a.png", "images/fanart/a.png"} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, grayPNG(t, uint8(i)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/images/fanart%2Fa.png", strings.NewReader(`{"title": "fan art"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PATCH answered %d: %s", rec.Code, rec.Body)
+	}
+	var e imageEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.ID != "fanart/a.png" || e.Path != "images/fanart/a.png" || e.Title != "fan art" {
+		t.Errorf("PATCH answered %+v", e)
+	}
+	entries, err := listImages(s.cfg.filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if want := map[string]string{"a.png": "a", "fanart/a.png": "fan art"}[e.ID]; e.Title != want {
+			t.Errorf("%s has title %q, want %q", e.ID, e.Title, want)
+		}
+	}
+}
+
+func TestAPIListPagesAndFilters(t *testing.T) {
+	_, mux, token := testAPIServer(t, scopeRead)
+	if err := os.MkdirAll(imageFolder, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"jane - a.png", "bob - b.png", "Jane - c.png", "jane - d.png", "ann - e.png"}
+	for i, name := range names {
+		path := filepath.Join(imageFolder, name)
+		if err := os.WriteFile(path, grayPNG(t, uint8(i)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		// Modified in the order of names, a day apart
+		day := time.Date(2026, 1, 1+i, 0, 0, 0, 0, time.UTC)
+		if err := os.Chtimes(path, day, day); err != nil {
+			t.Fatal(err)
+		}
+	}
+	md, err := loadMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hidden := filepath.Join(imageFolder, "jane - d.png")
+	md.set(hidden, imageInfo{Hidden: true})
+	if err := saveMetadata(md); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(query string) ([]string, string, int) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/images?"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		var entries []imageEntry
+		json.Unmarshal(rec.Body.Bytes(), &entries)
+		var ids []string
+		for _, e := range entries {
+			ids = append(ids, e.ID)
+		}
+		return ids, rec.Header().Get("X-Total-Count"), rec.Code
+	}
+	for _, tt := range []struct {
+		query string
+		want  string // IDs without " - " and ".png"
+		total string
+	}{
+		{"", "Jane-c ann-e bob-b jane-a jane-d", "5"},
+		{"sort=mtime", "ann-e jane-d Jane-c bob-b jane-a", "5"},
+		{"sort=author", "ann-e bob-b Jane-c jane-a jane-d", "5"},
+		{"author=JANE", "Jane-c jane-a jane-d", "3"},
+		{"status=hidden", "jane-d", "1"},
+		{"status=shown&author=jane", "Jane-c jane-a", "2"},
+		{"limit=2", "Jane-c ann-e", "5"},
+		{"limit=2&page=2", "bob-b jane-a", "5"},
+		{"limit=2&page=3", "jane-d", "5"},
+		{"limit=2&page=4", "", "5"},
+		{"page=1&sort=mtime&status=shown", "ann-e Jane-c bob-b jane-a", "4"},
+	} {
+		ids, total, code := list(tt.query)
+		got := strings.NewReplacer(" - ", "-", ".png", "").Replace(strings.Join(ids, " "))
+		if code != http.StatusOK || got != tt.want || total != tt.total {
+			t.Errorf("?%s: %d %q (of %s), want %q (of %s)", tt.query, code, got, total, tt.want, tt.total)
+		}
+	}
+	for _, query := range []string{"page=0", "limit=x", "limit=501", "sort=size", "status=gone"} {
+		if _, _, code := list(query); code != http.StatusBadRequest {
+			t.Errorf("?%s answered %d, want %d", query, code, http.StatusBadRequest)
+		}
+	}
+	// The queue is for moderators only
+	if _, _, code := list("status=pending"); code != http.StatusUnauthorized {
+		t.Errorf("?status=pending with a read key answered %d, want %d", code, http.StatusUnauthorized)
+	}
+}
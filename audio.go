@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func audioFolder() string {
+	return filepath.Join(cacheFolder, "audio")
+}
+
+// prepareAudio returns the URL the page plays audio_file from. Local files
+// are copied to the cache folder (when changed), which the serve command
+// serves along with the images; web addresses are used as they are.
+func prepareAudio(cfg config) (string, error) {
+	if cfg.audioFile == "" {
+		return "", nil
+	}
+	if strings.HasPrefix(cfg.audioFile, "http://") || strings.HasPrefix(cfg.audioFile, "https://") {
+		return cfg.audioFile, nil
+	}
+
+	url, err := cacheCopy(cfg.audioFile, audioFolder())
+	if err != nil {
+		return "", errorf("audio.failed", err)
+	}
+	return url, nil
+}
+
+// cacheCopy copies the file at src into dir, unless an identical copy is
+// already there, and returns the page URL of the copy. Earlier copies are
+// left to sweepAssets.
+func cacheCopy(src, dir string) (string, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return "", err
+	}
+	dest := filepath.Join(dir, filepath.Base(src))
+	if have, err := os.Stat(dest); err != nil || have.Size() != info.Size() || !have.ModTime().Equal(info.ModTime()) {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", err
+		}
+		if err := copyFile(src, dest); err != nil {
+			return "", err
+		}
+		if err := os.Chtimes(dest, info.ModTime(), info.ModTime()); err != nil {
+			return "", err
+		}
+	}
+	return filepath.ToSlash(dest), nil
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// writeAudio adds the looping music track. OBS browser sources play audio
+// without a click, so autoplay is enough there; browsers that block it
+// start the track on the first click or key press instead.
+func writeAudio(w *bufio.Writer, cfg config) {
+	mustWrite(w, fmt.Sprintf("    <audio id=\"music\" src=\"%s\" loop autoplay></audio>\n", html.EscapeString(cfg.audioURL)))
+	mustWrite(w, "    <script>\n")
+	mustWrite(w, "      (function () {\n")
+	mustWrite(w, "        var music = document.getElementById(\"music\");\n")
+	mustWrite(w, fmt.Sprintf("        music.volume = %g;\n", cfg.audioVolume))
+	mustWrite(w, "        function start() {\n")
+	mustWrite(w, "          music.play().then(function () {\n")
+	mustWrite(w, "            document.removeEventListener(\"pointerdown\", start);\n")
+	mustWrite(w, "            document.removeEventListener(\"keydown\", start);\n")
+	mustWrite(w, "          }, function () {});\n")
+	mustWrite(w, "        }\n")
+	mustWrite(w, "        document.addEventListener(\"pointerdown\", start);\n")
+	mustWrite(w, "        document.addEventListener(\"keydown\", start);\n")
+	mustWrite(w, "        start();\n")
+	mustWrite(w, "      })();\n")
+	mustWrite(w, "    </script>\n")
+}
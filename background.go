@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+var backgroundImageExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".avif": true, ".svg": true}
+
+// cssURLEscaper makes a URL safe inside a quoted url() in a style element.
+var cssURLEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "<", `\3c `)
+
+func backgroundFolder() string {
+	return filepath.Join(cacheFolder, "background")
+}
+
+// isBackgroundImage reports whether a background value names an image
+// rather than a color or gradient.
+func isBackgroundImage(value string) bool {
+	if strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://") {
+		return true
+	}
+	return !strings.Contains(value, "(") && backgroundImageExts[strings.ToLower(filepath.Ext(value))]
+}
+
+// prepareBackground returns the URL of the theme's background image, copying
+// local files to the cache folder like prepareAudio. It is empty when the
+// background isn't an image.
+func prepareBackground(cfg config) (string, error) {
+	if !isBackgroundImage(cfg.theme.background) {
+		return "", nil
+	}
+	if strings.Contains(cfg.theme.background, "://") {
+		return cfg.theme.background, nil
+	}
+	url, err := cacheCopy(cfg.theme.background, backgroundFolder())
+	if err != nil {
+		return "", errorf("background.failed", err)
+	}
+	return url, nil
+}
+
+// writeBackgroundStyle paints the page background, for showing the slider
+// on its own display rather than over other OBS sources.
+// gradient(...) is short for linear-gradient(...).
+func writeBackgroundStyle(w *bufio.Writer, cfg config) {
+	mustWrite(w, "      body {\n")
+	value := cfg.theme.background
+	switch {
+	case cfg.backgroundURL != "":
+		mustWrite(w, fmt.Sprintf("        background-image: url(\"%s\");\n", cssURLEscaper.Replace(cfg.backgroundURL)))
+		mustWrite(w, "        background-position: center;\n")
+		if cfg.theme.backgroundFit == "tile" {
+			mustWrite(w, "        background-repeat: repeat;\n")
+		} else {
+			mustWrite(w, "        background-repeat: no-repeat;\n")
+			mustWrite(w, fmt.Sprintf("        background-size: %s;\n", cfg.theme.backgroundFit))
+		}
+	case strings.HasPrefix(value, "gradient("):
+		mustWrite(w, fmt.Sprintf("        background: linear-%s;\n", value))
+	default:
+		mustWrite(w, fmt.Sprintf("        background: %s;\n", value))
+	}
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// buildFile keeps what earlier runs learned about the images, so a run only
+// reads, hashes and renders what changed since.
+func buildFile() string {
+	return filepath.Join(cacheFolder, "build.json")
+}
+
+// buildCache is the content of buildFile.
+type buildCache struct {
+	Images    map[string]buildImage    `json:"images"`              // by path
+	Sequences map[string]buildSequence `json:"sequences,omitempty"` // by folder
+	Hero      string                   `json:"hero,omitempty"`      // see heroKey
+}
+
+// buildImage is what was read from an image file. It holds as long as the
+// file keeps its size and modification time.
+type buildImage struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Width   int       `json:"width"`
+	Height  int       `json:"height"`
+	Decoded bool      `json:"decoded,omitempty"` // fully decoded, as validate_images=full does
+	Date    time.Time `json:"date,omitzero"`     // see imageDate
+	Hash    string    `json:"hash,omitempty"`
+	DHash   *uint64   `json:"dhash,omitempty"`  // see findDuplicates
+	Colors  []string  `json:"colors,omitempty"` // dominant colors, see pickAccents
+}
+
+// buildSequence is a sprite sheet rendered by renderSequence.
+type buildSequence struct {
+	Frames     string `json:"frames"` // see framesStamp
+	Count      int    `json:"count"`
+	FrameWidth int    `json:"frame_width"`
+	Height     int    `json:"height"` // of the sheet, see renderSequence
+}
+
+// loadBuildCache reads buildFile. Without it, or with rebuild set, every
+// image is processed from scratch; so is a cache that can't be parsed, as
+// it only ever saves work.
+func loadBuildCache(rebuild bool) (*buildCache, error) {
+	bc := &buildCache{}
+	content, err := os.ReadFile(buildFile())
+	switch {
+	case rebuild || errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, errorf("file.read", buildFile(), err)
+	default:
+		if err := json.Unmarshal(content, bc); err != nil {
+			bc = &buildCache{}
+		}
+	}
+	if bc.Images == nil {
+		bc.Images = map[string]buildImage{}
+	}
+	if bc.Sequences == nil {
+		bc.Sequences = map[string]buildSequence{}
+	}
+	return bc, nil
+}
+
+func saveBuildCache(bc *buildCache) error {
+	content, err := json.Marshal(bc)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cacheFolder, 0o755); err != nil {
+		return errorf("file.create_folder", cacheFolder, err)
+	}
+	if err := os.WriteFile(buildFile(), content, 0o644); err != nil {
+		return errorf("file.write", buildFile(), err)
+	}
+	return nil
+}
+
+// image returns what is known about the file at path, if it hasn't changed
+// since.
+func (bc *buildCache) image(path string, info fs.FileInfo) (buildImage, bool) {
+	e, ok := bc.Images[filepath.ToSlash(path)]
+	if !ok || info == nil || e.Size != info.Size() || !e.ModTime.Equal(info.ModTime()) {
+		return buildImage{}, false
+	}
+	return e, true
+}
+
+// addHashes records the content and perceptual hashes of metas, for the
+// images already in the cache.
+func (bc *buildCache) addHashes(metas []imageMeta) {
+	for _, m := range metas {
+		e, ok := bc.Images[m.relPath]
+		if !ok {
+			continue
+		}
+		if m.hash != "" {
+			e.Hash = m.hash
+		}
+		if m.dhash != nil {
+			e.DHash = m.dhash
+		}
+		bc.Images[m.relPath] = e
+	}
+}
+
+// addColors records the dominant colors of metas, for the images already in
+// the cache.
+func (bc *buildCache) addColors(metas []imageMeta) {
+	for _, m := range metas {
+		if e, ok := bc.Images[m.relPath]; ok && m.colors != nil {
+			e.Colors = m.colors
+			bc.Images[m.relPath] = e
+		}
+	}
+}
+
+// framesStamp identifies the frame files of a sequence as they are now.
+// It changes when a frame is added, removed or edited.
+func framesStamp(frames []string) string {
+	var b strings.Builder
+	for _, f := range frames {
+		b.WriteString(filepath.ToSlash(f))
+		if info, err := os.Stat(f); err == nil {
+			fmt.Fprintf(&b, "|%d|%d", info.Size(), info.ModTime().UnixNano())
+		}
+		b.WriteString("\n")
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// heroKey identifies the hero mosaic of metas rendered to path: the same
+// images in the same order with the same focal points make the same picture.
+func heroKey(path string, metas []imageMeta, cfg config) string {
+	ensureHashes(metas, cfg.workers)
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s|%d|%d\n", filepath.ToSlash(path), cfg.limits.maxSide, cfg.limits.maxPixels)
+	for _, m := range metas {
+		b.WriteString(m.hash)
+		if m.focus != nil {
+			fmt.Fprintf(&b, "|%g|%g", m.focus.X, m.focus.Y)
+		}
+		b.WriteString("\n")
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
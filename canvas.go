@@ -0,0 +1,41 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The page is laid out for a 1080p canvas. Other canvases scale every
+// length in it, so the strip takes up the same part of the screen.
+const baseCanvasHeight = 1080
+
+// stripHeight is the height of the strip in the 1080p layout.
+const stripHeight = 750
+
+// canvasPresets are the canvas sizes canvas accepts by name.
+var canvasPresets = map[string][2]int{
+	"720p":  {1280, 720},
+	"1080p": {1920, 1080},
+	"1440p": {2560, 1440},
+	"4k":    {3840, 2160},
+}
+
+// parseCanvas reads a canvas preset or a size like 2560x1080.
+func parseCanvas(value string) (int, int, error) {
+	if size, ok := canvasPresets[strings.ToLower(value)]; ok {
+		return size[0], size[1], nil
+	}
+	w, h, ok := strings.Cut(strings.ToLower(value), "x")
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	if !ok || errW != nil || errH != nil || width <= 0 || height <= 0 {
+		return 0, 0, errorf("canvas.invalid")
+	}
+	return width, height, nil
+}
+
+// px is a length in pixels of the 1080p layout, scaled to the canvas.
+func (cfg config) px(n int) int {
+	return int(math.Round(float64(n) * cfg.scale))
+}
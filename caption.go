@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var placeholder = regexp.MustCompile(`\{(\w+)\}`)
+
+// imageDate returns the date the image was taken, falling back to its
+// modification time.
+func imageDate(path string) time.Time {
+	if t, ok := exifDate(path); ok {
+		return t
+	}
+	if info, err := os.Stat(path); err == nil {
+		return info.ModTime()
+	}
+	return time.Time{}
+}
+
+// formatCaption expands the {placeholders} in format for m. A literal \n in
+// the format starts a new line. Unknown placeholders are left untouched.
+func formatCaption(format string, m imageMeta, cfg config) string {
+	base := filepath.Base(m.relPath)
+	values := map[string]string{
+		"title":       m.title,
+		"translation": m.translation,
+		"qr":          "",
+		"link":        linkLabel(m, true),
+		"author":      m.author,
+		"filename":    html.EscapeString(strings.TrimSuffix(base, filepath.Ext(base))),
+		"folder":      html.EscapeString(filepath.Base(filepath.Dir(m.relPath))),
+		"date":        "",
+		"width":       "",
+		"height":      "",
+	}
+	if m.qr != "" {
+		values["qr"] = `<span class="qr">` + m.qr + `</span>`
+	}
+	if !cfg.includeAuthor {
+		values["author"] = ""
+	}
+	if !m.date.IsZero() {
+		values["date"] = m.date.Format("2006-01-02")
+	}
+	if m.width > 0 && m.height > 0 {
+		values["width"] = strconv.Itoa(m.width)
+		values["height"] = strconv.Itoa(m.height)
+	}
+
+	out := placeholder.ReplaceAllStringFunc(format, func(p string) string {
+		if v, ok := values[p[1:len(p)-1]]; ok {
+			return v
+		}
+		return p
+	})
+	return strings.ReplaceAll(out, `\n`, "<br>")
+}
+
+// captionRenderer writes the captions of the tiles. New renderers are added
+// with registerCaptionRenderer and picked with the caption_renderer config
+// option.
+type captionRenderer interface {
+	writeStyle(w *bufio.Writer, cfg config)
+	writeCaption(w *bufio.Writer, m imageMeta, cfg config)
+}
+
+var captionRenderers = map[string]captionRenderer{}
+
+func registerCaptionRenderer(name string, r captionRenderer) {
+	if _, ok := captionRenderers[name]; ok {
+		panic("caption renderer " + name + " registered twice")
+	}
+	captionRenderers[name] = r
+}
+
+func captionRendererNames() string {
+	names := make([]string, 0, len(captionRenderers))
+	for name := range captionRenderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return oneOf(names...)
+}
+
+func init() {
+	registerCaptionRenderer("css", cssCaptions{})
+}
+
+// cssCaptions are captions as HTML text, outlined with -webkit-text-stroke.
+type cssCaptions struct{}
+
+func (cssCaptions) writeStyle(w *bufio.Writer, cfg config) {
+	mustWrite(w, "      #permas .caption {\n")
+	mustWrite(w, fmt.Sprintf("        font-family: %s;\n", fontStack(cfg)))
+	mustWrite(w, "        white-space: normal;\n")
+	mustWrite(w, "        overflow: hidden;\n")
+	mustWrite(w, "        text-overflow: ellipsis;\n")
+	mustWrite(w, "        max-width: 100%;\n")
+	mustWrite(w, "        text-align: center;\n")
+	mustWrite(w, "        margin: 0 auto;\n")
+	mustWrite(w, fmt.Sprintf("        margin-top: %dpx;\n", cfg.px(32)))
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #permas .author {\n")
+	mustWrite(w, fmt.Sprintf("        font-size: %dpx;\n", cfg.px(48)))
+	mustWrite(w, fmt.Sprintf("        color: %s;\n", accentVar("author-color", cfg.theme.authorTextColor, cfg)))
+	mustWrite(w, fmt.Sprintf("        -webkit-text-stroke: %dpx %s;\n", cfg.px(10), accentVar("author-stroke", cfg.theme.authorStrokeColor, cfg)))
+	mustWrite(w, "        paint-order: stroke fill;\n")
+	mustWrite(w, "        font-weight: bold;\n")
+	mustWrite(w, "        display: block;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #permas .title {\n")
+	mustWrite(w, fmt.Sprintf("        font-size: %dpx;\n", cfg.px(40)))
+	mustWrite(w, "        display: block;\n")
+	mustWrite(w, fmt.Sprintf("        color: %s;\n", accentVar("title-color", cfg.theme.titleTextColor, cfg)))
+	mustWrite(w, fmt.Sprintf("        -webkit-text-stroke: %dpx %s;\n", cfg.px(10), accentVar("title-stroke", cfg.theme.titleStrokeColor, cfg)))
+	mustWrite(w, "        paint-order: stroke fill;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	if cfg.translateTo != "" {
+		mustWrite(w, "      #permas .translation {\n")
+		mustWrite(w, fmt.Sprintf("        font-size: %dpx;\n", cfg.px(32)))
+		mustWrite(w, "        display: block;\n")
+		mustWrite(w, fmt.Sprintf("        color: %s;\n", accentVar("title-color", cfg.theme.titleTextColor, cfg)))
+		mustWrite(w, fmt.Sprintf("        -webkit-text-stroke: %dpx %s;\n", cfg.px(8), accentVar("title-stroke", cfg.theme.titleStrokeColor, cfg)))
+		mustWrite(w, "        paint-order: stroke fill;\n")
+		mustWrite(w, "        font-style: italic;\n")
+		mustWrite(w, "      }\n")
+		mustWrite(w, "\n")
+	}
+	if cfg.linkCaption != "off" {
+		mustWrite(w, "      #permas .handle {\n")
+		mustWrite(w, fmt.Sprintf("        font-size: %dpx;\n", cfg.px(32)))
+		mustWrite(w, "        display: block;\n")
+		mustWrite(w, fmt.Sprintf("        color: %s;\n", accentVar("title-color", cfg.theme.titleTextColor, cfg)))
+		mustWrite(w, fmt.Sprintf("        -webkit-text-stroke: %dpx %s;\n", cfg.px(8), accentVar("title-stroke", cfg.theme.titleStrokeColor, cfg)))
+		mustWrite(w, "        paint-order: stroke fill;\n")
+		mustWrite(w, "      }\n")
+		mustWrite(w, "\n")
+	}
+}
+
+func (cssCaptions) writeCaption(w *bufio.Writer, m imageMeta, cfg config) {
+	writeCaption(w, m, cfg)
+}
+
+func writeCaption(w *bufio.Writer, m imageMeta, cfg config) {
+	mustWrite(w, "          <div class=\"caption\">\n")
+	if cfg.captionFormat != "" {
+		mustWrite(w, fmt.Sprintf("            <div class=\"title\">%s</div>\n", formatCaption(cfg.captionFormat, m, cfg)))
+		if captionQR(m, cfg) {
+			mustWrite(w, fmt.Sprintf("            <div class=\"qr\">%s</div>\n", m.qr))
+		}
+		mustWrite(w, "          </div>\n")
+		return
+	}
+	if cfg.includeAuthor {
+		mustWrite(w, fmt.Sprintf("            <div class=\"author\">%s</div>\n", m.author))
+	}
+	mustWrite(w, fmt.Sprintf("            <div class=\"title\">%s</div>\n", m.title))
+	if m.translation != "" && m.translation != html.EscapeString(captionText(m.title)) {
+		mustWrite(w, fmt.Sprintf("            <div class=\"translation\">%s</div>\n", m.translation))
+	}
+	if handle := captionLink(m, cfg); handle != "" {
+		mustWrite(w, fmt.Sprintf("            <div class=\"handle\">%s</div>\n", handle))
+	}
+	if captionQR(m, cfg) {
+		mustWrite(w, fmt.Sprintf("            <div class=\"qr\">%s</div>\n", m.qr))
+	}
+	mustWrite(w, "          </div>\n")
+}
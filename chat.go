@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const twitchChatAddr = "irc.chat.twitch.tv:6697"
+
+// twitchAnonymous is the login Twitch accepts without a token, which can
+// read chat but not post in it.
+const twitchAnonymous = "justinfan31415"
+
+// ircMessage is a line of Twitch chat, e.g.
+// "@mod=1;badges=moderator/1 :jane!jane@jane.tmi.twitch.tv PRIVMSG #chan :!showart 12".
+type ircMessage struct {
+	tags    map[string]string
+	nick    string
+	command string
+	params  []string // the last is the text after " :", if any
+}
+
+func parseIRC(line string) ircMessage {
+	var m ircMessage
+	line = strings.TrimRight(line, "\r\n")
+	if rest, ok := strings.CutPrefix(line, "@"); ok {
+		var tags string
+		tags, line, _ = strings.Cut(rest, " ")
+		m.tags = map[string]string{}
+		for _, tag := range strings.Split(tags, ";") {
+			key, value, _ := strings.Cut(tag, "=")
+			m.tags[key] = value
+		}
+	}
+	if rest, ok := strings.CutPrefix(line, ":"); ok {
+		var prefix string
+		prefix, line, _ = strings.Cut(rest, " ")
+		m.nick, _, _ = strings.Cut(prefix, "!")
+	}
+	line, trailing, hasTrailing := strings.Cut(line, " :")
+	fields := strings.Fields(line)
+	if len(fields) > 0 {
+		m.command, m.params = fields[0], fields[1:]
+	}
+	if hasTrailing {
+		m.params = append(m.params, trailing)
+	}
+	return m
+}
+
+// text is the message of a PRIVMSG or NOTICE.
+func (m ircMessage) text() string {
+	if len(m.params) == 0 {
+		return ""
+	}
+	return m.params[len(m.params)-1]
+}
+
+// fromModerator reports whether a chat message was sent by a moderator or
+// the broadcaster.
+func (m ircMessage) fromModerator() bool {
+	return m.tags["mod"] == "1" || strings.Contains(","+m.tags["badges"], ",broadcaster/")
+}
+
+// chatBot is a connection to the chat of twitch_channel.
+type chatBot struct {
+	conn    net.Conn
+	channel string
+	canPost bool // logged in with twitch_token rather than anonymously
+}
+
+func (b *chatBot) send(line string) error {
+	b.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := fmt.Fprintf(b.conn, "%s\r\n", line)
+	return err
+}
+
+// say posts text in the channel, if the bot may.
+func (b *chatBot) say(text string) {
+	if !b.canPost {
+		return
+	}
+	if err := b.send("PRIVMSG #" + b.channel + " :" + text); err != nil {
+		slog.Warn(msg("chat.post_failed", err))
+	}
+}
+
+// watchChat keeps serve mode connected to the Twitch chat of
+// twitch_channel, so moderators can pin images with chat commands. A lost
+// connection is opened again, waiting longer after every failure.
+func (s *server) watchChat() {
+	wait := 5 * time.Second
+	for {
+		start := time.Now()
+		err := s.runChat()
+		if time.Since(start) > time.Minute {
+			wait = 5 * time.Second
+		}
+		slog.Warn(msg("chat.disconnected", err, wait))
+		time.Sleep(wait)
+		wait = min(wait*2, 5*time.Minute)
+	}
+}
+
+// runChat connects to chat and handles its messages until the connection
+// ends.
+func (s *server) runChat() error {
+	cfg := s.config()
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 15 * time.Second}, "tcp", twitchChatAddr, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	b := &chatBot{conn: conn, channel: strings.ToLower(strings.TrimPrefix(cfg.twitchChannel, "#")), canPost: cfg.twitchToken != ""}
+
+	nick, pass := twitchAnonymous, ""
+	if b.canPost {
+		nick, pass = strings.ToLower(cfg.twitchUser), "oauth:"+strings.TrimPrefix(cfg.twitchToken, "oauth:")
+	}
+	login := []string{"CAP REQ :twitch.tv/tags", "NICK " + nick, "JOIN #" + b.channel}
+	if pass != "" {
+		login = append([]string{"PASS " + pass}, login...)
+	}
+	for _, line := range login {
+		if err := b.send(line); err != nil {
+			return err
+		}
+	}
+
+	r := bufio.NewReader(conn)
+	for {
+		// Twitch pings every five minutes or so
+		conn.SetReadDeadline(time.Now().Add(10 * time.Minute))
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		m := parseIRC(line)
+		switch m.command {
+		case "PING":
+			if err := b.send("PONG :" + m.text()); err != nil {
+				return err
+			}
+		case "JOIN":
+			if m.nick == nick {
+				slog.Info(msg("chat.joined", b.channel))
+			}
+		case "NOTICE":
+			// Such as a failed login, after which Twitch hangs up
+			slog.Warn(msg("chat.notice", m.text()))
+		case "PRIVMSG":
+			if m.fromModerator() {
+				s.chatCommand(b, m.nick, m.text())
+			}
+		}
+	}
+}
+
+// chatCommand handles "!showart <number or title>" and "!artist <name>",
+// pinning the image in the slider for chat_pin_seconds and, with
+// chat_post_links, posting the artist's link.
+func (s *server) chatCommand(b *chatBot, nick, text string) {
+	command, arg, _ := strings.Cut(strings.TrimSpace(text), " ")
+	arg = strings.TrimSpace(arg)
+	if (command != "!showart" && command != "!artist") || arg == "" {
+		return
+	}
+	cfg := s.config()
+	e, err := s.chatImage(command, arg)
+	if err != nil {
+		slog.Warn(msg("chat.command_failed", nick, text, err))
+		b.say(msg("chat.not_found", arg))
+		return
+	}
+	pages := s.hub.broadcast(controlCommand{Action: actionPin, Image: e.Path, Seconds: cfg.chatPinSeconds})
+	slog.Info(msg("chat.pinned", nick, e.Path, pages))
+	if cfg.chatPostLinks && e.Link != "" {
+		b.say(msg("chat.link", chatCredit(e, cfg), e.Link))
+	}
+}
+
+// chatImage finds the image a chat command asks for among the ones the
+// slider shows: by its place in the current rotation (1 is the first to
+// scroll by, as in the gallery) or a part of its title for !showart, and
+// one of the artist's images, picked at random, for !artist.
+func (s *server) chatImage(command, arg string) (imageEntry, error) {
+	st, _, err := loadState()
+	if err != nil {
+		return imageEntry{}, err
+	}
+	entries, err := listImages(s.config().filter)
+	if err != nil {
+		return imageEntry{}, err
+	}
+	byPath := make(map[string]imageEntry, len(entries))
+	for _, e := range entries {
+		byPath[e.Path] = e
+	}
+	var shown []imageEntry
+	for _, path := range st.Current {
+		if e, ok := byPath[path]; ok && !e.Hidden {
+			shown = append(shown, e)
+		}
+	}
+
+	if command == "!showart" {
+		if n, err := strconv.Atoi(arg); err == nil {
+			if n < 1 || n > len(shown) {
+				return imageEntry{}, errorf("chat.out_of_range", len(shown))
+			}
+			return shown[n-1], nil
+		}
+	}
+	var matches []imageEntry
+	for _, e := range shown {
+		if command == "!artist" && strings.EqualFold(e.Author, strings.TrimPrefix(arg, "@")) ||
+			command == "!showart" && strings.Contains(strings.ToLower(e.Title), strings.ToLower(arg)) {
+			matches = append(matches, e)
+		}
+	}
+	if len(matches) == 0 {
+		return imageEntry{}, errNoImage
+	}
+	return matches[rand.IntN(len(matches))], nil
+}
+
+// chatCredit names an image in chat: its title and artist, unless
+// include_author=false.
+func chatCredit(e imageEntry, cfg config) string {
+	if e.Author == "" || !cfg.includeAuthor {
+		return e.Title
+	}
+	return msg("export.by", e.Title, e.Author)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+)
+
+// compactTile is a tile in the manifest written by output_mode=compact.
+// Names are short because there is one per image.
+type compactTile struct {
+	Src         string  `json:"s"`
+	Width       int     `json:"w,omitempty"`
+	Height      int     `json:"h,omitempty"`
+	Author      string  `json:"a,omitempty"`
+	Title       string  `json:"t,omitempty"`
+	Translation string  `json:"tr,omitempty"`
+	Caption     *string `json:"c,omitempty"` // expanded caption_format
+	Frames      int     `json:"f,omitempty"` // flipbook tiles only
+	FrameWidth  int     `json:"fw,omitempty"`
+	Image       string  `json:"i,omitempty"`  // relPath, if not Src
+	Video       string  `json:"v,omitempty"`  // see convertAnimations
+	Accent      string  `json:"ac,omitempty"` // style setting the colors of border_mode=auto
+	Alt         string  `json:"al,omitempty"` // see altText
+	QR          string  `json:"q,omitempty"`  // SVG, where qr_codes places one
+	KenBurns    string  `json:"k,omitempty"`  // class of the motion, see planKenBurns
+	Position    string  `json:"p,omitempty"`  // object-position, see objectPosition
+	Row         int     `json:"r,omitempty"`  // see tileRows
+	Source      string  `json:"o,omitempty"`  // class of the source, see sourceClass
+	Badge       string  `json:"b,omitempty"`  // see sourceBadge
+	Handle      string  `json:"hd,omitempty"` // see captionLink
+	Link        string  `json:"l,omitempty"`  // see tileLink
+}
+
+func newCompactTile(m imageMeta, cfg config) compactTile {
+	t := compactTile{Src: m.src(), Video: m.video, Accent: m.accent.style(), Alt: altText(m, cfg), Width: m.width, Height: m.height, Frames: m.frames, FrameWidth: m.frameWidth, Position: objectPosition(m, cfg), Source: sourceClass(m.origin), Badge: sourceBadge(m, cfg), Link: tileLink(m, cfg)}
+	if m.stamped != "" || m.optimized != "" {
+		t.Image = m.relPath
+	}
+	if m.kenBurns != nil {
+		t.KenBurns = m.kenBurns.name
+	}
+	if cfg.qrCodes == "corner" || captionQR(m, cfg) {
+		t.QR = m.qr
+	}
+	switch {
+	case cfg.captionFormat != "":
+		c := formatCaption(cfg.captionFormat, m, cfg)
+		t.Caption = &c
+	default:
+		t.Author, t.Title = m.author, m.title
+		if m.translation != html.EscapeString(captionText(m.title)) {
+			t.Translation = m.translation
+		}
+		t.Handle = captionLink(m, cfg)
+	}
+	return t
+}
+
+// writeCompactTiles writes the tiles as a JSON manifest and a script that
+// builds the same markup writeImageContainer would, in the first half of
+// each row; duplicateClient copies it into the second. For large galleries
+// this makes the page a fraction of the size.
+func writeCompactTiles(w *bufio.Writer, metas []imageMeta, cfg config) {
+	tiles := make([]compactTile, 0, len(metas))
+	for r, row := range tileRows(metas, cfg) {
+		for _, m := range row {
+			t := newCompactTile(m, cfg)
+			t.Row = r
+			tiles = append(tiles, t)
+		}
+	}
+	manifest, err := json.Marshal(tiles)
+	if err != nil {
+		panic(err) // only strings and numbers
+	}
+	options, err := json.Marshal(map[string]any{
+		"author":       cfg.includeAuthor,
+		"placement":    cfg.theme.captionPlacement,
+		"frameSeconds": cfg.sequenceFrameSeconds,
+		"qr":           cfg.qrCodes,
+		"lazy":         cfg.lazyLoading,
+		"placeholder":  lazyPlaceholder,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	mustWrite(w, "    <script>\n")
+	mustWrite(w, fmt.Sprintf("      var tiles = %s;\n", manifest))
+	mustWrite(w, fmt.Sprintf("      var options = %s;\n", options))
+	mustWrite(w, compactRenderer)
+	mustWrite(w, "    </script>\n")
+}
+
+const compactRenderer = `      (function () {
+        function attr(s) {
+          return String(s).replace(/&/g, "&amp;").replace(/"/g, "&quot;").replace(/</g, "&lt;");
+        }
+        function caption(t) {
+          var qr = options.qr === "caption" && t.q ? '<div class="qr">' + t.q + "</div>" : "";
+          if (t.c !== undefined) {
+            return '<div class="caption"><div class="title">' + t.c + "</div>" + qr + "</div>";
+          }
+          var h = '<div class="caption">';
+          if (options.author) h += '<div class="author">' + (t.a || "") + "</div>";
+          h += '<div class="title">' + (t.t || "") + "</div>";
+          if (t.tr) h += '<div class="translation">' + t.tr + "</div>";
+          if (t.hd) h += '<div class="handle">' + t.hd + "</div>";
+          return h + qr + "</div>";
+        }
+        function tile(t) {
+          var h = '<div class="image-container' + (t.o ? " " + t.o : "") + '" data-image="' + attr(t.i || t.s) + '"' + (t.ac ? ' style="' + attr(t.ac) + '"' : "") + ">";
+          if (t.b) h += '<div class="badge">' + attr(t.b) + "</div>";
+          var corner = options.qr === "corner" && t.q;
+          if (options.placement === "above") h += caption(t);
+          if (corner) h += '<div class="qr-frame">';
+          if (t.l) h += '<a class="artist-link" href="' + attr(t.l) + '" target="_blank" rel="noopener">';
+          if (t.f) {
+            h += '<div class="scroller flipbook" style="' + attr("width: " + t.fw + "px; --sheet-width: " + t.fw * t.f +
+              'px; background-image: url("' + t.s + '"); animation-duration: ' + options.frameSeconds * t.f +
+              "s; animation-timing-function: steps(" + t.f + ');') + '" role="img" aria-label="' + attr(t.al || "") + '"></div>';
+          } else {
+            var size = (t.w ? ' width="' + t.w + '" height="' + t.h + '"' : "") + (t.p ? ' style="object-position: ' + t.p + '"' : "");
+            var src = ' src="' + attr(t.s) + '"';
+            if (t.w && options.lazy === "native") src += ' loading="lazy" decoding="async"';
+            if (t.w && options.lazy === "observer") src = ' src="' + options.placeholder + '" data-src="' + attr(t.s) + '"';
+            var img = t.v ? '<video class="scroller" src="' + attr(t.v) + '"' + size + ' autoplay muted loop playsinline aria-label="' + attr(t.al || "") + '"></video>' :
+              '<img class="scroller"' + src + size + ' alt="' + attr(t.al || "") + '">';
+            h += t.k ? '<div class="kenburns ' + t.k + '">' + img + "</div>" : img;
+          }
+          if (t.l) h += "</a>";
+          if (corner) h += '<div class="qr">' + t.q + "</div></div>";
+          if (options.placement === "below") h += caption(t);
+          return h + "</div>";
+        }
+        var firsts = document.querySelectorAll("#permas .scroll-content");
+        for (var r = 0; r < firsts.length; r++) {
+          var row = tiles.filter(function (t) { return (t.r || 0) === r; });
+          // Before the end credits, if any
+          var credits = firsts[r].querySelector(".credits");
+          if (credits) credits.insertAdjacentHTML("beforebegin", row.map(tile).join(""));
+          else firsts[r].insertAdjacentHTML("beforeend", row.map(tile).join(""));
+        }
+      })();
+`
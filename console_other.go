@@ -0,0 +1,19 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// ownConsole reports whether the program was started by double-clicking it.
+// Outside Windows that can't be told apart from a terminal, so interactive
+// mode has to be asked for with -interactive.
+func ownConsole() bool {
+	return false
+}
+
+// enableColors reports whether standard output is a terminal that shows
+// ANSI colors.
+func enableColors() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0 && os.Getenv("TERM") != "dumb"
+}
@@ -0,0 +1,39 @@
+//go:build windows
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32                  = syscall.NewLazyDLL("kernel32.dll")
+	procSetConsoleMode        = kernel32.NewProc("SetConsoleMode")
+	procGetConsoleProcessList = kernel32.NewProc("GetConsoleProcessList")
+)
+
+// ownConsole reports whether the console window was opened just for this
+// process, which is what happens when the exe is double-clicked. Run from
+// a command prompt, the prompt shares the console.
+func ownConsole() bool {
+	var pids [2]uint32
+	n, _, _ := procGetConsoleProcessList.Call(uintptr(unsafe.Pointer(&pids[0])), uintptr(len(pids)))
+	return n == 1
+}
+
+// enableColors turns on ANSI escape codes in the console, which Windows 10
+// and later support once asked to.
+func enableColors() bool {
+	h, err := syscall.GetStdHandle(syscall.STD_OUTPUT_HANDLE)
+	if err != nil {
+		return false
+	}
+	var mode uint32
+	if err := syscall.GetConsoleMode(h, &mode); err != nil {
+		return false
+	}
+	const enableVirtualTerminalProcessing = 0x0004
+	ok, _, _ := procSetConsoleMode.Call(uintptr(h), uintptr(mode|enableVirtualTerminalProcessing))
+	return ok != 0
+}
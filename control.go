@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Remote control actions understood by the generated page.
+const (
+	actionPause  = "pause"
+	actionResume = "resume"
+	actionSkip   = "skip"  // scroll Image to the middle of the screen
+	actionPin    = "pin"   // show Image full-screen for Seconds
+	actionUnpin  = "unpin" // end a pin early
+	actionReload = "reload"
+)
+
+const defaultPinSeconds = 30
+
+type controlCommand struct {
+	Action  string `json:"action"`
+	Image   string `json:"image,omitempty"` // path as in the page, e.g. "images/jane - dragon.png"
+	Seconds int    `json:"seconds,omitempty"`
+}
+
+func (c *controlCommand) validate() error {
+	switch c.Action {
+	case actionPause, actionResume, actionUnpin, actionReload:
+		return nil
+	case actionSkip, actionPin:
+		if c.Image == "" {
+			return errorf("control.needs_image", c.Action)
+		}
+		if c.Action == actionPin && c.Seconds <= 0 {
+			c.Seconds = defaultPinSeconds
+		}
+		return nil
+	}
+	return errorf("control.unknown_action", c.Action, oneOf("pause", "resume", "skip", "pin", "unpin", "reload"))
+}
+
+// eventHub passes events on to every connected page: control commands to
+// the slider, and changed images to admin pages.
+type eventHub[T any] struct {
+	mu      sync.Mutex
+	clients map[chan T]struct{}
+	done    chan struct{} // closed by shutdown
+}
+
+func newEventHub[T any]() *eventHub[T] {
+	return &eventHub[T]{clients: map[chan T]struct{}{}, done: make(chan struct{})}
+}
+
+// shutdown ends every event stream, which would otherwise keep the server
+// from stopping.
+func (h *eventHub[T]) shutdown() {
+	close(h.done)
+}
+
+// broadcast sends event to all connected pages and returns how many there
+// are. A page that isn't keeping up misses the event rather than holding
+// up the others.
+func (h *eventHub[T]) broadcast(event T) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.clients {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+	return len(h.clients)
+}
+
+// serveEvents streams events to a page as server-sent events.
+func (h *eventHub[T]) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httpError(w, http.StatusInternalServerError, msg("api.no_streaming"))
+		return
+	}
+	ch := make(chan T, 8)
+	h.mu.Lock()
+	h.clients[ch] = struct{}{}
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.clients, ch)
+		h.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Comments keep proxies from closing an idle connection
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.done:
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case event := <-ch:
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		flusher.Flush()
+	}
+}
+
+// writeOverlayStyle styles an overlay showing a tile full-screen: the
+// one used to pin an image, or the one of interactive=true.
+func writeOverlayStyle(w *bufio.Writer, id string, cfg config) {
+	mustWrite(w, "      #"+id+" {\n")
+	mustWrite(w, "        position: fixed;\n")
+	mustWrite(w, "        inset: 0;\n")
+	mustWrite(w, "        display: none;\n")
+	mustWrite(w, "        flex-direction: column;\n")
+	mustWrite(w, "        align-items: center;\n")
+	mustWrite(w, "        justify-content: center;\n")
+	mustWrite(w, "        background: rgba(0, 0, 0, 0.85);\n")
+	mustWrite(w, "        z-index: 10;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #"+id+".shown {\n")
+	mustWrite(w, "        display: flex;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #"+id+" .image-container {\n")
+	mustWrite(w, "        margin: 0;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #"+id+" .scroller {\n")
+	mustWrite(w, "        height: 75vh;\n")
+	mustWrite(w, "        width: auto;\n")
+	mustWrite(w, "        max-width: 90vw;\n")
+	mustWrite(w, "        object-fit: contain;\n")
+	mustWrite(w, fmt.Sprintf("        border-radius: %dpx;\n", cfg.px(12)))
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #"+id+" .caption {\n")
+	mustWrite(w, fmt.Sprintf("        font-family: %s;\n", fontStack(cfg)))
+	mustWrite(w, "        text-align: center;\n")
+	mustWrite(w, fmt.Sprintf("        margin-top: %dpx;\n", cfg.px(32)))
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #"+id+" .author {\n")
+	mustWrite(w, fmt.Sprintf("        font-size: %dpx;\n", cfg.px(56)))
+	mustWrite(w, "        font-weight: bold;\n")
+	mustWrite(w, fmt.Sprintf("        color: %s;\n", cfg.theme.authorTextColor))
+	mustWrite(w, fmt.Sprintf("        -webkit-text-stroke: %dpx %s;\n", cfg.px(10), cfg.theme.authorStrokeColor))
+	mustWrite(w, "        paint-order: stroke fill;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, fmt.Sprintf("      #%[1]s .title, #%[1]s .translation {\n", id))
+	mustWrite(w, fmt.Sprintf("        font-size: %dpx;\n", cfg.px(48)))
+	mustWrite(w, fmt.Sprintf("        color: %s;\n", cfg.theme.titleTextColor))
+	mustWrite(w, fmt.Sprintf("        -webkit-text-stroke: %dpx %s;\n", cfg.px(10), cfg.theme.titleStrokeColor))
+	mustWrite(w, "        paint-order: stroke fill;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+}
+
+// controlClient connects the page to the serve command's control channel.
+// Outside serve mode (e.g. opened as a local file) it does nothing.
+const controlClient = `    <div id="pin"></div>
+    <script>
+      (function () {
+        if (!window.EventSource || location.protocol.indexOf("http") !== 0) {
+          return;
+        }
+        var strip = document.getElementById("permas");
+        // With layout=rows every row scrolls on its own
+        var rows = document.querySelectorAll("#permas .row");
+        var strips = rows.length ? Array.prototype.slice.call(rows) : [strip];
+        var pin = document.getElementById("pin");
+        var pinTimer = 0;
+        var reloading = false;
+        var fade = 0.4; // seconds the strip fades out and in around a reload
+
+        // After a reload, carry on from where the old page was (unless the
+        // schedule already set the position) and fade the new tiles in
+        var reloadedAt = sessionStorage.getItem("photo-slider-reload");
+        if (reloadedAt) {
+          sessionStorage.removeItem("photo-slider-reload");
+          strips.forEach(function (s) {
+            if (!s.style.animationDelay) {
+              s.style.animationDelay = -(Date.now() - reloadedAt) / 1000 + "s";
+            }
+          });
+          strip.style.opacity = 0;
+          void strip.offsetWidth;
+          strip.style.transition = "opacity " + fade + "s";
+          strip.style.opacity = 1;
+        }
+
+        function find(image) {
+          return document.querySelector("#permas .scroll-content [data-image=\"" + CSS.escape(image) + "\"]");
+        }
+
+        // Restart the animation of the tile's row at the point where tile
+        // is in the middle. Rows are zoomed out, so the screen is wider in
+        // their pixels
+        function skip(tile) {
+          var row = tile.closest(".row") || strip;
+          var style = getComputedStyle(row);
+          var half = row.querySelector(".scroll-content").offsetWidth;
+          var duration = parseFloat(style.animationDuration);
+          var x = tile.offsetLeft + tile.offsetWidth / 2 - window.innerWidth / 2 / (parseFloat(style.zoom) || 1);
+          var t = (((x / half) * duration) % duration + duration) % duration;
+          row.style.animationName = "none";
+          void row.offsetWidth;
+          row.style.animationName = "";
+          row.style.animationDelay = -t + "s";
+        }
+
+        function play(state) {
+          strips.forEach(function (s) { s.style.animationPlayState = state; });
+        }
+
+        function unpin() {
+          clearTimeout(pinTimer);
+          pin.className = "";
+          pin.innerHTML = "";
+        }
+
+        function show(tile, seconds) {
+          unpin();
+          pin.appendChild(tile.cloneNode(true));
+          pin.className = "shown";
+          pinTimer = setTimeout(unpin, seconds * 1000);
+        }
+
+        // Reload at the end of the loop, when the strip is back at its start,
+        // so a new order takes over from the first tile instead of the
+        // tiles changing under the viewer mid-scroll. With rows, the top
+        // row's loop counts
+        function reload() {
+          if (reloading) return;
+          reloading = true;
+          var style = getComputedStyle(strips[0]);
+          if (style.animationPlayState === "paused") {
+            location.reload();
+            return;
+          }
+          var done = false;
+          function swap() {
+            if (done) return;
+            done = true;
+            sessionStorage.setItem("photo-slider-reload", Date.now());
+            strip.style.transition = "opacity " + fade + "s";
+            strip.style.opacity = 0;
+            setTimeout(function () { location.reload(); }, fade * 1000);
+          }
+          strips[0].addEventListener("animationiteration", function (e) {
+            if (e.target === strips[0]) swap();
+          });
+          // In case the event never comes, e.g. paused after all
+          setTimeout(swap, (parseFloat(style.animationDuration) + 1) * 1000);
+        }
+
+        new EventSource("control/events").onmessage = function (e) {
+          var cmd = JSON.parse(e.data);
+          var tile = cmd.image ? find(cmd.image) : null;
+          switch (cmd.action) {
+            case "pause":
+              play("paused");
+              break;
+            case "resume":
+              play("running");
+              break;
+            case "skip":
+              if (tile) skip(tile);
+              break;
+            case "pin":
+              if (tile) show(tile, cmd.seconds);
+              break;
+            case "unpin":
+              unpin();
+              break;
+            case "reload":
+              reload();
+              break;
+          }
+        };
+      })();
+    </script>
+`
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"html/template"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The report written by the credits command, next to outputFile.
+const (
+	creditsHTMLFile = "credits.html"
+	creditsCSVFile  = "credits.csv"
+)
+
+// creditedPiece is an image in the credits report.
+type creditedPiece struct {
+	Title string
+	Path  string
+	Added time.Time // first generation it was in, or else its modification time
+}
+
+// creditedArtist is an artist in the credits report, with their pieces in
+// the order they were added.
+type creditedArtist struct {
+	Name   string
+	Link   string
+	Pieces []creditedPiece
+}
+
+func (a creditedArtist) First() time.Time { return a.Pieces[0].Added }
+func (a creditedArtist) Last() time.Time  { return a.Pieces[len(a.Pieces)-1].Added }
+
+// addedDate is when the image at path came into the slider: the first
+// generation that showed it, or for images no generation has shown yet,
+// when the file was last changed.
+func addedDate(path string, st state) time.Time {
+	if hash, err := imageHash(path); err == nil {
+		if t, ok := st.FirstShown[hash]; ok {
+			return t
+		}
+	}
+	if info, err := os.Stat(path); err == nil {
+		return info.ModTime()
+	}
+	return time.Time{}
+}
+
+// artistCredits groups the images of entries that the last generation kept
+// by artist, those with the most pieces first. Images it left out, such as
+// ones that failed to read, duplicates and those skipped by a hook or the
+// content filter, aren't credited, nor are ones hidden since. Only pieces
+// added since since count, unless it is zero.
+func artistCredits(entries []imageEntry, st state, since time.Time) []creditedArtist {
+	index := map[string]int{}
+	var out []creditedArtist
+	for _, e := range entries {
+		if e.Hidden || e.Author == "" {
+			continue
+		}
+		// st.Arrived holds the images the last generation kept
+		hash, err := imageHash(e.Path)
+		if _, kept := st.Arrived[hash]; err != nil || !kept {
+			continue
+		}
+		added := addedDate(e.Path, st)
+		if added.Before(since) {
+			continue
+		}
+		i, ok := index[e.Author]
+		if !ok {
+			i = len(out)
+			index[e.Author] = i
+			out = append(out, creditedArtist{Name: e.Author})
+		}
+		if out[i].Link == "" {
+			out[i].Link = e.Link
+		}
+		out[i].Pieces = append(out[i].Pieces, creditedPiece{Title: e.Title, Path: e.Path, Added: added})
+	}
+	for _, a := range out {
+		slices.SortStableFunc(a.Pieces, func(x, y creditedPiece) int { return x.Added.Compare(y.Added) })
+	}
+	slices.SortStableFunc(out, func(a, b creditedArtist) int {
+		return cmp.Or(cmp.Compare(len(b.Pieces), len(a.Pieces)), cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)))
+	})
+	return out
+}
+
+// runCredits implements the "credits" command, which writes creditsHTMLFile
+// and creditsCSVFile: every artist with their pieces in the gallery and
+// when each was added, e.g. to thank them in a recap stream. -since leaves
+// out pieces added before a date.
+func runCredits(args []string) error {
+	fset := flag.NewFlagSet("credits", flag.ContinueOnError)
+	sinceFlag := fset.String("since", "", "only count pieces added on or after this date (YYYY-MM-DD)")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	var since time.Time
+	if *sinceFlag != "" {
+		var err error
+		since, err = time.ParseInLocation(time.DateOnly, *sinceFlag, time.Local)
+		if err != nil {
+			return errorf("value.expected", "-since", *sinceFlag, msg("value.date_format"))
+		}
+	}
+	cfg, err := readConfig()
+	if err != nil {
+		return err
+	}
+	entries, err := listImages(cfg.filter)
+	if err != nil {
+		return err
+	}
+	st, generated, err := loadState()
+	if err != nil {
+		return err
+	}
+	if !generated {
+		return errorf("credits.not_generated", outputFile)
+	}
+	artists := artistCredits(entries, st, since)
+
+	if err := writeFileAtomic(creditsCSVFile, creditsCSV(artists)); err != nil {
+		return err
+	}
+	page, err := creditsHTML(artists, since, cfg)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(creditsHTMLFile, page); err != nil {
+		return err
+	}
+	fmt.Println(msg("credits.done", creditsHTMLFile, creditsCSVFile, countNoun(len(artists), "count.artist")))
+	return nil
+}
+
+// creditsCSV has a row per piece, with the artist's total, for
+// spreadsheets.
+func creditsCSV(artists []creditedArtist) []byte {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write([]string{"author", "author_pieces", "title", "path", "added", "link"})
+	for _, a := range artists {
+		for _, p := range a.Pieces {
+			w.Write([]string{a.Name, strconv.Itoa(len(a.Pieces)), p.Title, p.Path, p.Added.Format(time.DateOnly), a.Link})
+		}
+	}
+	w.Flush()
+	return b.Bytes()
+}
+
+func creditsHTML(artists []creditedArtist, since time.Time, cfg config) ([]byte, error) {
+	pieces := 0
+	for _, a := range artists {
+		pieces += len(a.Pieces)
+	}
+	summary := msg("credits.summary", countNoun(len(artists), "count.artist"), countNoun(pieces, "count.image"))
+	if !since.IsZero() {
+		summary = msg("credits.summary_since", summary, since.Format(time.DateOnly))
+	}
+	var b bytes.Buffer
+	err := creditsTemplate.Execute(&b, map[string]any{
+		"Lang":    cfg.lang,
+		"Title":   msg("credits.title"),
+		"Summary": summary,
+		"FontURL": fontURL(cfg),
+		"Style":   creditsStyle(cfg),
+		"Artists": artists,
+	})
+	return b.Bytes(), err
+}
+
+func creditsStyle(cfg config) template.CSS {
+	var b bytes.Buffer
+	w := bufio.NewWriter(&b)
+	mustWrite(w, "      body {\n")
+	mustWrite(w, "        margin: 0 auto;\n")
+	mustWrite(w, "        padding: 16px;\n")
+	mustWrite(w, "        max-width: 900px;\n")
+	mustWrite(w, fmt.Sprintf("        font-family: %s;\n", fontStack(cfg)))
+	mustWrite(w, "        color: #fff;\n")
+	mustWrite(w, "        background: #111;\n")
+	mustWrite(w, "      }\n")
+	for _, rule := range []string{
+		"a { color: inherit; }",
+		"h1, .summary { text-align: center; }",
+		"section { margin: 24px 0; }",
+		"h2 { margin-bottom: 4px; paint-order: stroke fill; }",
+		".dates { opacity: 0.7; }",
+		"li { margin: 2px 0; }",
+		"time { opacity: 0.7; margin-left: 8px; }",
+	} {
+		mustWrite(w, "      "+rule+"\n")
+	}
+	mustWrite(w, fmt.Sprintf("      h2 { color: %s; -webkit-text-stroke: 0.2em %s; }\n", cfg.theme.authorTextColor, cfg.theme.authorStrokeColor))
+	mustWrite(w, fmt.Sprintf("      section { border-bottom: 3px %s %s; padding-bottom: 16px; }\n", cfg.theme.imageBorderStyle, cfg.theme.imageBorderColor))
+	w.Flush()
+	return template.CSS(b.String())
+}
+
+var creditsTemplate = template.Must(template.New("credits").Funcs(template.FuncMap{
+	"msg":  msg,
+	"date": func(t time.Time) string { return t.Format(time.DateOnly) },
+	"pieces": func(a creditedArtist) string {
+		return countNoun(len(a.Pieces), "count.image")
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>{{.Title}}</title>
+    <link rel="preconnect" href="https://fonts.googleapis.com">
+    <link rel="preconnect" href="https://fonts.gstatic.com" crossorigin>
+    <link href="{{.FontURL}}" rel="stylesheet">
+    <style>
+{{.Style}}    </style>
+  </head>
+  <body>
+    <h1>{{.Title}}</h1>
+    <p class="summary">{{.Summary}}</p>
+    {{range .Artists}}
+    <section>
+      <h2>{{if .Link}}<a href="{{.Link}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}</h2>
+      <div class="dates">{{pieces .}} · {{if eq (date .First) (date .Last)}}{{msg "credits.added_on" (date .First)}}{{else}}{{msg "credits.added" (date .First) (date .Last)}}{{end}}</div>
+      <ul>
+        {{range .Pieces}}<li>{{or .Title .Path}}<time datetime="{{date .Added}}">{{date .Added}}</time></li>
+        {{end}}
+      </ul>
+    </section>
+    {{else}}
+    <p class="summary">{{msg "credits.none"}}</p>
+    {{end}}
+  </body>
+</html>
+`))
+
+// The end credits tiles of end_credits, which list a column of
+// creditsLines artists after another.
+const (
+	creditsLines       = 6
+	creditsColumns     = 3   // per tile, more artists go on further tiles
+	creditsColumnWidth = 420 // px
+	creditsPadding     = 40  // px around the text
+)
+
+// creditLine is an artist on the end credits tiles.
+type creditLine struct {
+	name   string // HTML, like imageMeta.author
+	pieces int
+}
+
+// pageCredits lists the artists of metas with how many tiles each has, the
+// most first.
+func pageCredits(metas []imageMeta) []creditLine {
+	index := map[string]int{}
+	var out []creditLine
+	for _, m := range metas {
+		if m.author == "" {
+			continue
+		}
+		key := strings.ToLower(exportText(m.author))
+		i, ok := index[key]
+		if !ok {
+			i = len(out)
+			index[key] = i
+			out = append(out, creditLine{name: m.author})
+		}
+		out[i].pieces++
+	}
+	slices.SortStableFunc(out, func(a, b creditLine) int { return cmp.Compare(b.pieces, a.pieces) })
+	return out
+}
+
+// creditsSlides splits the artists of metas over the end credits tiles,
+// none without end_credits or with include_author=false.
+func creditsSlides(metas []imageMeta, cfg config) [][]creditLine {
+	if !cfg.endCredits || !cfg.includeAuthor {
+		return nil
+	}
+	return slices.Collect(slices.Chunk(pageCredits(metas), creditsLines*creditsColumns))
+}
+
+// creditsSlideWidth is the width of an end credits tile with the given
+// number of artists, before scaling. It is at least two columns wide, so a
+// short list leaves room for the title.
+func creditsSlideWidth(artists int) int {
+	columns := max((artists+creditsLines-1)/creditsLines, 2)
+	return columns*creditsColumnWidth + 2*creditsPadding
+}
+
+// creditsTiles stand in for the end credits tiles where the strip is
+// measured and scheduled, see stripTiles.
+func creditsTiles(metas []imageMeta, cfg config) []imageMeta {
+	var out []imageMeta
+	for _, slide := range creditsSlides(metas, cfg) {
+		names := make([]string, len(slide))
+		for i, line := range slide {
+			names[i] = line.name
+		}
+		out = append(out, imageMeta{
+			author: strings.Join(names, ", "),
+			title:  template.HTMLEscapeString(cfg.endCreditsTitle),
+			width:  creditsSlideWidth(len(slide)),
+			height: imageHeight,
+		})
+	}
+	return out
+}
+
+func writeCreditsStyle(w *bufio.Writer, cfg config) {
+	mustWrite(w, "      #permas .credits-slide {\n")
+	mustWrite(w, "        box-sizing: border-box;\n")
+	mustWrite(w, fmt.Sprintf("        height: %dpx;\n", cfg.px(imageHeight)))
+	mustWrite(w, fmt.Sprintf("        padding: %dpx;\n", cfg.px(creditsPadding)))
+	mustWrite(w, fmt.Sprintf("        font-family: %s;\n", fontStack(cfg)))
+	mustWrite(w, "        white-space: nowrap;\n")
+	mustWrite(w, "        paint-order: stroke fill;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #permas .credits-title {\n")
+	mustWrite(w, fmt.Sprintf("        font-size: %dpx;\n", cfg.px(56)))
+	mustWrite(w, fmt.Sprintf("        margin-bottom: %dpx;\n", cfg.px(20)))
+	mustWrite(w, "        text-align: center;\n")
+	mustWrite(w, fmt.Sprintf("        color: %s;\n", cfg.theme.authorTextColor))
+	mustWrite(w, fmt.Sprintf("        -webkit-text-stroke: %dpx %s;\n", cfg.px(10), cfg.theme.authorStrokeColor))
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #permas .credits-names {\n")
+	mustWrite(w, "        display: grid;\n")
+	mustWrite(w, fmt.Sprintf("        grid-template-rows: repeat(%d, auto);\n", creditsLines))
+	mustWrite(w, "        grid-auto-flow: column;\n")
+	mustWrite(w, "        justify-content: center;\n")
+	mustWrite(w, fmt.Sprintf("        grid-auto-columns: %dpx;\n", cfg.px(creditsColumnWidth)))
+	mustWrite(w, "        margin: 0;\n")
+	mustWrite(w, "        padding: 0;\n")
+	mustWrite(w, "        list-style: none;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #permas .credits-name {\n")
+	mustWrite(w, fmt.Sprintf("        font-size: %dpx;\n", cfg.px(36)))
+	mustWrite(w, fmt.Sprintf("        color: %s;\n", cfg.theme.authorTextColor))
+	mustWrite(w, fmt.Sprintf("        -webkit-text-stroke: %dpx %s;\n", cfg.px(8), cfg.theme.authorStrokeColor))
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #permas .credits-count {\n")
+	mustWrite(w, fmt.Sprintf("        font-size: %dpx;\n", cfg.px(24)))
+	mustWrite(w, fmt.Sprintf("        margin-left: %dpx;\n", cfg.px(12)))
+	mustWrite(w, fmt.Sprintf("        color: %s;\n", cfg.theme.titleTextColor))
+	mustWrite(w, fmt.Sprintf("        -webkit-text-stroke: %dpx %s;\n", cfg.px(6), cfg.theme.titleStrokeColor))
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+}
+
+// writeCreditsContainers writes the end credits tiles, which go after the
+// last image of the first row.
+func writeCreditsContainers(w *bufio.Writer, slides [][]creditLine, cfg config) {
+	for _, slide := range slides {
+		mustWrite(w, "        <div class=\"image-container credits\">\n")
+		mustWrite(w, fmt.Sprintf("          <div class=\"credits-slide\" style=\"width: %dpx\">\n", cfg.px(creditsSlideWidth(len(slide)))))
+		mustWrite(w, fmt.Sprintf("            <div class=\"credits-title\">%s</div>\n", template.HTMLEscapeString(cfg.endCreditsTitle)))
+		mustWrite(w, "            <ul class=\"credits-names\">\n")
+		for _, line := range slide {
+			mustWrite(w, fmt.Sprintf("              <li><span class=\"credits-name\">%s</span><span class=\"credits-count\">%s</span></li>\n", line.name, template.HTMLEscapeString(countNoun(line.pieces, "count.image"))))
+		}
+		mustWrite(w, "            </ul>\n")
+		mustWrite(w, "          </div>\n")
+		mustWrite(w, "        </div>\n")
+	}
+}
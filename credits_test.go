@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestArtistCreditsOnlyKeptImages(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(imageFolder, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{"images/jane - dragon.png", "images/jane - broken.png", "images/jane - hidden.png", "images/bob - cat.png"}
+	for i, path := range paths {
+		if err := os.WriteFile(path, grayPNG(t, uint8(i)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st, _, err := loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The broken one was left out of the last generation
+	for _, path := range []string{paths[0], paths[2], paths[3]} {
+		hash, err := imageHash(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		st.Arrived[hash] = 1
+	}
+	entries := []imageEntry{
+		{Path: paths[0], Author: "jane", Title: "dragon"},
+		{Path: paths[1], Author: "jane", Title: "broken"},
+		{Path: paths[2], Author: "jane", Title: "hidden", Hidden: true},
+		{Path: paths[3], Author: "bob", Title: "cat"},
+	}
+	artists := artistCredits(entries, st, time.Time{})
+	if len(artists) != 2 {
+		t.Fatalf("credited %d artists, want 2: %+v", len(artists), artists)
+	}
+	for _, a := range artists {
+		if len(a.Pieces) != 1 {
+			t.Errorf("%s has %d pieces, want 1: %+v", a.Name, len(a.Pieces), a.Pieces)
+		}
+	}
+}
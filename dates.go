@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateRange limits images to those dated within [from, to). Zero bounds
+// are open.
+type dateRange struct {
+	from time.Time
+	to   time.Time
+}
+
+func (r dateRange) active() bool {
+	return !r.from.IsZero() || !r.to.IsZero()
+}
+
+func (r dateRange) contains(t time.Time) bool {
+	if !r.from.IsZero() && t.Before(r.from) {
+		return false
+	}
+	if !r.to.IsZero() && !t.Before(r.to) {
+		return false
+	}
+	return true
+}
+
+// parseSince parses a relative age such as "30d", "2w" or "12h" (or any
+// Go duration).
+func parseSince(value string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if n, ok := strings.CutSuffix(value, suffix); ok {
+			days, err := strconv.Atoi(n)
+			if err != nil || days < 0 {
+				return 0, errorf("dates.invalid_age", value)
+			}
+			return time.Duration(days) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, errorf("dates.invalid_age_hint", value)
+	}
+	return d, nil
+}
+
+// parseDay parses a YYYY-MM-DD date in local time.
+func parseDay(value string) (time.Time, error) {
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, errorf("dates.invalid_date", value)
+	}
+	return t, nil
+}
+
+// sourceDate is the date of an image for the date filters, expiry and
+// selection=newest: when the photo was taken (EXIF, falling back to the
+// file time) or the file's modification time, depending on date_source. It
+// is zero if unknown.
+func sourceDate(m imageMeta, cfg config) time.Time {
+	if cfg.dateSource == "taken" {
+		if !m.date.IsZero() {
+			return m.date // read already, or kept in the build cache
+		}
+		return imageDate(m.source)
+	}
+	if info, err := os.Stat(m.source); err == nil {
+		return info.ModTime()
+	}
+	return time.Time{}
+}
+
+// filterByDate keeps the images dated within the configured range.
+func filterByDate(metas []imageMeta, cfg config) []imageMeta {
+	if !cfg.dates.active() {
+		return metas
+	}
+	out := metas[:0]
+	for _, m := range metas {
+		if t := sourceDate(m, cfg); !t.IsZero() && cfg.dates.contains(t) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseSince(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		want  time.Duration // -1 for invalid
+	}{
+		{"30d", 30 * 24 * time.Hour},
+		{"0d", 0},
+		{"2w", 14 * 24 * time.Hour},
+		{"12h", 12 * time.Hour},
+		{"90m", 90 * time.Minute},
+		{"1h30m", 90 * time.Minute},
+		{"d", -1},
+		{"-1d", -1},
+		{"1.5d", -1},
+		{"-2h", -1},
+		{"30", -1},
+		{"30 days", -1},
+		{"", -1},
+	} {
+		got, err := parseSince(tt.value)
+		if tt.want < 0 {
+			if err == nil {
+				t.Errorf("parseSince(%q) = %v, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseSince(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestDateConfig(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.Local) }
+	for _, tt := range []struct {
+		config   string
+		from, to time.Time
+		invalid  bool
+	}{
+		{config: "min_date=2025-09-01", from: day(2025, 9, 1)},
+		{config: "max_date=2025-09-30", to: day(2025, 10, 1)},
+		{config: "min_date=2025-09-01\nmax_date=2025-09-01", from: day(2025, 9, 1), to: day(2025, 9, 2)},
+		{config: "max_date=2024-12-31", to: day(2025, 1, 1)},
+		{config: "min_date=2025-9-1", invalid: true},
+		{config: "min_date=2025-02-30", invalid: true},
+		{config: "max_date=yesterday", invalid: true},
+		{config: "since=2w", from: time.Now().Add(-14 * 24 * time.Hour)},
+		{config: "since=12h", from: time.Now().Add(-12 * time.Hour)},
+		{config: "since=soon", invalid: true},
+	} {
+		t.Run(tt.config, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			if err := os.WriteFile(configFile, []byte(tt.config+"\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := readConfig()
+			if tt.invalid {
+				if err == nil {
+					t.Errorf("accepted, dates %v to %v", cfg.dates.from, cfg.dates.to)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// since counts back from now, so allow for the time the test takes
+			if d := cfg.dates.from.Sub(tt.from); d < -time.Minute || d > time.Minute {
+				t.Errorf("from = %v, want %v", cfg.dates.from, tt.from)
+			}
+			if !cfg.dates.to.Equal(tt.to) {
+				t.Errorf("to = %v, want %v", cfg.dates.to, tt.to)
+			}
+		})
+	}
+}
+
+func TestDateRangeContains(t *testing.T) {
+	r := dateRange{from: time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC), to: time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)}
+	for _, tt := range []struct {
+		t    time.Time
+		want bool
+	}{
+		{time.Date(2025, 8, 31, 23, 59, 59, 0, time.UTC), false},
+		{time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC), true},
+		{time.Date(2025, 9, 30, 23, 59, 59, 0, time.UTC), true},
+		{time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC), false},
+	} {
+		if got := r.contains(tt.t); got != tt.want {
+			t.Errorf("contains(%v) = %v, want %v", tt.t, got, tt.want)
+		}
+	}
+	if open := (dateRange{}); open.active() || !open.contains(time.Time{}) {
+		t.Error("an empty range doesn't let everything through")
+	}
+}
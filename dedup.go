@@ -0,0 +1,240 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"io"
+	"log/slog"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// duplicate is an image whose content matches an earlier one.
+type duplicate struct {
+	path     string
+	original string
+	near     bool // perceptually similar rather than byte-identical
+}
+
+// hashImages computes the content hash of the images in metas that don't
+// have one from the build cache yet, returning the error for each image it
+// couldn't read.
+func hashImages(metas []imageMeta, workers int) []error {
+	errs := make([]error, len(metas))
+	parallel(msg("progress.hashing"), len(metas), workers, func(worker, i int) {
+		m := &metas[i]
+		if m.frames > 0 || m.hash != "" {
+			return
+		}
+		defer traceSpanOn(worker, traceHashing, "hash", "path", m.relPath)()
+		m.hash, errs[i] = imageHash(m.relPath)
+	})
+	return errs
+}
+
+// findDuplicates returns the images in metas that repeat an earlier image,
+// either byte for byte or, with near_duplicates, by perceptual hash
+// distance. Sequence tiles are never considered duplicates. The images must
+// be hashed, see hashImages.
+func findDuplicates(metas []imageMeta, cfg config) []duplicate {
+	var dups []duplicate
+	byHash := map[string]string{}
+	var unique []int // indexes of the first image with each content hash
+	for i, m := range metas {
+		if m.frames > 0 {
+			continue
+		}
+		if orig, ok := byHash[m.hash]; ok {
+			dups = append(dups, duplicate{path: m.relPath, original: orig})
+			continue
+		}
+		byHash[m.hash] = m.relPath
+		unique = append(unique, i)
+	}
+	if !cfg.nearDuplicates {
+		return dups
+	}
+
+	parallel(msg("progress.comparing"), len(unique), cfg.workers, func(worker, j int) {
+		m := &metas[unique[j]]
+		if m.dhash != nil {
+			return
+		}
+		defer traceSpanOn(worker, traceHashing, "perceptual hash", "path", m.relPath)()
+		img, err := decodeImage(m.relPath, cfg.limits)
+		if err != nil {
+			return // can't be compared, e.g. WebP
+		}
+		h := dHash(img)
+		m.dhash = &h
+	})
+	type seen struct {
+		path  string
+		dhash uint64
+	}
+	var hashed []seen
+	for _, i := range unique {
+		m := metas[i]
+		if m.dhash == nil {
+			continue
+		}
+		h := *m.dhash
+		dup := false
+		for _, s := range hashed {
+			if bits.OnesCount64(h^s.dhash) <= cfg.nearDuplicateBits {
+				dups = append(dups, duplicate{path: m.relPath, original: s.path, near: true})
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			hashed = append(hashed, seen{path: m.relPath, dhash: h})
+		}
+	}
+	return dups
+}
+
+func removeDuplicates(metas []imageMeta, dups []duplicate) []imageMeta {
+	drop := make(map[string]bool, len(dups))
+	for _, d := range dups {
+		drop[d.path] = true
+	}
+	out := metas[:0]
+	for _, m := range metas {
+		if !drop[m.relPath] {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// printDuplicates reports the duplicates found, either as a full list or
+// as a one line summary.
+func printDuplicates(dups []duplicate, skipped, list bool) {
+	if len(dups) == 0 {
+		return
+	}
+	key := "dedup.found"
+	if skipped {
+		key = "dedup.skipped"
+	}
+	count := countNoun(len(dups), "count.duplicate_image")
+	if !list {
+		slog.Info(msg(key+"_summary", count))
+		return
+	}
+	slog.Info(msg(key, count))
+	for _, d := range dups {
+		how := "dedup.same"
+		if d.near {
+			how = "dedup.similar"
+		}
+		slog.Info(msg(how, d.path, d.original))
+	}
+}
+
+// ensureHashes fills in the content hash of every image that doesn't have
+// one yet. Unreadable files keep their path as hash.
+func ensureHashes(metas []imageMeta, workers int) {
+	parallel(msg("progress.hashing"), len(metas), workers, func(worker, i int) {
+		if metas[i].hash != "" {
+			return
+		}
+		defer traceSpanOn(worker, traceHashing, "hash", "path", metas[i].relPath)()
+		sum, err := imageHash(metas[i].relPath)
+		if err != nil {
+			sum = metas[i].relPath
+		}
+		metas[i].hash = sum
+	})
+}
+
+// knownHashes are the content hashes imageHash found so far, by path. It
+// starts out with those saved in the build cache, so looking up what is
+// stored about every image in a folder doesn't read them all.
+var knownHashes struct {
+	sync.Mutex
+	images map[string]buildImage
+}
+
+// imageHash is fileHash for an image, which is only read if it changed
+// since its hash was last seen.
+func imageHash(path string) (string, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	knownHashes.Lock()
+	if knownHashes.images == nil {
+		knownHashes.images = map[string]buildImage{}
+		if bc, err := loadBuildCache(false); err == nil {
+			knownHashes.images = bc.Images
+		}
+	}
+	e, ok := (&buildCache{Images: knownHashes.images}).image(path, stat)
+	knownHashes.Unlock()
+	if ok && e.Hash != "" {
+		return e.Hash, nil
+	}
+	sum, err := fileHash(path)
+	if err != nil {
+		return "", err
+	}
+	knownHashes.Lock()
+	knownHashes.images[filepath.ToSlash(path)] = buildImage{Size: stat.Size(), ModTime: stat.ModTime(), Hash: sum}
+	knownHashes.Unlock()
+	return sum, nil
+}
+
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errorf("file.read", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// dHash is a 64-bit difference hash: the image is shrunk to 9x8 grayscale
+// and each bit records whether a pixel is brighter than its right neighbour.
+// Resized or recompressed copies of an image end up a few bits apart.
+func dHash(img image.Image) uint64 {
+	b := img.Bounds()
+	var gray [8][9]float64
+	for y := 0; y < 8; y++ {
+		y0 := b.Min.Y + y*b.Dy()/8
+		y1 := max(b.Min.Y+(y+1)*b.Dy()/8, y0+1)
+		for x := 0; x < 9; x++ {
+			x0 := b.Min.X + x*b.Dx()/9
+			x1 := max(b.Min.X+(x+1)*b.Dx()/9, x0+1)
+			// Average a sparse grid of samples from the cell
+			var sum float64
+			var n int
+			for sy := y0; sy < y1; sy += max(1, (y1-y0)/4) {
+				for sx := x0; sx < x1; sx += max(1, (x1-x0)/4) {
+					r, g, bl, _ := img.At(sx, sy).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)
+					n++
+				}
+			}
+			gray[y][x] = sum / float64(n)
+		}
+	}
+	var h uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			h <<= 1
+			if gray[y][x] > gray[y][x+1] {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// diffFile is the scratch page -diff generates to compare with outputFile.
+func diffFile() string {
+	return filepath.Join(filepath.Dir(outputFile), ".diff-"+filepath.Base(outputFile))
+}
+
+// pageTile is a tile as found in a generated page.
+type pageTile struct {
+	image   string // data-image, or the image's address if the page has none
+	caption string // text of the caption, lines joined with " / "
+}
+
+// pageSummary is what -diff compares of a generated page.
+type pageSummary struct {
+	tiles []pageTile        // in page order, each image once
+	style map[string]string // "selector { property" to value
+}
+
+var (
+	tileStartPattern = regexp.MustCompile(`<div class="image-container[^"]*"(?: data-image="([^"]*)")?[^>]*>`)
+	tileSrcPattern   = regexp.MustCompile(`class="scroller[^"]*" (?:src="[^"]*" data-src="([^"]*)"|src="([^"]*)"|style="[^"]*url\(&#34;([^&]*)&#34;\))`)
+	captionPattern   = regexp.MustCompile(`(?s)<div class="caption">(.*?)\n          </div>`)
+	captionQRPattern = regexp.MustCompile(`(?s)<div class="qr">.*?</svg></div>`)
+	tagPattern       = regexp.MustCompile(`<[^>]*>`)
+	stylePattern     = regexp.MustCompile(`(?s)<style>(.*?)</style>`)
+	manifestPattern  = regexp.MustCompile(`(?m)^      var tiles = (.*);$`)
+)
+
+// readPage summarizes the page at path. A page that doesn't exist has no
+// tiles and no style.
+func readPage(path string) (pageSummary, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return pageSummary{style: map[string]string{}}, nil
+	}
+	if err != nil {
+		return pageSummary{}, err
+	}
+	page := string(content)
+	s := pageSummary{style: map[string]string{}}
+	for _, m := range stylePattern.FindAllStringSubmatch(page, -1) {
+		parseStyle(m[1], s.style)
+	}
+	if m := manifestPattern.FindStringSubmatch(page); m != nil {
+		s.tiles, err = compactPageTiles(m[1])
+		return s, err
+	}
+
+	seen := map[string]bool{}
+	starts := tileStartPattern.FindAllStringSubmatchIndex(page, -1)
+	for i, start := range starts {
+		end := len(page)
+		if i+1 < len(starts) {
+			end = starts[i+1][0]
+		}
+		block := page[start[1]:end]
+		if close := strings.Index(block, "\n        </div>"); close >= 0 {
+			block = block[:close]
+		}
+		var t pageTile
+		if start[2] >= 0 {
+			t.image = html.UnescapeString(page[start[2]:start[3]])
+		} else if m := tileSrcPattern.FindStringSubmatch(block); m != nil {
+			// lazy_loading=observer gives every image the same src
+			t.image = html.UnescapeString(m[1] + m[2] + m[3])
+		}
+		if m := captionPattern.FindStringSubmatch(block); m != nil {
+			t.caption = pageCaption(m[1])
+		}
+		if t.image == "" || seen[t.image] {
+			continue
+		}
+		seen[t.image] = true
+		s.tiles = append(s.tiles, t)
+	}
+	return s, nil
+}
+
+// compactPageTiles reads the tiles from the manifest of a compact page.
+func compactPageTiles(manifest string) ([]pageTile, error) {
+	var tiles []compactTile
+	if err := json.Unmarshal([]byte(manifest), &tiles); err != nil {
+		return nil, errorf("diff.read_tiles", err)
+	}
+	out := make([]pageTile, 0, len(tiles))
+	for _, t := range tiles {
+		image := t.Image
+		if image == "" {
+			image = t.Src
+		}
+		var lines []string
+		if t.Caption != nil {
+			lines = []string{*t.Caption}
+		} else {
+			lines = []string{t.Author, t.Title, t.Translation}
+		}
+		out = append(out, pageTile{image: image, caption: captionLines(lines)})
+	}
+	return out, nil
+}
+
+// pageCaption is the text of a caption's markup.
+func pageCaption(markup string) string {
+	markup = captionQRPattern.ReplaceAllString(markup, "")
+	return captionLines(strings.Split(markup, "\n"))
+}
+
+func captionLines(lines []string) string {
+	var out []string
+	for _, line := range lines {
+		line = strings.ReplaceAll(line, "<br>", " ")
+		line = strings.TrimSpace(html.UnescapeString(tagPattern.ReplaceAllString(line, "")))
+		if line != "" {
+			out = append(out, line)
+		}
+	}
+	return strings.Join(out, " / ")
+}
+
+// parseStyle adds the declarations of css to style, keyed by the selectors
+// around them, e.g. "@keyframes scroll { to { transform".
+func parseStyle(css string, style map[string]string) {
+	for {
+		start := strings.Index(css, "/*")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(css[start:], "*/")
+		if end < 0 {
+			css = css[:start]
+			break
+		}
+		css = css[:start] + css[start+end+2:]
+	}
+	var selectors []string
+	text := 0
+	for i, c := range css {
+		switch c {
+		case '{':
+			selectors = append(selectors, strings.Join(strings.Fields(css[text:i]), " "))
+			text = i + 1
+		case ';', '}':
+			if name, value, ok := strings.Cut(css[text:i], ":"); ok && len(selectors) > 0 {
+				key := strings.Join(selectors, " { ") + " { " + strings.TrimSpace(name)
+				style[key] = strings.Join(strings.Fields(value), " ")
+			}
+			if c == '}' && len(selectors) > 0 {
+				selectors = selectors[:len(selectors)-1]
+			}
+			text = i + 1
+		}
+	}
+}
+
+// printDiff prints how the page -diff generated differs from outputFile:
+// images added and removed, captions changed and, with style, style values
+// changed. With settings (for -dry-run), it also prints the config settings
+// changed since the last generation.
+func printDiff(cfg config, style, settings bool) error {
+	before, err := readPage(outputFile)
+	if err != nil {
+		return err
+	}
+	after, err := readPage(cfg.previewOutput)
+	if err != nil {
+		return err
+	}
+	// The scratch page has a hero of its own
+	live := cfg
+	live.previewOutput = ""
+	for i, t := range after.tiles {
+		if t.image == filepath.ToSlash(heroFile(cfg)) {
+			after.tiles[i].image = filepath.ToSlash(heroFile(live))
+		}
+	}
+
+	captions := map[string]string{}
+	for _, t := range before.tiles {
+		captions[t.image] = t.caption
+	}
+	var added, changed []string
+	kept := map[string]bool{}
+	for _, t := range after.tiles {
+		old, ok := captions[t.image]
+		if !ok {
+			added = append(added, "  + "+t.image)
+			continue
+		}
+		kept[t.image] = true
+		if old != t.caption {
+			changed = append(changed, msg("diff.caption", t.image, old, t.caption))
+		}
+	}
+	var removed []string
+	for _, t := range before.tiles {
+		if !kept[t.image] {
+			removed = append(removed, "  - "+t.image)
+		}
+	}
+
+	var styles []string
+	if !style {
+		before.style, after.style = nil, nil
+	}
+	for key, value := range after.style {
+		old, ok := before.style[key]
+		switch {
+		case !ok:
+			styles = append(styles, msg("diff.style_added", key, value))
+		case old != value:
+			styles = append(styles, msg("diff.style_changed", key, old, value))
+		}
+	}
+	for key, value := range before.style {
+		if _, ok := after.style[key]; !ok {
+			styles = append(styles, msg("diff.style_removed", key, value))
+		}
+	}
+	slices.Sort(styles)
+
+	var config []string
+	known := true
+	if settings {
+		st, _, err := loadState()
+		if err != nil {
+			return err
+		}
+		known = st.Config != nil
+		config = configChanges(st.Config, cfg.settings)
+		fmt.Println(msg("diff.dry_run"))
+	}
+
+	fmt.Println(msg("diff.comparing", outputFile))
+	if !known {
+		fmt.Println(msg("diff.config_unknown"))
+	}
+	if len(added)+len(removed)+len(changed)+len(styles)+len(config) == 0 {
+		fmt.Println(msg("diff.none"))
+		return nil
+	}
+	section := func(key, noun string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Println(msg(key, countNoun(len(lines), noun)))
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+	}
+	section("diff.added", "count.image", added)
+	section("diff.removed", "count.image", removed)
+	section("diff.changed", "count.caption", changed)
+	section("diff.changed", "count.style_value", styles)
+	section("diff.config", "count.setting", config)
+	return nil
+}
+
+// outputlessSettings are config keys that don't change the page, left out
+// of the settings -dry-run compares.
+var outputlessSettings = map[string]bool{
+	"preview_screenshot": true,
+	"error_page":         true,
+	"webhook_url":        true,
+	"webhook_events":     true,
+	"admin_password":     true,
+	"moderation":         true,
+	"workers":            true,
+	"log_file":           true,
+	"log_max_size":       true,
+	"export_base_url":    true,
+	"hook_pre_scan":      true,
+	"hook_post_generate": true,
+	"twitch_channel":     true,
+	"twitch_user":        true,
+	"twitch_token":       true,
+	"chat_pin_seconds":   true,
+	"chat_post_links":    true,
+	"safety_api_key":     true,
+}
+
+// configChanges lists the settings that differ between before and after,
+// by key. A nil before (no generation recorded its settings yet) has no
+// changes.
+func configChanges(before, after map[string]string) []string {
+	if before == nil {
+		return nil
+	}
+	var lines []string
+	for key, value := range after {
+		old, ok := before[key]
+		switch {
+		case outputlessSettings[key]:
+		case !ok:
+			lines = append(lines, msg("diff.setting_added", key, value))
+		case old != value:
+			lines = append(lines, msg("diff.setting_changed", key, old, value))
+		}
+	}
+	for key, value := range before {
+		if _, ok := after[key]; !ok && !outputlessSettings[key] {
+			lines = append(lines, msg("diff.setting_removed", key, value))
+		}
+	}
+	slices.SortFunc(lines, func(a, b string) int {
+		return strings.Compare(strings.TrimLeft(a, " +-"), strings.TrimLeft(b, " +-"))
+	})
+	return lines
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestReadPageKeepsLazyTilesApart(t *testing.T) {
+	t.Chdir(t.TempDir())
+	cfg, err := readConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.theme, err = resolveTheme(cfg); err != nil {
+		t.Fatal(err)
+	}
+	metas := syntheticMetas(3)
+	for _, lazyLoading := range []string{"off", "observer"} {
+		cfg.lazyLoading = lazyLoading
+		if err := writeHTML(outputFile, metas, cfg); err != nil {
+			t.Fatal(err)
+		}
+		page, err := readPage(outputFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.tiles) != len(metas) {
+			t.Fatalf("lazy_loading=%s: read %d tiles, want %d", lazyLoading, len(page.tiles), len(metas))
+		}
+		for i, tile := range page.tiles {
+			if want := metas[i].src(); tile.image != want {
+				t.Errorf("lazy_loading=%s: tile %d is %q, want %q", lazyLoading, i, tile.image, want)
+			}
+		}
+	}
+}
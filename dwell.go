@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// dwellSeconds is how long the strip stops with m in the middle of the
+// screen: its own dwell from the metadata, or else dwell_seconds.
+func dwellSeconds(m imageMeta, cfg config) float64 {
+	if m.dwell != nil {
+		return max(*m.dwell, 0)
+	}
+	return cfg.dwellSeconds
+}
+
+// stripTiles are the tiles of one pass of the strip in order, the hero
+// tile first and the end credits last.
+func stripTiles(metas []imageMeta, cfg config) []imageMeta {
+	credits := creditsTiles(metas, cfg)
+	if (!cfg.heroTile || len(metas) == 0) && len(credits) == 0 {
+		return metas
+	}
+	var tiles []imageMeta
+	if cfg.heroTile && len(metas) > 0 {
+		tiles = append(tiles, imageMeta{relPath: heroFile(cfg), width: heroWidth, height: heroHeight, title: heroTitle(cfg, len(metas))})
+	}
+	tiles = append(tiles, metas...)
+	return append(tiles, credits...)
+}
+
+// totalDwell is how long the strip stands still in one loop.
+func totalDwell(metas []imageMeta, cfg config) float64 {
+	var total float64
+	for _, m := range stripTiles(metas, cfg) {
+		total += dwellSeconds(m, cfg)
+	}
+	return total
+}
+
+// scrollStop is a point where the strip stands still for hold seconds, pos
+// pixels into its loop.
+type scrollStop struct {
+	pos  float64
+	hold float64
+}
+
+// scrollTimeline is where the strip is when. It moves at speed, except at
+// the stops, where a tile is centered on screen.
+type scrollTimeline struct {
+	distance float64 // px in one loop
+	speed    float64 // px per second while moving
+	stops    []scrollStop
+}
+
+// newScrollTimeline lays out the strip with the tile sizes estimated by
+// tileWidth, so with captions wider than their images a tile stops a little
+// off center. The loop itself always lines up.
+func newScrollTimeline(metas []imageMeta, cfg config) scrollTimeline {
+	tiles := stripTiles(metas, cfg)
+	var tl scrollTimeline
+	widths := make([]float64, len(tiles))
+	for i, m := range tiles {
+		widths[i] = tileWidth(m, cfg) + float64(cfg.px(tileSpacing))
+		tl.distance += widths[i]
+	}
+	moving := float64(loopSeconds(metas, cfg)) - totalDwell(metas, cfg)
+	if tl.distance == 0 || moving <= 0 {
+		return scrollTimeline{}
+	}
+	tl.speed = tl.distance / moving
+
+	center := float64(cfg.scheduleViewport) / 2
+	var x float64
+	for i, m := range tiles {
+		if hold := dwellSeconds(m, cfg); hold > 0 {
+			tl.stops = append(tl.stops, scrollStop{pos: tl.wrap(x + widths[i]/2 - center), hold: hold})
+		}
+		x += widths[i]
+	}
+	sort.Slice(tl.stops, func(i, j int) bool { return tl.stops[i].pos < tl.stops[j].pos })
+	return tl
+}
+
+// wrap brings pos into [0, distance).
+func (tl scrollTimeline) wrap(pos float64) float64 {
+	pos = math.Mod(pos, tl.distance)
+	if pos < 0 {
+		pos += tl.distance
+	}
+	return pos
+}
+
+// timeAt is how many seconds into the loop the strip has moved pos pixels.
+// At a stop, it is the moment the strip gets there.
+func (tl scrollTimeline) timeAt(pos float64) float64 {
+	pos = tl.wrap(pos)
+	t := pos / tl.speed
+	for _, s := range tl.stops {
+		if s.pos < pos {
+			t += s.hold
+		}
+	}
+	return t
+}
+
+// writeScrollKeyframes writes the scroll animation of the strip. It moves
+// by half its width, one copy of the tiles, so the loop is seamless; with
+// dwell it stops on the way as each tile is centered. The rows of
+// layout=rows don't stop.
+func writeScrollKeyframes(w *bufio.Writer, metas []imageMeta, cfg config) {
+	mustWrite(w, "      @keyframes scroll {\n")
+	mustWrite(w, "        0% {\n")
+	mustWrite(w, "          transform: translateX(0);\n")
+	mustWrite(w, "        }\n")
+	tl := newScrollTimeline(metas, cfg)
+	if len(tl.stops) > 0 && len(tileRows(metas, cfg)) == 1 {
+		loop := float64(loopSeconds(metas, cfg))
+		for _, s := range tl.stops {
+			// Where the strip is, as a percentage of its width
+			at := fmt.Sprintf("translateX(%.4f%%)", -s.pos/tl.distance*50)
+			start := tl.timeAt(s.pos)
+			mustWrite(w, fmt.Sprintf("        %.4f%%, %.4f%% {\n", start/loop*100, (start+s.hold)/loop*100))
+			mustWrite(w, fmt.Sprintf("          transform: %s;\n", at))
+			mustWrite(w, "        }\n")
+		}
+	}
+	mustWrite(w, "        100% {\n")
+	mustWrite(w, "          transform: translateX(-50%);\n")
+	mustWrite(w, "        }\n")
+	mustWrite(w, "      }\n")
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// lastGoodFile is the path of the copy of the last successfully generated
+// output, linked from the error page.
+func lastGoodFile(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".last-good" + ext
+}
+
+func saveLastGood(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return errorf("file.read", path, err)
+	}
+	return writeFileAtomic(lastGoodFile(path), content)
+}
+
+// writeErrorPage replaces the output with a page that shows genErr, so a
+// failed generation is visible on stream instead of silently leaving old
+// content in place.
+func writeErrorPage(path string, genErr error, cfg config) error {
+	f, err := createPage(path, cfg)
+	if err != nil {
+		return err
+	}
+	defer f.discard()
+	w := bufio.NewWriter(f)
+
+	mustWrite(w, "<!DOCTYPE html>\n")
+	mustWrite(w, fmt.Sprintf("<html lang=\"%s\">\n", cfg.lang))
+	mustWrite(w, "  <head>\n")
+	mustWrite(w, fmt.Sprintf("    <title>%s</title>\n", html.EscapeString(msg("errorpage.title"))))
+	mustWrite(w, "    <style>\n")
+	mustWrite(w, "      body {\n")
+	mustWrite(w, "        margin: 32px;\n")
+	mustWrite(w, "        font-family: sans-serif;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      .error {\n")
+	mustWrite(w, "        display: inline-block;\n")
+	mustWrite(w, "        padding: 24px 32px;\n")
+	mustWrite(w, "        border-radius: 12px;\n")
+	mustWrite(w, "        background: rgba(40, 0, 0, 0.85);\n")
+	mustWrite(w, "        border: 4px solid #e53935;\n")
+	mustWrite(w, "        color: #ffffff;\n")
+	mustWrite(w, "        font-size: 24px;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      .error pre {\n")
+	mustWrite(w, "        white-space: pre-wrap;\n")
+	mustWrite(w, "        font-size: 20px;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      .error a {\n")
+	mustWrite(w, "        color: #90caf9;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "    </style>\n")
+	mustWrite(w, "  </head>\n")
+	mustWrite(w, "  <body>\n")
+	mustWrite(w, "    <div class=\"error\">\n")
+	mustWrite(w, fmt.Sprintf("      <strong>%s</strong>\n", html.EscapeString(msg("errorpage.heading"))))
+	mustWrite(w, fmt.Sprintf("      <pre>%s</pre>\n", html.EscapeString(genErr.Error())))
+	mustWrite(w, fmt.Sprintf("      <div>%s</div>\n", html.EscapeString(msg("errorpage.failed_at", time.Now().Format("2006-01-02 15:04:05")))))
+	if _, err := os.Stat(lastGoodFile(path)); !errors.Is(err, fs.ErrNotExist) {
+		mustWrite(w, fmt.Sprintf("      <div><a href=\"%s\">%s</a></div>\n", html.EscapeString(filepath.Base(lastGoodFile(path))), html.EscapeString(msg("errorpage.last_good"))))
+	}
+	mustWrite(w, "    </div>\n")
+	mustWrite(w, "  </body>\n")
+	mustWrite(w, "</html>\n")
+
+	if err := w.Flush(); err != nil {
+		return errorf("file.flush", path, err)
+	}
+	return f.commit()
+}
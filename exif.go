@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagDateTimeOriginal = 0x9003
+)
+
+// exifDate returns the date a JPEG was taken, read from its EXIF data.
+// DateTimeOriginal is preferred over the (edit) DateTime tag.
+func exifDate(path string) (time.Time, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi != [2]byte{0xFF, 0xD8} {
+		return time.Time{}, false
+	}
+	for {
+		var hdr [4]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil || hdr[0] != 0xFF {
+			return time.Time{}, false
+		}
+		// Start of scan or end of image: no more metadata segments
+		if hdr[1] == 0xDA || hdr[1] == 0xD9 {
+			return time.Time{}, false
+		}
+		size := int(binary.BigEndian.Uint16(hdr[2:])) - 2
+		if size < 0 {
+			return time.Time{}, false
+		}
+		if hdr[1] != 0xE1 {
+			if _, err := r.Discard(size); err != nil {
+				return time.Time{}, false
+			}
+			continue
+		}
+		seg := make([]byte, size)
+		if _, err := io.ReadFull(r, seg); err != nil {
+			return time.Time{}, false
+		}
+		if bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return parseExifDate(seg[6:])
+		}
+	}
+}
+
+func parseExifDate(tiff []byte) (time.Time, bool) {
+	if len(tiff) < 8 {
+		return time.Time{}, false
+	}
+	var bo binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return time.Time{}, false
+	}
+
+	ascii := func(entry []byte) string {
+		count := bo.Uint32(entry[4:])
+		var data []byte
+		if count <= 4 {
+			data = entry[8 : 8+count]
+		} else {
+			off := bo.Uint32(entry[8:])
+			if uint64(off)+uint64(count) > uint64(len(tiff)) {
+				return ""
+			}
+			data = tiff[off : off+count]
+		}
+		return strings.TrimRight(string(data), "\x00 ")
+	}
+	readIFD := func(off uint32, visit func(tag uint16, entry []byte)) {
+		if uint64(off)+2 > uint64(len(tiff)) {
+			return
+		}
+		n := int(bo.Uint16(tiff[off:]))
+		for i := 0; i < n; i++ {
+			e := int(off) + 2 + i*12
+			if e+12 > len(tiff) {
+				return
+			}
+			visit(bo.Uint16(tiff[e:]), tiff[e:e+12])
+		}
+	}
+
+	var dateTime, original string
+	var exifIFD uint32
+	readIFD(bo.Uint32(tiff[4:]), func(tag uint16, entry []byte) {
+		switch tag {
+		case tagDateTime:
+			dateTime = ascii(entry)
+		case tagExifIFD:
+			exifIFD = bo.Uint32(entry[8:])
+		}
+	})
+	if exifIFD != 0 {
+		readIFD(exifIFD, func(tag uint16, entry []byte) {
+			if tag == tagDateTimeOriginal {
+				original = ascii(entry)
+			}
+		})
+	}
+
+	for _, v := range []string{original, dateTime} {
+		if t, err := time.ParseInLocation("2006:01:02 15:04:05", v, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
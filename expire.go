@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// With expire_action=archive, expired images are moved to archiveFolder,
+// keeping their place below the images folder.
+const archiveFolder = "archive"
+
+// expireImages drops the images dated more than expire_after_days ago, or
+// moves them to the archive folder, and returns the rest. Archived images
+// are gone from the images folder, so the removed webhook fires for them.
+func expireImages(metas []imageMeta, cfg config, md metadata, failed *imageFailures) ([]imageMeta, error) {
+	cutoff := time.Now().AddDate(0, 0, -cfg.expireAfterDays)
+	out := metas[:0]
+	var expired []string
+	for _, m := range metas {
+		if t := sourceDate(m, cfg); t.IsZero() || !t.Before(cutoff) {
+			out = append(out, m)
+			continue
+		}
+		if cfg.expireAction == "archive" {
+			// Left in the images folder, but still excluded
+			if err := archiveImage(md, m.source); err != nil {
+				if err := failed.add(m.relPath, "failure.archive", errorf("expire.archive_failed", err)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+		expired = append(expired, m.relPath)
+	}
+	if len(expired) == 0 {
+		return out, nil
+	}
+
+	if cfg.expireAction == "archive" {
+		if err := saveMetadata(md); err != nil {
+			return nil, err
+		}
+		slog.Info(msg("expire.archived", len(expired), cfg.expireAfterDays, archiveFolder))
+	} else {
+		slog.Info(msg("expire.excluded", len(expired), cfg.expireAfterDays))
+	}
+	for _, path := range expired {
+		slog.Info("  " + path)
+	}
+	return out, nil
+}
+
+// archiveImage moves an image (or sequence folder) from the images folder
+// to the same place in the archive folder, along with its caption.
+func archiveImage(md metadata, path string) error {
+	rel, err := filepath.Rel(imageFolder, path)
+	if strings.HasPrefix(rel, "..") {
+		// From a source, whose folder is kept in the archive
+		rel, err = filepath.Rel(".", path)
+	}
+	if err != nil {
+		rel = filepath.Base(path)
+	}
+	dir := filepath.Join(archiveFolder, filepath.Dir(rel))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	info := md.info(path)
+	dest := uniquePath(dir, filepath.Base(path))
+	if err := os.Rename(path, dest); err != nil {
+		return err
+	}
+	md.set(path, imageInfo{})
+	md.set(dest, info)
+	return nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"log/slog"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// exportExtensions are the formats -format writes besides html, by the
+// extension of the file they are written to next to outputFile.
+var exportExtensions = map[string]string{
+	"rss":      ".xml",
+	"markdown": ".md",
+	"json":     ".json",
+}
+
+// exportFile is where the given format is written, e.g. photo.xml.
+func exportFile(format string) string {
+	return strings.TrimSuffix(outputFile, filepath.Ext(outputFile)) + exportExtensions[format]
+}
+
+// exportedImage is one image of a gallery export.
+type exportedImage struct {
+	Path        string     `json:"path"` // in the images folder
+	URL         string     `json:"url"`  // of the file the slider shows, see exportURL
+	Author      string     `json:"author"`
+	Title       string     `json:"title"`
+	Translation string     `json:"translation,omitempty"`
+	Link        string     `json:"link,omitempty"` // artist's page
+	Width       int        `json:"width"`
+	Height      int        `json:"height"`
+	Date        *time.Time `json:"date,omitempty"`
+	size        int64      // of the shown file, for RSS enclosures
+	full        string     // the image at full size, watermarked if stamped, for export-site
+	hash        string
+}
+
+// exportedGallery is what the json format writes.
+type exportedGallery struct {
+	Title     string          `json:"title"`
+	Generated time.Time       `json:"generated"`
+	Images    []exportedImage `json:"images"`
+}
+
+// exportText is the plain text of a caption part, which is HTML with <br>
+// for line breaks in the page.
+func exportText(s string) string {
+	return captionText(s)
+}
+
+// exportURL is the address of path once the folder with the page is
+// published at export_base_url, or path itself without one.
+func exportURL(path string, cfg config) string {
+	escaped := (&url.URL{Path: path}).EscapedPath()
+	if cfg.exportBaseURL == "" {
+		return escaped
+	}
+	return strings.TrimSuffix(cfg.exportBaseURL, "/") + "/" + escaped
+}
+
+// exportGallery lists the images of metas with plain text captions, in the
+// order the slider shows them. Flipbook tiles are left out, as their sprite
+// sheets are no picture to look at on their own.
+func exportGallery(metas []imageMeta, cfg config) exportedGallery {
+	g := exportedGallery{Generated: time.Now()}
+	for _, m := range metas {
+		if m.frames > 0 {
+			continue
+		}
+		e := exportedImage{
+			Path:   m.relPath,
+			URL:    exportURL(m.src(), cfg),
+			Title:  exportText(m.title),
+			Link:   m.link,
+			Width:  m.width,
+			Height: m.height,
+			full:   m.relPath,
+			hash:   m.hash,
+		}
+		if m.stamped != "" {
+			e.full = m.stamped
+		}
+		if cfg.includeAuthor {
+			e.Author = exportText(m.author)
+		}
+		if t := exportText(m.translation); t != e.Title {
+			e.Translation = t
+		}
+		if !m.date.IsZero() {
+			e.Date = &m.date
+		}
+		if info, err := os.Stat(m.src()); err == nil {
+			e.size = info.Size()
+		}
+		g.Images = append(g.Images, e)
+	}
+	g.Title = heroTitle(cfg, len(g.Images))
+	return g
+}
+
+// writeExport writes the images of metas to exportFile in the given format
+// instead of the page.
+func writeExport(format string, metas []imageMeta, cfg config) error {
+	g := exportGallery(metas, cfg)
+	var content []byte
+	var err error
+	switch format {
+	case "rss":
+		content, err = rssFeed(g, cfg)
+	case "markdown":
+		content = markdownGallery(g)
+	case "json":
+		content, err = json.MarshalIndent(g, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	path := exportFile(format)
+	if err := writeFileAtomic(path, content); err != nil {
+		return err
+	}
+	slog.Info(msg("generate.exported", path, countNoun(len(g.Images), "count.image")))
+	return nil
+}
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string       `xml:"title"`
+	Link        string       `xml:"link"`
+	Description string       `xml:"description"`
+	Author      string       `xml:"dc:creator,omitempty"`
+	GUID        rssGUID      `xml:"guid"`
+	PubDate     string       `xml:"pubDate,omitempty"`
+	Enclosure   rssEnclosure `xml:"enclosure"`
+}
+
+type rssGUID struct {
+	PermaLink bool   `xml:"isPermaLink,attr"`
+	Value     string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// rssFeed is an RSS 2.0 feed with an item per image, linking to the
+// artist's page where one is set. Feed readers expect absolute links, so it
+// is only useful with export_base_url.
+func rssFeed(g exportedGallery, cfg config) ([]byte, error) {
+	channel := rssChannel{
+		Title:         g.Title,
+		Link:          cfg.exportBaseURL,
+		Description:   g.Title,
+		LastBuildDate: g.Generated.Format(time.RFC1123Z),
+	}
+	for _, e := range g.Images {
+		item := rssItem{
+			Title:     e.Title,
+			Link:      e.Link,
+			Author:    e.Author,
+			GUID:      rssGUID{PermaLink: true, Value: e.URL},
+			Enclosure: rssEnclosure{URL: e.URL, Length: e.size, Type: mime.TypeByExtension(filepath.Ext(e.URL))},
+		}
+		if item.Link == "" {
+			item.Link = e.URL
+		}
+		if item.Title == "" {
+			item.Title = filepath.Base(e.Path)
+		}
+		if e.Date != nil {
+			item.PubDate = e.Date.Format(time.RFC1123Z)
+		}
+		description := fmt.Sprintf(`<img src="%s" alt="%s">`, html.EscapeString(e.URL), html.EscapeString(e.Title))
+		if e.Author != "" {
+			description += "<p>" + html.EscapeString(e.Author) + "</p>"
+		}
+		if e.Translation != "" {
+			description += "<p><i>" + html.EscapeString(e.Translation) + "</i></p>"
+		}
+		item.Description = description
+		channel.Items = append(channel.Items, item)
+	}
+	content, err := xml.MarshalIndent(rssDocument{Version: "2.0", Channel: channel}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	// encoding/xml can't declare the namespace of dc:creator on its own
+	content = bytes.Replace(content, []byte(`<rss version="2.0">`), []byte(`<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/">`), 1)
+	return append([]byte(xml.Header), append(content, '\n')...), nil
+}
+
+// markdownEscaper keeps caption text from being read as Markdown.
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "`", "\\`", "<", `\<`, ">", `\>`, "#", `\#`)
+
+// markdownGallery is a Markdown page with every image and its credit, e.g.
+// to include in a static site.
+func markdownGallery(g exportedGallery) []byte {
+	// Parentheses in an artist's link would end it early
+	link := strings.NewReplacer("(", "%28", ")", "%29")
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", markdownEscaper.Replace(g.Title))
+	for _, e := range g.Images {
+		title := markdownEscaper.Replace(e.Title)
+		fmt.Fprintf(&b, "\n![%s](<%s>)\n\n", title, e.URL)
+		credit := "**" + title + "**"
+		if title == "" {
+			credit = ""
+		}
+		if e.Author != "" {
+			author := markdownEscaper.Replace(e.Author)
+			if e.Link != "" {
+				author = "[" + author + "](" + link.Replace(e.Link) + ")"
+			}
+			credit = strings.TrimSpace(msg("export.by", credit, author))
+		}
+		if credit != "" {
+			b.WriteString(credit + "\n")
+		}
+		if e.Translation != "" {
+			fmt.Fprintf(&b, "*%s*\n", markdownEscaper.Replace(e.Translation))
+		}
+	}
+	return []byte(b.String())
+}
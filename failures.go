@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// imageFailure is a step of the generation that failed for one image.
+type imageFailure struct {
+	path string
+	step string // message key saying what failed, e.g. failure.read
+	err  error
+}
+
+// imageFailures collects what went wrong with single images during a run,
+// which then goes on with the rest of the gallery and reports them at its
+// end. With -strict the first failure ends the run instead.
+type imageFailures struct {
+	strict bool
+	list   []imageFailure
+}
+
+// add records that step failed for the image at path. With -strict it
+// returns the error that ends the run.
+func (f *imageFailures) add(path, step string, err error) error {
+	if f.strict {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	f.list = append(f.list, imageFailure{path: path, step: step, err: err})
+	return nil
+}
+
+// drop leaves out the images of metas that errs has an error for, adding
+// each as a failure of step.
+func (f *imageFailures) drop(metas []imageMeta, errs []error, step string) ([]imageMeta, error) {
+	out := metas[:0]
+	for i, m := range metas {
+		if errs[i] == nil {
+			out = append(out, m)
+			continue
+		}
+		if err := f.add(m.relPath, step, errs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// report lists the failures, one line per failed step.
+func (f *imageFailures) report() {
+	if len(f.list) == 0 {
+		return
+	}
+	images := map[string]bool{}
+	for _, x := range f.list {
+		images[x.path] = true
+	}
+	slog.Warn(msg("failure.summary", countNoun(len(images), "count.image")))
+	for _, x := range f.list {
+		slog.Warn(fmt.Sprintf("  %s: %s (%v)", x.path, msg(x.step), x.err))
+	}
+}
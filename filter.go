@@ -0,0 +1,87 @@
+package main
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// pathFilter decides which files in the images folder are used, based on
+// the include and exclude glob patterns from the config.
+//
+// Patterns are matched against the path relative to the images folder,
+// using forward slashes. "**" matches any number of folders, and a pattern
+// without a slash matches the file name in any folder.
+type pathFilter struct {
+	include []string
+	exclude []string
+	folders []string // subfolders read along with the images folder, from mix_ratio
+	within  string   // only use files in this subfolder, from folder
+}
+
+// allows reports whether the file at p (a path inside the images folder)
+// should be used.
+func (f pathFilter) allows(p string) bool {
+	rel, err := filepath.Rel(imageFolder, p)
+	if err != nil {
+		rel = p
+	}
+	rel = filepath.ToSlash(rel)
+	if f.within != "" && !strings.HasPrefix(rel, f.within+"/") {
+		return false
+	}
+	for _, pattern := range f.exclude {
+		if matchGlob(pattern, rel) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, pattern := range f.include {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchGlob(pattern, rel string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// splitList splits a comma separated config value.
+func splitList(value string) []string {
+	var out []string
+	for _, p := range strings.Split(value, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, rel string
+		want         bool
+	}{
+		{"*.png", "a.png", true},
+		{"*.png", "fanart/a.png", true},
+		{"*.png", "a.jpg", false},
+		{"a?.png", "ab.png", true},
+		{"[ab].png", "c.png", false},
+		{"fanart/*.png", "fanart/a.png", true},
+		{"fanart/*.png", "fanart/old/a.png", false},
+		{"fanart/*.png", "a.png", false},
+		{"*/a.png", "fanart/a.png", true},
+		{"**/a.png", "a.png", true},
+		{"**/a.png", "fanart/old/a.png", true},
+		{"fanart/**", "fanart/a.png", true},
+		{"fanart/**", "fanart/old/2024/a.png", true},
+		{"fanart/**", "memes/a.png", false},
+		{"fanart/**/*.gif", "fanart/a.gif", true},
+		{"fanart/**/*.gif", "fanart/old/2024/a.gif", true},
+		{"fanart/**/*.gif", "fanart/old/a.png", false},
+		{"**/old/**", "fanart/old/a.png", true},
+		{"**/old/**", "old/a.png", true},
+		{"**/old/**", "fanart/older/a.png", false},
+		{"fanart/**/old", "fanart/old/a.png", false},
+	} {
+		if got := matchGlob(tt.pattern, tt.rel); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestPathFilter(t *testing.T) {
+	f := pathFilter{
+		include: []string{"*.png", "fanart/**"},
+		exclude: []string{"**/drafts/**", "*-wip.*"},
+	}
+	for _, tt := range []struct {
+		rel  string
+		want bool
+	}{
+		{"a.png", true},
+		{"a.jpg", false},
+		{"fanart/a.jpg", true},
+		{"fanart/old/a.jpg", true},
+		{"fanart/drafts/a.png", false},
+		{"drafts/a.png", false},
+		{"fanart/a-wip.jpg", false},
+		{"memes/a-wip.png", false},
+		{"memes/a.png", true},
+	} {
+		if got := f.allows(filepath.Join(imageFolder, filepath.FromSlash(tt.rel))); got != tt.want {
+			t.Errorf("allows(%q) = %v, want %v", tt.rel, got, tt.want)
+		}
+	}
+
+	within := pathFilter{within: "fanart"}
+	for rel, want := range map[string]bool{"fanart/a.png": true, "fanart/old/a.png": true, "a.png": false, "fanartist/a.png": false} {
+		if got := within.allows(filepath.Join(imageFolder, filepath.FromSlash(rel))); got != want {
+			t.Errorf("folder=fanart: allows(%q) = %v, want %v", rel, got, want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Google Fonts only serves woff2 files to browsers it knows support them.
+const fontUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+
+var fontDisplays = map[string]struct{}{"auto": {}, "block": {}, "swap": {}, "fallback": {}, "optional": {}}
+
+var fontFileURL = regexp.MustCompile(`url\((https://[^)]+)\)`)
+
+// notoEmoji is the Google Fonts family emoji_font=noto loads.
+const notoEmoji = "Noto Color Emoji"
+
+// emojiFonts are the font families each emoji_font value puts at the end
+// of the font stack. The system ones are whatever the OS has installed, so
+// they look different on Windows, macOS and Linux.
+var emojiFonts = map[string][]string{
+	"noto":   {notoEmoji},
+	"system": {"Segoe UI Emoji", "Apple Color Emoji", "Noto Color Emoji"},
+	"none":   nil,
+}
+
+// fontStack is the CSS font-family of captions: the theme font, then the
+// fallback fonts and the emoji font for the characters it doesn't have.
+func fontStack(cfg config) string {
+	var families []string
+	for _, spec := range append([]string{cfg.theme.font}, cfg.fontFallbacks...) {
+		family, _, _ := strings.Cut(spec, ":")
+		families = append(families, family)
+	}
+	families = append(families, emojiFonts[cfg.emojiFont]...)
+	var stack []string
+	for _, family := range families {
+		stack = append(stack, "\""+family+"\"")
+	}
+	return strings.Join(append(stack, "sans-serif"), ", ")
+}
+
+// fontURL is the Google Fonts stylesheet for the theme font and the
+// fallback fonts, plus the emoji font if the captions have emoji.
+func fontURL(cfg config) string {
+	specs := append([]string{cfg.theme.font}, cfg.fontFallbacks...)
+	if cfg.emojiFont == "noto" && cfg.hasEmoji {
+		specs = append(specs, notoEmoji)
+	}
+	url := "https://fonts.googleapis.com/css2?"
+	for _, spec := range specs {
+		url += "family=" + strings.ReplaceAll(spec, " ", "+") + "&"
+	}
+	return url + "display=" + cfg.fontDisplay
+}
+
+// hasEmoji reports whether text has a character that is usually shown as
+// an emoji.
+func hasEmoji(text string) bool {
+	for _, r := range text {
+		switch {
+		case r >= 0x1f000 && r <= 0x1faff, // pictographs, emoticons, flags
+			r >= 0x2600 && r <= 0x27bf, // symbols and dingbats
+			r >= 0x2300 && r <= 0x23ff, // ⌚ and ⏰
+			r >= 0x2b00 && r <= 0x2bff, // ⭐ and ⬆
+			r == 0xfe0f:                // asks for the emoji form of the character before
+			return true
+		}
+	}
+	return false
+}
+
+// fontCacheFile is where the stylesheet for url is kept with its font files
+// inlined, so the font only has to be downloaded once.
+func fontCacheFile(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(cacheFolder, "fonts", hex.EncodeToString(sum[:8])+".css")
+}
+
+// loadLocalFont returns the @font-face rules for the theme font with the
+// font files inlined as data URLs. The page then renders captions in the
+// right font on its first frame, without a network request. Only the
+// glyphs in text are included, which keeps the page small.
+func loadLocalFont(cfg config, text string) (string, error) {
+	url := fontURL(cfg) + "&text=" + neturl.QueryEscape(text)
+	path := fontCacheFile(url)
+	content, err := os.ReadFile(path)
+	if err == nil {
+		return string(content), nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", errorf("file.read", path, err)
+	}
+
+	client := http.Client{Timeout: 30 * time.Second}
+	css, err := fetchFont(client, url)
+	if err != nil {
+		return "", err
+	}
+	var fetchErr error
+	inlined := fontFileURL.ReplaceAllStringFunc(string(css), func(match string) string {
+		if fetchErr != nil {
+			return match
+		}
+		file := fontFileURL.FindStringSubmatch(match)[1]
+		data, err := fetchFont(client, file)
+		if err != nil {
+			fetchErr = err
+			return match
+		}
+		return "url(data:font/woff2;base64," + base64.StdEncoding.EncodeToString(data) + ")"
+	})
+	if fetchErr != nil {
+		return "", fetchErr
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", errorf("file.create_folder", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(inlined), 0o644); err != nil {
+		return "", errorf("file.write", path, err)
+	}
+	// Every new caption character makes a new subset, so only keep this one
+	if old, err := filepath.Glob(filepath.Join(filepath.Dir(path), "*.css")); err == nil {
+		for _, p := range old {
+			if p != path {
+				os.Remove(p)
+			}
+		}
+	}
+	return inlined, nil
+}
+
+// captionGlyphs returns every character the page may show in the theme
+// font: basic Latin plus the characters in the captions and the hero title,
+// sorted and without repeats.
+func captionGlyphs(metas []imageMeta, cfg config) string {
+	seen := map[rune]bool{}
+	for r := rune(' '); r <= '~'; r++ {
+		seen[r] = true
+	}
+	add := func(s string) {
+		for _, r := range html.UnescapeString(strings.ReplaceAll(s, "<br>", " ")) {
+			seen[r] = true
+		}
+	}
+	for _, m := range metas {
+		add(m.author)
+		add(m.title)
+		add(m.translation)
+		if cfg.captionFormat != "" {
+			add(formatCaption(cfg.captionFormat, m, cfg))
+		}
+	}
+	if cfg.endCredits {
+		add(html.EscapeString(cfg.endCreditsTitle))
+	}
+	if cfg.heroTile {
+		add(html.EscapeString(heroTitle(cfg, len(metas))))
+	}
+	if len(metas) == 0 {
+		add(html.EscapeString(cfg.placeholderText))
+	}
+
+	glyphs := make([]rune, 0, len(seen))
+	for r := range seen {
+		// Emoji sequences are joined by ZWJ and flags of regions spelled in tags
+		if unicode.IsGraphic(r) || r == 0x200d || (r >= 0xe0020 && r <= 0xe007f) {
+			glyphs = append(glyphs, r)
+		}
+	}
+	slices.Sort(glyphs)
+	return string(glyphs)
+}
+
+func fetchFont(client http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", fontUserAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorf("font.download", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// writeFontLinks loads the theme font: inline when local_font has fetched
+// it, from Google Fonts otherwise. The stylesheet is preloaded so the font
+// files are requested as early as possible.
+func writeFontLinks(w *bufio.Writer, cfg config) {
+	if cfg.fontCSS != "" {
+		mustWrite(w, "    <style>\n")
+		mustWrite(w, strings.TrimRight(cfg.fontCSS, "\n")+"\n")
+		mustWrite(w, "    </style>\n")
+		return
+	}
+	url := html.EscapeString(fontURL(cfg))
+	mustWrite(w, "    <link rel=\"preconnect\" href=\"https://fonts.googleapis.com\">\n")
+	mustWrite(w, "    <link rel=\"preconnect\" href=\"https://fonts.gstatic.com\" crossorigin>\n")
+	mustWrite(w, fmt.Sprintf("    <link rel=\"preload\" href=\"%s\" as=\"style\">\n", url))
+	mustWrite(w, fmt.Sprintf("    <link href=\"%s\" rel=\"stylesheet\">\n", url))
+}
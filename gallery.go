@@ -0,0 +1,191 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// galleryImage is one image on the gallery page.
+type galleryImage struct {
+	imageEntry
+	Thumb  string
+	Full   string
+	Search string // lower-case author and title, matched against the search box
+}
+
+// serveGallery answers GET /gallery with the images of the current
+// generation, in the order they scroll by, for viewers to browse on their
+// phone. It is public and read-only: hidden images and images that are
+// only waiting for review don't appear.
+func (s *server) serveGallery(w http.ResponseWriter, r *http.Request) {
+	cfg := s.config()
+	st, _, err := loadState()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	entries, err := listImages(cfg.filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	byPath := make(map[string]imageEntry, len(entries))
+	for _, e := range entries {
+		byPath[filepath.ToSlash(e.Path)] = e
+	}
+
+	list := make([]galleryImage, 0, len(st.Current))
+	for _, path := range st.Current {
+		// Sequences and images since removed aren't in the images folder
+		e, ok := byPath[path]
+		if !ok || e.Hidden {
+			continue
+		}
+		if !cfg.includeAuthor {
+			e.Author = ""
+		}
+		list = append(list, galleryImage{
+			imageEntry: e,
+			Thumb:      "/thumb/" + url.PathEscape(e.ID) + "?h=400",
+			Full:       (&url.URL{Path: "/" + e.Path}).EscapedPath(),
+			Search:     strings.ToLower(e.Author + " " + e.Title),
+		})
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	galleryTemplate.Execute(w, map[string]any{
+		"Title":  heroTitle(cfg, len(list)),
+		"Images": list,
+	})
+}
+
+var galleryTemplate = template.Must(template.New("gallery").Funcs(template.FuncMap{"msg": msg}).Parse(`<!DOCTYPE html>
+<html>
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>{{.Title}}</title>
+    <style>
+      body { font-family: sans-serif; margin: 0 auto; padding: 16px; max-width: 1200px; background: #111; color: #eee; }
+      h1 { margin: 0 0 12px; }
+      a { color: #90caf9; }
+      #search { width: 100%; box-sizing: border-box; padding: 10px; margin-bottom: 16px; font-size: 16px; border-radius: 6px; border: none; }
+      .images { display: grid; grid-template-columns: repeat(auto-fill, minmax(160px, 1fr)); gap: 12px; }
+      .image { margin: 0; }
+      .image img { width: 100%; height: 200px; object-fit: cover; border-radius: 6px; cursor: zoom-in; background: #222; display: block; }
+      .image figcaption, #lightbox figcaption { margin-top: 4px; font-size: 14px; }
+      .author { color: #aaa; }
+      .empty { color: #aaa; }
+      #lightbox { position: fixed; inset: 0; background: rgba(0, 0, 0, 0.92); display: none; flex-direction: column; align-items: center; justify-content: center; margin: 0; padding: 16px; box-sizing: border-box; }
+      #lightbox.shown { display: flex; }
+      #lightbox img { max-width: 100%; max-height: calc(100% - 64px); object-fit: contain; }
+      #lightbox figcaption { text-align: center; font-size: 16px; }
+      #lightbox button { position: absolute; background: none; border: none; color: #fff; font-size: 40px; padding: 8px 16px; cursor: pointer; }
+      #close { top: 0; right: 0; }
+      #prev { left: 0; top: 50%; }
+      #next { right: 0; top: 50%; }
+    </style>
+  </head>
+  <body>
+    <h1>{{.Title}}</h1>
+    <input id="search" type="search" placeholder="{{msg "gallery.search"}}">
+    <div class="images">
+      {{range .Images}}
+      <figure class="image" data-id="{{.ID}}" data-search="{{.Search}}">
+        <img src="{{.Thumb}}" data-full="{{.Full}}" loading="lazy" alt="{{.Title}}">
+        <figcaption>
+          <div>{{.Title}}</div>
+          {{if .Author}}<div class="author">{{if .Link}}<a href="{{.Link}}" target="_blank" rel="noopener">{{.Author}}</a>{{else}}{{.Author}}{{end}}</div>{{end}}
+        </figcaption>
+      </figure>
+      {{else}}
+      <p class="empty">{{msg "gallery.empty"}}</p>
+      {{end}}
+    </div>
+    <figure id="lightbox">
+      <button id="close" aria-label="{{msg "gallery.close"}}">&times;</button>
+      <button id="prev" aria-label="{{msg "gallery.previous"}}">&lsaquo;</button>
+      <img alt="">
+      <figcaption></figcaption>
+      <button id="next" aria-label="{{msg "gallery.next"}}">&rsaquo;</button>
+    </figure>
+    <script>
+      (function () {
+        var figures = Array.prototype.slice.call(document.querySelectorAll(".image"));
+        var box = document.getElementById("lightbox");
+        var current = -1;
+
+        document.getElementById("search").addEventListener("input", function () {
+          var q = this.value.trim().toLowerCase();
+          figures.forEach(function (f) {
+            f.style.display = f.dataset.search.indexOf(q) < 0 ? "none" : "";
+          });
+        });
+
+        // The lightbox steps through the images the search left visible
+        function visible() {
+          return figures.filter(function (f) { return f.style.display !== "none"; });
+        }
+
+        // Counted for the stats artists are shown, see apiClick
+        function track(figure, event) {
+          navigator.sendBeacon("/api/images/" + encodeURIComponent(figure.dataset.id) + "/clicks", JSON.stringify({ event: event }));
+        }
+
+        function open(figure) {
+          track(figure, "open");
+          var img = figure.querySelector("img");
+          current = visible().indexOf(figure);
+          box.querySelector("img").src = img.dataset.full;
+          box.querySelector("figcaption").innerHTML = figure.querySelector("figcaption").innerHTML;
+          box.className = "shown";
+        }
+
+        function step(by) {
+          var list = visible();
+          if (list.length) open(list[(current + by + list.length) % list.length]);
+        }
+
+        function close() {
+          box.className = "";
+          box.querySelector("img").removeAttribute("src");
+        }
+
+        figures.forEach(function (f) {
+          f.querySelector("img").addEventListener("click", function () { open(f); });
+        });
+        // Links in the lightbox are copies, so they count for the image shown
+        document.addEventListener("click", function (e) {
+          var link = e.target.closest(".author a");
+          var figure = link && (link.closest(".image") || visible()[current]);
+          if (figure) track(figure, "link");
+        });
+        document.getElementById("close").addEventListener("click", close);
+        document.getElementById("prev").addEventListener("click", function () { step(-1); });
+        document.getElementById("next").addEventListener("click", function () { step(1); });
+        box.addEventListener("click", function (e) {
+          if (e.target === box) close();
+        });
+        document.addEventListener("keydown", function (e) {
+          if (!box.className) return;
+          if (e.key === "Escape") close();
+          if (e.key === "ArrowLeft") step(-1);
+          if (e.key === "ArrowRight") step(1);
+        });
+
+        // Swipe left and right on phones
+        var startX = null;
+        box.addEventListener("touchstart", function (e) { startX = e.touches[0].clientX; });
+        box.addEventListener("touchend", function (e) {
+          if (startX === null) return;
+          var dx = e.changedTouches[0].clientX - startX;
+          startX = null;
+          if (Math.abs(dx) > 50) step(dx < 0 ? 1 : -1);
+        });
+      })();
+    </script>
+  </body>
+</html>
+`))
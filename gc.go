@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// cacheReference finds paths into the cache folder in a page, once it is
+// unescaped: they are all quoted, in attributes, url() values and the tile
+// list of output_mode=compact. A query or fragment isn't part of the path.
+var cacheReference = regexp.MustCompile(cacheFolder + `/[^"<>\\?#]+`)
+
+// jsonUnescaper undoes the escaping of &, < and > by encoding/json in the
+// tile list of output_mode=compact.
+var jsonUnescaper = strings.NewReplacer(`\u0026`, "&", `\u003c`, "<", `\u003e`, ">")
+
+// pageAssetFolders are the folders in the cache folder that hold what pages
+// show, as opposed to what only speeds up generating (such as build.json or
+// fonts).
+func pageAssetFolders() []string {
+	return []string{optimizeFolder(), watermarkFolder(), filepath.Join(cacheFolder, "sequences"), audioFolder(), backgroundFolder(), placeholderFolder(), animationFolder()}
+}
+
+// pageAssets are the files in the cache folder that pages show.
+func pageAssets() []string {
+	var files []string
+	for _, dir := range pageAssetFolders() {
+		found, _ := filepath.Glob(filepath.Join(dir, "*"))
+		files = append(files, found...)
+	}
+	// The hero mosaic, and the one of previews
+	heroes, _ := filepath.Glob(filepath.Join(cacheFolder, "hero*.png"))
+	return append(files, heroes...)
+}
+
+// retainedPages are the generated pages that may be shown again: the
+// output, the copy of it kept for the error page, its variants for other
+// source sizes and the backups of both. Exports count too, as they link to
+// the watermarked and optimized copies.
+func retainedPages() ([]string, error) {
+	backups, err := listBackups(outputFile)
+	if err != nil {
+		return nil, err
+	}
+	pages := []string{outputFile, lastGoodFile(outputFile)}
+	for format := range exportExtensions {
+		pages = append(pages, exportFile(format))
+	}
+	pages = append(pages, sourceSizeFiles()...)
+	for _, backup := range backups {
+		pages = append(append(pages, backup), variantBackups(backup)...)
+	}
+	return pages, nil
+}
+
+// referencedAssets returns the cache paths the retained pages refer to.
+func referencedAssets() (map[string]bool, error) {
+	pages, err := retainedPages()
+	if err != nil {
+		return nil, err
+	}
+	refs := map[string]bool{}
+	for _, page := range pages {
+		content, err := os.ReadFile(page)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, errorf("file.read", page, err)
+		}
+		text := jsonUnescaper.Replace(html.UnescapeString(string(content)))
+		for _, ref := range cacheReference.FindAllString(text, -1) {
+			refs[filepath.FromSlash(ref)] = true
+		}
+	}
+	return refs, nil
+}
+
+// collectGarbage removes the page assets that no retained page refers to
+// any more, such as optimized copies of deleted images, and returns them
+// with their total size. With dryRun it only returns them.
+func collectGarbage(dryRun bool) ([]string, int64, error) {
+	refs, err := referencedAssets()
+	if err != nil {
+		return nil, 0, err
+	}
+	var removed []string
+	var size int64
+	for _, path := range pageAssets() {
+		if refs[path] {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				return removed, size, err
+			}
+		}
+		removed = append(removed, path)
+		size += info.Size()
+	}
+	slices.Sort(removed)
+	return removed, size, nil
+}
+
+// sweepAssets is collectGarbage after a generation. A failure only means
+// some disk space isn't freed yet, so it is reported, not returned.
+func sweepAssets() {
+	removed, size, err := collectGarbage(false)
+	if err != nil {
+		slog.Warn(msg("gc.failed", err))
+	}
+	for _, path := range removed {
+		slog.Debug(msg("gc.removed", path))
+	}
+	if len(removed) > 0 {
+		slog.Info(msg("gc.done", countNoun(len(removed), "count.file"), megabytes(size)))
+	}
+}
+
+// runGC implements the "gc" command, which removes the cached copies and
+// other files in the cache folder that neither the output nor its backups
+// show.
+func runGC(args []string) error {
+	fset := flag.NewFlagSet("gc", flag.ContinueOnError)
+	dryRun := fset.Bool("dry-run", false, "only list the files that would be removed")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	removed, size, err := collectGarbage(*dryRun)
+	key, doneKey := "gc.removed", "gc.done"
+	if *dryRun {
+		key, doneKey = "gc.would_remove", "gc.would_free"
+	}
+	for _, path := range removed {
+		fmt.Println(msg(key, path))
+	}
+	if err != nil {
+		return err
+	}
+	if len(removed) == 0 {
+		fmt.Println(msg("gc.nothing"))
+		return nil
+	}
+	fmt.Println(msg(doneKey, countNoun(len(removed), "count.file"), megabytes(size)))
+	return nil
+}
+
+// megabytes formats a file size for messages.
+func megabytes(size int64) string {
+	return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+}
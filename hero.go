@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"image"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	heroWidth  = 1600
+	heroHeight = 900
+)
+
+// heroFile is where the mosaic is rendered to. Preview pages get their own,
+// so they don't change the live page's.
+func heroFile(cfg config) string {
+	if cfg.previewOutput != "" {
+		return filepath.Join(cacheFolder, "hero-preview.png")
+	}
+	return filepath.Join(cacheFolder, "hero.png")
+}
+
+// renderHero composites a mosaic of every decodable image into a single PNG.
+// Images that can't be decoded (e.g. WebP) leave their cell empty.
+func renderHero(path string, metas []imageMeta, cfg config) error {
+	n := len(metas)
+	cols := int(math.Ceil(math.Sqrt(float64(n) * heroWidth / heroHeight)))
+	rows := (n + cols - 1) / cols
+	cellW, cellH := heroWidth/cols, heroHeight/rows
+
+	canvas := image.NewRGBA(image.Rect(0, 0, cellW*cols, cellH*rows))
+	draw.Draw(canvas, canvas.Bounds(), image.Black, image.Point{}, draw.Src)
+	// Every cell is drawn by one worker, so they don't get in each other's way
+	parallel(msg("progress.hero"), n, cfg.workers, func(worker, i int) {
+		m := metas[i]
+		defer traceSpanOn(worker, traceProcessing, "hero cell", "path", m.relPath)()
+		src, err := decodeImage(m.relPath, cfg.limits)
+		if err != nil {
+			return
+		}
+		x, y := (i%cols)*cellW, (i/cols)*cellH
+		drawCover(canvas, image.Rect(x, y, x+cellW, y+cellH), src, m.focus)
+	})
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return errorf("file.create_folder", filepath.Dir(path), err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return errorf("file.create", path, err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, canvas); err != nil {
+		return errorf("file.encode", path, err)
+	}
+	return nil
+}
+
+// drawCover scales src to fill r, cropping the overflow evenly on both sides,
+// or around focus if set. Sampling is nearest-neighbour, which is plenty for
+// thumbnail-sized cells.
+func drawCover(dst *image.RGBA, r image.Rectangle, src image.Image, focus *focusPoint) {
+	sb := src.Bounds()
+	scale := math.Max(float64(r.Dx())/float64(sb.Dx()), float64(r.Dy())/float64(sb.Dy()))
+	fx, fy := 0.5, 0.5
+	if focus != nil {
+		fx, fy = focus.X, focus.Y
+	}
+	// Center the crop on the focal point, without going past the edges
+	cropW, cropH := float64(r.Dx())/scale, float64(r.Dy())/scale
+	offX := math.Min(math.Max(fx*float64(sb.Dx())-cropW/2, 0), float64(sb.Dx())-cropW)
+	offY := math.Min(math.Max(fy*float64(sb.Dy())-cropH/2, 0), float64(sb.Dy())-cropH)
+	for y := 0; y < r.Dy(); y++ {
+		sy := sb.Min.Y + int(offY+float64(y)/scale)
+		for x := 0; x < r.Dx(); x++ {
+			sx := sb.Min.X + int(offX+float64(x)/scale)
+			dst.Set(r.Min.X+x, r.Min.Y+y, src.At(sx, sy))
+		}
+	}
+}
+
+func writeHeroStyle(w *bufio.Writer, cfg config) {
+	mustWrite(w, "      #permas .hero {\n")
+	mustWrite(w, "        position: relative;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #permas .hero-title {\n")
+	mustWrite(w, "        position: absolute;\n")
+	mustWrite(w, fmt.Sprintf("        top: %dpx;\n", cfg.px(imageHeight/2)))
+	mustWrite(w, "        left: 0;\n")
+	mustWrite(w, "        right: 0;\n")
+	mustWrite(w, "        transform: translateY(-50%);\n")
+	mustWrite(w, fmt.Sprintf("        font-family: %s;\n", fontStack(cfg)))
+	mustWrite(w, fmt.Sprintf("        font-size: %dpx;\n", cfg.px(64)))
+	mustWrite(w, "        white-space: normal;\n")
+	mustWrite(w, fmt.Sprintf("        color: %s;\n", cfg.theme.authorTextColor))
+	mustWrite(w, fmt.Sprintf("        -webkit-text-stroke: %dpx %s;\n", cfg.px(12), cfg.theme.authorStrokeColor))
+	mustWrite(w, "        paint-order: stroke fill;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+}
+
+// heroTitle is the hero_title text for a gallery of count images.
+func heroTitle(cfg config, count int) string {
+	return strings.ReplaceAll(cfg.heroTitle, "{count}", formatCount(count))
+}
+
+func writeHeroContainer(w *bufio.Writer, count int, cfg config) {
+	title := heroTitle(cfg, count)
+	mustWrite(w, "        <div class=\"image-container hero\">\n")
+	// The mosaic only repeats the images, the title says what it is
+	mustWrite(w, fmt.Sprintf("          <img class=\"scroller\" src=\"%s\" alt=\"\">\n", html.EscapeString(filepath.ToSlash(heroFile(cfg)))))
+	mustWrite(w, fmt.Sprintf("          <div class=\"hero-title\">%s</div>\n", html.EscapeString(title)))
+	mustWrite(w, "        </div>\n")
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// runHide implements the "hide" and "show" commands, which take images out
+// of the slider and put them back, like the Hide and Show buttons of the
+// admin page. The files stay where they are and keep their captions, links
+// and focal points. Without arguments, "hide" lists the hidden images.
+func runHide(args []string, hidden bool) error {
+	name := "show"
+	if hidden {
+		name = "hide"
+	}
+	fset := flag.NewFlagSet(name, flag.ContinueOnError)
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := readConfig()
+	if err != nil {
+		return err
+	}
+	if fset.NArg() == 0 {
+		if !hidden {
+			return errors.New(msg("hide.usage"))
+		}
+		return listHidden(cfg)
+	}
+
+	lock, err := acquireLock(name)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+	md, err := loadMetadata()
+	if err != nil {
+		return err
+	}
+	var changed []imageEntry
+	for _, arg := range fset.Args() {
+		// Paths as typed or tab-completed work as well as paths in images/
+		id := filepath.ToSlash(filepath.Clean(arg))
+		id = strings.TrimPrefix(id, imageFolder+"/")
+		e, err := findImage(cfg.filter, id)
+		if err != nil {
+			return err
+		}
+		if e.Hidden == hidden {
+			key := "hide.already_shown"
+			if hidden {
+				key = "hide.already_hidden"
+			}
+			fmt.Println(msg(key, e.Path))
+			continue
+		}
+		info := md.info(e.Path)
+		info.Hidden = hidden
+		md.set(e.Path, info)
+		changed = append(changed, e)
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	if err := saveMetadata(md); err != nil {
+		return err
+	}
+	for _, e := range changed {
+		key := "hide.shown"
+		if hidden {
+			key = "hide.hidden"
+		}
+		fmt.Println(msg(key, e.Path))
+	}
+	fmt.Println(msg("hide.next_generation", outputFile))
+	return nil
+}
+
+func listHidden(cfg config) error {
+	entries, err := listImages(cfg.filter)
+	if err != nil {
+		return err
+	}
+	var hidden []string
+	for _, e := range entries {
+		if e.Hidden {
+			hidden = append(hidden, e.Path)
+		}
+	}
+	if len(hidden) == 0 {
+		fmt.Println(msg("hide.none"))
+		return nil
+	}
+	fmt.Println(msg("hide.list", countNoun(len(hidden), "count.image")))
+	for _, path := range hidden {
+		fmt.Println("  " + path)
+	}
+	return nil
+}
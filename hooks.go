@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The points of a generation where hook commands run, configured with
+// hook_<point>. Hooks are external programs rather than Go plugins, which
+// don't work on Windows.
+const (
+	hookPreScan      = "pre_scan"      // before the images folder is read
+	hookPerImage     = "per_image"     // for every image, see runImageHooks
+	hookPostGenerate = "post_generate" // after the page was written
+)
+
+// hooksFile caches what per_image hooks printed, so each only runs once
+// for an image with a given caption.
+func hooksFile() string {
+	return filepath.Join(cacheFolder, "hooks.json")
+}
+
+// hookedImage is what a per_image hook gets on stdin, and post_generate for
+// every image.
+type hookedImage struct {
+	Path   string     `json:"path"`
+	Author string     `json:"author"`
+	Title  string     `json:"title"`
+	Link   string     `json:"link,omitempty"`
+	Width  int        `json:"width,omitempty"`
+	Height int        `json:"height,omitempty"`
+	Hash   string     `json:"hash,omitempty"`
+	Date   *time.Time `json:"date,omitempty"`
+}
+
+func newHookedImage(m imageMeta) hookedImage {
+	h := hookedImage{Path: m.relPath, Author: exportText(m.author), Title: exportText(m.title), Link: m.link, Width: m.width, Height: m.height, Hash: m.hash}
+	if !m.date.IsZero() {
+		h.Date = &m.date
+	}
+	return h
+}
+
+// hookResult is what a per_image hook may print on stdout: whether to
+// leave the image out, e.g. for a content filter, and captions to use
+// instead, e.g. generated ones. Printing nothing changes nothing.
+type hookResult struct {
+	Skip   bool    `json:"skip,omitempty"`
+	Reason string  `json:"reason,omitempty"`
+	Author *string `json:"author,omitempty"`
+	Title  *string `json:"title,omitempty"`
+	Link   *string `json:"link,omitempty"`
+}
+
+// splitCommand splits a command from the config into the program and its
+// arguments at spaces, except within double or single quotes, so a program
+// under C:\Program Files can be run. Backslashes are kept as they are, as
+// in Windows paths.
+func splitCommand(command string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	var quote rune
+	inArg := false
+	for _, r := range command {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errorf("hook.missing_quote", quote, command)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// runHook runs command for point with input on stdin and arg as its last
+// argument, and returns what it printed. It is told the point in
+// PHOTO_SLIDER_HOOK.
+func runHook(point, command string, input []byte, arg string) ([]byte, error) {
+	args, err := splitCommand(command)
+	if err != nil {
+		return nil, fmt.Errorf("hook_%s: %w", point, err)
+	}
+	if len(args) == 0 {
+		return nil, errorf("hook.empty", point)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], append(args[1:], arg)...)
+	cmd.Env = append(os.Environ(), "PHOTO_SLIDER_HOOK="+point)
+	cmd.Stdin = bytes.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if detail := strings.TrimSpace(stderr.String()); detail != "" {
+			err = fmt.Errorf("%w: %s", err, detail)
+		}
+		return nil, errorf("hook.run", point, args[0], err)
+	}
+	return out, nil
+}
+
+// logHookOutput shows what a pre_scan or post_generate hook printed.
+func logHookOutput(point string, out []byte) {
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			slog.Info(msg("hook.output", point, line))
+		}
+	}
+}
+
+// runPreScanHooks runs the pre_scan hooks with the images folder as their
+// argument, e.g. to fetch new submissions or upscale small images before
+// they are read. A failing hook is reported and the run goes on, unless
+// with -strict.
+func runPreScanHooks(cfg config) error {
+	for _, command := range cfg.hooks[hookPreScan] {
+		out, err := runHook(hookPreScan, command, nil, imageFolder)
+		if err != nil {
+			if cfg.strict {
+				return err
+			}
+			slog.Warn(msg("hook.failed", err))
+			continue
+		}
+		logHookOutput(hookPreScan, out)
+	}
+	return nil
+}
+
+// runPostGenerateHooks runs the post_generate hooks with the page as their
+// argument and the images on it as a JSON list on stdin, e.g. to upload
+// the page.
+func runPostGenerateHooks(metas []imageMeta, cfg config) error {
+	if len(cfg.hooks[hookPostGenerate]) == 0 {
+		return nil
+	}
+	images := make([]hookedImage, len(metas))
+	for i, m := range metas {
+		images[i] = newHookedImage(m)
+	}
+	input, err := json.Marshal(images)
+	if err != nil {
+		return err
+	}
+	for _, command := range cfg.hooks[hookPostGenerate] {
+		out, err := runHook(hookPostGenerate, command, input, outputFile)
+		if err != nil {
+			if cfg.strict {
+				return err
+			}
+			slog.Warn(msg("hook.failed", err))
+			continue
+		}
+		logHookOutput(hookPostGenerate, out)
+	}
+	return nil
+}
+
+// hookCache maps a hash of a per_image hook command and its input to what
+// it printed.
+type hookCache map[string]hookResult
+
+func loadHookCache() (hookCache, error) {
+	c := hookCache{}
+	content, err := os.ReadFile(hooksFile())
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, errorf("file.read", hooksFile(), err)
+	}
+	if err := json.Unmarshal(content, &c); err != nil {
+		return nil, errorf("file.parse", hooksFile(), err)
+	}
+	return c, nil
+}
+
+func saveHookCache(c hookCache) error {
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cacheFolder, 0o755); err != nil {
+		return errorf("file.create_folder", cacheFolder, err)
+	}
+	return writeFileAtomic(hooksFile(), content)
+}
+
+// runImageHooks runs the per_image hooks for every image of metas (flipbooks
+// aside) with its path as the argument and its details as JSON on stdin,
+// in order, each seeing the captions the one before gave. It returns the
+// images no hook left out. Images a hook fails for are left out too, as a
+// filter that couldn't check an image mustn't let it through.
+//
+// What a hook printed is kept in hooksFile, so it runs again only when the
+// image or its caption changes.
+func runImageHooks(metas []imageMeta, cfg config, failed *imageFailures) ([]imageMeta, error) {
+	commands := cfg.hooks[hookPerImage]
+	if len(commands) == 0 {
+		return metas, nil
+	}
+	cache, err := loadHookCache()
+	if err != nil {
+		return nil, err
+	}
+	var mu sync.Mutex
+	ran := 0
+	skip := make([]string, len(metas))
+	errs := make([]error, len(metas))
+	parallel(msg("progress.hooks"), len(metas), cfg.workers, func(worker, i int) {
+		m := &metas[i]
+		if m.frames > 0 {
+			return
+		}
+		for _, command := range commands {
+			input, err := json.Marshal(newHookedImage(*m))
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			sum := sha256.Sum256(append([]byte(command+"\n"), input...))
+			key := hex.EncodeToString(sum[:16])
+			mu.Lock()
+			r, ok := cache[key]
+			mu.Unlock()
+			if !ok {
+				done := traceSpanOn(worker, traceProcessing, "per_image hook", "path", m.relPath)
+				out, err := runHook(hookPerImage, command, input, m.relPath)
+				done()
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				if out := bytes.TrimSpace(out); len(out) > 0 {
+					if err := json.Unmarshal(out, &r); err != nil {
+						errs[i] = errorf("hook.bad_json", hookPerImage, command, err)
+						return
+					}
+				}
+				mu.Lock()
+				cache[key] = r
+				ran++
+				mu.Unlock()
+			}
+			if r.Skip {
+				skip[i] = cmp.Or(r.Reason, command)
+				return
+			}
+			if r.Author != nil {
+				m.author = html.EscapeString(*r.Author)
+			}
+			if r.Title != nil {
+				m.title = html.EscapeString(*r.Title)
+			}
+			if r.Link != nil {
+				m.link = *r.Link
+			}
+		}
+	})
+	if ran > 0 {
+		if err := saveHookCache(cache); err != nil {
+			return nil, err
+		}
+	}
+
+	out := metas[:0]
+	var skipped []string
+	for i, m := range metas {
+		switch {
+		case errs[i] != nil:
+			if err := failed.add(m.relPath, "failure.hook", errs[i]); err != nil {
+				return nil, err
+			}
+		case skip[i] != "":
+			skipped = append(skipped, fmt.Sprintf("  %s (%s)", m.relPath, skip[i]))
+		default:
+			out = append(out, m)
+		}
+	}
+	if len(skipped) > 0 {
+		slog.Info(msg("hook.skipped", countNoun(len(skipped), "count.image")))
+		for _, line := range skipped {
+			slog.Info(line)
+		}
+	}
+	return out, nil
+}
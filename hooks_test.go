@@ -0,0 +1,33 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	for _, tc := range []struct {
+		command string
+		want    []string
+	}{
+		{"python nsfw_check.py", []string{"python", "nsfw_check.py"}},
+		{"  sh   upload.sh  ", []string{"sh", "upload.sh"}},
+		{`"C:\Program Files\Python\python.exe" C:\hooks\caption.py`, []string{`C:\Program Files\Python\python.exe`, `C:\hooks\caption.py`}},
+		{`python check.py --label 'not safe' --min=""`, []string{"python", "check.py", "--label", "not safe", "--min="}},
+		{`tool ""`, []string{"tool", ""}},
+		{`say "it's"`, []string{"say", "it's"}},
+		{"", nil},
+	} {
+		got, err := splitCommand(tc.command)
+		if err != nil {
+			t.Errorf("splitCommand(%q): %v", tc.command, err)
+			continue
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("splitCommand(%q) = %q, want %q", tc.command, got, tc.want)
+		}
+	}
+	if _, err := splitCommand(`"C:\Program Files\tool.exe`); err == nil {
+		t.Error("splitCommand with a missing closing quote succeeded")
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// defaultLanguage is used for messages missing from the chosen language
+// and when the system language has no catalog.
+const defaultLanguage = "en"
+
+// localeFiles holds a message catalog per language, named after its
+// ISO 639-1 code, e.g. locales/de.json. A catalog maps message keys to
+// fmt format strings; counted nouns have a ".one" and an ".other" key.
+//
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+var catalogs = loadCatalogs()
+
+// messages is the catalog of the current language. It starts out as the
+// system language, and readConfig switches it to the lang option.
+var messages atomic.Pointer[map[string]string]
+
+func init() {
+	useLanguage(systemLanguage())
+}
+
+func loadCatalogs() map[string]map[string]string {
+	entries, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	out := make(map[string]map[string]string, len(entries))
+	for _, e := range entries {
+		content, err := localeFiles.ReadFile(path.Join("locales", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var catalog map[string]string
+		if err := json.Unmarshal(content, &catalog); err != nil {
+			panic(fmt.Sprintf("locales/%s: %v", e.Name(), err))
+		}
+		out[strings.TrimSuffix(e.Name(), ".json")] = catalog
+	}
+	return out
+}
+
+// languages lists the languages with a catalog.
+func languages() []string {
+	out := make([]string, 0, len(catalogs))
+	for lang := range catalogs {
+		out = append(out, lang)
+	}
+	slices.Sort(out)
+	return out
+}
+
+// systemLanguage is the language of the locale environment variables, e.g.
+// "de" for LANG=de_DE.UTF-8, or defaultLanguage if it has no catalog.
+func systemLanguage() string {
+	for _, key := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := os.Getenv(key)
+		if value == "" {
+			continue
+		}
+		lang := strings.ToLower(value)
+		if i := strings.IndexAny(lang, "_.@-"); i >= 0 {
+			lang = lang[:i]
+		}
+		if _, ok := catalogs[lang]; ok {
+			return lang
+		}
+		break
+	}
+	return defaultLanguage
+}
+
+// useLanguage switches the messages to lang, which must have a catalog.
+func useLanguage(lang string) {
+	catalog := catalogs[lang]
+	messages.Store(&catalog)
+}
+
+// localizeConfig switches to the language of cfg and fills in the texts
+// the config file left out in that language.
+func localizeConfig(cfg *config) {
+	useLanguage(cfg.lang)
+	if _, ok := cfg.settings["hero_title"]; !ok {
+		cfg.heroTitle = msg("hero.title")
+	}
+	if _, ok := cfg.settings["end_credits_title"]; !ok {
+		cfg.endCreditsTitle = msg("credits.slide_title")
+	}
+	if _, ok := cfg.settings["placeholder_text"]; !ok {
+		cfg.placeholderText = msg("placeholder.text")
+	}
+}
+
+// msg formats the message key in the current language.
+func msg(key string, args ...any) string {
+	format := catalogFormat(key)
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// errorf is fmt.Errorf with the format of the message key, which can wrap
+// an error with %w like any other.
+func errorf(key string, args ...any) error {
+	return fmt.Errorf(catalogFormat(key), args...)
+}
+
+// msgError is an error whose text is the message key in the language of
+// the moment it is shown. Errors in package variables are made before the
+// config sets the language.
+type msgError string
+
+func (e msgError) Error() string {
+	return msg(string(e))
+}
+
+// catalogFormat is the format of the message key in the current language,
+// falling back to English and then to the key itself.
+func catalogFormat(key string) string {
+	format, ok := (*messages.Load())[key]
+	if !ok {
+		format, ok = catalogs[defaultLanguage][key]
+	}
+	if !ok {
+		format = key
+	}
+	return format
+}
+
+// oneOf lists values as alternatives, e.g. "a, b or c".
+func oneOf(values ...string) string {
+	n := len(values)
+	if n < 2 {
+		return strings.Join(values, "")
+	}
+	return strings.Join(values[:n-1], ", ") + " " + msg("list.or") + " " + values[n-1]
+}
+
+// formatCount formats n with thousands separators, e.g. 12,345.
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	neg := n < 0
+	if neg {
+		s = s[1:]
+	}
+	sep := msg("number.separator")
+	var out strings.Builder
+	for i := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			out.WriteString(sep)
+		}
+		out.WriteByte(s[i])
+	}
+	if neg {
+		return "-" + out.String()
+	}
+	return out.String()
+}
+
+// countNoun formats n followed by the singular or plural form of the
+// message key, e.g. "1 image" or "1,234 images" for "count.image".
+func countNoun(n int, key string) string {
+	if n == 1 {
+		return msg(key+".one", formatCount(n))
+	}
+	return msg(key+".other", formatCount(n))
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestConfigErrorsAreTranslated(t *testing.T) {
+	t.Chdir(t.TempDir())
+	useLanguage("de")
+	t.Cleanup(func() { useLanguage(defaultLanguage) })
+	if err := os.WriteFile(configFile, []byte("layout = grid\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := readConfig()
+	if err == nil {
+		t.Fatal("readConfig accepted layout = grid")
+	}
+	if want := `ungültiger Wert "grid" für layout (erwartet strip oder rows)`; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+)
+
+func init() {
+	// The standard library can't decode WebP, but reading the size from the
+	// header is enough for probing and validation.
+	image.RegisterFormat("webp", "RIFF????WEBP", decodeWebP, decodeWebPConfig)
+}
+
+// imageLimits guard against decompression bombs: small files that claim
+// huge dimensions and would take gigabytes of memory to decode. Images are
+// checked against the limits from their header, before any pixel data is
+// allocated. Zero means no limit.
+type imageLimits struct {
+	maxSide   int // width or height in pixels
+	maxPixels int // width times height
+}
+
+var errImageTooLarge = msgError("image.too_large")
+
+func (l imageLimits) check(c image.Config) error {
+	if l.maxSide > 0 && (c.Width > l.maxSide || c.Height > l.maxSide) {
+		return errorf("image.too_wide", errImageTooLarge, c.Width, c.Height, l.maxSide)
+	}
+	if l.maxPixels > 0 && int64(c.Width)*int64(c.Height) > int64(l.maxPixels) {
+		return errorf("image.too_many_pixels", errImageTooLarge, c.Width, c.Height, l.maxPixels/1_000_000)
+	}
+	return nil
+}
+
+// decodeImage decodes the image at path if it is within limits.
+func decodeImage(path string, limits imageLimits) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c, _, err := image.DecodeConfig(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+	if err := limits.check(c); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bufio.NewReader(f))
+	return img, err
+}
+
+// imageSize reads the pixel dimensions of the image at path from its header.
+// With full set, the whole image is decoded as well, which catches
+// truncated and otherwise corrupt files whose header is still intact.
+// WebP files are only ever checked at the header level. Images over limits
+// fail with errImageTooLarge.
+func imageSize(path string, full bool, limits imageLimits) (int, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	c, format, err := image.DecodeConfig(bufio.NewReader(f))
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := limits.check(c); err != nil {
+		return 0, 0, err
+	}
+	if full && format != "webp" {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return 0, 0, err
+		}
+		if _, _, err := image.Decode(bufio.NewReader(f)); err != nil {
+			return 0, 0, err
+		}
+	}
+	return c.Width, c.Height, nil
+}
+
+var errWebPUnsupported = msgError("image.webp_unsupported")
+
+func decodeWebP(io.Reader) (image.Image, error) {
+	return nil, errWebPUnsupported
+}
+
+// decodeWebPConfig reads the canvas size from the first chunk of a WebP
+// file, which is VP8 (lossy), VP8L (lossless) or VP8X (extended).
+func decodeWebPConfig(r io.Reader) (image.Config, error) {
+	var hdr [30]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return image.Config{}, errors.New(msg("image.webp_short"))
+	}
+	le := binary.LittleEndian
+	data := hdr[20:]
+	var w, h int
+	switch string(hdr[12:16]) {
+	case "VP8 ":
+		if data[3] != 0x9d || data[4] != 0x01 || data[5] != 0x2a {
+			return image.Config{}, errors.New(msg("image.webp_vp8"))
+		}
+		w = int(le.Uint16(data[6:]) & 0x3fff)
+		h = int(le.Uint16(data[8:]) & 0x3fff)
+	case "VP8L":
+		if data[0] != 0x2f {
+			return image.Config{}, errors.New(msg("image.webp_vp8l"))
+		}
+		bits := le.Uint32(data[1:])
+		w = int(bits&0x3fff) + 1
+		h = int(bits>>14&0x3fff) + 1
+	case "VP8X":
+		w = int(uint32(data[4])|uint32(data[5])<<8|uint32(data[6])<<16) + 1
+		h = int(uint32(data[7])|uint32(data[8])<<8|uint32(data[9])<<16) + 1
+	default:
+		return image.Config{}, errorf("image.webp_chunk", hdr[12:16])
+	}
+	if w == 0 || h == 0 {
+		return image.Config{}, errors.New(msg("image.webp_dimensions"))
+	}
+	return image.Config{Width: w, Height: h}, nil
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// initPreviewFile is the page the init wizard shows the colors on while
+// they are picked.
+func initPreviewFile() string {
+	return filepath.Join(cacheFolder, "init-preview.html")
+}
+
+// errInitCancelled is returned when the input ends in the middle of init.
+var errInitCancelled = msgError("init.cancelled")
+
+var hexColorPattern = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// wizard asks the questions of init on the console.
+type wizard struct {
+	in *bufio.Scanner
+}
+
+// ask prints question and returns the answer, or def if Enter is pressed.
+func (wz wizard) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", question, paint(colorBold, def))
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	if !wz.in.Scan() {
+		fmt.Println()
+		return "", errInitCancelled
+	}
+	if answer := strings.TrimSpace(wz.in.Text()); answer != "" {
+		return answer, nil
+	}
+	return def, nil
+}
+
+// choose asks until the answer is one of options.
+func (wz wizard) choose(question string, options []string, def string) (string, error) {
+	for {
+		answer, err := wz.ask(question, def)
+		if err != nil {
+			return "", err
+		}
+		if slices.Contains(options, strings.ToLower(answer)) {
+			return strings.ToLower(answer), nil
+		}
+		fmt.Println(paint(colorYellow, msg("init.invalid", strings.Join(options, ", "))))
+	}
+}
+
+// yes asks a yes or no question.
+func (wz wizard) yes(question string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	for {
+		answer, err := wz.ask(question+" ("+hint+")", "")
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return def, nil
+		case "y", "yes", "j", "ja":
+			return true, nil
+		case "n", "no", "nein":
+			return false, nil
+		}
+		fmt.Println(paint(colorYellow, msg("init.invalid", "y, n")))
+	}
+}
+
+// color asks until the answer is a hex color.
+func (wz wizard) color(question, def string) (string, error) {
+	for {
+		answer, err := wz.ask(question, def)
+		if err != nil {
+			return "", err
+		}
+		if hexColorPattern.MatchString(answer) {
+			return strings.ToLower(answer), nil
+		}
+		fmt.Println(paint(colorYellow, msg("init.invalid_color")))
+	}
+}
+
+// runInit implements the "init" command, which walks a new user through
+// the main options and writes a config file with them. Everything else is
+// left at its default and explained in the file as in the default config.
+func runInit(args []string) error {
+	fset := flag.NewFlagSet("init", flag.ContinueOnError)
+	defaults := fset.Bool("defaults", false, "write the default config without asking anything")
+	force := fset.Bool("force", false, "replace an existing "+configFile+" without asking")
+	noBrowser := fset.Bool("no-browser", false, "don't open the color preview in the browser")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	colors = os.Getenv("NO_COLOR") == "" && enableColors()
+	wz := wizard{in: bufio.NewScanner(os.Stdin)}
+
+	if _, err := os.Stat(configFile); err == nil && !*force {
+		if *defaults {
+			return errorf("init.exists_error", configFile)
+		}
+		replace, err := wz.yes(msg("init.exists", configFile), false)
+		if err != nil || !replace {
+			return err
+		}
+	}
+
+	return writeConfig(wz, *defaults, !*noBrowser)
+}
+
+// writeConfig writes the config file: the default one, or with what
+// initWizard asked for.
+func writeConfig(wz wizard, defaults, browser bool) error {
+	content := defaultConfig()
+	if !defaults {
+		settings, err := initWizard(wz, browser)
+		if err != nil {
+			return err
+		}
+		content = configWith(settings)
+	}
+	if err := os.MkdirAll(imageFolder, 0o755); err != nil {
+		return errorf("file.create_folder", imageFolder, err)
+	}
+	if err := writeFileAtomic(configFile, []byte(content)); err != nil {
+		return err
+	}
+	fmt.Println(paint(colorGreen, msg("init.written", configFile)))
+	fmt.Println(msg("init.next", imageFolder, outputFile))
+	return nil
+}
+
+// initWizard asks for the main options and returns the ones to set in the
+// config file.
+func initWizard(wz wizard, browser bool) (map[string]string, error) {
+	settings := map[string]string{}
+	fmt.Println(paint(colorBold, "Photo Slider"))
+	fmt.Println(msg("init.welcome"))
+	fmt.Println()
+
+	lang, err := wz.choose(msg("init.lang", strings.Join(languages(), ", ")), languages(), systemLanguage())
+	if err != nil {
+		return nil, err
+	}
+	useLanguage(lang)
+	if lang != systemLanguage() {
+		settings["lang"] = lang
+	}
+
+	// Images folder
+	fmt.Println()
+	fmt.Println(msg("init.images", imageFolder))
+	var folders []string
+	entries, err := os.ReadDir(imageFolder)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			folders = append(folders, e.Name())
+		}
+	}
+	folder := ""
+	if len(folders) > 0 {
+		for {
+			if folder, err = wz.ask(msg("init.folder", strings.Join(folders, ", ")), ""); err != nil {
+				return nil, err
+			}
+			if folder == "" || slices.Contains(folders, folder) {
+				break
+			}
+			fmt.Println(paint(colorYellow, msg("init.invalid", strings.Join(folders, ", "))))
+		}
+		if folder != "" {
+			settings["folder"] = folder
+		}
+	}
+
+	// Layout
+	fmt.Println()
+	layout, err := wz.choose(msg("init.layout"), []string{"strip", "rows"}, "strip")
+	if err != nil {
+		return nil, err
+	}
+	settings["layout"] = layout
+	canvas, err := wz.choose(msg("init.canvas"), []string{"720p", "1080p", "1440p", "4k"}, "1080p")
+	if err != nil {
+		return nil, err
+	}
+	settings["canvas"] = canvas
+	author, err := wz.yes(msg("init.author"), true)
+	if err != nil {
+		return nil, err
+	}
+	settings["include_author"] = fmt.Sprint(author)
+
+	// Colors, shown on the preview page as they are picked
+	fmt.Println()
+	preview := initPreview{lang: lang, includeAuthor: author, folder: filepath.Join(imageFolder, folder)}
+	if err := preview.write(true); err != nil {
+		return nil, err
+	}
+	// Stop reloading once the wizard is done
+	defer func() { preview.write(false) }()
+	if browser {
+		fmt.Println(msg("init.preview", initPreviewFile()))
+		openFile(initPreviewFile())
+	}
+	themeNames := slices.Sorted(maps.Keys(builtinThemes))
+	themeName, err := wz.choose(msg("init.theme", strings.Join(themeNames, ", ")), themeNames, defaultThemeName)
+	if err != nil {
+		return nil, err
+	}
+	settings["theme"] = themeName
+	preview.style = builtinThemes[defaultThemeName].with(builtinThemes[themeName])
+	if err := preview.write(true); err != nil {
+		return nil, err
+	}
+
+	custom, err := wz.yes(msg("init.custom_colors"), false)
+	if err != nil {
+		return nil, err
+	}
+	if custom {
+		for _, c := range []struct {
+			key   string
+			value *string
+		}{
+			{"author_text_color", &preview.style.authorTextColor},
+			{"author_stroke_color", &preview.style.authorStrokeColor},
+			{"title_text_color", &preview.style.titleTextColor},
+			{"title_stroke_color", &preview.style.titleStrokeColor},
+			{"image_border_color", &preview.style.imageBorderColor},
+		} {
+			if !author && strings.HasPrefix(c.key, "author_") {
+				continue
+			}
+			color, err := wz.color(msg("init.color."+c.key), *c.value)
+			if err != nil {
+				return nil, err
+			}
+			if color != *c.value {
+				settings[c.key] = color
+				*c.value = color
+				if err := preview.write(true); err != nil {
+					return nil, err
+				}
+			}
+		}
+		borderStyles := []string{"none", "solid", "dashed", "dotted", "double", "groove", "ridge", "inset", "outset"}
+		style, err := wz.choose(msg("init.border_style", strings.Join(borderStyles, ", ")), borderStyles, preview.style.imageBorderStyle)
+		if err != nil {
+			return nil, err
+		}
+		if style != preview.style.imageBorderStyle {
+			settings["image_border_style"] = style
+			preview.style.imageBorderStyle = style
+		}
+	}
+	borderMode, err := wz.choose(msg("init.border_mode"), []string{"theme", "auto"}, "theme")
+	if err != nil {
+		return nil, err
+	}
+	settings["border_mode"] = borderMode
+	fmt.Println()
+	return settings, nil
+}
+
+// configWith is the default config with settings set, each on the first
+// line of its option, commented out or not. Options the default config
+// doesn't mention are added at the end.
+func configWith(settings map[string]string) string {
+	lines := strings.Split(defaultConfig(), "\n")
+	for _, key := range slices.Sorted(maps.Keys(settings)) {
+		line := key + "=" + settings[key]
+		i := slices.IndexFunc(lines, func(l string) bool {
+			k, _, ok := strings.Cut(strings.TrimPrefix(l, "#"), "=")
+			return ok && k == key
+		})
+		if i < 0 {
+			lines = append(lines, line)
+			continue
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// initPreview is the page that shows the colors picked in init on a few
+// tiles: the first images of the folder, or blank ones while it is empty.
+type initPreview struct {
+	lang          string
+	includeAuthor bool
+	folder        string
+	style         theme
+}
+
+// initPreviewTiles is how many tiles the preview shows.
+const initPreviewTiles = 3
+
+type initPreviewTile struct {
+	Src    string // relative to the preview page, empty for a blank tile
+	Width  int    // of a blank tile
+	Author string
+	Title  string
+}
+
+// write writes the preview page. While live, it reloads itself every
+// second to show the latest colors.
+func (p initPreview) write(live bool) error {
+	cfg := config{
+		theme:           builtinThemes[defaultThemeName].with(p.style),
+		includeAuthor:   p.includeAuthor,
+		captionRenderer: "css",
+		fontDisplay:     "swap",
+		emojiFont:       "none",
+		scale:           0.5,
+		lang:            p.lang,
+	}
+	var tiles []initPreviewTile
+	images, _ := findImages(p.folder, pathFilter{})
+	for _, path := range images[:min(len(images), initPreviewTiles)] {
+		m := newImageMeta(path)
+		tiles = append(tiles, initPreviewTile{Src: "../" + filepath.ToSlash(path), Author: exportText(m.author), Title: exportText(m.title)})
+	}
+	for i := len(tiles); i < initPreviewTiles; i++ {
+		tiles = append(tiles, initPreviewTile{Width: cfg.px(imageHeight) * (3 + i) / 4, Author: msg("init.sample_author"), Title: msg("init.sample_title")})
+	}
+
+	var style bytes.Buffer
+	w := bufio.NewWriter(&style)
+	mustWrite(w, "      body {\n")
+	mustWrite(w, "        margin: 0;\n")
+	mustWrite(w, fmt.Sprintf("        padding: %dpx;\n", cfg.px(32)))
+	mustWrite(w, "        background: repeating-conic-gradient(#2a2a2a 0 25%, #333 0 50%) 0 0 / 32px 32px;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #permas .image-container {\n")
+	mustWrite(w, "        display: inline-block;\n")
+	mustWrite(w, "        vertical-align: top;\n")
+	mustWrite(w, fmt.Sprintf("        margin: %dpx %dpx 0 %dpx;\n", cfg.px(32), cfg.px(tileSpacing), cfg.px(16)))
+	mustWrite(w, "        text-align: center;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #permas img, #permas .sample {\n")
+	mustWrite(w, fmt.Sprintf("        height: %dpx;\n", cfg.px(imageHeight)))
+	mustWrite(w, fmt.Sprintf("        border-radius: %dpx;\n", cfg.px(12)))
+	mustWrite(w, "        display: block;\n")
+	mustWrite(w, fmt.Sprintf("        margin: 0 auto %dpx;\n", cfg.px(10)))
+	mustWrite(w, fmt.Sprintf("        outline: %dpx %s %s;\n", cfg.px(5), cfg.theme.imageBorderStyle, cfg.theme.imageBorderColor))
+	mustWrite(w, fmt.Sprintf("        outline-offset: %dpx;\n", cfg.px(16)))
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #permas .sample {\n")
+	mustWrite(w, "        background: linear-gradient(135deg, #6a8caf, #c4a7d7);\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	cssCaptions{}.writeStyle(w, cfg)
+	w.Flush()
+
+	var page bytes.Buffer
+	err := initPreviewTemplate.Execute(&page, struct {
+		Lang    string
+		Title   string
+		Live    bool
+		FontURL string
+		Style   template.CSS
+		Author  bool
+		Tiles   []initPreviewTile
+	}{
+		Lang:    cfg.lang,
+		Title:   msg("init.preview_title"),
+		Live:    live,
+		FontURL: fontURL(cfg),
+		Style:   template.CSS(style.String()),
+		Author:  cfg.includeAuthor,
+		Tiles:   tiles,
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cacheFolder, 0o755); err != nil {
+		return errorf("file.create_folder", cacheFolder, err)
+	}
+	return writeFileAtomic(initPreviewFile(), page.Bytes())
+}
+
+var initPreviewTemplate = template.Must(template.New("init-preview").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+  <head>
+    <meta charset="utf-8">
+    {{- if .Live}}
+    <meta http-equiv="refresh" content="1">
+    {{- end}}
+    <title>{{.Title}}</title>
+    <link rel="preconnect" href="https://fonts.googleapis.com">
+    <link rel="preconnect" href="https://fonts.gstatic.com" crossorigin>
+    <link href="{{.FontURL}}" rel="stylesheet">
+    <style>
+{{.Style}}    </style>
+  </head>
+  <body>
+    <div id="permas">
+      {{- range .Tiles}}
+      <div class="image-container">
+        {{if .Src}}<img src="{{.Src}}" alt="">{{else}}<div class="sample" style="width: {{.Width}}px"></div>{{end}}
+        <div class="caption">
+          {{- if $.Author}}
+          <div class="author">{{.Author}}</div>
+          {{- end}}
+          <div class="title">{{.Title}}</div>
+        </div>
+      </div>
+      {{- end}}
+    </div>
+  </body>
+</html>
+`))
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadCustomCode reads the files named by custom_css_file and
+// custom_js_file so they can be inlined into the page.
+func loadCustomCode(cfg *config) error {
+	read := func(path string) (string, error) {
+		if path == "" {
+			return "", nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", errorf("inject.read_failed", err)
+		}
+		return string(content), nil
+	}
+	var err error
+	if cfg.customCSS, err = read(cfg.customCSSFile); err != nil {
+		return err
+	}
+	if cfg.customJS, err = read(cfg.customJSFile); err != nil {
+		return err
+	}
+	return nil
+}
+
+// writeCustomCSS inlines the custom stylesheet at the end of the <style>
+// block, so its rules win over the generated ones.
+func writeCustomCSS(w *bufio.Writer, cfg config) {
+	if cfg.customCSS == "" {
+		return
+	}
+	mustWrite(w, "\n")
+	mustWrite(w, fmt.Sprintf("      /* %s */\n", cfg.customCSSFile))
+	mustWrite(w, strings.TrimRight(cfg.customCSS, "\n")+"\n")
+}
+
+// writeCustomJS inlines the custom script at the end of <body>, after all
+// tiles have been added to the page.
+func writeCustomJS(w *bufio.Writer, cfg config) {
+	if cfg.customJS == "" {
+		return
+	}
+	mustWrite(w, "    <script>\n")
+	mustWrite(w, fmt.Sprintf("      // %s\n", cfg.customJSFile))
+	mustWrite(w, strings.TrimRight(cfg.customJS, "\n")+"\n")
+	mustWrite(w, "    </script>\n")
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// watchInterval is how often watch mode checks for changes.
+const watchInterval = 2 * time.Second
+
+// ANSI colors for interactive mode, see paint.
+const (
+	colorRed    = "31"
+	colorGreen  = "32"
+	colorYellow = "33"
+	colorBold   = "1"
+)
+
+// colors is set when the console shows ANSI colors, see enableColors.
+var colors bool
+
+// generating is held while interactive mode generates, so Ctrl+C waits
+// for the generation to finish.
+var generating sync.Mutex
+
+// paint colors s for the console, if it can show colors.
+func paint(color, s string) string {
+	if !colors {
+		return s
+	}
+	return "\x1b[" + color + "m" + s + "\x1b[0m"
+}
+
+// runInteractive is the menu shown when the exe is double-clicked (or run
+// with -interactive): the console window stays open, so errors can be
+// read, and the slider can be regenerated without starting it again.
+func runInteractive() {
+	colors = os.Getenv("NO_COLOR") == "" && enableColors()
+	in := bufio.NewScanner(os.Stdin)
+
+	lock, err := acquireLock("-interactive")
+	if err != nil {
+		printFailure(err)
+		// Keep a double-clicked window open until the error is read
+		fmt.Print(msg("interactive.press_enter"))
+		in.Scan()
+		return
+	}
+	defer lock.release()
+	ctx, stop := notifyShutdown()
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		generating.Lock()
+		lock.release()
+		os.Exit(1)
+	}()
+
+	// A new user sets up the config first
+	if _, err := os.Stat(configFile); errors.Is(err, fs.ErrNotExist) {
+		if err := writeConfig(wizard{in: in}, false, true); err != nil {
+			printFailure(err)
+		}
+	}
+	interactiveGenerate()
+	for {
+		fmt.Println()
+		fmt.Println(paint(colorBold, "Photo Slider"))
+		fmt.Println(msg("interactive.generate", outputFile))
+		fmt.Println(msg("interactive.watch"))
+		fmt.Println(msg("interactive.open", outputFile))
+		fmt.Println(msg("interactive.edit", configFile))
+		fmt.Println(msg("interactive.quit"))
+		fmt.Print(msg("interactive.choice"))
+		if !in.Scan() {
+			return
+		}
+		switch strings.ToLower(strings.TrimSpace(in.Text())) {
+		case "1":
+			interactiveGenerate()
+		case "2":
+			watch(in)
+		case "3":
+			if _, err := os.Stat(outputFile); err != nil {
+				fmt.Println(paint(colorYellow, msg("interactive.no_output", outputFile)))
+				continue
+			}
+			openFile(outputFile)
+		case "4":
+			editFile(configFile)
+		case "q":
+			return
+		default:
+			fmt.Println(paint(colorYellow, msg("interactive.help")))
+		}
+	}
+}
+
+// interactiveGenerate reads the config and generates, reporting the result
+// in color rather than exiting on errors.
+func interactiveGenerate() bool {
+	generating.Lock()
+	defer generating.Unlock()
+	cfg, err := readConfig()
+	if err == nil {
+		useLogFile(cfg.logFile, cfg.logMaxSize)
+		err = generate(cfg)
+	}
+	if err != nil {
+		if cfg.errorPage {
+			if pageErr := writeErrorPage(outputFile, err, cfg); pageErr != nil {
+				slog.Warn(msg("generate.error_page_failed", pageErr))
+			}
+		}
+		printFailure(err)
+		return false
+	}
+	fmt.Println(paint(colorGreen, msg("interactive.done")))
+	return true
+}
+
+func printFailure(err error) {
+	fmt.Println(paint(colorRed, msg("interactive.error", err)))
+}
+
+// watch generates again whenever something in the images folder, the
+// config or the metadata changes, until Enter is pressed.
+func watch(in *bufio.Scanner) {
+	stop := make(chan struct{})
+	go func() {
+		in.Scan()
+		close(stop)
+	}()
+	fmt.Println(msg("interactive.watching", imageFolder, configFile))
+	last := watchStamp()
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			stamp := watchStamp()
+			if stamp == last {
+				continue
+			}
+			last = stamp
+			fmt.Println()
+			fmt.Println(paint(colorBold, msg("interactive.changed", time.Now().Format("15:04:05"))))
+			interactiveGenerate()
+		}
+	}
+}
+
+// watchStamp describes the files generating depends on: it changes when
+// one of them is added, removed or edited, or another playlist is due.
+func watchStamp() string {
+	var b strings.Builder
+	add := func(path string, info fs.FileInfo) {
+		fmt.Fprintf(&b, "%s|%d|%d\n", path, info.Size(), info.ModTime().UnixNano())
+	}
+	walk := func(root string) {
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				add(path, info)
+			}
+			return nil
+		})
+	}
+	// The config says which other files there are; while it is invalid,
+	// only its own changes count
+	cfg, err := readConfig()
+	if err != nil {
+		cfg = config{}
+	}
+	walk(imageFolder)
+	for _, s := range cfg.sources {
+		walk(s.folder)
+	}
+	for _, path := range []string{configFile, metaFile, cfg.linksFile} {
+		if info, err := os.Stat(path); err == nil {
+			add(path, info)
+		}
+	}
+	// A playlist can become active without any file changing
+	fmt.Fprintf(&b, "playlist|%s\n", currentPlaylist())
+	return b.String()
+}
+
+// editFile opens path in a text editor: $EDITOR in this console if set,
+// Notepad on Windows, the default application otherwise.
+func editFile(path string) {
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		fmt.Println(paint(colorYellow, msg("interactive.no_config", path)))
+		return
+	}
+	if editor := os.Getenv("EDITOR"); editor != "" {
+		cmd := exec.Command(editor, path)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			printFailure(err)
+		}
+		return
+	}
+	if runtime.GOOS == "windows" {
+		if err := exec.Command("notepad", path).Start(); err != nil {
+			printFailure(err)
+		}
+		return
+	}
+	openFile(path)
+}
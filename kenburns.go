@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// kenBurnsSeconds is how long one zoom takes; it then plays backwards.
+const kenBurnsSeconds = 12
+
+// kenBurnsMotion is the slow pan and zoom of one image with effect=kenburns.
+type kenBurnsMotion struct {
+	name         string // of the CSS class and keyframes
+	fromScale    float64
+	toScale      float64
+	fromX, fromY float64 // translation in percent of the image size
+	toX, toY     float64
+	delay        float64 // seconds into the animation the image starts at
+}
+
+// planKenBurns gives every image its own random motion. With effect_seed
+// set, an image moves the same way on every run, wherever the shuffle puts
+// it, so the output only changes when the images do.
+func planKenBurns(metas []imageMeta, cfg config) {
+	seed := cfg.effectSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	for i := range metas {
+		m := &metas[i]
+		if m.frames > 0 {
+			continue
+		}
+		h := fnv.New64a()
+		h.Write([]byte(m.source))
+		rng := rand.New(rand.NewSource(seed ^ int64(h.Sum64())))
+
+		// A point at offset x percent stays inside the image as long as
+		// |x| <= (scale-1)/(2*scale), so no edges show while panning
+		offset := func(scale float64) (float64, float64) {
+			limit := (scale - 1) / (2 * scale) * 100
+			angle := rng.Float64() * 2 * math.Pi
+			return limit * math.Cos(angle), limit * math.Sin(angle)
+		}
+		small, large := 1.05+rng.Float64()*0.05, 1.2+rng.Float64()*0.1
+		k := &kenBurnsMotion{name: fmt.Sprintf("kb%d", i+1), fromScale: small, toScale: large}
+		if rng.Intn(2) == 0 {
+			k.fromScale, k.toScale = large, small // zoom out
+		}
+		k.fromX, k.fromY = offset(k.fromScale)
+		k.toX, k.toY = offset(k.toScale)
+		if m.focus != nil {
+			// Zoomed in, the focal point is as close to the middle as
+			// the edges allow
+			x, y := &k.toX, &k.toY
+			if k.fromScale > k.toScale {
+				x, y = &k.fromX, &k.fromY
+			}
+			limit := (large - 1) / (2 * large) * 100
+			*x = math.Max(-limit, math.Min(limit, (0.5-m.focus.X)*100))
+			*y = math.Max(-limit, math.Min(limit, (0.5-m.focus.Y)*100))
+		}
+		k.delay = rng.Float64() * kenBurnsSeconds
+		m.kenBurns = k
+	}
+}
+
+func writeKenBurnsStyle(w *bufio.Writer, metas []imageMeta, cfg config) {
+	mustWrite(w, "      #permas .kenburns {\n")
+	mustWrite(w, "        width: fit-content;\n")
+	mustWrite(w, "        overflow: hidden;\n")
+	mustWrite(w, fmt.Sprintf("        border-radius: %dpx;\n", cfg.px(12)))
+	mustWrite(w, fmt.Sprintf("        margin-bottom: %dpx;\n", cfg.px(10)))
+	mustWrite(w, fmt.Sprintf("        outline: %dpx %s %s;\n", cfg.px(5), accentVar("border-style", cfg.theme.imageBorderStyle, cfg), accentVar("border", cfg.theme.imageBorderColor, cfg)))
+	mustWrite(w, fmt.Sprintf("        outline-offset: %dpx;\n", cfg.px(16)))
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #permas .kenburns img, #permas .kenburns video {\n")
+	mustWrite(w, "        outline: none;\n")
+	mustWrite(w, "        border-radius: 0;\n")
+	mustWrite(w, "        margin-bottom: 0;\n")
+	mustWrite(w, fmt.Sprintf("        animation-duration: %ds;\n", kenBurnsSeconds))
+	mustWrite(w, "        animation-timing-function: ease-in-out;\n")
+	mustWrite(w, "        animation-iteration-count: infinite;\n")
+	mustWrite(w, "        animation-direction: alternate;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	for _, m := range metas {
+		k := m.kenBurns
+		if k == nil {
+			continue
+		}
+		mustWrite(w, fmt.Sprintf("      #permas .%s img, #permas .%s video {\n", k.name, k.name))
+		mustWrite(w, fmt.Sprintf("        animation-name: %s;\n", k.name))
+		mustWrite(w, fmt.Sprintf("        animation-delay: -%.2fs;\n", k.delay))
+		mustWrite(w, "      }\n")
+		mustWrite(w, fmt.Sprintf("      @keyframes %s {\n", k.name))
+		mustWrite(w, fmt.Sprintf("        from { transform: scale(%.3f) translate(%.2f%%, %.2f%%); }\n", k.fromScale, k.fromX, k.fromY))
+		mustWrite(w, fmt.Sprintf("        to { transform: scale(%.3f) translate(%.2f%%, %.2f%%); }\n", k.toScale, k.toX, k.toY))
+		mustWrite(w, "      }\n")
+	}
+	mustWrite(w, "\n")
+}
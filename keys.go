@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const keysFile = "photo-slider.keys"
+
+// API key scopes. A key only grants the scopes it was created with.
+const (
+	scopeRead     = "read"
+	scopeUpload   = "upload"
+	scopeModerate = "moderate"
+	scopeControl  = "control"
+)
+
+var allScopes = []string{scopeRead, scopeUpload, scopeModerate, scopeControl}
+
+// apiKey is a stored API key. Only a hash of the secret is kept, so the
+// full key is shown once when it is created.
+type apiKey struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Hash    string    `json:"hash"`
+	Scopes  []string  `json:"scopes"`
+	Created time.Time `json:"created"`
+}
+
+func loadKeys() ([]apiKey, error) {
+	content, err := os.ReadFile(keysFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errorf("keys.read_failed", err)
+	}
+	var keys []apiKey
+	if err := json.Unmarshal(content, &keys); err != nil {
+		return nil, errorf("keys.parse_failed", keysFile, err)
+	}
+	return keys, nil
+}
+
+func saveKeys(keys []apiKey) error {
+	content, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(keysFile, content, 0o600); err != nil {
+		return errorf("keys.write_failed", err)
+	}
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// authorize reports whether token is a known key with the given scope.
+func authorize(keys []apiKey, token, scope string) bool {
+	id, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	hash := hashToken(token)
+	for _, k := range keys {
+		if k.ID != id || subtle.ConstantTimeCompare([]byte(k.Hash), []byte(hash)) != 1 {
+			continue
+		}
+		for _, s := range k.Scopes {
+			if s == scope {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// runKeys implements the "keys" command: create, revoke and list API keys.
+func runKeys(args []string) error {
+	usage := errors.New(msg("keys.usage"))
+	if len(args) == 0 {
+		return usage
+	}
+	keys, err := loadKeys()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "create":
+		fset := flag.NewFlagSet("keys create", flag.ContinueOnError)
+		name := fset.String("name", "", "what the key is for, e.g. \"discord bot\"")
+		scopes := fset.String("scopes", scopeRead, "comma separated scopes: "+strings.Join(allScopes, ", "))
+		if err := fset.Parse(args[1:]); err != nil {
+			return err
+		}
+		list := splitList(*scopes)
+		if len(list) == 0 {
+			return errors.New(msg("keys.no_scope"))
+		}
+		for _, s := range list {
+			if !slices.Contains(allScopes, s) {
+				return errorf("keys.unknown_scope", s, oneOf(allScopes...))
+			}
+		}
+		id, err := randomHex(4)
+		if err != nil {
+			return err
+		}
+		secret, err := randomHex(24)
+		if err != nil {
+			return err
+		}
+		token := id + "." + secret
+		keys = append(keys, apiKey{ID: id, Name: *name, Hash: hashToken(token), Scopes: list, Created: time.Now()})
+		if err := saveKeys(keys); err != nil {
+			return err
+		}
+		fmt.Println(msg("keys.created", id, strings.Join(list, ", "), token))
+		return nil
+
+	case "revoke":
+		if len(args) != 2 {
+			return usage
+		}
+		out := keys[:0]
+		for _, k := range keys {
+			if k.ID != args[1] {
+				out = append(out, k)
+			}
+		}
+		if len(out) == len(keys) {
+			return errorf("keys.not_found", args[1])
+		}
+		if err := saveKeys(out); err != nil {
+			return err
+		}
+		fmt.Println(msg("keys.revoked", args[1]))
+		return nil
+
+	case "list":
+		if len(keys) == 0 {
+			fmt.Println(msg("keys.none"))
+			return nil
+		}
+		for _, k := range keys {
+			fmt.Println(msg("keys.row", k.ID, k.Name, strings.Join(k.Scopes, ","), k.Created.Format("2006-01-02")))
+		}
+		return nil
+	}
+	return usage
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
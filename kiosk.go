@@ -0,0 +1,156 @@
+package main
+
+import "bufio"
+
+// writeKioskStyle styles the page for interactive=true: tiles that can be
+// tapped, and the overlay showing one full-screen.
+func writeKioskStyle(w *bufio.Writer, cfg config) {
+	mustWrite(w, "      #permas {\n")
+	mustWrite(w, "        touch-action: none;\n")
+	mustWrite(w, "        user-select: none;\n")
+	mustWrite(w, "        cursor: pointer;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	// Links around images mustn't change the layout, see tileLink
+	mustWrite(w, "      .artist-link {\n")
+	mustWrite(w, "        display: contents;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	writeOverlayStyle(w, "zoom", cfg)
+}
+
+// kioskClient makes the page respond to touch and clicks, for a touchscreen
+// at a venue: tapping an image shows it full-screen with its caption,
+// tapping elsewhere pauses or resumes the strip, and swiping scrolls to the
+// next or previous image. Tapping a full-screen image with an artist link
+// opens the link. None of it is in the page without interactive=true, as
+// OBS sends clicks to a browser source too.
+const kioskClient = `    <div id="zoom"></div>
+    <script>
+      (function () {
+        var strip = document.getElementById("permas");
+        // With layout=rows every row scrolls on its own
+        var rows = document.querySelectorAll("#permas .row");
+        var strips = rows.length ? Array.prototype.slice.call(rows) : [strip];
+        var zoom = document.getElementById("zoom");
+        // After this long without a touch, a full-screen image is closed and
+        // the strip scrolls on, so a kiosk left alone doesn't stay stopped
+        var idle = 30 * 1000;
+        var idleTimer = 0;
+        var paused = false;
+        var start = null;
+
+        function play(state) {
+          strips.forEach(function (s) { s.style.animationPlayState = state; });
+        }
+
+        function setPaused(p) {
+          paused = p;
+          play(p || zoom.className ? "paused" : "running");
+        }
+
+        function touched() {
+          clearTimeout(idleTimer);
+          idleTimer = setTimeout(function () {
+            close();
+            setPaused(false);
+          }, idle);
+        }
+
+        function close() {
+          zoom.className = "";
+          zoom.innerHTML = "";
+          setPaused(paused);
+        }
+
+        // Served pages count opened images and followed links for the stats
+        // artists are shown, see apiClick. Tiles are named by path, images
+        // by their path in images/ there
+        function count(tile, event) {
+          if (location.protocol.indexOf("http") === 0 && tile.dataset.image) {
+            var id = tile.dataset.image.replace(/^images\//, "");
+            navigator.sendBeacon("/api/images/" + encodeURIComponent(id) + "/clicks", JSON.stringify({ event: event }));
+          }
+        }
+
+        function open(tile) {
+          count(tile, "open");
+          zoom.innerHTML = "";
+          zoom.appendChild(tile.cloneNode(true));
+          zoom.className = "shown";
+          play("paused");
+        }
+
+        // Restart the animation of the tile's row at the point where the
+        // tile is in the middle, like the remote control's skip. Rows are
+        // zoomed out, so the screen is wider in their pixels
+        function center(tile) {
+          var row = tile.closest(".row") || strip;
+          var style = getComputedStyle(row);
+          var half = row.querySelector(".scroll-content").offsetWidth;
+          var duration = parseFloat(style.animationDuration);
+          var x = tile.offsetLeft + tile.offsetWidth / 2 - window.innerWidth / 2 / (parseFloat(style.zoom) || 1);
+          var t = (((x / half) * duration) % duration + duration) % duration;
+          row.style.animationName = "none";
+          void row.offsetWidth;
+          row.style.animationName = "";
+          row.style.animationDelay = -t + "s";
+        }
+
+        // The tile of row nearest to the middle of the screen, moved by step
+        // tiles. The duplicate copy continues the first, so there is always
+        // a next and a previous one
+        function neighbour(row, step) {
+          var tiles = row.querySelectorAll(".image-container");
+          var middle = window.innerWidth / 2, best = 0, distance = Infinity;
+          for (var i = 0; i < tiles.length; i++) {
+            var r = tiles[i].getBoundingClientRect();
+            var d = Math.abs(r.left + r.width / 2 - middle);
+            if (d < distance) {
+              best = i;
+              distance = d;
+            }
+          }
+          var n = tiles.length / 2;
+          return tiles[(((best + step) % n) + n) % n];
+        }
+
+        strip.addEventListener("pointerdown", function (e) {
+          start = { x: e.clientX, y: e.clientY };
+        });
+        strip.addEventListener("pointerup", function (e) {
+          if (!start) return;
+          var dx = e.clientX - start.x, dy = e.clientY - start.y;
+          start = null;
+          touched();
+          if (Math.abs(dx) > 50 && Math.abs(dx) > Math.abs(dy)) {
+            // Swiping left brings in the next image, as on a phone
+            var row = e.target.closest(".row") || strip;
+            center(neighbour(row, dx < 0 ? 1 : -1));
+            return;
+          }
+          var tile = e.target.closest(".image-container");
+          if (tile) {
+            open(tile);
+          } else {
+            setPaused(!paused);
+          }
+        });
+        strip.addEventListener("pointercancel", function () { start = null; });
+        // Links only open from the full-screen image, a tap on the strip
+        // shows it first
+        strip.addEventListener("click", function (e) {
+          if (e.target.closest("a")) e.preventDefault();
+        });
+        zoom.addEventListener("click", function (e) {
+          touched();
+          var tile = zoom.querySelector(".image-container");
+          if (e.target.closest("a") && tile) {
+            count(tile, "link");
+            return;
+          }
+          close();
+        });
+      })();
+    </script>
+`
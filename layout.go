@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parseThresholds reads row_thresholds: aspect ratios (width / height) in
+// increasing order, e.g. "0.8, 1.25".
+func parseThresholds(value string) ([]float64, error) {
+	var out []float64
+	for _, part := range strings.Split(value, ",") {
+		n, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || n <= 0 {
+			return nil, errorf("layout.not_ratio", strings.TrimSpace(part))
+		}
+		if len(out) > 0 && n <= out[len(out)-1] {
+			return nil, errorf("layout.not_larger", n, out[len(out)-1])
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// aspectRatio is the width of the tile of m divided by its height. Images
+// whose size couldn't be read count as square.
+func aspectRatio(m imageMeta, cfg config) float64 {
+	switch {
+	case m.frames > 0:
+		return float64(m.frameWidth) / float64(cfg.px(imageHeight))
+	case m.width > 0 && m.height > 0:
+		return float64(m.width) / float64(m.height)
+	}
+	return 1
+}
+
+// tileRows splits metas into the rows that scroll by on top of each other.
+// With layout=rows, an image goes in the row of the first threshold its
+// aspect ratio is below, so the narrowest images are in the top row; rows
+// without images are left out. Otherwise there is a single row. Images keep
+// their order within a row.
+func tileRows(metas []imageMeta, cfg config) [][]imageMeta {
+	if cfg.layout != "rows" {
+		return [][]imageMeta{metas}
+	}
+	rows := make([][]imageMeta, len(cfg.rowThresholds)+1)
+	for _, m := range metas {
+		r := sort.SearchFloat64s(cfg.rowThresholds, aspectRatio(m, cfg))
+		if r < len(cfg.rowThresholds) && aspectRatio(m, cfg) == cfg.rowThresholds[r] {
+			r++ // a ratio equal to a threshold belongs above it
+		}
+		rows[r] = append(rows[r], m)
+	}
+	out := rows[:0]
+	for _, row := range rows {
+		if len(row) > 0 {
+			out = append(out, row)
+		}
+	}
+	return out
+}
+
+// rowSeconds is how long one pass of row i takes. The hero tile and the
+// given number of end credits tiles are in the first row.
+func rowSeconds(i int, row []imageMeta, credits int, cfg config) int {
+	if cfg.targetLoopSeconds > 0 {
+		return cfg.targetLoopSeconds
+	}
+	n := len(row)
+	if i == 0 && cfg.heroTile {
+		n++
+	}
+	if i == 0 {
+		n += credits
+	}
+	return n * secondsPerTile
+}
+
+// writeRowsStyle makes every row a strip of its own, scaled down so that
+// together they are as tall as the single strip.
+func writeRowsStyle(w *bufio.Writer, count int, cfg config) {
+	mustWrite(w, "      #permas .row {\n")
+	mustWrite(w, "        display: flex;\n")
+	mustWrite(w, "        width: max-content;\n")
+	mustWrite(w, fmt.Sprintf("        height: %dpx;\n", cfg.px(stripHeight)))
+	mustWrite(w, fmt.Sprintf("        zoom: %.4f;\n", 1/float64(count)))
+	mustWrite(w, "        animation-name: scroll;\n")
+	mustWrite(w, "        animation-iteration-count: infinite;\n")
+	mustWrite(w, "        animation-timing-function: linear;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+)
+
+// lazyPlaceholder is what an image shows until lazy_loading=observer loads
+// it: a transparent GIF.
+const lazyPlaceholder = "data:image/gif;base64,R0lGODlhAQABAIAAAAAAAP///yH5BAEAAAAALAAAAAABAAEAAAIBRAA7"
+
+// imgSrc is the src attribute of the image of m, with what lazy_loading
+// adds to it. An image of unknown size is always loaded right away, as
+// the tile would change its width once it is.
+func imgSrc(m imageMeta, cfg config) string {
+	src := html.EscapeString(m.src())
+	switch {
+	case m.width == 0 || m.height == 0:
+		return fmt.Sprintf(" src=\"%s\"", src)
+	case cfg.lazyLoading == "native":
+		return fmt.Sprintf(" src=\"%s\" loading=\"lazy\" decoding=\"async\"", src)
+	case cfg.lazyLoading == "observer":
+		return fmt.Sprintf(" src=\"%s\" data-src=\"%s\"", lazyPlaceholder, src)
+	}
+	return fmt.Sprintf(" src=\"%s\"", src)
+}
+
+// writeLazyStyle lets the images a screen away from the window count as
+// visible for lazyClient. Elements that clip their content would hide them
+// from it until they scroll in, so only the window clips.
+func writeLazyStyle(w *bufio.Writer, cfg config) {
+	if cfg.lazyLoading != "observer" {
+		return
+	}
+	mustWrite(w, "      body, #permas {\n")
+	mustWrite(w, "        overflow: visible;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+}
+
+// lazyClient loads the images of lazy_loading=observer once they are within
+// a screen's width of the window, so a page with thousands of images only
+// loads and decodes the ones about to scroll in. Images stay loaded once
+// they were, so the next loop doesn't wait for them.
+const lazyClient = `    <script>
+      (function () {
+        var images = document.querySelectorAll("#permas img[data-src]");
+        function load(img) {
+          img.src = img.dataset.src;
+          img.removeAttribute("data-src");
+        }
+        if (!("IntersectionObserver" in window)) {
+          images.forEach(load);
+          return;
+        }
+        var observer = new IntersectionObserver(function (entries) {
+          entries.forEach(function (e) {
+            if (!e.isIntersecting) return;
+            load(e.target);
+            observer.unobserve(e.target);
+          });
+        }, { rootMargin: "0px 100%" });
+        images.forEach(function (img) { observer.observe(img); });
+      })();
+    </script>
+`
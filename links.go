@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"html"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// artistLink is a row of links_file: the artist's page and, optionally,
+// the handle to show for it.
+type artistLink struct {
+	link   string
+	handle string
+}
+
+// artistLinks are the rows of links_file, by image and by author.
+type artistLinks struct {
+	images  map[string]artistLink // by file name or path relative to the images folder
+	authors map[string]artistLink // by author in lower case
+}
+
+// loadLinks reads links_file, a CSV file whose first line names the
+// columns: image, author, link and handle (only link is required). Each
+// row gives the link of an image, by file name or path, or of every image
+// by an author. An empty path reads nothing.
+func loadLinks(path string) (artistLinks, error) {
+	links := artistLinks{images: map[string]artistLink{}, authors: map[string]artistLink{}}
+	if path == "" {
+		return links, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return links, errorf("links.read_failed", err)
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return links, nil
+	}
+	if err != nil {
+		return links, errorf("links.read_failed", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["link"]; !ok {
+		return links, errorf("links.no_column", path)
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return links, errorf("links.read_failed", err)
+		}
+		line, _ := r.FieldPos(0)
+		l := artistLink{link: field(record, "link"), handle: field(record, "handle")}
+		if l.link != "" && !webLink(l.link) {
+			return links, errorf("links.bad_url", path, line, l.link)
+		}
+		image, author := filepath.ToSlash(field(record, "image")), field(record, "author")
+		switch {
+		case image != "":
+			links.images[image] = l
+		case author != "":
+			links.authors[strings.ToLower(author)] = l
+		default:
+			return links, errorf("links.no_key", path, line)
+		}
+	}
+	return links, nil
+}
+
+// apply sets the link of m from links_file, unless photo-slider.meta has
+// one for it. A row for the image wins over one for its author.
+func (links artistLinks) apply(m *imageMeta) {
+	rel, err := filepath.Rel(imageFolder, m.source)
+	if err != nil {
+		rel = m.source
+	}
+	l, ok := links.images[filepath.ToSlash(rel)]
+	if !ok {
+		l, ok = links.images[filepath.Base(m.source)]
+	}
+	if byAuthor, found := links.authors[strings.ToLower(exportText(m.author))]; found {
+		if !ok || l.link == "" {
+			l.link = byAuthor.link
+		}
+		if l.handle == "" {
+			l.handle = byAuthor.handle
+		}
+		ok = true
+	}
+	if !ok {
+		return
+	}
+	if m.link == "" {
+		m.link = l.link
+	}
+	m.handle = l.handle
+}
+
+// webLink reports whether link is an http or https address, the only ones
+// the page links to.
+func webLink(link string) bool {
+	u, err := url.Parse(link)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// handleSites are the sites whose profile addresses end in the handle
+// people know the artist by there.
+var handleSites = map[string]bool{
+	"twitter.com":    true,
+	"x.com":          true,
+	"instagram.com":  true,
+	"threads.net":    true,
+	"tiktok.com":     true,
+	"twitch.tv":      true,
+	"youtube.com":    true,
+	"artstation.com": true,
+	"deviantart.com": true,
+}
+
+// linkHandle is the handle in the profile address link, e.g. "@jane" for
+// https://x.com/jane, if link is the profile on a site of handleSites or on
+// Bluesky.
+func linkHandle(link string) (string, bool) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", false
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	name := parts[0]
+	switch {
+	case host == "bsky.app" && len(parts) == 2 && parts[0] == "profile":
+		name = strings.TrimSuffix(parts[1], ".bsky.social")
+	case !handleSites[host] || len(parts) != 1:
+		return "", false
+	case host == "youtube.com" && !strings.HasPrefix(name, "@"):
+		return "", false
+	}
+	name = strings.TrimPrefix(name, "@")
+	if name == "" {
+		return "", false
+	}
+	return "@" + name, true
+}
+
+// maxLinkLabel is the most characters of a link shown under a caption.
+const maxLinkLabel = 40
+
+// shortLink is link without its scheme, "www.", query and trailing slash,
+// e.g. "artstation.com/jane", cut short if it is still long.
+func shortLink(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	s := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.") + strings.TrimRight(u.EscapedPath(), "/")
+	if utf8.RuneCountInString(s) > maxLinkLabel {
+		s = string([]rune(s)[:maxLinkLabel-1]) + "…"
+	}
+	return s
+}
+
+// linkLabel is what identifies the artist's link of m in text: the handle
+// from links_file, the one in the address, or else the shortened address.
+// It is escaped for HTML, and empty without a link.
+func linkLabel(m imageMeta, preferHandle bool) string {
+	if m.link == "" {
+		return ""
+	}
+	if preferHandle {
+		if m.handle != "" {
+			return html.EscapeString(m.handle)
+		}
+		if h, ok := linkHandle(m.link); ok {
+			return html.EscapeString(h)
+		}
+	}
+	return html.EscapeString(shortLink(m.link))
+}
+
+// captionLink is the line link_caption adds under the title of m, or "".
+func captionLink(m imageMeta, cfg config) string {
+	if cfg.linkCaption == "off" {
+		return ""
+	}
+	return linkLabel(m, cfg.linkCaption == "handle")
+}
+
+// tileLink is the address the tile of m links to on pages that respond to
+// touch, or "" for none. OBS would follow a link when the source is
+// clicked, so other pages never have one.
+func tileLink(m imageMeta, cfg config) string {
+	if !cfg.interactive || !webLink(m.link) {
+		return ""
+	}
+	return m.link
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// lockFile marks the folder as in use by the photo-slider that writes
+// photo.html and the cache: serve mode, interactive mode or a single run.
+// It holds that process's ID, so one left behind by a crash can be told
+// apart from an instance that is still running.
+const lockFile = "photo-slider.lock"
+
+// lockGrace is how long a lock file without a process ID is taken to be
+// one that another instance is only just writing.
+const lockGrace = 5 * time.Second
+
+// shutdownTimeout is how long serve mode waits for requests in progress
+// when it is stopped.
+const shutdownTimeout = 10 * time.Second
+
+// instanceLock is this process's hold on lockFile.
+type instanceLock struct {
+	path string
+}
+
+// acquireLock takes lockFile for mode (the command, named to a second
+// instance; empty for a single run), so two instances started by a script
+// don't overwrite each other's photo.html and cache. A lock left behind by
+// an instance that no longer runs is taken over.
+func acquireLock(mode string) (*instanceLock, error) {
+	content := fmt.Sprintf("%d\n%s\n%s\n", os.Getpid(), mode, time.Now().Format(time.RFC3339))
+	for range 2 {
+		f, err := os.OpenFile(lockFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_, err = f.WriteString(content)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(lockFile)
+				return nil, errorf("file.write_failed", lockFile, err)
+			}
+			return &instanceLock{path: lockFile}, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, errorf("file.create_folder", lockFile, err)
+		}
+		pid, holder, ok := readLock()
+		switch {
+		case ok && pid != os.Getpid() && processRunning(pid):
+			return nil, errorf("lock.held", strings.TrimSpace("photo-slider "+holder), pid, lockFile)
+		case !ok && lockAge() < lockGrace:
+			return nil, errorf("lock.starting", lockFile)
+		}
+		slog.Warn(msg("lock.stale", lockFile))
+		if err := os.Remove(lockFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, errorf("lock.contended", lockFile)
+}
+
+// readLock returns the process ID and command in lockFile.
+func readLock() (pid int, mode string, ok bool) {
+	content, err := os.ReadFile(lockFile)
+	if err != nil {
+		return 0, "", false
+	}
+	lines := strings.Split(string(content), "\n")
+	if len(lines) < 2 {
+		return 0, "", false
+	}
+	pid, err = strconv.Atoi(lines[0])
+	if err != nil || pid <= 0 {
+		return 0, "", false
+	}
+	return pid, lines[1], true
+}
+
+// lockAge is how long ago lockFile was written.
+func lockAge() time.Duration {
+	info, err := os.Stat(lockFile)
+	if err != nil {
+		return 0
+	}
+	return time.Since(info.ModTime())
+}
+
+// release gives up the lock.
+func (l *instanceLock) release() {
+	if l == nil {
+		return
+	}
+	if pid, _, ok := readLock(); ok && pid == os.Getpid() {
+		os.Remove(l.path)
+	}
+}
+
+// notifyShutdown returns a context that is canceled by Ctrl+C, or when the
+// process is asked to stop, e.g. by a script that closes OBS.
+func notifyShutdown() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
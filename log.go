@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logBackups is how many rotated log files are kept next to log_file.
+const logBackups = 3
+
+// logLevel is the least severe level shown on the console: info by default,
+// debug with -verbose and warnings with -quiet. The log file gets every
+// level regardless.
+var logLevel = new(slog.LevelVar)
+
+// logger is where slog's default logger writes, set up by setupLogging and
+// useLogFile.
+var logger = &logOutput{out: os.Stdout, errOut: os.Stderr}
+
+func init() {
+	slog.SetDefault(slog.New(&logHandler{output: logger}))
+}
+
+// logOutput is shared by the handlers made by WithAttrs.
+type logOutput struct {
+	mu         sync.Mutex
+	out        io.Writer
+	errOut     io.Writer
+	timestamps bool
+	file       *logFile
+}
+
+// setupLogging applies -verbose and -quiet and, in serve mode, puts the
+// time in front of console lines.
+func setupLogging(verbose, quiet, timestamps bool) error {
+	if verbose && quiet {
+		return errors.New(msg("log.verbose_quiet"))
+	}
+	switch {
+	case verbose:
+		logLevel.Set(slog.LevelDebug)
+	case quiet:
+		logLevel.Set(slog.LevelWarn)
+	}
+	logger.mu.Lock()
+	logger.timestamps = timestamps
+	logger.mu.Unlock()
+	return nil
+}
+
+// useLogFile makes the log also go to path (none if empty), rotating it once
+// it is larger than maxSize bytes. Serve mode calls it on every
+// regeneration, so a changed log_file takes effect without a restart.
+func useLogFile(path string, maxSize int64) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	if f := logger.file; f != nil {
+		if f.path == path {
+			f.maxSize = maxSize
+			return
+		}
+		f.close()
+		logger.file = nil
+	}
+	if path != "" {
+		logger.file = &logFile{path: path, maxSize: maxSize}
+	}
+}
+
+// logHandler writes messages as they are to the console, warnings and
+// errors to stderr, and with their time, level and attributes to the log
+// file. Empty messages print an empty line and are left out of the file.
+type logHandler struct {
+	output *logOutput
+	attrs  []slog.Attr
+}
+
+func (h *logHandler) Enabled(_ context.Context, level slog.Level) bool {
+	h.output.mu.Lock()
+	defer h.output.mu.Unlock()
+	return level >= logLevel.Level() || h.output.file != nil
+}
+
+func (h *logHandler) Handle(_ context.Context, r slog.Record) error {
+	o := h.output
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if r.Level >= logLevel.Level() {
+		out := o.out
+		if r.Level >= slog.LevelWarn {
+			out = o.errOut
+		}
+		line := r.Message
+		if o.timestamps && line != "" {
+			line = r.Time.Format("15:04:05") + " " + line
+		}
+		fmt.Fprintln(out, line)
+	}
+	if o.file == nil || r.Message == "" {
+		return nil
+	}
+	var b strings.Builder
+	b.WriteString(r.Time.Format(time.RFC3339))
+	b.WriteString(" " + r.Level.String() + " ")
+	// Lists under a message are indented on the console
+	b.WriteString(strings.TrimSpace(r.Message))
+	writeAttr := func(a slog.Attr) bool {
+		fmt.Fprintf(&b, " %s=%q", a.Key, a.Value.String())
+		return true
+	}
+	for _, a := range h.attrs {
+		writeAttr(a)
+	}
+	r.Attrs(writeAttr)
+	b.WriteString("\n")
+	if err := o.file.write(b.String()); err != nil {
+		// Don't log about failing to log
+		fmt.Fprintln(o.errOut, msg("log.failed", o.file.path, err))
+		o.file.close()
+		o.file = nil
+	}
+	return nil
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &logHandler{output: h.output, attrs: append(append([]slog.Attr(nil), h.attrs...), attrs...)}
+}
+
+// WithGroup isn't used, attributes are written without the group.
+func (h *logHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// logFile is a log file that is renamed to path.1 once it grows past
+// maxSize, path.1 to path.2 and so on, keeping logBackups of them.
+type logFile struct {
+	path    string
+	maxSize int64 // 0 for no limit
+	f       *os.File
+	size    int64
+}
+
+func (l *logFile) write(line string) error {
+	if l.f == nil {
+		f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		l.f, l.size = f, info.Size()
+	}
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+		return l.write(line)
+	}
+	n, err := l.f.WriteString(line)
+	l.size += int64(n)
+	return err
+}
+
+func (l *logFile) rotate() error {
+	l.close()
+	os.Remove(fmt.Sprintf("%s.%d", l.path, logBackups))
+	for i := logBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	return os.Rename(l.path, l.path+".1")
+}
+
+func (l *logFile) close() {
+	if l.f != nil {
+		l.f.Close()
+		l.f = nil
+	}
+}
@@ -3,19 +3,40 @@ package main
 import (
 	"bufio"
 	"errors"
+	"flag"
 	"fmt"
 	"html"
+	"image"
 	"io/fs"
-	"math/rand"
+	"log/slog"
+	"math"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
 	imageFolder = "images"
 	outputFile  = "photo.html"
 	configFile  = "photo-slider.config"
+	cacheFolder = "cache"
+	previewFile = "photo-preview.png"
+)
+
+// Strip layout, shared by the generated CSS and everything that needs to
+// know where tiles end up on screen.
+const (
+	imageHeight    = 500 // px
+	tileSpacing    = 80  // px between tiles
+	secondsPerTile = 5
+	// Fastest pace target_loop_seconds may set; images that would go by
+	// faster are left out
+	minSecondsPerTile = 3
 )
 
 var allowedExt = map[string]struct{}{
@@ -27,80 +48,754 @@ var allowedExt = map[string]struct{}{
 }
 
 type imageMeta struct {
-	relPath string
-	author  string
-	title   string
+	relPath     string
+	source      string // file or folder the tile was made from
+	origin      string // source in sources it is from, "" for the images folder
+	hash        string // content hash, see ensureHashes
+	author      string
+	title       string
+	translation string // title in translate_to, see translateCaptions
+	stamped     string // watermarked copy shown instead of relPath, see stampWatermarks
+	optimized   string // smaller copy shown instead of relPath, see optimizeImages
+	video       string // looping video shown instead of an animation, see convertAnimations
+	link        string // artist's page, see imageInfo and loadLinks
+	handle      string // shown for link, from links_file, see linkLabel
+	qr          string // SVG QR code of link, see makeQRCodes
+	kenBurns    *kenBurnsMotion
+	focus       *focusPoint // part of the image to keep in frame, see imageInfo
+	dwell       *float64    // overrides dwell_seconds, see imageInfo
+	frames      int         // number of frames if relPath is a sequence sprite sheet
+	frameWidth  int
+	dhash       *uint64      // perceptual hash, see findDuplicates
+	colors      []string     // dominant colors, see pickAccents
+	accent      *imageAccent // colors instead of the theme's, with border_mode=auto
+	alt         string       // text for screen readers, see altText
+	date        time.Time    // see imageDate
+	width       int          // 0 if the size couldn't be read
+	height      int
+}
+
+// src is the file the page shows for m.
+func (m imageMeta) src() string {
+	if m.stamped != "" {
+		return m.stamped
+	}
+	if m.optimized != "" {
+		return m.optimized
+	}
+	return filepath.ToSlash(m.relPath)
 }
 
 type config struct {
-	includeAuthor     bool
-	authorTextColor   string
-	authorStrokeColor string
-	titleTextColor    string
-	titleStrokeColor  string
-	imageBorderColor  string
-	imageBorderStyle  string
+	includeAuthor        bool
+	themeName            string
+	customThemes         map[string]customTheme
+	style                theme // style options set directly in the config, applied over the theme
+	theme                theme // effective theme, see resolveTheme
+	heroTile             bool
+	interactive          bool // page responds to touch, see kioskClient
+	heroTitle            string
+	endCredits           bool // end the strip with tiles thanking the artists, see creditsSlides
+	endCreditsTitle      string
+	customCSSFile        string
+	customJSFile         string
+	customCSS            string // contents of customCSSFile, see loadCustomCode
+	customJS             string // contents of customJSFile, see loadCustomCode
+	sequenceTiles        bool
+	sequenceFrameSeconds float64
+	captionFormat        string
+	captionRenderer      string // name of a registered captionRenderer
+	borderMode           string // theme or auto, see pickAccents
+	playlist             string // name of the active playlist, "" for none
+	maxImageWidth        int
+	imageFit             string
+	previewScreenshot    bool
+	duplicates           string // skip, report or off
+	nearDuplicates       bool
+	nearDuplicateBits    int
+	validateImages       string // full, header or off
+	limits               imageLimits
+	filter               pathFilter
+	webhookURLs          []string
+	webhookEvents        []string
+	maxImages            int
+	targetLoopSeconds    int                    // length of one loop, 0 for secondsPerTile per tile
+	dwellSeconds         float64                // pause with each tile centered, see newScrollTimeline
+	reducedMotion        string                 // slow, pause or off, see writeReducedMotion
+	selection            string                 // newest, random or rotate
+	newImageRuns         int                    // generations new images are kept in despite max_images
+	shuffle              string                 // name of a registered shuffler
+	manualOrderFile      string                 // order for shuffle=manual
+	mixRatio             map[string]int         // weights of folders, see mixFolders
+	sources              []imageSource          // folders read along with the images folder
+	sourceOptions        map[string]imageSource // source.<name>.<option> settings, see applySourceOptions
+	dates                dateRange
+	dateSource           string // modified or taken
+	expireAfterDays      int    // 0 keeps images forever
+	expireAction         string // exclude or archive
+	errorPage            bool
+	backups              int // earlier versions of outputFile kept in backupFolder
+	reportDuplicates     bool
+	scheduleFile         string
+	scheduleViewport     int
+	exportBaseURL        string // where the folder with the page is published, see exportURL
+	canvasWidth          int    // of the OBS canvas, see parseCanvas
+	canvasHeight         int
+	sourceSizes          []sourceSize // browser source sizes to write variants of the page for
+	sourceSize           string       // name of the size a variant is written for, "" for outputFile
+	scale                float64      // of every length in the page, see px
+	translateCmd         string
+	hooks                map[string][]string // commands by hook point, e.g. hookPerImage
+	translateTo          string
+	remoteControl        bool // page is served by the serve command, see controlClient
+	debugOverlay         bool // page is shown by the preview command, see writeDebugClient
+	adminPassword        string
+	twitchChannel        string // whose chat serve mode takes commands from, see watchChat
+	twitchUser           string
+	twitchToken          string
+	chatPinSeconds       int
+	chatPostLinks        bool
+	outputMode           string // full or compact
+	lazyLoading          string // off, native or observer, see imgSrc
+	moderation           bool   // submissions go to incomingFolder first
+	safetyCmd            string // content filter command, see checkSafety
+	safetyURL            string // content filter service, used without safetyCmd
+	safetyAPIKey         string
+	safetyThreshold      float64 // score from which an image is flagged
+	safetyAction         string  // quarantine or report
+	fontDisplay          string  // CSS font-display strategy
+	localFont            bool
+	fontFallbacks        []string // Google Fonts families after the theme font, with axis specs like font
+	emojiFont            string   // noto, system or none, see emojiFonts
+	hasEmoji             bool     // some caption has emoji, see fontURL
+	fontCSS              string   // font inlined by local_font, see loadLocalFont
+	watermarkImage       string
+	watermarkText        string
+	watermarkPosition    string // top-left, top-right, bottom-left or bottom-right
+	watermarkOpacity     float64
+	watermarkSize        float64 // watermark width as a fraction of the image width
+	qrCodes              string  // off, caption or corner
+	qrSize               int
+	linksFile            string // artist links by image or author, see loadLinks
+	linkCaption          string // off, handle or url
+	effect               string // none or kenburns
+	effectSeed           int64  // 0 for different motions every run
+	audioFile            string
+	audioVolume          float64
+	audioURL             string // where the page plays audioFile from, see prepareAudio
+	previewOutput        string // set by -preview-out, see generate
+	exportFormat         string // set by -format other than html, or site by export-site, see generate
+	siteFolder           string // set by export-site
+	diff                 bool   // set by -diff and -dry-run, previewOutput is then compared with outputFile
+	backgroundURL        string // of the theme's background image, see prepareBackground
+	optimize             bool   // show scaled-down copies of large images
+	optimizeQuality      int
+	animatedImages       string  // keep, poster or video, see convertAnimations
+	animatedMaxMegabytes float64 // animations larger than this are heavy
+	animatedMaxFPS       int     // and so are faster ones
+	workers              int     // goroutines for reading, hashing and converting images
+	rebuild              bool    // ignore the build cache, see loadBuildCache
+	strict               bool    // set by -strict, see imageFailures
+	placeholderText      string
+	placeholderImage     string
+	placeholderURL       string // of placeholder_image, see preparePlaceholder
+	layout               string
+	rowThresholds        []float64 // aspect ratios between the rows of layout=rows
+	lang                 string    // language of messages and default texts
+	logFile              string
+	logMaxSize           int64             // bytes before log_file is rotated, 0 for no limit
+	settings             map[string]string // as given in the config file, see configChanges
 }
 
 func main() {
-	if err := run(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	var err error
+	command := ""
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+	// Left over by the last update on Windows
+	removeOldBinary()
+	switch command {
+	case "version":
+		err = runVersion(os.Args[2:])
+	case "update":
+		err = runUpdate(os.Args[2:])
+	case "init":
+		err = runInit(os.Args[2:])
+	case "preview":
+		err = runPreview(os.Args[2:])
+	case "verify-render":
+		err = verifyRender(os.Args[2:])
+	case "keys":
+		err = runKeys(os.Args[2:])
+	case "now-showing":
+		err = nowShowing(os.Args[2:])
+	case "serve":
+		err = runServe(os.Args[2:])
+	case "review":
+		err = runReview(os.Args[2:])
+	case "rollback":
+		err = runRollback(os.Args[2:])
+	case "gc":
+		err = runGC(os.Args[2:])
+	case "stats":
+		err = runStats(os.Args[2:])
+	case "export-site":
+		err = runExportSite(os.Args[2:])
+	case "credits":
+		err = runCredits(os.Args[2:])
+	case "export-originals":
+		err = runExportOriginals(os.Args[2:])
+	case "hide":
+		err = runHide(os.Args[2:], true)
+	case "show":
+		err = runHide(os.Args[2:], false)
+	default:
+		err = run()
+	}
+	if err != nil {
+		slog.Error(err.Error())
 		os.Exit(1)
 	}
 }
 
 func run() error {
+	themeFlag := flag.String("theme", "", "theme to use, overrides the theme config option")
+	previewFlag := flag.Bool("preview", false, "save a screenshot of the result to "+previewFile)
+	reportDuplicates := flag.Bool("report-duplicates", false, "list duplicate images and which copy was kept")
+	sinceFlag := flag.String("since", "", "only include images from the last period, e.g. 30d, 2w or 12h")
+	previewOut := flag.String("preview-out", "", "write a preview of the next generation, including queued images marked for preview, to this file instead")
+	traceFlag := flag.String("trace", "", "write a timeline of the run to this file, for chrome://tracing or Perfetto")
+	profileFlag := flag.Bool("profile", false, "show how long each step of generating took and how large "+outputFile+" came out")
+	rebuildFlag := flag.Bool("rebuild", false, "process every image again instead of reusing what earlier runs found")
+	strictFlag := flag.Bool("strict", false, "stop at the first image that can't be read or processed, instead of leaving it out and listing it at the end")
+	diffFlag := flag.Bool("diff", false, "show how "+outputFile+" would change, without changing it")
+	dryRunFlag := flag.Bool("dry-run", false, "show which images, captions and config settings changed since the last generation, without writing anything")
+	verboseFlag := flag.Bool("verbose", false, "also show details such as which images were reused from the build cache")
+	quietFlag := flag.Bool("quiet", false, "only show warnings and errors")
+	formatFlag := flag.String("format", "html", "what to write: html (the slider), or the same images as rss, markdown or json, to photo.xml, photo.md or photo.json")
+	interactiveFlag := flag.Bool("interactive", false, "show a menu to generate, watch for changes, open the result or edit the config, and keep the window open")
+	flag.Parse()
+	if err := setupLogging(*verboseFlag, *quietFlag, false); err != nil {
+		return err
+	}
+
+	// Double-clicking the exe opens a console that closes as soon as the
+	// program exits, before anyone can read what went wrong
+	if *interactiveFlag || (len(os.Args) == 1 && ownConsole()) {
+		runInteractive()
+		return nil
+	}
+
 	// Read config file
 	cfg, err := readConfig()
 	if err != nil {
 		return err
 	}
+	useLogFile(cfg.logFile, cfg.logMaxSize)
+	if *themeFlag != "" {
+		cfg.themeName = *themeFlag
+	}
+	if *previewFlag {
+		cfg.previewScreenshot = true
+	}
+	if *sinceFlag != "" {
+		age, err := parseSince(*sinceFlag)
+		if err != nil {
+			return err
+		}
+		cfg.dates.from = time.Now().Add(-age)
+	}
+	cfg.reportDuplicates = *reportDuplicates
+	cfg.previewOutput = *previewOut
+	cfg.rebuild = *rebuildFlag
+	cfg.strict = *strictFlag
+	if *diffFlag || *dryRunFlag {
+		if cfg.previewOutput != "" {
+			return errors.New(msg("generate.diff_flags"))
+		}
+		cfg.diff = true
+		cfg.previewOutput = diffFile()
+		defer os.Remove(cfg.previewOutput)
+	}
+	if *formatFlag != "html" {
+		if _, ok := exportExtensions[*formatFlag]; !ok {
+			return errorf("value.expected", "-format", *formatFlag, oneOf("html", "rss", "markdown", "json"))
+		}
+		if cfg.previewOutput != "" {
+			return errors.New(msg("generate.format_flags"))
+		}
+		cfg.exportFormat = *formatFlag
+	}
+
+	// Only runs that write photo.html wait their turn; -diff, -preview-out
+	// and -format leave it alone
+	if cfg.previewOutput == "" && cfg.exportFormat == "" {
+		lock, err := acquireLock("")
+		if err != nil {
+			return err
+		}
+		defer lock.release()
+	}
+
+	if *traceFlag != "" {
+		startTracing()
+		defer func() {
+			if err := writeTrace(*traceFlag); err != nil {
+				slog.Warn(err.Error())
+			} else {
+				slog.Info(msg("generate.trace_saved", *traceFlag))
+			}
+		}()
+	}
+	if *profileFlag && tracing == nil {
+		startTracing()
+	}
+	if err := generate(cfg); err != nil {
+		if cfg.errorPage && cfg.previewOutput == "" && cfg.exportFormat == "" {
+			if pageErr := writeErrorPage(outputFile, err, cfg); pageErr != nil {
+				slog.Warn(msg("generate.error_page_failed", pageErr))
+			}
+		}
+		return err
+	}
+	if *profileFlag {
+		printProfile()
+	}
+	if cfg.diff {
+		return printDiff(cfg, *diffFlag, *dryRunFlag)
+	}
+	return nil
+}
+
+// generate builds the slider from the images folder and writes it to
+// outputFile.
+//
+// With previewOutput set, it writes the page the next run would make to that
+// file instead, adding the queued images marked for preview (unless for
+// -diff), and leaves the live page, the state and the files as they are: no
+// webhooks are sent and nothing is archived. The same goes for exportFormat,
+// which writes the images in that format to exportFile instead of a page, or
+// with site, a website to siteFolder.
+func generate(cfg config) error {
+	var err error
+	if cfg.theme, err = resolveTheme(cfg); err != nil {
+		return err
+	}
+	if err := loadCustomCode(&cfg); err != nil {
+		return err
+	}
 	// Ensure images directory exists
 	if _, err := os.Stat(imageFolder); errors.Is(err, fs.ErrNotExist) {
 		if mkErr := os.MkdirAll(imageFolder, 0o755); mkErr != nil {
-			return fmt.Errorf("failed to create %s: %w", imageFolder, mkErr)
+			return errorf("file.create_folder", imageFolder, mkErr)
 		}
-		fmt.Printf("Creating %s folder...\n", imageFolder)
-		fmt.Printf("Please place your images in the %s folder and run this program again.\n", imageFolder)
+		slog.Info(msg("generate.creating_folder", imageFolder))
+		slog.Info(msg("generate.place_images", imageFolder))
 		return nil
 	}
 
+	if cfg.playlist != "" {
+		slog.Info(msg("generate.playlist", cfg.playlist))
+	}
+
+	// Images that fail a step are left out, or shown as they are, and
+	// listed at the end
+	failed := &imageFailures{strict: cfg.strict}
+	defer failed.report()
+
+	// Give pre_scan hooks a chance to change the images folder first
+	if !cfg.diff {
+		endSpan := traceSpan(traceDiscovery, "pre_scan hooks")
+		if err := runPreScanHooks(cfg); err != nil {
+			return err
+		}
+		endSpan()
+	}
+
 	// Discover images
-	images, err := findImages(imageFolder)
+	endSpan := traceSpan(traceDiscovery, "find images")
+	images, err := findImages(imageFolder, cfg.filter)
 	if err != nil {
 		return err
 	}
+	sourceImages, err := findSourceImages(cfg)
+	if err != nil {
+		return err
+	}
+	images = append(images, sourceImages...)
+	endSpan()
 
-	// Randomize order for output
-	rand.Shuffle(len(images), func(i, j int) { images[i], images[j] = images[j], images[i] })
+	endSpan = traceSpan(traceDiscovery, "load metadata")
+	md, err := loadMetadata()
+	if err != nil {
+		return err
+	}
+	endSpan()
+	slog.Debug(msg("generate.found", countNoun(len(images), "count.image"), imageFolder))
 
+	out := outputFile
+	if cfg.previewOutput != "" {
+		out = cfg.previewOutput
+		queued, err := listQueue()
+		if err != nil {
+			return err
+		}
+		for _, e := range queued {
+			if e.Preview && !cfg.diff {
+				images = append(images, e.Path)
+			}
+		}
+	}
+
+	endSpan = traceSpan(traceDiscovery, "load links")
+	links, err := loadLinks(cfg.linksFile)
+	if err != nil {
+		return err
+	}
+	endSpan()
+
+	endSpan = traceSpan(traceDiscovery, "load build cache")
+	bc, err := loadBuildCache(cfg.rebuild)
+	if err != nil {
+		return err
+	}
+	endSpan()
+
+	// Images that haven't changed since the last run aren't read again
+	endSpan = traceSpan(traceDiscovery, "read images", "count", strconv.Itoa(len(images)))
+	read := make([]imageMeta, len(images))
+	readErrs := make([]error, len(images))
+	built := make([]buildImage, len(images))
+	reread := make([]bool, len(images))
+	parallel(msg("progress.reading"), len(images), cfg.workers, func(worker, i int) {
+		path := images[i]
+		info := md.info(path)
+		if info.Hidden {
+			slog.Debug(msg("generate.hidden", path))
+			return
+		}
+		m := newImageMeta(path)
+		m.origin = cfg.sourceOf(path)
+		info.apply(&m)
+		links.apply(&m)
+		stat, _ := os.Stat(path)
+		e, ok := bc.image(path, stat)
+		if !ok || (cfg.validateImages == "full" && !e.Decoded) {
+			reread[i] = true
+			defer traceSpanOn(worker, traceDiscovery, "read image", "path", m.relPath)()
+			// Only the size is read again when validation got stricter
+			e = buildImage{Date: e.Date, Hash: e.Hash, DHash: e.DHash, Colors: e.Colors}
+			e.Width, e.Height, readErrs[i] = imageSize(path, cfg.validateImages == "full", cfg.limits)
+			e.Decoded = cfg.validateImages == "full"
+		} else {
+			readErrs[i] = cfg.limits.check(image.Config{Width: e.Width, Height: e.Height})
+		}
+		if (cfg.captionFormat != "" || cfg.exportFormat != "") && e.Date.IsZero() {
+			e.Date = imageDate(path)
+		}
+		if stat != nil {
+			e.Size, e.ModTime = stat.Size(), stat.ModTime()
+		}
+		m.width, m.height, m.date = e.Width, e.Height, e.Date
+		m.hash, m.dhash, m.colors = e.Hash, e.DHash, e.Colors
+		read[i], built[i] = m, e
+	})
 	metas := make([]imageMeta, 0, len(images))
-	for _, path := range images {
-		base := filepath.Base(path)
-		name := strings.TrimSuffix(base, filepath.Ext(base))
-		author, title := parseAuthorTitle(name)
-		metas = append(metas, imageMeta{relPath: filepath.ToSlash(path), author: author, title: title})
+	cached := map[string]buildImage{}
+	reused, readAgain := 0, 0
+	for i, m := range read {
+		if m.relPath == "" {
+			continue // hidden
+		}
+		if reread[i] {
+			readAgain++
+		} else {
+			reused++
+		}
+		// Oversized images are skipped even without validation
+		if err := readErrs[i]; err != nil && (cfg.validateImages != "off" || errors.Is(err, errImageTooLarge)) {
+			if err := failed.add(m.relPath, "failure.read", err); err != nil {
+				return err
+			}
+			continue
+		}
+		if readErrs[i] == nil && !built[i].ModTime.IsZero() {
+			cached[m.relPath] = built[i]
+		}
+		metas = append(metas, m)
+	}
+	bc.Images = cached
+	slog.Debug(msg("generate.cache", reused, readAgain))
+	endSpan()
+
+	// Drop (or just report) repeated submissions of the same image
+	if cfg.duplicates != "off" {
+		endSpan := traceSpan(traceHashing, "find duplicates")
+		// Images that can't be hashed can't be told apart from others
+		if metas, err = failed.drop(metas, hashImages(metas, cfg.workers), "failure.hash"); err != nil {
+			return err
+		}
+		dups := findDuplicates(metas, cfg)
+		bc.addHashes(metas) // duplicates too, so they aren't hashed again
+		if cfg.duplicates == "skip" {
+			metas = removeDuplicates(metas, dups)
+		}
+		printDuplicates(dups, cfg.duplicates == "skip", cfg.reportDuplicates || cfg.duplicates == "report")
+		endSpan()
+	} else {
+		// Later steps need the hashes anyway
+		ensureHashes(metas, cfg.workers)
+		bc.addHashes(metas)
+	}
+
+	// Keep images the content filter flags off the stream until reviewed
+	endSpan = traceSpan(traceProcessing, "content filter")
+	if metas, err = checkSafety(metas, cfg, md, failed); err != nil {
+		return err
+	}
+	endSpan()
+
+	endSpan = traceSpan(traceProcessing, "per_image hooks")
+	if metas, err = runImageHooks(metas, cfg, failed); err != nil {
+		return err
+	}
+	endSpan()
+
+	// Turn numbered sequences in subfolders into flipbook tiles
+	if cfg.sequenceTiles {
+		endSpan := traceSpan(traceDiscovery, "find sequences")
+		sequences, err := findSequences(imageFolder, cfg.filter)
+		if err != nil {
+			return err
+		}
+		endSpan()
+		built := map[string]buildSequence{}
+		for dir, frames := range sequences {
+			stamp := framesStamp(frames)
+			e, ok := bc.Sequences[dir]
+			height := cfg.px(imageHeight)
+			if _, err := os.Stat(sequenceFile(dir)); ok && e.Frames == stamp && e.Height == height && err == nil {
+				metas = append(metas, sequenceMeta(dir, e.Count, e.FrameWidth))
+				built[dir] = e
+				continue
+			}
+			endSpan := traceSpan(traceProcessing, "render sequence", "path", dir)
+			m, err := renderSequence(dir, frames, height, cfg.limits)
+			if err != nil {
+				endSpan()
+				if err := failed.add(dir, "failure.sequence", err); err != nil {
+					return err
+				}
+				continue
+			}
+			metas = append(metas, m)
+			built[dir] = buildSequence{Frames: stamp, Count: m.frames, FrameWidth: m.frameWidth, Height: height}
+			endSpan()
+		}
+		bc.Sequences = built
+	}
+
+	// Retire old images for good
+	if cfg.expireAfterDays > 0 {
+		if cfg.previewOutput != "" || cfg.exportFormat != "" {
+			cfg.expireAction = "exclude"
+		}
+		endSpan := traceSpan(traceProcessing, "expire images")
+		metas, err = expireImages(metas, cfg, md, failed)
+		if err != nil {
+			return err
+		}
+		endSpan()
+	}
+
+	available := append([]imageMeta(nil), metas...)
+
+	// Keep only images from the configured date range
+	endSpan = traceSpan(traceProcessing, "select images")
+	metas = filterByDate(metas, cfg)
+
+	st, hasState, err := loadState()
+	if err != nil {
+		return err
+	}
+
+	// Limit the number of images
+	metas = selectImages(metas, cfg, &st)
+	slog.Debug(msg("generate.selected", len(metas), len(available)))
+
+	// Order the tiles
+	if err := shufflers[cfg.shuffle].shuffle(metas, cfg, &st); err != nil {
+		return err
+	}
+	// A manual order is taken as it is
+	if cfg.shuffle != "manual" {
+		mixFolders(metas, cfg)
+	}
+	endSpan()
+
+	if cfg.translateCmd != "" && cfg.translateTo != "" {
+		// A failing translator shouldn't keep the slider from updating
+		endSpan := traceSpan(traceProcessing, "translate captions")
+		if err := translateCaptions(metas, cfg); err != nil {
+			slog.Warn(msg("generate.translate_failed", err))
+		}
+		endSpan()
+	}
+
+	if cfg.heroTile && len(metas) > 0 {
+		// The same images in the same order make the same mosaic
+		key := heroKey(heroFile(cfg), metas, cfg)
+		if _, err := os.Stat(heroFile(cfg)); err != nil || key != bc.Hero {
+			endSpan := traceSpan(traceProcessing, "render hero")
+			if err := renderHero(heroFile(cfg), metas, cfg); err != nil {
+				return err
+			}
+			endSpan()
+			if cfg.previewOutput == "" {
+				bc.Hero = key
+			}
+		}
+	}
+
+	if cfg.qrCodes != "off" {
+		endSpan := traceSpan(traceProcessing, "make QR codes")
+		makeQRCodes(metas, cfg)
+		endSpan()
+	}
+	if cfg.effect == "kenburns" {
+		planKenBurns(metas, cfg)
+	}
+
+	if cfg.borderMode == "auto" {
+		endSpan := traceSpan(traceProcessing, "find colors")
+		pickAccents(metas, cfg)
+		bc.addColors(metas)
+		endSpan()
+	}
+
+	endSpan = traceSpan(traceProcessing, "convert animations")
+	if err := convertAnimations(metas, cfg, failed); err != nil {
+		return err
+	}
+	endSpan()
+
+	endSpan = traceSpan(traceProcessing, "optimize images")
+	if err := optimizeImages(metas, cfg, failed); err != nil {
+		return err
+	}
+	endSpan()
+
+	endSpan = traceSpan(traceProcessing, "stamp watermarks")
+	if err := stampWatermarks(metas, cfg, failed); err != nil {
+		return err
+	}
+	endSpan()
+	if cfg.exportFormat != "" {
+		defer traceSpan(traceRendering, "write export", "format", cfg.exportFormat)()
+		if cfg.exportFormat == "site" {
+			return writeSite(cfg.siteFolder, metas, cfg)
+		}
+		return writeExport(cfg.exportFormat, metas, cfg)
+	}
+
+	glyphs := captionGlyphs(metas, cfg)
+	cfg.hasEmoji = hasEmoji(glyphs)
+	if cfg.localFont {
+		// Without a connection, fall back to Google Fonts
+		endSpan := traceSpan(traceProcessing, "load font")
+		if cfg.fontCSS, err = loadLocalFont(cfg, glyphs); err != nil {
+			slog.Warn(msg("generate.font_failed", err))
+		}
+		endSpan()
+	}
+
+	endSpan = traceSpan(traceProcessing, "copy assets")
+	if cfg.audioURL, err = prepareAudio(cfg); err != nil {
+		return err
+	}
+	if cfg.backgroundURL, err = prepareBackground(cfg); err != nil {
+		return err
+	}
+	if cfg.placeholderURL, err = preparePlaceholder(cfg); err != nil {
+		return err
+	}
+	endSpan()
+
+	endSpan = traceSpan(traceRendering, "write html", "path", out, "tiles", strconv.Itoa(len(metas)))
+	if err := writePage(out, metas, cfg); err != nil {
+		return err
+	}
+	endSpan()
+	if cfg.previewOutput == "" {
+		endSpan := traceSpan(traceRendering, "write source size variants")
+		if err := writeSourceSizes(metas, cfg); err != nil {
+			return err
+		}
+		endSpan()
+	}
+	if cfg.diff {
+		return nil
+	}
+	if cfg.previewOutput != "" {
+		slog.Info(msg("generate.preview", out, countNoun(len(metas), "count.image")))
+		return nil
+	}
+	if err := saveBuildCache(bc); err != nil {
+		return err
+	}
+	if cfg.errorPage {
+		if err := saveLastGood(outputFile); err != nil {
+			return err
+		}
+	}
+	sweepAssets()
+	if cfg.scheduleFile != "" {
+		endSpan := traceSpan(traceRendering, "write schedule")
+		if err := writeSchedule(cfg.scheduleFile, buildSchedule(metas, cfg)); err != nil {
+			return err
+		}
+		endSpan()
 	}
 
-	if err := writeHTML(outputFile, metas, cfg); err != nil {
+	endSpan = traceSpan(traceProcessing, "track lifecycle")
+	trackLifecycle(cfg, &st, !hasState, available, metas)
+	st.Config = cfg.settings
+	if err := saveState(st); err != nil {
+		return err
+	}
+	endSpan()
+	if cfg.previewScreenshot {
+		// A missing browser shouldn't fail an otherwise good generation
+		endSpan := traceSpan(traceRendering, "screenshot")
+		if err := savePreview(); err != nil {
+			slog.Warn(msg("generate.preview_failed", previewFile, err))
+		} else {
+			slog.Info(msg("generate.preview_saved", previewFile))
+		}
+		endSpan()
+	}
+	endSpan = traceSpan(traceProcessing, "post_generate hooks")
+	if err := runPostGenerateHooks(metas, cfg); err != nil {
 		return err
 	}
+	endSpan()
 
-	fmt.Println()
-	fmt.Printf("Generated %s with %d images from %s folder.\n", outputFile, len(metas), imageFolder)
-	fmt.Println()
-	fmt.Println("Instructions:")
-	fmt.Printf("1. Place your images in the \"%s\" folder\n", imageFolder)
-	fmt.Printf("2. Run this program to generate the HTML (edit %s to hide author)\n", configFile)
-	fmt.Printf("3. Add %s as web source in OBS to view the photo slider\n", outputFile)
-	fmt.Println()
+	slog.Info("")
+	slog.Info(msg("generate.done", outputFile, countNoun(len(metas), "count.image"), imageFolder))
+	slog.Info("")
+	slog.Info(msg("generate.instructions"))
+	slog.Info(msg("generate.step1", imageFolder))
+	slog.Info(msg("generate.step2", configFile))
+	slog.Info(msg("generate.step3", outputFile))
+	slog.Info("")
 	return nil
 }
 
-func findImages(root string) ([]string, error) {
+func findImages(root string, filter pathFilter) ([]string, error) {
 	entries, err := os.ReadDir(root)
 	if err != nil {
-		return nil, fmt.Errorf("read dir %s: %w", root, err)
+		return nil, errorf("file.read_dir", root, err)
 	}
 	out := make([]string, 0, len(entries))
 	for _, e := range entries {
@@ -111,11 +806,33 @@ func findImages(root string) ([]string, error) {
 		if _, ok := allowedExt[ext]; !ok {
 			continue
 		}
-		out = append(out, filepath.Join(root, e.Name()))
+		path := filepath.Join(root, e.Name())
+		if !filter.allows(path) {
+			continue
+		}
+		out = append(out, path)
+	}
+	if root == imageFolder {
+		for _, folder := range filter.folders {
+			more, err := findImages(filepath.Join(root, filepath.FromSlash(folder)), filter)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, more...)
+		}
 	}
 	return out, nil
 }
 
+// newImageMeta describes the image at path, with author and title taken
+// from its filename.
+func newImageMeta(path string) imageMeta {
+	base := filepath.Base(path)
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+	author, title := parseAuthorTitle(name)
+	return imageMeta{relPath: filepath.ToSlash(path), source: path, author: author, title: title}
+}
+
 func parseAuthorTitle(filename string) (string, string) {
 	// Expect format: "author - title"
 	// If missing, author defaults to "Author" and title uses the filename
@@ -126,8 +843,9 @@ func parseAuthorTitle(filename string) (string, string) {
 		if len(parts) > 1 {
 			rawTitle = strings.TrimSpace(parts[1])
 		}
-		repAuthor := strings.Replace(rawAuthor, "%", "<br>", -1)
-		repTitle := strings.Replace(rawTitle, "%", "<br>", -1)
+		// File names are text, and may come from anyone who can upload
+		repAuthor := strings.Replace(html.EscapeString(rawAuthor), "%", "<br>", -1)
+		repTitle := strings.Replace(html.EscapeString(rawTitle), "%", "<br>", -1)
 		author := strings.TrimSpace(repAuthor)
 		title := strings.TrimSpace(repTitle)
 		if author == "" {
@@ -138,39 +856,87 @@ func parseAuthorTitle(filename string) (string, string) {
 		}
 		return author, title
 	}
-	filename = strings.Replace(filename, "%", "<br>", -1)
+	filename = strings.Replace(html.EscapeString(filename), "%", "<br>", -1)
 	return "", filename
 }
 
+// configMissing says once that there is no config file, rather than on
+// every read of watch and serve mode.
+var configMissing sync.Once
+
 func readConfig() (config, error) {
 	// Default config values
 	cfg := config{
-		includeAuthor:     true,
-		authorTextColor:   "#ffffff",
-		authorStrokeColor: "#803128",
-		titleTextColor:    "#ffffff",
-		titleStrokeColor:  "#bd685e",
-		imageBorderColor:  "#741d34",
-		imageBorderStyle:  "dashed",
+		includeAuthor: true,
+		themeName:     defaultThemeName,
+		heroTile:      false,
+
+		sequenceFrameSeconds: 0.5,
+		imageFit:             "contain",
+		duplicates:           "skip",
+		nearDuplicateBits:    5,
+		validateImages:       "full",
+		limits:               imageLimits{maxSide: 16384, maxPixels: 100_000_000},
+		selection:            "random",
+		shuffle:              "random",
+		captionRenderer:      "css",
+		borderMode:           "theme",
+		reducedMotion:        "slow",
+		dateSource:           "modified",
+		expireAction:         "exclude",
+		scheduleViewport:     1920,
+		canvasWidth:          1920,
+		canvasHeight:         baseCanvasHeight,
+		scale:                1,
+		outputMode:           "full",
+		lazyLoading:          "off",
+		fontDisplay:          "swap",
+		emojiFont:            "noto",
+		watermarkPosition:    "bottom-right",
+		watermarkOpacity:     0.5,
+		watermarkSize:        0.2,
+		qrCodes:              "off",
+		qrSize:               120,
+		linkCaption:          "off",
+		chatPinSeconds:       defaultPinSeconds,
+		safetyThreshold:      0.8,
+		safetyAction:         "quarantine",
+		effect:               "none",
+		audioVolume:          0.3,
+		optimizeQuality:      85,
+		animatedImages:       "keep",
+		animatedMaxMegabytes: 5,
+		animatedMaxFPS:       30,
+		layout:               "strip",
+		rowThresholds:        []float64{1},
+		workers:              runtime.NumCPU(),
+		lang:                 systemLanguage(),
+		logMaxSize:           10 << 20,
+		hooks:                map[string][]string{},
+		settings:             map[string]string{},
 	}
 
-	// Check if config file exists
+	// Without a config file, "photo-slider init" creates one
 	if _, err := os.Stat(configFile); errors.Is(err, fs.ErrNotExist) {
-		// Create default config file
-		if err := createDefaultConfig(); err != nil {
-			return cfg, fmt.Errorf("failed to create default config: %w", err)
-		}
+		localizeConfig(&cfg)
+		configMissing.Do(func() { slog.Info(msg("config.missing", configFile)) })
 		return cfg, nil
 	}
 
 	// Read config file
 	content, err := os.ReadFile(configFile)
 	if err != nil {
-		return cfg, fmt.Errorf("failed to read config file: %w", err)
+		return cfg, errorf("config.read_failed", err)
 	}
 
 	// Parse config
 	lines := strings.Split(string(content), "\n")
+	playlists, err := parsePlaylists(lines)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.playlist = activePlaylist(playlists, time.Now())
+	lines = append(lines, playlistLines(lines, cfg.playlist)...)
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
 		if line == "" || strings.HasPrefix(line, "#") {
@@ -181,63 +947,828 @@ func readConfig() (config, error) {
 			parts := strings.SplitN(line, "=", 2)
 			key := strings.TrimSpace(parts[0])
 			value := strings.TrimSpace(parts[1])
+			cfg.settings[key] = value
+
+			if setStyleOption(&cfg.style, key, value) {
+				continue
+			}
+			if strings.HasPrefix(key, "theme.") {
+				setThemeOption(&cfg, key, value)
+				continue
+			}
+			if strings.HasPrefix(key, "source.") {
+				if err := setSourceOption(&cfg, key, value); err != nil {
+					return cfg, err
+				}
+				continue
+			}
 
 			switch key {
 			case "include_author":
 				cfg.includeAuthor = value == "true"
-			case "author_text_color":
-				cfg.authorTextColor = value
-			case "author_stroke_color":
-				cfg.authorStrokeColor = value
-			case "title_text_color":
-				cfg.titleTextColor = value
-			case "title_stroke_color":
-				cfg.titleStrokeColor = value
-			case "image_border_color":
-				cfg.imageBorderColor = value
-			case "image_border_style":
-				cfg.imageBorderStyle = value
+			case "theme":
+				cfg.themeName = value
+			case "hero_tile":
+				cfg.heroTile = value == "true"
+			case "interactive":
+				cfg.interactive = value == "true"
+			case "hero_title":
+				cfg.heroTitle = value
+			case "end_credits":
+				cfg.endCredits = value == "true"
+			case "end_credits_title":
+				cfg.endCreditsTitle = value
+			case "custom_css_file":
+				cfg.customCSSFile = value
+			case "custom_js_file":
+				cfg.customJSFile = value
+			case "sequence_tiles":
+				cfg.sequenceTiles = value == "true"
+			case "sequence_frame_seconds":
+				seconds, err := strconv.ParseFloat(value, 64)
+				if err != nil || seconds <= 0 {
+					return cfg, errorf("value.invalid", key, value)
+				}
+				cfg.sequenceFrameSeconds = seconds
+			case "caption_format":
+				cfg.captionFormat = value
+			case "folder":
+				cfg.filter.within = strings.Trim(filepath.ToSlash(value), "/")
+			case "caption_renderer":
+				if _, ok := captionRenderers[value]; !ok {
+					return cfg, errorf("value.expected", key, value, captionRendererNames())
+				}
+				cfg.captionRenderer = value
+			case "border_mode":
+				if value != "theme" && value != "auto" {
+					return cfg, errorf("value.expected", key, value, oneOf("theme", "auto"))
+				}
+				cfg.borderMode = value
+			case "max_image_width":
+				width, err := strconv.Atoi(value)
+				if err != nil || width < 0 {
+					return cfg, errorf("value.invalid", key, value)
+				}
+				cfg.maxImageWidth = width
+			case "image_fit":
+				if value != "contain" && value != "cover" {
+					return cfg, errorf("value.expected", key, value, oneOf("contain", "cover"))
+				}
+				cfg.imageFit = value
+			case "preview_screenshot":
+				cfg.previewScreenshot = value == "true"
+			case "duplicates":
+				if value != "skip" && value != "report" && value != "off" {
+					return cfg, errorf("value.expected", key, value, oneOf("skip", "report", "off"))
+				}
+				cfg.duplicates = value
+			case "near_duplicates":
+				cfg.nearDuplicates = value == "true"
+			case "near_duplicate_threshold":
+				threshold, err := strconv.Atoi(value)
+				if err != nil || threshold < 0 || threshold > 64 {
+					return cfg, errorf("value.invalid", key, value)
+				}
+				cfg.nearDuplicateBits = threshold
+			case "validate_images":
+				if value != "full" && value != "header" && value != "off" {
+					return cfg, errorf("value.expected", key, value, oneOf("full", "header", "off"))
+				}
+				cfg.validateImages = value
+			case "max_image_dimension":
+				side, err := strconv.Atoi(value)
+				if err != nil || side < 0 {
+					return cfg, errorf("value.invalid", key, value)
+				}
+				cfg.limits.maxSide = side
+			case "max_image_megapixels":
+				mp, err := strconv.Atoi(value)
+				if err != nil || mp < 0 {
+					return cfg, errorf("value.invalid", key, value)
+				}
+				cfg.limits.maxPixels = mp * 1_000_000
+			case "include":
+				cfg.filter.include = append(cfg.filter.include, splitList(value)...)
+			case "exclude":
+				cfg.filter.exclude = append(cfg.filter.exclude, splitList(value)...)
+			case "webhook_url":
+				cfg.webhookURLs = append(cfg.webhookURLs, value)
+			case "webhook_events":
+				events := splitList(value)
+				if err := validateEvents(events); err != nil {
+					return cfg, err
+				}
+				cfg.webhookEvents = append(cfg.webhookEvents, events...)
+			case "max_images":
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 0 {
+					return cfg, errorf("value.invalid", key, value)
+				}
+				cfg.maxImages = n
+			case "target_loop_seconds":
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 0 {
+					return cfg, errorf("value.invalid", key, value)
+				}
+				cfg.targetLoopSeconds = n
+			case "reduced_motion":
+				if value != "slow" && value != "pause" && value != "off" {
+					return cfg, errorf("value.expected", key, value, oneOf("slow", "pause", "off"))
+				}
+				cfg.reducedMotion = value
+			case "dwell_seconds":
+				n, err := strconv.ParseFloat(value, 64)
+				if err != nil || n < 0 {
+					return cfg, errorf("value.invalid", key, value)
+				}
+				cfg.dwellSeconds = n
+			case "selection":
+				if value != "newest" && value != "random" && value != "rotate" && value != "least-recent" {
+					return cfg, errorf("value.expected", key, value, oneOf("newest", "random", "rotate", "least-recent"))
+				}
+				cfg.selection = value
+			case "new_image_runs":
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 0 {
+					return cfg, errorf("value.invalid", key, value)
+				}
+				cfg.newImageRuns = n
+			case "shuffle":
+				if _, ok := shufflers[value]; !ok {
+					return cfg, errorf("value.expected", key, value, shufflerNames())
+				}
+				cfg.shuffle = value
+			case "manual_order_file":
+				cfg.manualOrderFile = value
+			case "mix_ratio":
+				ratio, err := parseMixRatio(value)
+				if err != nil {
+					return cfg, errorf("value.invalid_because", key, value, err)
+				}
+				cfg.mixRatio = ratio
+				cfg.filter.folders = mixedFolders(ratio)
+			case "sources":
+				sources, err := parseSources(value)
+				if err != nil {
+					return cfg, errorf("value.invalid_because", key, value, err)
+				}
+				cfg.sources = sources
+			case "since":
+				age, err := parseSince(value)
+				if err != nil {
+					return cfg, err
+				}
+				cfg.dates.from = time.Now().Add(-age)
+			case "min_date":
+				day, err := parseDay(value)
+				if err != nil {
+					return cfg, err
+				}
+				cfg.dates.from = day
+			case "max_date":
+				day, err := parseDay(value)
+				if err != nil {
+					return cfg, err
+				}
+				cfg.dates.to = day.AddDate(0, 0, 1)
+			case "date_source":
+				if value != "modified" && value != "taken" {
+					return cfg, errorf("value.expected", key, value, oneOf("modified", "taken"))
+				}
+				cfg.dateSource = value
+			case "expire_after_days":
+				days, err := strconv.Atoi(value)
+				if err != nil || days < 0 {
+					return cfg, errorf("value.expected_days", key, value)
+				}
+				cfg.expireAfterDays = days
+			case "expire_action":
+				if value != "exclude" && value != "archive" {
+					return cfg, errorf("value.expected", key, value, oneOf("exclude", "archive"))
+				}
+				cfg.expireAction = value
+			case "error_page":
+				cfg.errorPage = value == "true"
+			case "backups":
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 0 {
+					return cfg, errorf("value.expected_count", key, value)
+				}
+				cfg.backups = n
+			case "schedule_file":
+				cfg.scheduleFile = value
+			case "export_base_url":
+				cfg.exportBaseURL = value
+			case "schedule_viewport_width":
+				width, err := strconv.Atoi(value)
+				if err != nil || width <= 0 {
+					return cfg, errorf("value.invalid", key, value)
+				}
+				cfg.scheduleViewport = width
+			case "canvas":
+				width, height, err := parseCanvas(value)
+				if err != nil {
+					return cfg, errorf("value.invalid_because", key, value, err)
+				}
+				cfg.canvasWidth, cfg.canvasHeight = width, height
+			case "source_sizes":
+				cfg.sourceSizes = nil
+				for _, item := range splitList(value) {
+					width, height, err := parseCanvas(item)
+					if err != nil {
+						return cfg, errorf("value.invalid_because", key, value, err)
+					}
+					cfg.sourceSizes = append(cfg.sourceSizes, sourceSize{width, height})
+				}
+			case "scale":
+				n, err := strconv.ParseFloat(value, 64)
+				if err != nil || n < 0.25 || n > 8 {
+					return cfg, errorf("value.expected_scale", key, value)
+				}
+				cfg.scale = n
+			case "translate_cmd":
+				cfg.translateCmd = value
+			case "hook_pre_scan", "hook_per_image", "hook_post_generate":
+				point := strings.TrimPrefix(key, "hook_")
+				cfg.hooks[point] = append(cfg.hooks[point], value)
+			case "translate_to":
+				cfg.translateTo = value
+			case "admin_password":
+				cfg.adminPassword = value
+			case "moderation":
+				cfg.moderation = value == "true"
+			case "safety_cmd":
+				cfg.safetyCmd = value
+			case "safety_url":
+				cfg.safetyURL = value
+			case "safety_api_key":
+				cfg.safetyAPIKey = value
+			case "safety_threshold":
+				n, err := strconv.ParseFloat(value, 64)
+				if err != nil || n <= 0 || n > 1 {
+					return cfg, errorf("value.expected_fraction", key, value)
+				}
+				cfg.safetyThreshold = n
+			case "safety_action":
+				if value != "quarantine" && value != "report" {
+					return cfg, errorf("value.expected", key, value, oneOf("quarantine", "report"))
+				}
+				cfg.safetyAction = value
+			case "twitch_channel":
+				cfg.twitchChannel = value
+			case "twitch_user":
+				cfg.twitchUser = value
+			case "twitch_token":
+				cfg.twitchToken = value
+			case "chat_pin_seconds":
+				seconds, err := strconv.Atoi(value)
+				if err != nil || seconds <= 0 {
+					return cfg, errorf("value.expected_seconds", key, value)
+				}
+				cfg.chatPinSeconds = seconds
+			case "chat_post_links":
+				cfg.chatPostLinks = value == "true"
+			case "watermark_image":
+				cfg.watermarkImage = value
+			case "watermark_text":
+				cfg.watermarkText = value
+			case "watermark_position":
+				if _, ok := watermarkPositions[value]; !ok {
+					return cfg, errorf("value.expected", key, value, oneOf("top-left", "top-right", "bottom-left", "bottom-right"))
+				}
+				cfg.watermarkPosition = value
+			case "watermark_opacity", "watermark_size":
+				n, err := strconv.ParseFloat(value, 64)
+				if err != nil || n <= 0 || n > 1 {
+					return cfg, errorf("value.expected_fraction", key, value)
+				}
+				if key == "watermark_opacity" {
+					cfg.watermarkOpacity = n
+				} else {
+					cfg.watermarkSize = n
+				}
+			case "qr_codes":
+				if value != "off" && value != "caption" && value != "corner" {
+					return cfg, errorf("value.expected", key, value, oneOf("off", "caption", "corner"))
+				}
+				cfg.qrCodes = value
+			case "qr_size":
+				size, err := strconv.Atoi(value)
+				if err != nil || size <= 0 {
+					return cfg, errorf("value.invalid", key, value)
+				}
+				cfg.qrSize = size
+			case "links_file":
+				cfg.linksFile = value
+			case "link_caption":
+				if value != "off" && value != "handle" && value != "url" {
+					return cfg, errorf("value.expected", key, value, oneOf("off", "handle", "url"))
+				}
+				cfg.linkCaption = value
+			case "effect":
+				if value != "none" && value != "kenburns" {
+					return cfg, errorf("value.expected", key, value, oneOf("none", "kenburns"))
+				}
+				cfg.effect = value
+			case "effect_seed":
+				seed, err := strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					return cfg, errorf("value.invalid", key, value)
+				}
+				cfg.effectSeed = seed
+			case "workers":
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 0 {
+					return cfg, errorf("value.expected_workers", key, value)
+				}
+				if n == 0 {
+					n = runtime.NumCPU()
+				}
+				cfg.workers = n
+			case "optimize":
+				cfg.optimize = value == "true"
+			case "optimize_quality":
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 1 || n > 100 {
+					return cfg, errorf("value.expected_percent", key, value)
+				}
+				cfg.optimizeQuality = n
+			case "animated_images":
+				if value != "keep" && value != "poster" && value != "video" {
+					return cfg, errorf("value.expected", key, value, oneOf("keep", "poster", "video"))
+				}
+				cfg.animatedImages = value
+			case "animated_max_megabytes":
+				n, err := strconv.ParseFloat(value, 64)
+				if err != nil || n < 0 {
+					return cfg, errorf("value.invalid", key, value)
+				}
+				cfg.animatedMaxMegabytes = n
+			case "animated_max_fps":
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 0 {
+					return cfg, errorf("value.invalid", key, value)
+				}
+				cfg.animatedMaxFPS = n
+			case "audio_file":
+				cfg.audioFile = value
+			case "lang":
+				if _, ok := catalogs[value]; !ok {
+					return cfg, errorf("value.expected", key, value, oneOf(languages()...))
+				}
+				cfg.lang = value
+			case "log_file":
+				cfg.logFile = value
+			case "log_max_size":
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 0 {
+					return cfg, errorf("value.expected_megabytes", key, value)
+				}
+				cfg.logMaxSize = int64(n) << 20
+			case "placeholder_text":
+				cfg.placeholderText = value
+			case "placeholder_image":
+				cfg.placeholderImage = value
+			case "audio_volume":
+				n, err := strconv.ParseFloat(value, 64)
+				if err != nil || n < 0 || n > 1 {
+					return cfg, errorf("value.expected_unit", key, value)
+				}
+				cfg.audioVolume = n
+			case "font_display":
+				if _, ok := fontDisplays[value]; !ok {
+					return cfg, errorf("value.expected", key, value, oneOf("swap", "block", "fallback", "optional", "auto"))
+				}
+				cfg.fontDisplay = value
+			case "local_font":
+				cfg.localFont = value == "true"
+			case "font_fallback":
+				cfg.fontFallbacks = append(cfg.fontFallbacks, value)
+			case "emoji_font":
+				if _, ok := emojiFonts[value]; !ok {
+					return cfg, errorf("value.expected", key, value, oneOf("noto", "system", "none"))
+				}
+				cfg.emojiFont = value
+			case "layout":
+				if value != "strip" && value != "rows" {
+					return cfg, errorf("value.expected", key, value, oneOf("strip", "rows"))
+				}
+				cfg.layout = value
+			case "row_thresholds":
+				thresholds, err := parseThresholds(value)
+				if err != nil {
+					return cfg, errorf("value.invalid_detail", key, value, err)
+				}
+				cfg.rowThresholds = thresholds
+			case "output_mode":
+				if value != "full" && value != "compact" {
+					return cfg, errorf("value.expected", key, value, oneOf("full", "compact"))
+				}
+				cfg.outputMode = value
+			case "lazy_loading":
+				if value != "off" && value != "native" && value != "observer" {
+					return cfg, errorf("value.expected", key, value, oneOf("off", "native", "observer"))
+				}
+				cfg.lazyLoading = value
 			}
 		}
 	}
 
+	if cfg.layout == "rows" && cfg.scheduleFile != "" {
+		return cfg, errorf("config.schedule_rows")
+	}
+	if cfg.captionRenderer != "css" && cfg.outputMode == "compact" {
+		return cfg, errorf("config.renderer_compact", cfg.captionRenderer)
+	}
+	if cfg.layout == "rows" && cfg.dwellSeconds > 0 {
+		return cfg, errorf("config.dwell_rows")
+	}
+	if err := applySourceOptions(&cfg); err != nil {
+		return cfg, err
+	}
+	// mix_ratio can weigh sources too, which aren't subfolders
+	cfg.filter.folders = slices.DeleteFunc(cfg.filter.folders, func(folder string) bool { return cfg.source(folder) != nil })
+	if within := cfg.filter.within; within != "" && !slices.Contains(cfg.filter.folders, within) {
+		cfg.filter.folders = append(cfg.filter.folders, within)
+	}
+	// scale and schedule_viewport_width win over what canvas implies
+	if _, ok := cfg.settings["scale"]; !ok {
+		cfg.scale = float64(cfg.canvasHeight) / baseCanvasHeight
+	}
+	if _, ok := cfg.settings["schedule_viewport_width"]; !ok {
+		cfg.scheduleViewport = cfg.canvasWidth
+	}
+	localizeConfig(&cfg)
 	return cfg, nil
 }
 
-func createDefaultConfig() error {
-	content := `# Photo Slider Configuration
+// defaultConfig is the config file init -defaults writes, with every option
+// explained.
+func defaultConfig() string {
+	return `# Photo Slider Configuration
 # Set include_author to true to show author names, false to hide them
 include_author=true
 
-# Color customization (use hex color codes like #ffffff)
-author_text_color=#ffffff
-author_stroke_color=#803128
-title_text_color=#ffffff
-title_stroke_color=#bd685e
-image_border_color=#741d34
+# Theme options: default, neon, pastel, minimal, dark (or a custom theme defined below)
+theme=default
+
+# Language of messages and default texts: en or de (defaults to the system language)
+#lang=de
+
+# Uncomment to override the colors of the selected theme (use hex color codes like #ffffff)
+#author_text_color=#ffffff
+#author_stroke_color=#803128
+#title_text_color=#ffffff
+#title_stroke_color=#bd685e
+#image_border_color=#741d34
 
 # Border style options: none, solid, dashed, dotted, double, groove, ridge, inset, outset
-image_border_style=dashed
+#image_border_style=dashed
+
+# Border and outline colors: theme (the colors above for every image) or auto
+# (each image's border and caption outlines in its own dominant colors)
+border_mode=theme
+
+# Google Fonts family used for captions, and caption placement (below, above, none)
+#font=Nunito:ital,wght@1,800
+#caption_placement=below
+
+# Page background: transparent (to show what's behind the OBS source), a color
+# like #202020, a gradient like gradient(to right, #1e3c72, #2a5298), or an
+# image file; background_fit is cover, contain or tile for images
+#background=transparent
+#background_fit=cover
+
+# How captions wait for the font: swap (show a fallback font meanwhile), block
+# (stay invisible until it has loaded, for up to 3 seconds), fallback, optional or auto.
+# With local_font=true the font is downloaded into the cache folder and embedded
+# in the page (only the characters the captions use), so it is there on the
+# first frame of every refresh
+font_display=swap
+local_font=false
+
+# Fonts for characters the theme font doesn't have, e.g. Japanese titles, tried
+# in order. Google Fonts families like font; repeat the line for more than one
+#font_fallback=Noto Sans JP:wght@800
+
+# Emoji in captions: noto (Noto Color Emoji, the same on every machine), system
+# (the emoji font of the OS, which looks different on Windows and macOS) or none
+emoji_font=noto
+
+# Custom themes: theme.<name>.<option>, optionally based on another theme
+#theme.mytheme.base=dark
+#theme.mytheme.title_stroke_color=#ff8800
+
+# Opening "hero" tile showing a mosaic of all images ({count} is replaced with the number of images)
+hero_tile=false
+#hero_title=Fan Art Wall — {count} pieces
+
+# Closing tiles thanking every artist in the slider, with how many of their
+# pieces it shows
+end_credits=false
+#end_credits_title=Thanks to our artists!
+
+# For a touchscreen: tap an image to show it full-screen, tap elsewhere to pause,
+# swipe to scroll to the next image. Leave off for OBS, which passes clicks on
+interactive=false
+
+# Files whose contents are inlined into the page (CSS at the end of the styles, JS at the end of the body)
+#custom_css_file=custom.css
+#custom_js_file=custom.js
+
+# Show subfolders holding a numbered image sequence (e.g. WIP shots) as a single animated flipbook tile
+sequence_tiles=false
+sequence_frame_seconds=0.5
+
+# Caption template replacing the author/title lines. Placeholders: {author}, {title},
+# {filename}, {folder}, {date}, {width}, {height}, {translation}, {qr}; \n starts a new line
+#caption_format={title}\nby {author} • {date}
+
+# How captions are drawn: css (text outlined by the browser) or svg (text plates
+# that look the same in every OBS version; lines are wrapped by an estimate)
+caption_renderer=css
+
+# Widest an image may be shown, in pixels (0 for no limit). Wider images are
+# letterboxed (image_fit=contain) or cropped (image_fit=cover)
+max_image_width=0
+image_fit=contain
+
+# Size of the OBS canvas the page is shown on: 720p, 1080p, 1440p, 4k or a size
+# like 2560x1080. The page is laid out for 1080p and scaled to the canvas height,
+# so the strip takes up the same part of the screen. scale sets the factor
+# directly instead (1 is 1080p)
+canvas=1080p
+#scale=1.5
+
+# Browser source sizes to also lay the page out for, e.g. a wide strip and a
+# small one. Each gets a copy of photo.html scaled so the strip fills its height,
+# and the page switches to the one closest to the source's size when it loads,
+# so every source can use the same photo.html
+#source_sizes=1920x300, 800x150
+
+# Show scaled-down copies of JPEGs and PNGs taller than the slider shows them,
+# which saves a lot of OBS memory with camera photos. The copies are kept in the
+# cache folder (JPEGs at optimize_quality, 1-100); your images are not changed
+optimize=false
+optimize_quality=85
+
+# Animated GIFs and WebPs larger than animated_max_megabytes (0 for all of
+# them) or faster than animated_max_fps (0 for no limit) can stutter OBS. keep
+# shows them anyway and lists them, poster shows their first frame instead, and
+# video a looping WebM made with ffmpeg (which has to be installed)
+animated_images=keep
+animated_max_megabytes=5
+animated_max_fps=30
+
+# How many images are read, hashed and converted at the same time (0 for one
+# per CPU core)
+workers=0
+
+# Stamp a PNG logo or a line of text onto every image, e.g. your channel name.
+# The stamped copies are kept in the cache folder; your images are not changed.
+# Position: top-left, top-right, bottom-left or bottom-right. Size is the width
+# of the watermark as a fraction of the image width
+#watermark_image=logo.png
+#watermark_text=twitch.tv/mychannel
+watermark_position=bottom-right
+watermark_opacity=0.5
+watermark_size=0.2
+
+# Show a QR code linking to the artist's page (set in the admin page or API) in
+# the caption or the bottom right corner of the image: off, caption or corner
+qr_codes=off
+qr_size=120
+
+# Artist links from a CSV file with the columns image, author, link and handle:
+# each row sets the link (and the handle to show) of one image or of every image
+# by an author. Links set in the admin page or API win
+#links_file=links.csv
+# Show the artist's link under the title: off, handle (like @jane, where the
+# link is a profile on a known site) or url (the shortened address)
+link_caption=off
+
+# Slowly pan and zoom every image (Ken Burns effect): none or kenburns. Each image
+# moves in a random direction; set effect_seed to any number other than 0 to get
+# the same motions on every run
+effect=none
+effect_seed=0
+
+# Play a music file (or web address) in a loop behind the slider, at a volume
+# from 0 to 1. In OBS, tick "Control audio via OBS" on the browser source to
+# mix it like any other source
+#audio_file=music.mp3
+audio_volume=0.3
+
+# Shown instead of the slider while there are no images, so the browser source
+# isn't just blank. Leave the text empty to only show the image
+#placeholder_text=Drop images into the images folder
+#placeholder_image=placeholder.png
+
+# How tiles are written: full (as HTML) or compact (as a list the page turns into
+# HTML when it loads, much smaller for galleries with thousands of images)
+output_mode=full
+# When the page loads the images: off (all at once), native (when the browser
+# thinks they are needed) or observer (once they are a screen away from scrolling
+# in), so pages with thousands of images start faster and use less memory
+lazy_loading=off
+
+# Layout: strip (one row of tiles) or rows (a row per aspect ratio range, e.g.
+# portrait images on top and landscape ones below). row_thresholds are the
+# width/height ratios between the rows, smallest first, e.g. 0.8,1.25 for
+# portrait, square-ish and landscape rows
+layout=strip
+row_thresholds=1
+
+# Save a screenshot of the slider to photo-preview.png after generating (needs Chrome, Chromium or Edge)
+preview_screenshot=false
+
+# Duplicate images: skip (show only the first copy), report (show all, but list them) or off
+duplicates=skip
+# Also treat resized/recompressed copies as duplicates; the threshold is how
+# many of the 64 perceptual hash bits may differ
+near_duplicates=false
+near_duplicate_threshold=5
+
+# Skip images that can't be read: full (decode every image, catches truncated
+# files), header (only check the file header, faster) or off
+validate_images=full
+# Skip images larger than this (0 for no limit), so a malicious or broken file
+# can't use up all memory while decoding. 100 megapixels take about 400 MB
+max_image_dimension=16384
+max_image_megapixels=100
+
+# Comma separated file patterns to leave out, or to limit the slider to. Patterns
+# are relative to the images folder; ** matches any number of folders
+#exclude=*_wip*, drafts/**
+#include=*.png
+
+# Webhooks that receive a JSON POST for image events (image.first_shown, image.removed,
+# image.approved, image.rejected); leave webhook_events out to get all of them
+#webhook_url=https://example.com/hook
+#webhook_events=image.first_shown, image.removed
+
+# Show at most max_images images (0 for all), picked by selection: newest,
+# random, rotate (the next batch on every run, cycling through all images) or
+# least-recent (the images shown longest ago, never shown ones first)
+max_images=0
+selection=random
+
+# Make one loop of the strip last this many seconds, e.g. as long as a BRB
+# screen, by scrolling faster or slower (0 for 5 seconds per image). Images that
+# wouldn't get at least 3 seconds each are left out, picked by selection as well
+#target_loop_seconds=120
+
+# Stop the strip for this many seconds whenever an image is in the middle of the
+# screen, so viewers get a good look at each piece (0 to scroll without stopping).
+# Set "dwell" for an image in photo-slider.meta to give it a different pause
+#dwell_seconds=2
+
+# For viewers whose system asks for less motion, when the page is embedded on a
+# website (OBS never asks): slow (a quarter of the speed, no zooming or
+# flipbooks), pause (everything stands still) or off
+reduced_motion=slow
+
+# Keep images in the next new_image_runs generations after they are added,
+# whichever images selection would pick, so none slip through unseen (0 for off)
+new_image_runs=0
+
+# Order of the tiles: random, spread-author (random, but keeps images by the
+# same author apart), least-recent (images that weren't shown last time first)
+# or manual (the file names listed in manual_order_file, then the rest by name)
+shuffle=random
+
+# Also read these subfolders of the images folder and interleave their images
+# in this ratio, e.g. three from fanart for every one from memes. Images right
+# in the images folder count as 1 unless listed as "."
+#mix_ratio=fanart:3, memes:1
+#manual_order_file=order.txt
+
+# Only show the images in this subfolder of the images folder
+#folder=fanart
+
+# Folders outside the images folder to show too, as name:folder pairs. Folders
+# are relative to the program's folder. source.<name>.<option> gives the tiles
+# of a source a badge or their own caption and border colors
+#sources=fanart:fanart, memes:memes
+#source.fanart.badge=Fan Art
+#source.memes.title_text_color=#ffcc00
+
+# Playlists switch to other options at certain times: playlist.<name>.when takes
+# days (fri, sat-sun, ...) and/or a time range (18:00-23:00), and
+# playlist.<name>.<option> sets any option while it is active. The first
+# playlist whose time it is wins
+#playlist.friday.when=fri
+#playlist.friday.folder=fanart
+#playlist.friday.theme=neon
+
+# Only include images from the last period (e.g. 30d, 2w, 12h) or between two
+# dates (YYYY-MM-DD, both included). date_source is modified (file time) or
+# taken (EXIF date of photos, file time otherwise)
+#since=30d
+#min_date=2025-09-01
+#max_date=2025-09-30
+date_source=modified
+
+# Stop showing images dated (see date_source) more than this many days ago;
+# 0 keeps them forever. expire_action=archive also moves them from the images
+# folder to the archive folder, exclude leaves them where they are
+expire_after_days=0
+expire_action=exclude
+
+# If generating fails, replace photo.html with a page showing the error (and a
+# link to the last good version) instead of leaving old content on stream
+error_page=false
+
+# Keep this many earlier versions of photo.html in the backups folder, to go back
+# to one with "photo-slider rollback" if a generation turns out wrong on stream
+backups=0
+
+# Also write all messages to this file, with their time and the details only
+# -verbose shows, to look into what serve mode did later. Once it is larger than
+# log_max_size megabytes (0 for no limit) it is renamed to .1, keeping 3 old files
+#log_file=photo-slider.log
+log_max_size=10
+
+# Write a JSON schedule of which image is in the middle of the screen when, for
+# chat bots ("photo-slider now-showing" prints the current one). The slider then
+# keeps its position in sync with the clock. Set the width of the OBS source
+#schedule_file=photo-schedule.json
+schedule_viewport_width=1920
+
+# Where the folder with photo.html is published, e.g. on your website, for the
+# links in the gallery exports of -format rss, markdown and json (relative links
+# when empty; RSS readers need full ones)
+#export_base_url=https://example.com/slider
+
+# Command that machine-translates captions, shown under the original title.
+# It gets translate_to as its last argument and the titles on stdin, one per
+# line, and prints the translations in the same order. Results are cached
+#translate_cmd=python translate.py
+#translate_to=de
+
+# Commands run during every generation (each can be repeated, they run in
+# order). hook_pre_scan gets the images folder before it is read,
+# hook_per_image each image with its details as JSON on stdin (it may print
+# JSON to leave the image out or change its caption), hook_post_generate the
+# page once it is written
+#hook_pre_scan=python fetch_submissions.py
+#hook_per_image=python nsfw_check.py
+#hook_post_generate=sh upload.sh
+
+# Password for the admin page of "photo-slider serve" (disabled when empty)
+#admin_password=
+
+# Put images uploaded through the API in the incoming folder until they are
+# approved in the admin page or with "photo-slider review"
+moderation=false
+
+# Content filter that scores every image from 0 (safe) to 1 (not safe for
+# stream) before it is shown: safety_cmd gets the image path as its last
+# argument, safety_url gets the image POSTed (with safety_api_key as a Bearer
+# token). Images scoring safety_threshold or more are moved to the incoming
+# folder for review (quarantine) or only listed (report). Scores are cached
+#safety_cmd=python classify.py
+#safety_url=http://localhost:8000/classify
+#safety_api_key=
+safety_threshold=0.8
+safety_action=quarantine
+
+# Twitch channel whose moderators can pin images in "photo-slider serve" with
+# "!showart 12" or "!artist name" in chat. To post the artist's link in chat,
+# give a bot account and its OAuth token (chat:read and chat:edit scopes)
+#twitch_channel=
+#twitch_user=
+#twitch_token=
+chat_pin_seconds=30
+chat_post_links=false
 `
-	return os.WriteFile(configFile, []byte(content), 0o644)
+}
+
+// writePage writes the slider to path, or while there are no images, the
+// placeholder page.
+func writePage(path string, metas []imageMeta, cfg config) error {
+	if len(metas) == 0 {
+		// Say what to do instead of leaving the source blank
+		return writePlaceholder(path, cfg.placeholderURL, cfg)
+	}
+	return writeHTML(path, metas, cfg)
 }
 
 func writeHTML(path string, metas []imageMeta, cfg config) error {
-	f, err := os.Create(path)
+	f, err := createPage(path, cfg)
 	if err != nil {
-		return fmt.Errorf("create %s: %w", path, err)
+		return err
 	}
-	defer f.Close()
+	defer f.discard()
 	w := bufio.NewWriter(f)
 
 	// Begin HTML
 	mustWrite(w, "<!DOCTYPE html>\n")
-	mustWrite(w, "<html>\n")
+	mustWrite(w, fmt.Sprintf("<html lang=\"%s\">\n", cfg.lang))
 	mustWrite(w, "  <head>\n")
 	mustWrite(w, "    <title>Photo Slider</title>\n")
-	mustWrite(w, "    <link rel=\"preconnect\" href=\"https://fonts.googleapis.com\">\n")
-	mustWrite(w, "    <link rel=\"preconnect\" href=\"https://fonts.gstatic.com\" crossorigin>\n")
-	mustWrite(w, "    <link href=\"https://fonts.googleapis.com/css2?family=Nunito:ital,wght@1,800&display=swap\" rel=\"stylesheet\">\n")
+	writeSizeDetector(w, cfg)
+	writeFontLinks(w, cfg)
 	mustWrite(w, "    <style>\n")
 	mustWrite(w, "      html, body {\n")
 	mustWrite(w, "        display: flex;\n")
@@ -256,25 +1787,39 @@ func writeHTML(path string, metas []imageMeta, cfg config) error {
 	mustWrite(w, "       display: none;\n")
 	mustWrite(w, "     }\n")
 	mustWrite(w, "\n")
+	if cfg.theme.background != "transparent" {
+		writeBackgroundStyle(w, cfg)
+	}
 	mustWrite(w, "      *, *::before, *::after {\n")
 	mustWrite(w, "        box-sizing: border-box;\n")
 	mustWrite(w, "      }\n")
 	mustWrite(w, "\n")
 	mustWrite(w, "      #permas {\n")
-	mustWrite(w, "        height: 750px;\n")
+	mustWrite(w, fmt.Sprintf("        height: %dpx;\n", cfg.px(stripHeight)))
 	mustWrite(w, "        position: absolute;\n")
 	mustWrite(w, "        overflow: hidden;\n")
 	mustWrite(w, "        overflow-y: hidden;\n")
 	mustWrite(w, "        white-space: nowrap;\n")
 	mustWrite(w, "        left: 0;\n")
-	mustWrite(w, "        animation-name: scroll;\n")
-	mustWrite(w, fmt.Sprintf("        animation-duration: %ds;\n", len(metas)*5))
-	mustWrite(w, "        animation-iteration-count: infinite;\n")
-	mustWrite(w, "        animation-timing-function: linear;\n")
-	mustWrite(w, "        display: flex;\n")
-	mustWrite(w, "        width: max-content;\n")
-	mustWrite(w, "      }\n")
-	mustWrite(w, "\n")
+	rows := tileRows(metas, cfg)
+	if len(rows) > 1 {
+		// The rows scroll, each at its own pace
+		mustWrite(w, "        display: flex;\n")
+		mustWrite(w, "        flex-direction: column;\n")
+		mustWrite(w, "        width: 100%;\n")
+		mustWrite(w, "      }\n")
+		mustWrite(w, "\n")
+		writeRowsStyle(w, len(rows), cfg)
+	} else {
+		mustWrite(w, "        animation-name: scroll;\n")
+		mustWrite(w, fmt.Sprintf("        animation-duration: %ds;\n", loopSeconds(metas, cfg)))
+		mustWrite(w, "        animation-iteration-count: infinite;\n")
+		mustWrite(w, "        animation-timing-function: linear;\n")
+		mustWrite(w, "        display: flex;\n")
+		mustWrite(w, "        width: max-content;\n")
+		mustWrite(w, "      }\n")
+		mustWrite(w, "\n")
+	}
 	mustWrite(w, "      #permas .scroll-content {\n")
 	mustWrite(w, "        display: flex;\n")
 	mustWrite(w, "        white-space: nowrap;\n")
@@ -289,93 +1834,186 @@ func writeHTML(path string, metas []imageMeta, cfg config) error {
 	mustWrite(w, "\n")
 	mustWrite(w, "      .image-container {\n")
 	mustWrite(w, "        display: inline-block;\n")
-	mustWrite(w, "        margin-top: 32px;\n")
-	mustWrite(w, "        margin-right: 80px;\n")
-	mustWrite(w, "        text-align: center;\n")
-	mustWrite(w, "      }\n")
-	mustWrite(w, "\n")
-	mustWrite(w, "      #permas img {\n")
-	mustWrite(w, "        height: 500px;\n")
-	mustWrite(w, "        border-radius: 12px;\n")
-	mustWrite(w, "        display: block;\n")
-	mustWrite(w, "        margin-bottom: 10px;\n")
-	mustWrite(w, fmt.Sprintf("        outline: 5px %s %s;\n", cfg.imageBorderStyle, cfg.imageBorderColor))
-	mustWrite(w, "        outline-offset: 16px;\n")
-	mustWrite(w, "      }\n")
-	mustWrite(w, "\n")
-	mustWrite(w, "      #permas .caption {\n")
-	mustWrite(w, "        font-family: \"Nunito\", sans-serif;\n")
-	mustWrite(w, "        white-space: normal;\n")
-	mustWrite(w, "        overflow: hidden;\n")
-	mustWrite(w, "        text-overflow: ellipsis;\n")
-	mustWrite(w, "        max-width: 100%;\n")
+	mustWrite(w, fmt.Sprintf("        margin-top: %dpx;\n", cfg.px(32)))
+	mustWrite(w, fmt.Sprintf("        margin-right: %dpx;\n", cfg.px(tileSpacing)))
 	mustWrite(w, "        text-align: center;\n")
-	mustWrite(w, "        margin: 0 auto;\n")
-	mustWrite(w, "        margin-top: 32px;\n")
 	mustWrite(w, "      }\n")
 	mustWrite(w, "\n")
-	mustWrite(w, "      #permas .author {\n")
-	mustWrite(w, "        font-size: 48px;\n")
-	mustWrite(w, fmt.Sprintf("        color: %s;\n", cfg.authorTextColor))
-	mustWrite(w, fmt.Sprintf("        -webkit-text-stroke: 10px %s;\n", cfg.authorStrokeColor))
-	mustWrite(w, "        paint-order: stroke fill;\n")
-	mustWrite(w, "        font-weight: bold;\n")
+	mustWrite(w, "      #permas img, #permas video {\n")
+	mustWrite(w, fmt.Sprintf("        height: %dpx;\n", cfg.px(imageHeight)))
+	mustWrite(w, fmt.Sprintf("        border-radius: %dpx;\n", cfg.px(12)))
 	mustWrite(w, "        display: block;\n")
+	mustWrite(w, fmt.Sprintf("        margin-bottom: %dpx;\n", cfg.px(10)))
+	mustWrite(w, fmt.Sprintf("        outline: %dpx %s %s;\n", cfg.px(5), accentVar("border-style", cfg.theme.imageBorderStyle, cfg), accentVar("border", cfg.theme.imageBorderColor, cfg)))
+	mustWrite(w, fmt.Sprintf("        outline-offset: %dpx;\n", cfg.px(16)))
+	mustWrite(w, "        width: auto;\n")
+	if cfg.maxImageWidth > 0 {
+		mustWrite(w, fmt.Sprintf("        max-width: %dpx;\n", cfg.px(cfg.maxImageWidth)))
+		mustWrite(w, fmt.Sprintf("        object-fit: %s;\n", cfg.imageFit))
+	}
 	mustWrite(w, "      }\n")
 	mustWrite(w, "\n")
-	mustWrite(w, "      #permas .title {\n")
-	mustWrite(w, "        font-size: 40px;\n")
-	mustWrite(w, "        display: block;\n")
-	mustWrite(w, fmt.Sprintf("        color: %s;\n", cfg.titleTextColor))
-	mustWrite(w, fmt.Sprintf("        -webkit-text-stroke: 10px %s;\n", cfg.titleStrokeColor))
-	mustWrite(w, "        paint-order: stroke fill;\n")
-	mustWrite(w, "      }\n")
-	mustWrite(w, "\n")
-	mustWrite(w, "      @keyframes scroll {\n")
-	mustWrite(w, "        0% {\n")
-	mustWrite(w, "          transform: translateX(0);\n")
-	mustWrite(w, "        }\n")
-	mustWrite(w, "        100% {\n")
-	mustWrite(w, "          transform: translateX(-50%);\n")
-	mustWrite(w, "        }\n")
-	mustWrite(w, "      }\n")
+	captionRenderers[cfg.captionRenderer].writeStyle(w, cfg)
+	writeSourceStyle(w, cfg)
+	if cfg.heroTile {
+		writeHeroStyle(w, cfg)
+	}
+	if cfg.endCredits {
+		writeCreditsStyle(w, cfg)
+	}
+	if cfg.sequenceTiles {
+		writeSequenceStyle(w, cfg)
+	}
+	if cfg.qrCodes != "off" {
+		writeQRStyle(w, cfg)
+	}
+	if cfg.effect == "kenburns" {
+		writeKenBurnsStyle(w, metas, cfg)
+	}
+	if cfg.remoteControl {
+		writeOverlayStyle(w, "pin", cfg)
+	}
+	if cfg.interactive {
+		writeKioskStyle(w, cfg)
+	}
+	if cfg.debugOverlay {
+		writeDebugStyle(w)
+	}
+	writeScrollKeyframes(w, metas, cfg)
+	writeReducedMotion(w, cfg)
+	writeLazyStyle(w, cfg)
+	writeCustomCSS(w, cfg)
 	mustWrite(w, "    </style>\n")
 	mustWrite(w, "  </head>\n")
 	mustWrite(w, "  <body>\n")
-	mustWrite(w, "    <div id=\"permas\">\n")
-	mustWrite(w, "      <div class=\"scroll-content\">\n")
-
-	for _, m := range metas {
-		writeImageContainer(w, m, cfg)
-	}
-
-	mustWrite(w, "      </div>\n")
-	mustWrite(w, "      <div class=\"scroll-content-duplicate\">\n")
-
-	for _, m := range metas {
-		writeImageContainer(w, m, cfg)
+	mustWrite(w, fmt.Sprintf("    <div id=\"permas\" role=\"region\" aria-label=\"%s\">\n", html.EscapeString(msg("a11y.slider"))))
+	credits := creditsSlides(metas, cfg)
+	for i, row := range rows {
+		if len(rows) > 1 {
+			mustWrite(w, fmt.Sprintf("      <div class=\"row\" style=\"animation-duration: %ds\">\n", rowSeconds(i, row, len(credits), cfg)))
+		}
+		mustWrite(w, "      <div class=\"scroll-content\">\n")
+		if i == 0 && cfg.heroTile && len(metas) > 0 {
+			writeHeroContainer(w, len(metas), cfg)
+		}
+		// In compact mode the tiles are added by writeCompactTiles
+		if cfg.outputMode == "full" {
+			for _, m := range row {
+				writeImageContainer(w, m, cfg)
+			}
+		}
+		if i == 0 {
+			writeCreditsContainers(w, credits, cfg)
+		}
+		mustWrite(w, "      </div>\n")
+		// The second copy only makes the loop seamless, so duplicateClient
+		// fills it in rather than the page carrying every tile twice
+		mustWrite(w, "      <div class=\"scroll-content-duplicate\" aria-hidden=\"true\"></div>\n")
+		if len(rows) > 1 {
+			mustWrite(w, "      </div>\n")
+		}
 	}
-
-	mustWrite(w, "      </div>\n")
 	mustWrite(w, "    </div>\n")
+	if cfg.outputMode == "compact" {
+		writeCompactTiles(w, metas, cfg)
+	}
+	mustWrite(w, duplicateClient)
+	if cfg.lazyLoading == "observer" {
+		mustWrite(w, lazyClient)
+	}
+	if cfg.scheduleFile != "" {
+		writeClockSync(w, metas, cfg)
+	}
+	if cfg.reducedMotion == "slow" {
+		mustWrite(w, reducedMotionClient)
+	}
+	if cfg.remoteControl {
+		mustWrite(w, controlClient)
+	}
+	if cfg.interactive {
+		mustWrite(w, kioskClient)
+	}
+	if cfg.debugOverlay {
+		writeDebugClient(w)
+	}
+	if cfg.audioURL != "" {
+		writeAudio(w, cfg)
+	}
+	writeCustomJS(w, cfg)
 	mustWrite(w, "  </body>\n")
 	mustWrite(w, "</html>\n")
 
 	if err := w.Flush(); err != nil {
-		return fmt.Errorf("flush %s: %w", path, err)
+		return errorf("file.flush", path, err)
 	}
-	return nil
+	return f.commit()
 }
 
+// duplicateClient copies each row into its second half, which the strip
+// scrolls into view as the first one leaves. It runs before every other
+// script, so they find both copies as if the page had them.
+const duplicateClient = `    <script>
+      (function () {
+        var firsts = document.querySelectorAll("#permas .scroll-content");
+        var duplicates = document.querySelectorAll("#permas .scroll-content-duplicate");
+        for (var r = 0; r < firsts.length; r++) {
+          duplicates[r].innerHTML = firsts[r].innerHTML;
+        }
+      })();
+    </script>
+`
+
 func writeImageContainer(w *bufio.Writer, m imageMeta, cfg config) {
-	mustWrite(w, "        <div class=\"image-container\">\n")
-	mustWrite(w, fmt.Sprintf("          <img class=\"scroller\" src=\"%s\">\n", html.EscapeString(filepath.ToSlash(m.relPath))))
-	mustWrite(w, "          <div class=\"caption\">\n")
-	if cfg.includeAuthor {
-		mustWrite(w, fmt.Sprintf("            <div class=\"author\">%s</div>\n", m.author))
-	}
-	mustWrite(w, fmt.Sprintf("            <div class=\"title\">%s</div>\n", m.title))
-	mustWrite(w, "          </div>\n")
+	class := "image-container"
+	if m.origin != "" {
+		class += " " + sourceClass(m.origin)
+	}
+	if cfg.remoteControl {
+		mustWrite(w, fmt.Sprintf("        <div class=\"%s\" data-image=\"%s\"%s>\n", class, html.EscapeString(filepath.ToSlash(m.relPath)), accentAttr(m)))
+	} else {
+		mustWrite(w, fmt.Sprintf("        <div class=\"%s\"%s>\n", class, accentAttr(m)))
+	}
+	writeBadge(w, m, cfg)
+	if cfg.theme.captionPlacement == "above" {
+		captionRenderers[cfg.captionRenderer].writeCaption(w, m, cfg)
+	}
+	corner := cfg.qrCodes == "corner" && m.qr != ""
+	if corner {
+		mustWrite(w, "          <div class=\"qr-frame\">\n")
+	}
+	link := tileLink(m, cfg)
+	if link != "" {
+		mustWrite(w, fmt.Sprintf("          <a class=\"artist-link\" href=\"%s\" target=\"_blank\" rel=\"noopener\">\n", html.EscapeString(link)))
+	}
+	if m.frames > 0 {
+		writeFlipbook(w, m, cfg)
+	} else {
+		size := ""
+		if m.width > 0 && m.height > 0 {
+			size = fmt.Sprintf(" width=\"%d\" height=\"%d\"", m.width, m.height)
+		}
+		if pos := objectPosition(m, cfg); pos != "" {
+			size += fmt.Sprintf(" style=\"object-position: %s\"", pos)
+		}
+		img := fmt.Sprintf("<img class=\"scroller\"%s%s%s>", imgSrc(m, cfg), size, altAttr("alt", m, cfg))
+		if m.video != "" {
+			img = fmt.Sprintf("<video class=\"scroller\" src=\"%s\"%s autoplay muted loop playsinline%s></video>", html.EscapeString(m.video), size, altAttr("aria-label", m, cfg))
+		}
+		if m.kenBurns != nil {
+			img = fmt.Sprintf("<div class=\"kenburns %s\">%s</div>", m.kenBurns.name, img)
+		}
+		mustWrite(w, "          "+img+"\n")
+	}
+	if link != "" {
+		mustWrite(w, "          </a>\n")
+	}
+	if corner {
+		mustWrite(w, fmt.Sprintf("          <div class=\"qr\">%s</div>\n", m.qr))
+		mustWrite(w, "          </div>\n")
+	}
+	if cfg.theme.captionPlacement == "below" {
+		captionRenderers[cfg.captionRenderer].writeCaption(w, m, cfg)
+	}
 	mustWrite(w, "        </div>\n")
 }
 
@@ -384,3 +2022,23 @@ func mustWrite(w *bufio.Writer, s string) {
 		panic(err)
 	}
 }
+
+// tileCount is the number of tiles in one pass of the strip.
+func tileCount(metas []imageMeta, cfg config) int {
+	n := len(metas)
+	if cfg.heroTile && n > 0 {
+		n++
+	}
+	return n + len(creditsSlides(metas, cfg))
+}
+
+// loopSeconds is how long one pass of the strip takes, pauses included.
+// target_loop_seconds is stretched if the pauses leave less than a second
+// of scrolling per tile.
+func loopSeconds(metas []imageMeta, cfg config) int {
+	dwell := totalDwell(metas, cfg)
+	if cfg.targetLoopSeconds > 0 {
+		return max(cfg.targetLoopSeconds, int(math.Ceil(dwell))+tileCount(metas, cfg))
+	}
+	return int(math.Ceil(dwell)) + tileCount(metas, cfg)*secondsPerTile
+}
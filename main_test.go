@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// galleryImages is the size of the synthetic galleries benchmarked, an
+// archive of several years of submissions.
+const galleryImages = 4000
+
+// benchmarkFolder moves the benchmark to an empty folder with the default
+// config, and keeps generate from logging every run.
+func benchmarkFolder(b *testing.B) config {
+	b.Helper()
+	b.Chdir(b.TempDir())
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+	b.Cleanup(func() { slog.SetDefault(logger) })
+	cfg, err := readConfig()
+	if err != nil {
+		b.Fatal(err)
+	}
+	return cfg
+}
+
+// syntheticMetas describes n images of varying widths, as findImages and
+// the build cache would, without any files behind them.
+func syntheticMetas(n int) []imageMeta {
+	metas := make([]imageMeta, n)
+	for i := range metas {
+		metas[i] = newImageMeta(filepath.Join(imageFolder, fmt.Sprintf("artist %d - picture %d.png", i%50, i)))
+		metas[i].width, metas[i].height = 400+i%7*100, 500
+	}
+	return metas
+}
+
+// reportPageSize adds the size of the page at path per image to the
+// benchmark's results.
+func reportPageSize(b *testing.B, path string, images int) {
+	b.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(info.Size())/float64(images), "bytes/image")
+}
+
+// BenchmarkWriteHTML measures writing the page of a large gallery once its
+// images are known, in each output_mode and lazy_loading.
+func BenchmarkWriteHTML(b *testing.B) {
+	for _, tc := range []struct{ outputMode, lazyLoading string }{
+		{"full", "off"},
+		{"full", "observer"},
+		{"compact", "off"},
+		{"compact", "observer"},
+	} {
+		b.Run(tc.outputMode+"/"+tc.lazyLoading, func(b *testing.B) {
+			cfg := benchmarkFolder(b)
+			var err error
+			if cfg.theme, err = resolveTheme(cfg); err != nil {
+				b.Fatal(err)
+			}
+			cfg.outputMode, cfg.lazyLoading = tc.outputMode, tc.lazyLoading
+			metas := syntheticMetas(galleryImages)
+			for b.Loop() {
+				if err := writeHTML(outputFile, metas, cfg); err != nil {
+					b.Fatal(err)
+				}
+			}
+			reportPageSize(b, outputFile, len(metas))
+		})
+	}
+}
+
+// BenchmarkGenerate measures a run over a large images folder that hasn't
+// changed since the last one, which is what every generation in serve and
+// interactive mode after the first is.
+func BenchmarkGenerate(b *testing.B) {
+	cfg := benchmarkFolder(b)
+	if err := os.Mkdir(imageFolder, 0o755); err != nil {
+		b.Fatal(err)
+	}
+	for i := range galleryImages {
+		// Each image a color of its own, so none is a duplicate
+		img := image.NewRGBA(image.Rect(0, 0, 8+i%7, 10))
+		for p := 0; p < len(img.Pix); p += 4 {
+			img.Pix[p], img.Pix[p+1], img.Pix[p+2], img.Pix[p+3] = uint8(i), uint8(i>>8), uint8(i%251), 255
+		}
+		f, err := os.Create(filepath.Join(imageFolder, fmt.Sprintf("artist %d - picture %d.png", i%50, i)))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := png.Encode(f, img); err != nil {
+			b.Fatal(err)
+		}
+		f.Close()
+	}
+	// The first run reads every image and fills the build cache
+	if err := generate(cfg); err != nil {
+		b.Fatal(err)
+	}
+	for b.Loop() {
+		if err := generate(cfg); err != nil {
+			b.Fatal(err)
+		}
+	}
+	reportPageSize(b, outputFile, galleryImages)
+}
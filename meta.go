@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const metaFile = "photo-slider.meta"
+
+// imageInfo is what is stored about an image besides the file itself, as
+// edited in the admin page. Images waiting for review have one too, which
+// they keep when they are approved.
+type imageInfo struct {
+	Author *string     `json:"author,omitempty"` // overrides the author from the file name
+	Title  *string     `json:"title,omitempty"`  // overrides the title from the file name
+	Hidden bool        `json:"hidden,omitempty"` // left out of the slider
+	Link   string      `json:"link,omitempty"`   // artist's page, shown as a QR code
+	Focus  *focusPoint `json:"focus,omitempty"`  // part of the image to keep in frame when cropping
+	Dwell  *float64    `json:"dwell,omitempty"`  // seconds the strip stops at it, overriding dwell_seconds
+	Alt    string      `json:"alt,omitempty"`    // describes it to screen readers, instead of the caption
+
+	Preview bool     `json:"preview,omitempty"` // queued image shown in -preview-out pages
+	Flagged *float64 `json:"flagged,omitempty"` // content filter score, kept after approving so it isn't flagged again
+
+	Version int `json:"version,omitempty"` // counts the changes, so editors notice each other's
+}
+
+// focusPoint is a point in an image, as fractions of its width and height
+// from the top left corner. Crops are moved towards it as far as possible.
+type focusPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// parseFocus reads a focal point from form values. Empty values, and the
+// center (where crops go anyway), give nil.
+func parseFocus(x, y string) (*focusPoint, error) {
+	if x == "" && y == "" {
+		return nil, nil
+	}
+	fx, errX := strconv.ParseFloat(x, 64)
+	fy, errY := strconv.ParseFloat(y, 64)
+	if errX != nil || errY != nil {
+		return nil, errorf("meta.invalid_focus", x, y)
+	}
+	return checkFocus(&focusPoint{X: fx, Y: fy})
+}
+
+// checkFocus validates a focal point, dropping it if it is the center.
+func checkFocus(f *focusPoint) (*focusPoint, error) {
+	if f == nil || (f.X == 0.5 && f.Y == 0.5) {
+		return nil, nil
+	}
+	if f.X < 0 || f.X > 1 || f.Y < 0 || f.Y > 1 {
+		return nil, errorf("meta.focus_range", f.X, f.Y)
+	}
+	return f, nil
+}
+
+// objectPosition is the CSS object-position that keeps the focal point of m
+// in frame where image_fit=cover crops it, or "" if there is none.
+func objectPosition(m imageMeta, cfg config) string {
+	if m.focus == nil || cfg.maxImageWidth <= 0 || cfg.imageFit != "cover" {
+		return ""
+	}
+	return fmt.Sprintf("%.1f%% %.1f%%", m.focus.X*100, m.focus.Y*100)
+}
+
+// metadata maps the content hashes of images to what is stored about them,
+// so captions and links stay with an image when it is renamed or moved.
+// Files that can't be read, and entries from before content hashing, are
+// keyed by path, e.g. "images/jane - dragon.png".
+type metadata map[string]imageInfo
+
+func loadMetadata() (metadata, error) {
+	md := metadata{}
+	content, err := os.ReadFile(metaFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return md, nil
+	}
+	if err != nil {
+		return nil, errorf("meta.read_failed", err)
+	}
+	if err := json.Unmarshal(content, &md); err != nil {
+		return nil, errorf("meta.parse_failed", metaFile, err)
+	}
+	// Metadata files from before content hashing are keyed by path
+	for key, info := range md {
+		if !strings.Contains(key, "/") {
+			continue
+		}
+		if hash, err := imageHash(filepath.FromSlash(key)); err == nil {
+			if _, ok := md[hash]; !ok {
+				md[hash] = info
+			}
+			delete(md, key)
+		}
+	}
+	return md, nil
+}
+
+func saveMetadata(md metadata) error {
+	content, err := json.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(metaFile, content, 0o644); err != nil {
+		return errorf("meta.write_failed", err)
+	}
+	return nil
+}
+
+// metaKey is the key of the image at path in metadata.
+func metaKey(path string) string {
+	if hash, err := imageHash(path); err == nil {
+		return hash
+	}
+	return filepath.ToSlash(path)
+}
+
+func (md metadata) info(path string) imageInfo {
+	if info, ok := md[metaKey(path)]; ok {
+		return info
+	}
+	return md[filepath.ToSlash(path)]
+}
+
+// set stores info for path as its next version, dropping entries that no
+// longer hold anything.
+func (md metadata) set(path string, info imageInfo) {
+	info.Version = md.info(path).Version + 1
+	delete(md, filepath.ToSlash(path))
+	if info == (imageInfo{Version: info.Version}) {
+		delete(md, metaKey(path))
+		return
+	}
+	md[metaKey(path)] = info
+}
+
+// apply overrides the caption parsed from the file name with the stored one.
+func (info imageInfo) apply(m *imageMeta) {
+	m.link = info.Link
+	m.focus = info.Focus
+	m.dwell = info.Dwell
+	m.alt = info.Alt
+	if info.Author != nil {
+		m.author = html.EscapeString(*info.Author)
+	}
+	if info.Title != nil {
+		m.title = html.EscapeString(*info.Title)
+	}
+}
+
+// captionFromName is the author and title of the image at path as parsed
+// from its file name, in plain text.
+func captionFromName(path string) (string, string) {
+	base := filepath.Base(path)
+	author, title := parseAuthorTitle(strings.TrimSuffix(base, filepath.Ext(base)))
+	return exportText(author), exportText(title)
+}
+
+// caption is the author and title of the image at path: the ones stored
+// in info, or else the ones in the file name.
+func (info imageInfo) caption(path string) (string, string) {
+	author, title := captionFromName(path)
+	if info.Author != nil {
+		author = *info.Author
+	}
+	if info.Title != nil {
+		title = *info.Title
+	}
+	return author, title
+}
+
+// setCaption stores author and title as overrides for the image at path.
+// Values that match the file name aren't stored, so renaming the file
+// still changes the caption.
+func (info *imageInfo) setCaption(path, author, title string) {
+	fromAuthor, fromTitle := captionFromName(path)
+	info.Author, info.Title = nil, nil
+	if author != fromAuthor {
+		info.Author = &author
+	}
+	if title != fromTitle {
+		info.Title = &title
+	}
+}
+
+// imageEntry is an image in the images folder with its effective caption,
+// as listed by the admin page and the API.
+type imageEntry struct {
+	ID      string      `json:"id"` // path in its folder, see imageID
+	Path    string      `json:"path"`
+	Author  string      `json:"author"`
+	Title   string      `json:"title"`
+	Hidden  bool        `json:"hidden"`
+	Link    string      `json:"link"`
+	Focus   *focusPoint `json:"focus"`
+	Dwell   *float64    `json:"dwell"`
+	Alt     string      `json:"alt"`
+	Preview bool        `json:"preview,omitempty"` // only for images waiting for review
+	Flagged *float64    `json:"flagged,omitempty"` // content filter score, see checkSafety
+	Version int         `json:"version"`           // changes whenever the entry is saved
+}
+
+var errNoImage = msgError("meta.no_image")
+
+// errStaleVersion is returned for a change based on an older version of an
+// image's entry than the stored one.
+var errStaleVersion = msgError("meta.stale")
+
+// listImages returns the images in the images folder, including hidden ones.
+func listImages(filter pathFilter) ([]imageEntry, error) {
+	return listFolder(imageFolder, filter)
+}
+
+// listQueue returns the images in the incoming folder waiting for review.
+func listQueue() ([]imageEntry, error) {
+	if _, err := os.Stat(incomingFolder); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return listFolder(incomingFolder, pathFilter{})
+}
+
+func listFolder(dir string, filter pathFilter) ([]imageEntry, error) {
+	images, err := findImages(dir, filter)
+	if err != nil {
+		return nil, err
+	}
+	md, err := loadMetadata()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]imageEntry, 0, len(images))
+	for _, path := range images {
+		info := md.info(path)
+		author, title := info.caption(path)
+		out = append(out, imageEntry{ID: imageID(dir, path), Path: filepath.ToSlash(path), Author: author, Title: title, Hidden: info.Hidden, Link: info.Link, Focus: info.Focus, Dwell: info.Dwell, Alt: info.Alt, Preview: info.Preview, Flagged: info.Flagged, Version: info.Version})
+	}
+	return out, nil
+}
+
+// imageID is the ID of the image at path in dir: its path relative to
+// dir with forward slashes, e.g. "fanart/a.png" for images/fanart/a.png.
+// File names alone aren't unique, as mix_ratio reads subfolders too. In
+// URLs it is escaped as one segment, e.g. /thumb/fanart%2Fa.png.
+func imageID(dir, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// findImage returns the image with the given ID, or errNoImage.
+func findImage(filter pathFilter, id string) (imageEntry, error) {
+	entries, err := listImages(filter)
+	if err != nil {
+		return imageEntry{}, err
+	}
+	return findEntry(entries, id)
+}
+
+// findQueued returns the image waiting for review with the given ID, or
+// errNoImage.
+func findQueued(id string) (imageEntry, error) {
+	entries, err := listQueue()
+	if err != nil {
+		return imageEntry{}, err
+	}
+	return findEntry(entries, id)
+}
+
+func findEntry(entries []imageEntry, id string) (imageEntry, error) {
+	for _, e := range entries {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return imageEntry{}, fmt.Errorf("%w: %q", errNoImage, id)
+}
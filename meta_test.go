@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMetadataFollowsRenames(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir(imageFolder, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	before, after := filepath.Join(imageFolder, "jnae - dragon.png"), filepath.Join(imageFolder, "jane - dragon.png")
+	if err := os.WriteFile(before, testPNG(t), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	md := metadata{}
+	md.set(before, imageInfo{Link: "https://example.com/jane"})
+	if err := saveMetadata(md); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(before, after); err != nil {
+		t.Fatal(err)
+	}
+
+	md, err := loadMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link := md.info(after).Link; link != "https://example.com/jane" {
+		t.Errorf("link after renaming = %q, want it kept", link)
+	}
+}
+
+func TestMetadataMigratesPathKeys(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir(imageFolder, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(imageFolder, "jane - dragon.png")
+	if err := os.WriteFile(path, testPNG(t), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	content, err := json.Marshal(map[string]imageInfo{
+		"images/jane - dragon.png": {Hidden: true, Version: 2},
+		"images/gone - away.png":   {Hidden: true, Version: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(metaFile, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	md, err := loadMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := fileHash(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := md[hash]; !info.Hidden || info.Version != 2 {
+		t.Errorf("entry under the content hash = %+v, want the one stored under the path", info)
+	}
+	if _, ok := md["images/jane - dragon.png"]; ok {
+		t.Error("the entry is still stored under the path too")
+	}
+	// Without the file there's nothing to hash, so the path still works
+	if !md.info(filepath.Join(imageFolder, "gone - away.png")).Hidden {
+		t.Error("the entry of a missing file was lost")
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parseMixRatio reads mix_ratio, e.g. "fanart:3, memes:1", into weights by
+// folder path relative to the images folder, with "" for the images folder
+// itself (written ".").
+func parseMixRatio(value string) (map[string]int, error) {
+	ratio := map[string]int{}
+	for _, item := range splitList(value) {
+		folder, weight, ok := strings.Cut(item, ":")
+		n, err := strconv.Atoi(strings.TrimSpace(weight))
+		if !ok || err != nil || n < 1 {
+			return nil, errorf("mix.invalid", item)
+		}
+		folder = strings.Trim(filepath.ToSlash(strings.TrimSpace(folder)), "/")
+		if folder == "." {
+			// The images folder itself
+			folder = ""
+		}
+		ratio[folder] = n
+	}
+	return ratio, nil
+}
+
+// mixedFolders are the subfolders in ratio, which are read along with the
+// images folder.
+func mixedFolders(ratio map[string]int) []string {
+	var folders []string
+	for folder := range ratio {
+		if folder != "" {
+			folders = append(folders, folder)
+		}
+	}
+	sort.Strings(folders)
+	return folders
+}
+
+// mixFolder is the folder (or source) in mix_ratio that m is from, or ""
+// for the images folder itself.
+func mixFolder(m imageMeta, cfg config) string {
+	if m.origin != "" {
+		if _, ok := cfg.mixRatio[m.origin]; ok {
+			return m.origin
+		}
+		return ""
+	}
+	rel, err := filepath.Rel(imageFolder, filepath.Dir(m.source))
+	if err != nil {
+		return ""
+	}
+	if dir := filepath.ToSlash(rel); dir != "." {
+		if _, ok := cfg.mixRatio[dir]; ok {
+			return dir
+		}
+	}
+	return ""
+}
+
+// mixFolders interleaves the tiles of the folders in mix_ratio, so that
+// e.g. with "fanart:3, memes:1" every stretch of four tiles has three from
+// fanart and one from memes, for as long as both have tiles left. The images
+// folder itself counts with weight 1 unless it is listed as ".". Within a
+// folder, tiles keep the order the shuffler gave them.
+//
+// The folders take turns by smooth weighted round-robin: each turn every
+// folder with tiles left gains its weight, and the one ahead gives up the
+// sum of the weights for its tile. That spreads each folder's tiles evenly
+// instead of in runs.
+func mixFolders(metas []imageMeta, cfg config) {
+	if len(cfg.mixRatio) == 0 {
+		return
+	}
+	type folder struct {
+		tiles   []imageMeta
+		weight  int
+		current int
+	}
+	index := map[string]int{}
+	var folders []*folder
+	for _, m := range metas {
+		name := mixFolder(m, cfg)
+		i, ok := index[name]
+		if !ok {
+			weight, listed := cfg.mixRatio[name]
+			if !listed {
+				weight = 1
+			}
+			i = len(folders)
+			index[name] = i
+			folders = append(folders, &folder{weight: weight})
+		}
+		folders[i].tiles = append(folders[i].tiles, m)
+	}
+
+	for i := range metas {
+		var pick *folder
+		total := 0
+		for _, f := range folders {
+			if len(f.tiles) == 0 {
+				continue
+			}
+			f.current += f.weight
+			total += f.weight
+			if pick == nil || f.current > pick.current {
+				pick = f
+			}
+		}
+		pick.current -= total
+		metas[i] = pick.tiles[0]
+		pick.tiles = pick.tiles[1:]
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"maps"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseMixRatio(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		want  map[string]int // nil for invalid
+	}{
+		{"", map[string]int{}},
+		{"fanart:3, memes:1", map[string]int{"fanart": 3, "memes": 1}},
+		{" fanart : 3 ,memes:1 ", map[string]int{"fanart": 3, "memes": 1}},
+		{".:2, fanart:1", map[string]int{"": 2, "fanart": 1}},
+		{"/fan/art/:2", map[string]int{"fan/art": 2}},
+		{"fanart", nil},
+		{"fanart:", nil},
+		{"fanart:0", nil},
+		{"fanart:-1", nil},
+		{"fanart:1.5", nil},
+		{"fanart:x", nil},
+		{"fanart:3, memes", nil},
+	} {
+		got, err := parseMixRatio(tt.value)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("parseMixRatio(%q) = %v, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseMixRatio(%q): %v", tt.value, err)
+		} else if !maps.Equal(got, tt.want) {
+			t.Errorf("parseMixRatio(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestMixFolders(t *testing.T) {
+	for _, tt := range []struct {
+		ratio string
+		tiles string // folder of each tile in shuffled order, "r" for the images folder
+		want  string
+	}{
+		{"f:3, m:1", "ffffffmm", "ffmfffmf"},
+		{"f:1, m:1", "fffm", "fmff"},
+		{"f:2", "rrffff", "frffrf"},
+		{".:2, f:1", "ffrrrr", "rfrrfr"},
+		{"f:1, m:1", "", ""},
+	} {
+		cfg := config{}
+		cfg.mixRatio, _ = parseMixRatio(tt.ratio)
+		var metas []imageMeta
+		for i, folder := range tt.tiles {
+			dir := imageFolder
+			if folder != 'r' {
+				dir = filepath.Join(imageFolder, string(folder))
+			}
+			metas = append(metas, imageMeta{source: filepath.Join(dir, string(rune('a'+i))+".png")})
+		}
+		mixFolders(metas, cfg)
+		var got strings.Builder
+		seen := map[string]bool{}
+		for _, m := range metas {
+			if seen[m.source] {
+				t.Errorf("%s: %s is there twice", tt.ratio, m.source)
+			}
+			seen[m.source] = true
+			if folder := mixFolder(m, cfg); folder == "" {
+				got.WriteByte('r')
+			} else {
+				got.WriteString(folder)
+			}
+		}
+		if got.String() != tt.want {
+			t.Errorf("%s with %q: %q, want %q", tt.ratio, tt.tiles, got.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// With moderation on, submissions land in incomingFolder and only move to
+// the images folder once approved. Rejected images are kept in
+// rejectedFolder, with the reason in rejectLog.
+const (
+	incomingFolder = "incoming"
+	rejectedFolder = "rejected"
+)
+
+func rejectLog() string {
+	return filepath.Join(rejectedFolder, "rejected.log")
+}
+
+// uniquePath returns a path in dir for a file called name that doesn't
+// exist yet, adding " (2)", " (3)" and so on before the extension.
+func uniquePath(dir, name string) string {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	path := filepath.Join(dir, name)
+	for n := 2; ; n++ {
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			return path
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", stem, n, ext))
+	}
+}
+
+// approve moves a queued image into the images folder, along with the
+// caption set for it while it was queued, and returns its new path.
+func approve(cfg config, md metadata, path string) (string, error) {
+	if err := os.MkdirAll(imageFolder, 0o755); err != nil {
+		return "", errorf("file.create_folder", imageFolder, err)
+	}
+	// Looked up while the file is still there, see metaKey
+	info := md.info(path)
+	dest := uniquePath(imageFolder, filepath.Base(path))
+	if err := os.Rename(path, dest); err != nil {
+		return "", err
+	}
+	info.Preview = false
+	md.set(path, imageInfo{})
+	md.set(dest, info)
+
+	m := newImageMeta(dest)
+	info.apply(&m)
+	sendEvent(cfg, eventApproved, hookImage(m))
+	return dest, nil
+}
+
+// reject moves a queued image to the rejected folder and logs why.
+func reject(cfg config, md metadata, path, reason string) error {
+	if err := os.MkdirAll(rejectedFolder, 0o755); err != nil {
+		return errorf("file.create_folder", rejectedFolder, err)
+	}
+	m := newImageMeta(path)
+	md.info(path).apply(&m)
+	dest := uniquePath(rejectedFolder, filepath.Base(path))
+	if err := os.Rename(path, dest); err != nil {
+		return err
+	}
+	md.set(path, imageInfo{})
+
+	f, err := os.OpenFile(rejectLog(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return errorf("file.write_failed", rejectLog(), err)
+	}
+	defer f.Close()
+	reason = strings.Join(strings.Fields(reason), " ")
+	if _, err := fmt.Fprintf(f, "%s\t%s\t%s\n", time.Now().Format(time.RFC3339), filepath.Base(dest), reason); err != nil {
+		return errorf("file.write_failed", rejectLog(), err)
+	}
+
+	sendPayload(cfg, webhookPayload{Event: eventRejected, Time: time.Now(), Image: hookImage(m), Reason: reason})
+	return nil
+}
+
+// runReview implements the "review" command, which goes through the images
+// waiting in the incoming folder one by one.
+func runReview(args []string) error {
+	fset := flag.NewFlagSet("review", flag.ContinueOnError)
+	open := fset.Bool("open", false, "open each image in the default image viewer")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := readConfig()
+	if err != nil {
+		return err
+	}
+	queue, err := listQueue()
+	if err != nil {
+		return err
+	}
+	if len(queue) == 0 {
+		fmt.Println(msg("review.empty", incomingFolder))
+		return nil
+	}
+	md, err := loadMetadata()
+	if err != nil {
+		return err
+	}
+
+	in := bufio.NewScanner(os.Stdin)
+	ask := func(prompt string) (string, bool) {
+		fmt.Print(prompt)
+		if !in.Scan() {
+			return "", false
+		}
+		return strings.TrimSpace(in.Text()), true
+	}
+
+	fmt.Println(msg("review.start", countNoun(len(queue), "count.image"), msg("review.keys")))
+	approved := 0
+	var reviewErr error
+review:
+	for i, e := range queue {
+		w, h, sizeErr := imageSize(e.Path, false, cfg.limits)
+		fmt.Println()
+		if sizeErr != nil {
+			fmt.Println(msg("review.unreadable", i+1, len(queue), e.Path, sizeErr))
+		} else {
+			fmt.Println(msg("review.image", i+1, len(queue), e.Path, w, h))
+		}
+		if e.Flagged != nil {
+			fmt.Println(msg("review.flagged", *e.Flagged))
+		}
+		if *open {
+			openFile(e.Path)
+		}
+		for {
+			fmt.Println(msg("review.caption", e.Author, e.Title))
+			answer, ok := ask("> ")
+			if !ok {
+				break review
+			}
+			switch answer {
+			case "a":
+				dest, err := approve(cfg, md, e.Path)
+				if err != nil {
+					reviewErr = err
+					break review
+				}
+				approved++
+				fmt.Println(msg("review.approved", dest))
+			case "r":
+				reason, ok := ask(msg("review.reason"))
+				if !ok {
+					break review
+				}
+				if err := reject(cfg, md, e.Path, reason); err != nil {
+					reviewErr = err
+					break review
+				}
+				fmt.Println(msg("review.rejected", rejectedFolder))
+			case "e":
+				author, _ := ask(msg("review.author", e.Author))
+				title, _ := ask(msg("review.title", e.Title))
+				if author != "" {
+					e.Author = author
+				}
+				if title != "" {
+					e.Title = title
+				}
+				info := md.info(e.Path)
+				info.setCaption(e.Path, e.Author, e.Title)
+				md.set(e.Path, info)
+				continue
+			case "p":
+				info := md.info(e.Path)
+				info.Preview = !info.Preview
+				md.set(e.Path, info)
+				if info.Preview {
+					fmt.Println(msg("review.in_preview"))
+				} else {
+					fmt.Println(msg("review.not_in_preview"))
+				}
+				continue
+			case "o":
+				openFile(e.Path)
+				continue
+			case "s", "":
+			case "q":
+				break review
+			default:
+				fmt.Println("  " + msg("review.keys"))
+				continue
+			}
+			break
+		}
+	}
+	// Files already moved need their captions to move along
+	if err := saveMetadata(md); err != nil {
+		return err
+	}
+	if reviewErr != nil {
+		return reviewErr
+	}
+
+	if approved > 0 {
+		fmt.Println()
+		return generate(cfg)
+	}
+	return nil
+}
+
+// openFile shows path in the system's default application.
+func openFile(path string) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", path)
+	case "darwin":
+		cmd = exec.Command("open", path)
+	default:
+		cmd = exec.Command("xdg-open", path)
+	}
+	if err := cmd.Start(); err != nil {
+		slog.Warn(msg("open.failed", path, err))
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image/jpeg"
+	"image/png"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func optimizeFolder() string {
+	return filepath.Join(cacheFolder, "optimized")
+}
+
+// optimizeHeight is the height optimized copies are scaled to: what the page
+// shows, with room for the Ken Burns zoom.
+func optimizeHeight(cfg config) int {
+	if cfg.effect == "kenburns" {
+		return cfg.px(imageHeight) * 13 / 10
+	}
+	return cfg.px(imageHeight)
+}
+
+// optimizeImages writes a copy of every JPEG and PNG that is taller than the
+// page shows it to the cache, scaled down, and points the tile at the copy.
+// A browser source keeps every image decoded at full size, so a gallery of
+// camera photos shrinks to a fraction of the memory. Opaque images become
+// JPEGs at optimize_quality; PNGs with transparency stay PNGs.
+func optimizeImages(metas []imageMeta, cfg config, failed *imageFailures) error {
+	if !cfg.optimize {
+		return nil
+	}
+	height := optimizeHeight(cfg)
+	id := fmt.Sprintf("%d|%d", height, cfg.optimizeQuality)
+
+	ensureHashes(metas, cfg.workers)
+	made := make([]bool, len(metas))
+	errs := make([]error, len(metas))
+	parallel(msg("progress.optimizing"), len(metas), cfg.workers, func(worker, i int) {
+		m := &metas[i]
+		ext := strings.ToLower(filepath.Ext(m.relPath))
+		if m.frames > 0 || m.height <= height || (ext != ".jpg" && ext != ".jpeg" && ext != ".png") {
+			return
+		}
+		sum := sha256.Sum256([]byte(m.hash + "|" + id))
+		base := filepath.Join(optimizeFolder(), hex.EncodeToString(sum[:8]))
+		if found, _ := filepath.Glob(base + ".*"); len(found) > 0 {
+			m.optimized = filepath.ToSlash(found[0])
+			return
+		}
+		defer traceSpanOn(worker, traceProcessing, "optimize image", "path", m.relPath)()
+		path, err := shrinkImage(base, m.relPath, height, cfg)
+		if err != nil {
+			errs[i] = err
+			return
+		}
+		m.optimized, made[i] = filepath.ToSlash(path), true
+	})
+
+	count := 0
+	for i, m := range metas {
+		if errs[i] != nil {
+			if err := failed.add(m.relPath, "failure.optimize", errs[i]); err != nil {
+				return err
+			}
+		}
+		if made[i] {
+			count++
+		}
+	}
+	if count > 0 {
+		slog.Info(msg("optimize.done", countNoun(count, "count.image")))
+	}
+	// Copies of images that are gone or were made differently are left to
+	// sweepAssets, as backups of the page may still show them
+	return nil
+}
+
+// shrinkImage scales the image at src down to height and writes it to base
+// plus the extension of the format it picks, returning that path.
+func shrinkImage(base, src string, height int, cfg config) (string, error) {
+	img, err := decodeImage(src, cfg.limits)
+	if err != nil {
+		return "", err
+	}
+	b := img.Bounds()
+	out := scaleImage(img, max(1, b.Dx()*height/b.Dy()), height)
+
+	path := base + ".jpg"
+	if o, ok := img.(interface{ Opaque() bool }); ok && !o.Opaque() {
+		path = base + ".png"
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", errorf("file.create_folder", filepath.Dir(path), err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return "", errorf("file.create", path, err)
+	}
+	if filepath.Ext(path) == ".jpg" {
+		err = jpeg.Encode(f, out, &jpeg.Options{Quality: cfg.optimizeQuality})
+	} else {
+		err = png.Encode(f, out)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", errorf("file.encode", path, err)
+	}
+	return path, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// originalsManifest is the file export-originals writes next to the copies.
+const originalsManifest = "manifest.json"
+
+// exportedOriginal is an image in the manifest of export-originals: how it
+// was credited and how viewers saw it.
+type exportedOriginal struct {
+	File       string     `json:"file"`     // the copy, relative to the manifest
+	Original   string     `json:"original"` // path in the images folder
+	Author     string     `json:"author"`
+	Title      string     `json:"title"`
+	Link       string     `json:"link,omitempty"`
+	Hidden     bool       `json:"hidden,omitempty"`
+	Added      time.Time  `json:"added"`                // see addedDate
+	LastShown  *time.Time `json:"last_shown,omitempty"` // last generation it was in
+	Opens      int        `json:"opens"`                // see imageStats
+	LinkClicks int        `json:"link_clicks"`
+}
+
+// runExportOriginals implements the "export-originals" command, which copies
+// an artist's images as they were submitted, without watermark or resizing,
+// to a folder with a manifest of their captions, to send to the artist.
+func runExportOriginals(args []string) error {
+	fset := flag.NewFlagSet("export-originals", flag.ContinueOnError)
+	author := fset.String("author", "", "artist whose images to export, as in the captions (required)")
+	var out string
+	fset.StringVar(&out, "o", "", "folder to copy the images to (default: originals/<author>)")
+	fset.StringVar(&out, "out", "", "same as -o")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*author) == "" {
+		return errors.New(msg("originals.needs_author"))
+	}
+	if out == "" {
+		out = filepath.Join("originals", siteSlug(*author))
+	}
+	cfg, err := readConfig()
+	if err != nil {
+		return err
+	}
+	entries, err := listImages(cfg.filter)
+	if err != nil {
+		return err
+	}
+	st, _, err := loadState()
+	if err != nil {
+		return err
+	}
+	stats, err := loadStats()
+	if err != nil {
+		return err
+	}
+
+	var manifest []exportedOriginal
+	for _, e := range entries {
+		if !strings.EqualFold(strings.TrimSpace(e.Author), strings.TrimSpace(*author)) {
+			continue
+		}
+		// Keep subfolders, so images with the same name in two of them don't collide
+		file, err := filepath.Rel(imageFolder, e.Path)
+		if err != nil {
+			file = filepath.Base(e.Path)
+		}
+		dest := filepath.Join(out, file)
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return errorf("file.create_folder", filepath.Dir(dest), err)
+		}
+		if err := copyFile(e.Path, dest); err != nil {
+			return errorf("file.copy", e.Path, err)
+		}
+		if info, err := os.Stat(e.Path); err == nil {
+			os.Chtimes(dest, info.ModTime(), info.ModTime())
+		}
+		o := exportedOriginal{
+			File:       filepath.ToSlash(file),
+			Original:   e.Path,
+			Author:     e.Author,
+			Title:      e.Title,
+			Link:       e.Link,
+			Hidden:     e.Hidden,
+			Added:      addedDate(e.Path, st),
+			Opens:      stats[e.Path].Opens,
+			LinkClicks: stats[e.Path].LinkClicks,
+		}
+		if hash, err := fileHash(e.Path); err == nil {
+			if t, ok := st.LastShown[hash]; ok {
+				o.LastShown = &t
+			}
+		}
+		manifest = append(manifest, o)
+	}
+	if len(manifest) == 0 {
+		return errorf("originals.none", *author, imageFolder)
+	}
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(out, originalsManifest), content); err != nil {
+		return err
+	}
+	fmt.Println(msg("originals.done", countNoun(len(manifest), "count.image"), manifest[0].Author, out))
+	return nil
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// backupFolder holds the earlier versions of the output kept by backups.
+const backupFolder = "backups"
+
+// atomicFile is a file written under a temporary name next to path and
+// renamed to path by commit. OBS refreshing the source in the middle of a
+// generation, or a crash, then never gets a half-written page: it sees the
+// old file or the new one.
+type atomicFile struct {
+	*os.File
+	path      string
+	backups   int // earlier versions of path to keep in backupFolder
+	committed bool
+}
+
+// createAtomic starts writing path, keeping the given number of backups of
+// what it replaces.
+func createAtomic(path string, backups int) (*atomicFile, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, errorf("file.create", path, err)
+	}
+	return &atomicFile{File: f, path: path, backups: backups}, nil
+}
+
+// createPage is createAtomic for a generated page, which keeps backups if it
+// is the live output.
+func createPage(path string, cfg config) (*atomicFile, error) {
+	backups := 0
+	if path == outputFile {
+		backups = cfg.backups
+	}
+	return createAtomic(path, backups)
+}
+
+// commit replaces path with what was written.
+func (f *atomicFile) commit() error {
+	if err := f.Sync(); err != nil {
+		return errorf("file.write", f.path, err)
+	}
+	if err := f.Close(); err != nil {
+		return errorf("file.write", f.path, err)
+	}
+	// Temporary files are only readable by their owner
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return err
+	}
+	if f.backups > 0 {
+		if err := backupOutput(f.path, f.Name(), f.backups); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		return errorf("file.replace", f.path, err)
+	}
+	f.committed = true
+	return nil
+}
+
+// discard removes the temporary file unless it was committed, leaving path
+// as it was. It is meant to be deferred.
+func (f *atomicFile) discard() {
+	if !f.committed {
+		f.Close()
+		os.Remove(f.Name())
+	}
+}
+
+// writeFileAtomic is os.WriteFile through an atomicFile.
+func writeFileAtomic(path string, content []byte) error {
+	f, err := createAtomic(path, 0)
+	if err != nil {
+		return err
+	}
+	defer f.discard()
+	if _, err := f.Write(content); err != nil {
+		return errorf("file.write", path, err)
+	}
+	return f.commit()
+}
+
+// backupOutput copies path to backupFolder before next replaces it, unless
+// next is the same, and removes all but the newest keep backups of it. The
+// source size variants of the page are written after it, so the ones there
+// still belong to the version backed up and are copied along with it.
+func backupOutput(path, next string, keep int) error {
+	old, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return errorf("file.read", path, err)
+	}
+	content, err := os.ReadFile(next)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(old, content) {
+		return nil
+	}
+
+	if err := os.MkdirAll(backupFolder, 0o755); err != nil {
+		return errorf("file.create_folder", backupFolder, err)
+	}
+	stamp := newBackupStamp(path)
+	if err := os.WriteFile(backupName(path, stamp), old, 0o644); err != nil {
+		return errorf("file.back_up", path, err)
+	}
+	if path == outputFile {
+		for _, variant := range sourceSizeFiles() {
+			content, err := os.ReadFile(variant)
+			if err != nil {
+				return errorf("file.read", variant, err)
+			}
+			if err := os.WriteFile(backupName(variant, stamp), content, 0o644); err != nil {
+				return errorf("file.back_up", variant, err)
+			}
+		}
+	}
+	backups, err := listBackups(path)
+	if err != nil {
+		return err
+	}
+	for len(backups) > keep {
+		for _, variant := range variantBackups(backups[0]) {
+			if err := os.Remove(variant); err != nil {
+				return err
+			}
+		}
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// newBackupStamp is the time stamp for a new backup of path, to the
+// microsecond, as several generations can run within a second. It moves on
+// if a backup with that stamp exists anyway.
+func newBackupStamp(path string) string {
+	t := time.Now()
+	for {
+		stamp := t.Format("20060102-150405") + fmt.Sprintf("%06d", t.Nanosecond()/1000)
+		if _, err := os.Stat(backupName(path, stamp)); errors.Is(err, fs.ErrNotExist) {
+			return stamp
+		}
+		t = t.Add(time.Microsecond)
+	}
+}
+
+// backupName is where the backup of path made at the time stamp goes.
+func backupName(path, stamp string) string {
+	ext := filepath.Ext(path)
+	return filepath.Join(backupFolder, strings.TrimSuffix(filepath.Base(path), ext)+"-"+stamp+ext)
+}
+
+// variantBackups returns the backups of source size variants made along
+// with the backup of the output at backup.
+func variantBackups(backup string) []string {
+	stamp := backupStamp(backup)
+	found, _ := filepath.Glob(backupName(sourceSizeFile("*"), stamp))
+	var out []string
+	for _, path := range found {
+		if sourceSizeFilePattern.MatchString(variantOf(path, stamp)) {
+			out = append(out, path)
+		}
+	}
+	return out
+}
+
+// backupStamp is the time stamp in the name of a backup of the output.
+func backupStamp(backup string) string {
+	ext := filepath.Ext(outputFile)
+	return strings.TrimSuffix(strings.TrimPrefix(filepath.Base(backup), strings.TrimSuffix(outputFile, ext)+"-"), ext)
+}
+
+// variantOf is the variant of the page that the backup made at the time
+// stamp is a copy of.
+func variantOf(backup, stamp string) string {
+	ext := filepath.Ext(backup)
+	return strings.TrimSuffix(filepath.Base(backup), "-"+stamp+ext) + ext
+}
+
+// listBackups returns the backups of path, oldest first.
+func listBackups(path string) ([]string, error) {
+	ext := filepath.Ext(path)
+	var backups []string
+	// Backups of older versions have a stamp to the second
+	for _, stamp := range []string{"????????-??????", "????????-????????????"} {
+		found, err := filepath.Glob(filepath.Join(backupFolder, strings.TrimSuffix(filepath.Base(path), ext)+"-"+stamp+ext))
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, found...)
+	}
+	// The time in the name sorts like the time itself
+	slices.Sort(backups)
+	return backups, nil
+}
+
+// runRollback implements the "rollback" command, which puts the newest
+// backup of the output and its variants back in place. The backup is used
+// up, so running it again goes back one more version.
+func runRollback(args []string) error {
+	fset := flag.NewFlagSet("rollback", flag.ContinueOnError)
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	lock, err := acquireLock("rollback")
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+	backups, err := listBackups(outputFile)
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		return errorf("rollback.none", outputFile, backupFolder, configFile)
+	}
+	newest := backups[len(backups)-1]
+	content, err := os.ReadFile(newest)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(outputFile, content); err != nil {
+		return err
+	}
+	if err := os.Remove(newest); err != nil {
+		return err
+	}
+	// Bring back the variants the restored page had, and only those
+	stamp := backupStamp(newest)
+	restored := map[string]bool{}
+	for _, backup := range variantBackups(newest) {
+		variant := variantOf(backup, stamp)
+		content, err := os.ReadFile(backup)
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(variant, content); err != nil {
+			return err
+		}
+		if err := os.Remove(backup); err != nil {
+			return err
+		}
+		restored[variant] = true
+	}
+	for _, variant := range sourceSizeFiles() {
+		if !restored[variant] {
+			os.Remove(variant)
+		}
+	}
+	slog.Info(msg("rollback.done", outputFile, newest, len(backups)-1))
+	return nil
+}
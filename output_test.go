@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeGeneration writes the output and its variants as a generation
+// would, the output first.
+func writeGeneration(t *testing.T, cfg config, content string, variants ...string) {
+	t.Helper()
+	f, err := createPage(outputFile, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.discard()
+	f.WriteString(content)
+	if err := f.commit(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range variants {
+		if err := writeFileAtomic(sourceSizeFile(name), []byte(content+" "+name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// assertContent fails the test unless the file at path holds want.
+func assertContent(t *testing.T, path, want string) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("%s = %q, want %q", path, got, want)
+	}
+}
+
+func TestRollbackRestoresVariants(t *testing.T) {
+	t.Chdir(t.TempDir())
+	cfg := config{backups: 5}
+	writeGeneration(t, cfg, "old", "800x150")
+	writeGeneration(t, cfg, "new", "800x150", "1920x300")
+
+	if err := runRollback(nil); err != nil {
+		t.Fatal(err)
+	}
+	assertContent(t, outputFile, "old")
+	assertContent(t, sourceSizeFile("800x150"), "old 800x150")
+	if _, err := os.Stat(sourceSizeFile("1920x300")); err == nil {
+		t.Errorf("%s the restored page didn't have is still there", sourceSizeFile("1920x300"))
+	}
+	if left, _ := filepath.Glob(filepath.Join(backupFolder, "*")); len(left) != 0 {
+		t.Errorf("backups left after the rollback: %q", left)
+	}
+}
+
+func TestBackupsWithinASecond(t *testing.T) {
+	t.Chdir(t.TempDir())
+	cfg := config{backups: 5}
+	for _, content := range []string{"one", "two", "three", "four"} {
+		writeGeneration(t, cfg, content, "800x150")
+	}
+	backups, err := listBackups(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 3 {
+		t.Fatalf("backups = %q, want 3", backups)
+	}
+	for i, want := range []string{"one", "two", "three"} {
+		assertContent(t, backups[i], want)
+		if variants := variantBackups(backups[i]); len(variants) != 1 {
+			t.Errorf("%s has variants %q, want 1", backups[i], variants)
+		}
+	}
+}
+
+func TestRollbackNeedsTheLock(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeGeneration(t, config{backups: 5}, "old")
+	writeGeneration(t, config{backups: 5}, "new")
+	lock, err := acquireLock("serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.release()
+	// The lock is this process's own, so make it another's that still runs
+	if err := os.WriteFile(lockFile, []byte(fmt.Sprintf("%d\nserve\n", os.Getppid())), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runRollback(nil); err == nil {
+		t.Error("rollback ran while serve holds the lock")
+	}
+	assertContent(t, outputFile, "new")
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log/slog"
+	"math"
+	"sort"
+)
+
+// paletteSamples is how many pixels along each side dominantColors looks
+// at: enough to find the main colors, few enough to be quick.
+const paletteSamples = 96
+
+// dominantColors returns up to three colors that cover most of img, as CSS
+// hex colors, most prominent first. Saturated pixels count more than grey
+// ones, so a colorful figure wins over a plain background. Colors too close
+// to one already picked are passed over.
+func dominantColors(img image.Image) []string {
+	type bucket struct {
+		r, g, b, weight float64
+	}
+	buckets := map[int]*bucket{}
+	bounds := img.Bounds()
+	stepX := max(1, bounds.Dx()/paletteSamples)
+	stepY := max(1, bounds.Dy()/paletteSamples)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += stepY {
+		for x := bounds.Min.X; x < bounds.Max.X; x += stepX {
+			r32, g32, b32, a32 := img.At(x, y).RGBA()
+			if a32 < 0x8000 {
+				continue // transparent areas have no color
+			}
+			// Undo the alpha premultiplication
+			r, g, b := float64(r32)*255/float64(a32), float64(g32)*255/float64(a32), float64(b32)*255/float64(a32)
+			hi, lo := max(r, g, b), min(r, g, b)
+			saturation := 0.0
+			if hi > 0 {
+				saturation = (hi - lo) / hi
+			}
+			weight := 1 + 3*saturation
+			key := int(r)>>4<<8 | int(g)>>4<<4 | int(b)>>4
+			k := buckets[key]
+			if k == nil {
+				k = &bucket{}
+				buckets[key] = k
+			}
+			k.r += r * weight
+			k.g += g * weight
+			k.b += b * weight
+			k.weight += weight
+		}
+	}
+
+	sorted := make([]*bucket, 0, len(buckets))
+	for _, k := range buckets {
+		sorted = append(sorted, k)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].weight > sorted[j].weight })
+	var picked [][3]float64
+	for _, k := range sorted {
+		c := [3]float64{k.r / k.weight, k.g / k.weight, k.b / k.weight}
+		distinct := true
+		for _, p := range picked {
+			if math.Sqrt((c[0]-p[0])*(c[0]-p[0])+(c[1]-p[1])*(c[1]-p[1])+(c[2]-p[2])*(c[2]-p[2])) < 64 {
+				distinct = false
+				break
+			}
+		}
+		if distinct {
+			picked = append(picked, c)
+		}
+		if len(picked) == 3 {
+			break
+		}
+	}
+	colors := make([]string, len(picked))
+	for i, c := range picked {
+		colors[i] = hexColor(c)
+	}
+	return colors
+}
+
+func hexColor(c [3]float64) string {
+	return fmt.Sprintf("#%02x%02x%02x", uint8(math.Round(c[0])), uint8(math.Round(c[1])), uint8(math.Round(c[2])))
+}
+
+// darkened returns the hex color hex scaled down to at most the given
+// relative luminance, keeping its hue, so light caption text stays readable
+// on an outline of it.
+func darkened(hex string, luminance float64) string {
+	var r, g, b uint8
+	if _, err := fmt.Sscanf(hex, "#%02x%02x%02x", &r, &g, &b); err != nil {
+		return hex
+	}
+	c := [3]float64{float64(r), float64(g), float64(b)}
+	l := (0.2126*c[0] + 0.7152*c[1] + 0.0722*c[2]) / 255
+	if l <= luminance {
+		return hex
+	}
+	f := luminance / l
+	return hexColor([3]float64{c[0] * f, c[1] * f, c[2] * f})
+}
+
+// imageAccent are the colors a tile uses instead of the theme's with
+// border_mode=auto.
+type imageAccent struct {
+	border       string
+	authorStroke string
+	titleStroke  string
+}
+
+// accentOf picks the accent colors of an image from its dominant colors:
+// the first for the border and, darkened, the author outline, and the
+// second (if there is one) darkened for the title outline.
+func accentOf(colors []string) *imageAccent {
+	if len(colors) == 0 {
+		return nil
+	}
+	title := colors[0]
+	if len(colors) > 1 {
+		title = colors[1]
+	}
+	return &imageAccent{border: colors[0], authorStroke: darkened(colors[0], 0.2), titleStroke: darkened(title, 0.3)}
+}
+
+// style is the inline style of a tile that sets its accent colors, read by
+// the rules accentVar writes.
+func (a *imageAccent) style() string {
+	if a == nil {
+		return ""
+	}
+	return fmt.Sprintf("--border: %s; --author-stroke: %s; --title-stroke: %s", a.border, a.authorStroke, a.titleStroke)
+}
+
+// override replaces the colors of a that t sets, as the colors set for a
+// source win over the image's own.
+func (a *imageAccent) override(t theme) {
+	if a == nil {
+		return
+	}
+	if t.imageBorderColor != "" {
+		a.border = t.imageBorderColor
+	}
+	if t.authorStrokeColor != "" {
+		a.authorStroke = t.authorStrokeColor
+	}
+	if t.titleStrokeColor != "" {
+		a.titleStroke = t.titleStrokeColor
+	}
+}
+
+// accentVar is the CSS value of a theme color that a tile may override with
+// border_mode=auto or the colors of its source: the variable name, falling
+// back to the theme's color.
+func accentVar(name, color string, cfg config) string {
+	if cfg.borderMode != "auto" && !cfg.styledSources() {
+		return color
+	}
+	return fmt.Sprintf("var(--%s, %s)", name, color)
+}
+
+// pickAccents finds the dominant colors of every image of metas that the
+// build cache has none for, and sets the accent colors of all of them.
+// Flipbooks, WebPs (which Go can't decode) and images that can't be decoded
+// keep the theme's colors.
+func pickAccents(metas []imageMeta, cfg config) {
+	parallel(msg("progress.colors"), len(metas), cfg.workers, func(worker, i int) {
+		m := &metas[i]
+		if m.frames > 0 {
+			return
+		}
+		if m.colors == nil {
+			defer traceSpanOn(worker, traceProcessing, "find colors", "path", m.relPath)()
+			img, err := decodeImage(m.relPath, cfg.limits)
+			if err != nil {
+				slog.Debug(msg("colors.failed", m.relPath, err))
+				return
+			}
+			m.colors = dominantColors(img)
+		}
+		m.accent = accentOf(m.colors)
+		if s := cfg.source(m.origin); s != nil {
+			m.accent.override(s.style)
+		}
+	})
+}
+
+// accentAttr is the style attribute of a tile with accent colors, or "".
+func accentAttr(m imageMeta) string {
+	if m.accent == nil {
+		return ""
+	}
+	return fmt.Sprintf(" style=\"%s\"", m.accent.style())
+}
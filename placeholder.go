@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// placeholderPoll is how often serve mode looks for images while the
+// images folder is empty.
+const placeholderPoll = 5 * time.Second
+
+func placeholderFolder() string {
+	return filepath.Join(cacheFolder, "placeholder")
+}
+
+// preparePlaceholder returns the URL of placeholder_image, copying a local
+// file to the cache folder like prepareAudio.
+func preparePlaceholder(cfg config) (string, error) {
+	if cfg.placeholderImage == "" {
+		return "", nil
+	}
+	if strings.HasPrefix(cfg.placeholderImage, "http://") || strings.HasPrefix(cfg.placeholderImage, "https://") {
+		return cfg.placeholderImage, nil
+	}
+	url, err := cacheCopy(cfg.placeholderImage, placeholderFolder())
+	if err != nil {
+		return "", errorf("placeholder.failed", err)
+	}
+	return url, nil
+}
+
+// writePlaceholder writes the page shown while there are no images, so the
+// browser source says what to do instead of staying blank. It uses the
+// theme's font, colors and background. When served, it reloads as soon as
+// the slider is regenerated.
+func writePlaceholder(path, imageURL string, cfg config) error {
+	f, err := createPage(path, cfg)
+	if err != nil {
+		return err
+	}
+	defer f.discard()
+	w := bufio.NewWriter(f)
+
+	mustWrite(w, "<!DOCTYPE html>\n")
+	mustWrite(w, fmt.Sprintf("<html lang=\"%s\">\n", cfg.lang))
+	mustWrite(w, "  <head>\n")
+	mustWrite(w, "    <title>Photo Slider</title>\n")
+	writeSizeDetector(w, cfg)
+	writeFontLinks(w, cfg)
+	mustWrite(w, "    <style>\n")
+	mustWrite(w, "      html, body {\n")
+	mustWrite(w, "        width: 100%;\n")
+	mustWrite(w, "        height: 100%;\n")
+	mustWrite(w, "        margin: 0px;\n")
+	mustWrite(w, "        overflow: hidden;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	if cfg.theme.background != "transparent" {
+		writeBackgroundStyle(w, cfg)
+	}
+	mustWrite(w, "      .placeholder {\n")
+	mustWrite(w, "        display: flex;\n")
+	mustWrite(w, "        flex-direction: column;\n")
+	mustWrite(w, "        align-items: center;\n")
+	mustWrite(w, fmt.Sprintf("        margin-top: %dpx;\n", cfg.px(32)))
+	mustWrite(w, fmt.Sprintf("        font-family: %s;\n", fontStack(cfg)))
+	mustWrite(w, fmt.Sprintf("        font-size: %dpx;\n", cfg.px(48)))
+	mustWrite(w, "        font-weight: bold;\n")
+	mustWrite(w, fmt.Sprintf("        color: %s;\n", cfg.theme.authorTextColor))
+	mustWrite(w, fmt.Sprintf("        -webkit-text-stroke: %dpx %s;\n", cfg.px(10), cfg.theme.authorStrokeColor))
+	mustWrite(w, "        paint-order: stroke fill;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      .placeholder img {\n")
+	mustWrite(w, fmt.Sprintf("        height: %dpx;\n", cfg.px(imageHeight)))
+	mustWrite(w, fmt.Sprintf("        border-radius: %dpx;\n", cfg.px(12)))
+	mustWrite(w, fmt.Sprintf("        margin-bottom: %dpx;\n", cfg.px(32)))
+	mustWrite(w, "      }\n")
+	mustWrite(w, "    </style>\n")
+	mustWrite(w, "  </head>\n")
+	mustWrite(w, "  <body>\n")
+	mustWrite(w, "    <div class=\"placeholder\">\n")
+	if imageURL != "" {
+		mustWrite(w, fmt.Sprintf("      <img src=\"%s\" alt=\"\">\n", html.EscapeString(imageURL)))
+	}
+	if cfg.placeholderText != "" {
+		mustWrite(w, fmt.Sprintf("      <div>%s</div>\n", html.EscapeString(cfg.placeholderText)))
+	}
+	mustWrite(w, "    </div>\n")
+	if cfg.remoteControl {
+		mustWrite(w, "    <script>\n")
+		mustWrite(w, "      new EventSource(\"control/events\").onmessage = function (e) {\n")
+		mustWrite(w, "        if (JSON.parse(e.data).action === \"reload\") location.reload();\n")
+		mustWrite(w, "      };\n")
+		mustWrite(w, "    </script>\n")
+	}
+	mustWrite(w, "  </body>\n")
+	mustWrite(w, "</html>\n")
+
+	if err := w.Flush(); err != nil {
+		return errorf("file.flush", path, err)
+	}
+	return f.commit()
+}
+
+// watchEmpty regenerates the slider once images show up in an empty images
+// folder, so the placeholder makes way for them without a restart. Images
+// added through the admin page or the API regenerate it anyway.
+func (s *server) watchEmpty() {
+	count := func() int {
+		images, err := findImages(imageFolder, s.config().filter)
+		if err != nil {
+			return -1
+		}
+		return len(images)
+	}
+	empty := count() == 0
+	for range time.Tick(placeholderPoll) {
+		n := count()
+		if empty && n > 0 {
+			if err := s.regenerate(); err != nil {
+				slog.Error(msg("serve.regenerate_failed", err))
+			}
+		}
+		empty = n == 0
+	}
+}
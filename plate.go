@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+func init() {
+	registerCaptionRenderer("svg", svgCaptions{})
+}
+
+// svgCaptions draw every caption as an SVG text plate: the outline is an
+// SVG stroke behind the text and the shadow a drop-shadow filter, which all
+// browsers draw the same, where OBS versions differ in how they draw
+// -webkit-text-stroke. The plates are written into the page, not linked as
+// images, so they use the caption font.
+//
+// SVG text doesn't wrap, so lines are broken where the text is estimated to
+// get wider than the image.
+type svgCaptions struct{}
+
+// plateLine is one line of text on a plate.
+type plateLine struct {
+	text        string // HTML-escaped
+	size        int    // font size in px
+	fill        string
+	stroke      string
+	strokeWidth int
+	weight      string // font-weight, or "" for normal
+	style       string // font-style, or "" for normal
+}
+
+func (svgCaptions) writeStyle(w *bufio.Writer, cfg config) {
+	mustWrite(w, "      #permas .caption {\n")
+	mustWrite(w, "        max-width: 100%;\n")
+	mustWrite(w, "        margin: 0 auto;\n")
+	mustWrite(w, fmt.Sprintf("        margin-top: %dpx;\n", cfg.px(32)))
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #permas .plate, #pin .plate, #zoom .plate {\n")
+	mustWrite(w, "        display: block;\n")
+	mustWrite(w, "        margin: 0 auto;\n")
+	mustWrite(w, "        overflow: visible;\n")
+	mustWrite(w, fmt.Sprintf("        font-family: %s;\n", fontStack(cfg)))
+	mustWrite(w, fmt.Sprintf("        filter: drop-shadow(0 %dpx %dpx rgba(0, 0, 0, 0.5));\n", cfg.px(3), cfg.px(3)))
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+}
+
+func (svgCaptions) writeCaption(w *bufio.Writer, m imageMeta, cfg config) {
+	mustWrite(w, "          <div class=\"caption\">\n")
+	if lines := plateLines(m, cfg); len(lines) > 0 {
+		mustWrite(w, "            "+plateSVG(lines, int(tileWidth(m, cfg)), cfg)+"\n")
+	}
+	// The QR code can't go inside the text, so {qr} puts it below it
+	if cfg.qrCodes == "caption" && m.qr != "" {
+		mustWrite(w, fmt.Sprintf("            <div class=\"qr\">%s</div>\n", m.qr))
+	}
+	mustWrite(w, "          </div>\n")
+}
+
+// plateLines are the lines of the caption of m, in the sizes and colors of
+// the CSS captions, before wrapping.
+func plateLines(m imageMeta, cfg config) []plateLine {
+	t := tileTheme(m, cfg)
+	author := plateLine{size: cfg.px(48), fill: t.authorTextColor, stroke: t.authorStrokeColor, strokeWidth: cfg.px(10), weight: "bold"}
+	title := plateLine{size: cfg.px(40), fill: t.titleTextColor, stroke: t.titleStrokeColor, strokeWidth: cfg.px(10)}
+	translation := plateLine{size: cfg.px(32), fill: t.titleTextColor, stroke: t.titleStrokeColor, strokeWidth: cfg.px(8), style: "italic"}
+	handle := plateLine{size: cfg.px(32), fill: t.titleTextColor, stroke: t.titleStrokeColor, strokeWidth: cfg.px(8)}
+	if a := m.accent; a != nil {
+		author.stroke, title.stroke, translation.stroke, handle.stroke = a.authorStroke, a.titleStroke, a.titleStroke, a.titleStroke
+	}
+
+	var lines []plateLine
+	add := func(style plateLine, text string) {
+		for _, part := range strings.Split(text, "<br>") {
+			if part = strings.TrimSpace(part); part != "" {
+				style.text = part
+				lines = append(lines, style)
+			}
+		}
+	}
+	if cfg.captionFormat != "" {
+		m.qr = ""
+		add(title, formatCaption(cfg.captionFormat, m, cfg))
+		return lines
+	}
+	if cfg.includeAuthor {
+		add(author, m.author)
+	}
+	add(title, m.title)
+	if m.translation != "" && m.translation != html.EscapeString(captionText(m.title)) {
+		add(translation, m.translation)
+	}
+	add(handle, captionLink(m, cfg))
+	return lines
+}
+
+// wrapPlateLine breaks l into lines of at most width px, estimating the
+// width of a character as a little over half the font size. A word wider
+// than width gets a line of its own.
+func wrapPlateLine(l plateLine, width int) []plateLine {
+	perLine := max(width*100/(l.size*55), 1)
+	var out []plateLine
+	var line []string
+	length := 0
+	for _, word := range strings.Fields(l.text) {
+		n := utf8.RuneCountInString(html.UnescapeString(word))
+		if len(line) > 0 && length+1+n > perLine {
+			l.text = strings.Join(line, " ")
+			out = append(out, l)
+			line, length = nil, 0
+		}
+		if len(line) > 0 {
+			length++
+		}
+		line = append(line, word)
+		length += n
+	}
+	if len(line) > 0 {
+		l.text = strings.Join(line, " ")
+		out = append(out, l)
+	}
+	return out
+}
+
+// plateSVG draws lines centered on a plate width px wide, as tall as the
+// lines need.
+func plateSVG(lines []plateLine, width int, cfg config) string {
+	var wrapped []plateLine
+	for _, l := range lines {
+		wrapped = append(wrapped, wrapPlateLine(l, width)...)
+	}
+	var b strings.Builder
+	// Room for the outline above the first line
+	y := float64(cfg.px(5))
+	for _, l := range wrapped {
+		height := float64(l.size) * 1.25
+		attrs := fmt.Sprintf(`x="%d" y="%.1f" font-size="%d" fill="%s" stroke="%s" stroke-width="%d"`,
+			width/2, y+height*0.78, l.size, html.EscapeString(l.fill), html.EscapeString(l.stroke), l.strokeWidth)
+		if l.weight != "" {
+			attrs += fmt.Sprintf(` font-weight="%s"`, l.weight)
+		}
+		if l.style != "" {
+			attrs += fmt.Sprintf(` font-style="%s"`, l.style)
+		}
+		b.WriteString(fmt.Sprintf(`<text %s text-anchor="middle" stroke-linejoin="round" paint-order="stroke">%s</text>`, attrs, l.text))
+		y += height
+	}
+	total := int(y) + cfg.px(5)
+	return fmt.Sprintf(`<svg class="plate" width="%d" height="%d" viewBox="0 0 %d %d">%s</svg>`, width, total, width, total, b.String())
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// playlistPoll is how often serve mode checks whether another playlist is
+// due.
+const playlistPoll = 15 * time.Second
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// playlist is a set of config options that apply at certain times, e.g.
+// another folder and theme on Fridays. It is defined with
+// playlist.<name>.when and playlist.<name>.<option> lines.
+type playlist struct {
+	name     string
+	days     [7]bool // by time.Weekday
+	from, to int     // minutes since midnight; from == to is all day
+}
+
+// parseWhen reads when a playlist applies: days (e.g. "fri" or "sat-sun"),
+// a time range (e.g. "18:00-23:00"), or both. A range ending before it
+// starts goes on past midnight, still counting as the day it started.
+func parseWhen(value string) (playlist, error) {
+	var p playlist
+	anyDay := false
+	for _, token := range strings.FieldsFunc(strings.ToLower(value), func(r rune) bool { return r == ' ' || r == ',' }) {
+		start, end, isRange := strings.Cut(token, "-")
+		if strings.Contains(token, ":") {
+			if !isRange {
+				return p, errorf("playlist.invalid_range", token)
+			}
+			var err error
+			if p.from, err = parseClock(start); err != nil {
+				return p, err
+			}
+			if p.to, err = parseClock(end); err != nil {
+				return p, err
+			}
+			continue
+		}
+		first, okFirst := weekdays[start]
+		last, okLast := first, okFirst
+		if isRange {
+			last, okLast = weekdays[end]
+		}
+		if !okFirst || !okLast {
+			return p, errorf("playlist.invalid_days", token)
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			p.days[d] = true
+			if d == last {
+				break
+			}
+		}
+		anyDay = true
+	}
+	if !anyDay {
+		for d := range p.days {
+			p.days[d] = true
+		}
+	}
+	return p, nil
+}
+
+// parseClock reads a time of day like 18:00 as minutes since midnight.
+func parseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(s, ":")
+	hours, errH := strconv.Atoi(h)
+	minutes, errM := strconv.Atoi(m)
+	if !ok || errH != nil || errM != nil || hours < 0 || hours > 24 || minutes < 0 || minutes > 59 || hours*60+minutes > 24*60 {
+		return 0, errorf("playlist.invalid_time", s)
+	}
+	return hours*60 + minutes, nil
+}
+
+// activeAt reports whether the playlist applies at t.
+func (p playlist) activeAt(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	today := p.days[t.Weekday()]
+	yesterday := p.days[(t.Weekday()+6)%7]
+	switch {
+	case p.from == p.to:
+		return today
+	case p.from < p.to:
+		return today && minute >= p.from && minute < p.to
+	default:
+		return (today && minute >= p.from) || (yesterday && minute < p.to)
+	}
+}
+
+// parsePlaylists finds the playlists defined in the config lines, in the
+// order of their when lines.
+func parsePlaylists(lines []string) ([]playlist, error) {
+	var out []playlist
+	for _, line := range lines {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || strings.HasPrefix(key, "#") || !strings.HasPrefix(key, "playlist.") {
+			continue
+		}
+		name, option, _ := strings.Cut(strings.TrimPrefix(key, "playlist."), ".")
+		if option != "when" {
+			continue
+		}
+		p, err := parseWhen(value)
+		if err != nil {
+			return nil, errorf("value.invalid_because", key, value, err)
+		}
+		p.name = name
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// activePlaylist is the name of the first playlist that applies at t, or ""
+// if none does.
+func activePlaylist(playlists []playlist, t time.Time) string {
+	for _, p := range playlists {
+		if p.activeAt(t) {
+			return p.name
+		}
+	}
+	return ""
+}
+
+// playlistLines turns the options of the named playlist into plain config
+// lines, to be read after the rest so they win.
+func playlistLines(lines []string, name string) []string {
+	if name == "" {
+		return nil
+	}
+	prefix := "playlist." + name + "."
+	var out []string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		option := strings.TrimPrefix(line, prefix)
+		if key, _, _ := strings.Cut(option, "="); strings.TrimSpace(key) != "when" {
+			out = append(out, option)
+		}
+	}
+	return out
+}
+
+// playlistLabel names a playlist for messages.
+func playlistLabel(name string) string {
+	if name == "" {
+		return msg("playlist.none")
+	}
+	return name
+}
+
+// currentPlaylist is the playlist the config makes active now, for watch
+// mode to notice a switch.
+func currentPlaylist() string {
+	cfg, err := readConfig()
+	if err != nil {
+		return ""
+	}
+	return cfg.playlist
+}
+
+// watchPlaylists generates the slider again whenever another playlist
+// becomes active.
+func (s *server) watchPlaylists() {
+	for range time.Tick(playlistPoll) {
+		cfg, err := readConfig()
+		if err != nil || cfg.playlist == s.config().playlist {
+			continue
+		}
+		slog.Info(msg("serve.playlist", playlistLabel(cfg.playlist)))
+		if err := s.regenerate(); err != nil {
+			slog.Error(msg("serve.regenerate_failed", err))
+		}
+	}
+}
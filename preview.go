@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// previewServer is the state of the preview command.
+type previewServer struct {
+	hub     *eventHub[controlCommand]
+	page    string        // the generated page, in a temporary folder
+	sources []imageSource // of the first generation, whose folders are served
+
+	mu sync.Mutex // held while generating
+}
+
+// runPreview implements the "preview" command: it generates the slider to a
+// temporary folder, serves it on a local server only as long as the command
+// runs, and opens it in the browser with a debug overlay. Whenever the
+// images or the config change it generates again and the page reloads, so
+// settings can be tried out without OBS. The live page is left as it is.
+func runPreview(args []string) error {
+	fset := flag.NewFlagSet("preview", flag.ContinueOnError)
+	addr := fset.String("addr", "localhost:0", "address to listen on (a free port by default)")
+	noBrowser := fset.Bool("no-browser", false, "only show the address instead of opening the browser")
+	verbose := fset.Bool("verbose", false, "also show details such as which images were reused from the build cache")
+	quiet := fset.Bool("quiet", false, "only show warnings and errors")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if err := setupLogging(*verbose, *quiet, true); err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "photo-slider-preview-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	p := &previewServer{hub: newEventHub[controlCommand](), page: filepath.Join(dir, outputFile)}
+	if err := p.generate(); err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		http.ServeFile(w, r, p.page)
+	})
+	handleFiles(mux, p.sources, heroFile(config{previewOutput: p.page}))
+	mux.HandleFunc("GET /control/events", p.hub.serveEvents)
+	srv := &http.Server{Handler: mux}
+
+	ctx, stop := notifyShutdown()
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	go p.watch(ctx)
+
+	url := "http://" + ln.Addr().String() + "/"
+	slog.Info(msg("preview.listening", url))
+	if !*noBrowser {
+		openFile(url)
+	}
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	// Let a generation finish before its folder is removed
+	p.mu.Lock()
+	return nil
+}
+
+// generate generates the preview page from the current config and tells
+// the open pages to reload.
+func (p *previewServer) generate() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cfg, err := readConfig()
+	if err != nil {
+		return err
+	}
+	cfg.previewOutput = p.page
+	cfg.remoteControl = true
+	cfg.debugOverlay = true
+	// The browser window shows the page laid out for the canvas
+	cfg.sourceSizes = nil
+	start := time.Now()
+	if err := generate(cfg); err != nil {
+		return err
+	}
+	slog.Debug(msg("serve.regenerated", time.Since(start).Round(time.Millisecond)))
+	if p.sources == nil {
+		p.sources = cfg.sources
+	}
+	p.hub.broadcast(controlCommand{Action: actionReload})
+	return nil
+}
+
+// watch generates the preview again whenever something it depends on
+// changes, like watch mode of the interactive menu. A failed generation
+// leaves the last page up.
+func (p *previewServer) watch(ctx context.Context) {
+	last := watchStamp()
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stamp := watchStamp()
+			if stamp == last {
+				continue
+			}
+			last = stamp
+			slog.Info(msg("preview.changed"))
+			if err := p.generate(); err != nil {
+				slog.Error(msg("serve.regenerate_failed", err))
+			}
+		}
+	}
+}
+
+// writeDebugStyle styles the debug overlay of the preview command. It
+// isn't scaled with the page, so it stays readable at any canvas size.
+func writeDebugStyle(w *bufio.Writer) {
+	mustWrite(w, "      #debug {\n")
+	mustWrite(w, "        position: fixed;\n")
+	mustWrite(w, "        top: 8px;\n")
+	mustWrite(w, "        left: 8px;\n")
+	mustWrite(w, "        z-index: 1001;\n")
+	mustWrite(w, "        padding: 8px 12px;\n")
+	mustWrite(w, "        border-radius: 6px;\n")
+	mustWrite(w, "        font: 14px/1.5 monospace;\n")
+	mustWrite(w, "        color: #fff;\n")
+	mustWrite(w, "        background: rgba(0, 0, 0, 0.75);\n")
+	mustWrite(w, "        white-space: pre;\n")
+	mustWrite(w, "        pointer-events: none;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #debug-center {\n")
+	mustWrite(w, "        position: fixed;\n")
+	mustWrite(w, "        top: 0;\n")
+	mustWrite(w, "        bottom: 0;\n")
+	mustWrite(w, "        left: 50%;\n")
+	mustWrite(w, "        z-index: 1000;\n")
+	mustWrite(w, "        border-left: 1px dashed rgba(255, 64, 64, 0.8);\n")
+	mustWrite(w, "        pointer-events: none;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #permas .image-container {\n")
+	mustWrite(w, "        position: relative;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      .debug-label {\n")
+	mustWrite(w, "        position: absolute;\n")
+	mustWrite(w, "        top: 0;\n")
+	mustWrite(w, "        left: 0;\n")
+	mustWrite(w, "        z-index: 1;\n")
+	mustWrite(w, "        padding: 2px 6px;\n")
+	mustWrite(w, "        font: bold 14px monospace;\n")
+	mustWrite(w, "        color: #fff;\n")
+	mustWrite(w, "        background: rgba(0, 0, 0, 0.75);\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      .debug-current > .debug-label {\n")
+	mustWrite(w, "        background: rgba(200, 32, 32, 0.9);\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+}
+
+// writeDebugClient writes the debug overlay of the preview command: every
+// tile is labelled with its number, and a panel shows the image in the
+// middle of the window and how fast the strip actually scrolls, measured
+// from where it is on screen.
+func writeDebugClient(w *bufio.Writer) {
+	text, _ := json.Marshal(map[string]string{
+		"image":   msg("debug.image"),
+		"speed":   msg("debug.speed"),
+		"row":     msg("debug.row"),
+		"loop":    msg("debug.loop"),
+		"window":  msg("debug.window"),
+		"hero":    msg("debug.hero"),
+		"credits": msg("debug.credits"),
+	})
+	mustWrite(w, "    <div id=\"debug\"></div>\n")
+	mustWrite(w, "    <div id=\"debug-center\"></div>\n")
+	mustWrite(w, "    <script>\n")
+	mustWrite(w, fmt.Sprintf("      var debugText = %s;\n", text))
+	mustWrite(w, debugClient)
+	mustWrite(w, "    </script>\n")
+}
+
+const debugClient = `      (function () {
+        var panel = document.getElementById("debug");
+        var rows = document.querySelectorAll("#permas .row");
+        var strips = rows.length ? Array.prototype.slice.call(rows) : [document.getElementById("permas")];
+        var measured = strips.map(function () { return null; });
+        var speeds = strips.map(function () { return null; });
+
+        function format(s) {
+          var args = arguments, i = 1;
+          return s.replace(/%[sdv]/g, function () { return args[i++]; });
+        }
+
+        function tiles(strip, cls) {
+          var content = strip.querySelector("." + cls);
+          return content ? Array.prototype.slice.call(content.children) : [];
+        }
+
+        function name(tile) {
+          if (tile.dataset.image) return tile.dataset.image;
+          if (tile.classList.contains("hero")) return debugText.hero;
+          if (tile.classList.contains("credits")) return debugText.credits;
+          return "";
+        }
+
+        // Compact pages add their tiles once loaded, so this runs on every update
+        function label() {
+          strips.forEach(function (strip) {
+            ["scroll-content", "scroll-content-duplicate"].forEach(function (cls) {
+              tiles(strip, cls).forEach(function (tile, i) {
+                if (tile.querySelector(":scope > .debug-label")) return;
+                var l = document.createElement("div");
+                l.className = "debug-label";
+                l.textContent = "#" + (i + 1);
+                tile.appendChild(l);
+              });
+            });
+          });
+        }
+
+        function update() {
+          label();
+          var middle = window.innerWidth / 2;
+          var now = performance.now();
+          var lines = [];
+          strips.forEach(function (strip, r) {
+            var content = strip.querySelector(".scroll-content");
+            if (!content) return;
+            // How far the strip moved since the last update; it jumps back
+            // once per loop, which doesn't count
+            var left = content.getBoundingClientRect().left;
+            var last = measured[r];
+            if (last && left <= last.left && now > last.time) {
+              var speed = (last.left - left) / ((now - last.time) / 1000);
+              speeds[r] = speeds[r] === null ? speed : speeds[r] * 0.7 + speed * 0.3;
+            }
+            measured[r] = { left: left, time: now };
+
+            var own = tiles(strip, "scroll-content");
+            var all = own.concat(tiles(strip, "scroll-content-duplicate"));
+            all.forEach(function (tile) { tile.classList.remove("debug-current"); });
+            all.forEach(function (tile, i) {
+              var box = tile.getBoundingClientRect();
+              if (box.left <= middle && box.right >= middle) {
+                tile.classList.add("debug-current");
+                var n = i % own.length + 1;
+                var prefix = strips.length > 1 ? format(debugText.row, r + 1) + " " : "";
+                lines.push(prefix + format(debugText.image, n, own.length, name(tile)));
+              }
+            });
+            var speed = speeds[r] === null ? "…" : Math.round(speeds[r]);
+            var loop = "";
+            var animations = strip.getAnimations ? strip.getAnimations() : [];
+            if (animations.length) {
+              loop = ", " + format(debugText.loop, Math.round(animations[0].effect.getComputedTiming().duration / 100) / 10);
+            }
+            lines.push((strips.length > 1 ? format(debugText.row, r + 1) + " " : "") + format(debugText.speed, speed) + loop);
+          });
+          lines.push(format(debugText.window, window.innerWidth, window.innerHeight));
+          panel.textContent = lines.join("\n");
+        }
+
+        setInterval(update, 250);
+        window.addEventListener("load", update);
+      })();
+`
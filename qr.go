@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// A QR code encoder for the artist links, just big enough for URLs: byte
+// mode, error correction level M and versions 1 to 10 (up to 213 bytes).
+
+var errQRTooLong = msgError("qr.too_long")
+
+// qrVersions holds, for each version, the total number of codewords, the
+// error correction codewords per block and the number of blocks at level M.
+var qrVersions = [...]struct{ total, ecPerBlock, blocks int }{
+	{26, 10, 1},
+	{44, 16, 1},
+	{70, 26, 1},
+	{100, 18, 2},
+	{134, 24, 2},
+	{172, 16, 4},
+	{196, 18, 4},
+	{242, 22, 4},
+	{292, 22, 5},
+	{346, 26, 5},
+}
+
+// qrAlignment is the center coordinate of the alignment patterns per
+// version, on both axes.
+var qrAlignment = [...][]int{
+	{},
+	{6, 18},
+	{6, 22},
+	{6, 26},
+	{6, 30},
+	{6, 34},
+	{6, 22, 38},
+	{6, 24, 42},
+	{6, 26, 46},
+	{6, 28, 50},
+}
+
+// qrCode is a QR symbol; dark modules are true.
+type qrCode struct {
+	size     int
+	modules  [][]bool
+	function [][]bool // finder, timing, alignment and format modules
+}
+
+// encodeQR returns the smallest QR code holding text.
+func encodeQR(text string) (*qrCode, error) {
+	data := []byte(text)
+	version := 0
+	for v, info := range qrVersions {
+		countBits := 8
+		if v+1 >= 10 {
+			countBits = 16
+		}
+		dataBytes := info.total - info.ecPerBlock*info.blocks
+		if 4+countBits+8*len(data) <= 8*dataBytes {
+			version = v + 1
+			break
+		}
+	}
+	if version == 0 {
+		return nil, errorf("qr.too_long_bytes", errQRTooLong, len(data))
+	}
+	info := qrVersions[version-1]
+
+	// Mode indicator, character count, data, terminator and padding
+	var bits []bool
+	put := func(v, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, v>>i&1 != 0)
+		}
+	}
+	put(0b0100, 4)
+	if version >= 10 {
+		put(len(data), 16)
+	} else {
+		put(len(data), 8)
+	}
+	for _, b := range data {
+		put(int(b), 8)
+	}
+	capacity := 8 * (info.total - info.ecPerBlock*info.blocks)
+	put(0, min(4, capacity-len(bits)))
+	put(0, (8-len(bits)%8)%8)
+	for pad := 0xec; len(bits) < capacity; pad ^= 0xec ^ 0x11 {
+		put(pad, 8)
+	}
+	codewords := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			codewords[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+
+	// Split into blocks (the short ones first), add error correction and
+	// interleave
+	short := info.total / info.blocks
+	numShort := info.blocks - info.total%info.blocks
+	divisor := rsDivisor(info.ecPerBlock)
+	var blocks, ecs [][]byte
+	for i := 0; i < info.blocks; i++ {
+		n := short - info.ecPerBlock
+		if i >= numShort {
+			n++
+		}
+		blocks = append(blocks, codewords[:n])
+		ecs = append(ecs, rsRemainder(codewords[:n], divisor))
+		codewords = codewords[n:]
+	}
+	var final []byte
+	for i := 0; i <= short-info.ecPerBlock; i++ {
+		for _, b := range blocks {
+			if i < len(b) {
+				final = append(final, b[i])
+			}
+		}
+	}
+	for i := 0; i < info.ecPerBlock; i++ {
+		for _, ec := range ecs {
+			final = append(final, ec[i])
+		}
+	}
+
+	q := newQRCode(version)
+	q.placeData(final)
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormat(mask)
+		if p := q.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		q.applyMask(mask) // undo
+	}
+	q.applyMask(best)
+	q.drawFormat(best)
+	return q, nil
+}
+
+// newQRCode draws the function patterns of an empty symbol.
+func newQRCode(version int) *qrCode {
+	size := version*4 + 17
+	q := &qrCode{size: size}
+	for i := 0; i < size; i++ {
+		q.modules = append(q.modules, make([]bool, size))
+		q.function = append(q.function, make([]bool, size))
+	}
+
+	for i := 0; i < size; i++ {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+	for _, c := range [][2]int{{3, 3}, {size - 4, 3}, {3, size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x >= 0 && x < size && y >= 0 && y < size {
+					d := max(abs(dx), abs(dy))
+					q.set(x, y, d != 2 && d != 4)
+				}
+			}
+		}
+	}
+	pos := qrAlignment[version-1]
+	for i, x := range pos {
+		for j, y := range pos {
+			last := len(pos) - 1
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue // overlaps a finder pattern
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+	q.drawFormat(0) // reserves the modules; drawn again once the mask is known
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = rem<<1 ^ (rem>>11)*0x1f25
+		}
+		bits := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			a, b := size-11+i%3, i/3
+			q.set(a, b, bits>>i&1 != 0)
+			q.set(b, a, bits>>i&1 != 0)
+		}
+	}
+	return q
+}
+
+// set draws a function module.
+func (q *qrCode) set(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.function[y][x] = true
+}
+
+func (q *qrCode) drawFormat(mask int) {
+	data := 0b00<<3 | mask // level M
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		q.set(8, i, bit(i))
+	}
+	q.set(8, 7, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		q.set(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.size-15+i, bit(i))
+	}
+	q.set(8, q.size-8, true)
+}
+
+// placeData fills the non-function modules with data, in two-module wide
+// columns zigzagging up and down from the bottom right.
+func (q *qrCode) placeData(data []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // skip the vertical timing pattern
+		}
+		for vert := 0; vert < q.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert
+				}
+				if !q.function[y][x] && i < len(data)*8 {
+					q.modules[y][x] = data[i/8]>>(7-i%8)&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (q *qrCode) applyMask(mask int) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !q.function[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the symbol is to scan, using the run, block and
+// balance rules of the standard; the mask with the lowest score is used.
+func (q *qrCode) penalty() int {
+	p := 0
+	for y := 0; y < q.size; y++ {
+		for _, line := range [][]bool{q.row(y), q.column(y)} {
+			run := 1
+			for x := 1; x <= len(line); x++ {
+				if x < len(line) && line[x] == line[x-1] {
+					run++
+					continue
+				}
+				if run >= 5 {
+					p += run - 2
+				}
+				run = 1
+			}
+		}
+	}
+	dark := 0
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			c := q.modules[y][x]
+			if c {
+				dark++
+			}
+			if x > 0 && y > 0 && c == q.modules[y][x-1] && c == q.modules[y-1][x] && c == q.modules[y-1][x-1] {
+				p += 3
+			}
+		}
+	}
+	total := q.size * q.size
+	p += abs(dark*20-total*10) / total * 10
+	return p
+}
+
+func (q *qrCode) row(y int) []bool {
+	return q.modules[y]
+}
+
+func (q *qrCode) column(x int) []bool {
+	col := make([]bool, q.size)
+	for y := range col {
+		col[y] = q.modules[y][x]
+	}
+	return col
+}
+
+// svg draws the code with a four module quiet zone, size pixels square.
+func (q *qrCode) svg(size int) string {
+	n := q.size + 8
+	var path strings.Builder
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if q.modules[y][x] {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x+4, y+4)
+			}
+		}
+	}
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" shape-rendering="crispEdges"><rect width="%d" height="%d" fill="#fff"/><path d="%s" fill="#000"/></svg>`,
+		n, n, size, size, n, n, path.String())
+}
+
+// rsDivisor returns the Reed-Solomon generator polynomial of the given
+// degree, highest coefficient first and without the leading 1.
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// rsRemainder returns the error correction codewords for data.
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMultiply(d, factor)
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11d
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// makeQRCodes draws the QR code of every image that has a link.
+func makeQRCodes(metas []imageMeta, cfg config) {
+	for i := range metas {
+		m := &metas[i]
+		if m.link == "" {
+			continue
+		}
+		q, err := encodeQR(m.link)
+		if err != nil {
+			slog.Warn(msg("qr.failed", m.relPath, err))
+			continue
+		}
+		m.qr = q.svg(cfg.qrSize)
+	}
+}
+
+// captionQR reports whether the QR code of m goes at the end of its caption,
+// i.e. with qr_codes=caption unless caption_format places it with {qr}.
+func captionQR(m imageMeta, cfg config) bool {
+	return cfg.qrCodes == "caption" && m.qr != "" && !strings.Contains(cfg.captionFormat, "{qr}")
+}
+
+func writeQRStyle(w *bufio.Writer, cfg config) {
+	mustWrite(w, "      #permas .qr {\n")
+	mustWrite(w, "        display: block;\n")
+	mustWrite(w, fmt.Sprintf("        width: %dpx;\n", cfg.px(cfg.qrSize)))
+	mustWrite(w, fmt.Sprintf("        height: %dpx;\n", cfg.px(cfg.qrSize)))
+	mustWrite(w, fmt.Sprintf("        margin: %dpx auto 0;\n", cfg.px(16)))
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #permas .qr svg {\n")
+	mustWrite(w, "        display: block;\n")
+	mustWrite(w, fmt.Sprintf("        border-radius: %dpx;\n", cfg.px(8)))
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #permas .qr-frame {\n")
+	mustWrite(w, "        position: relative;\n")
+	mustWrite(w, "        width: fit-content;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #permas .qr-frame .qr {\n")
+	mustWrite(w, "        position: absolute;\n")
+	mustWrite(w, fmt.Sprintf("        right: %dpx;\n", cfg.px(12)))
+	mustWrite(w, fmt.Sprintf("        bottom: %dpx;\n", cfg.px(22)))
+	mustWrite(w, "        margin: 0;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// qrFormatM holds the format information of level M per mask, from the
+// table in the standard.
+var qrFormatM = [8]int{
+	0b101010000010010,
+	0b101000100100101,
+	0b101111001111100,
+	0b101101101001011,
+	0b100010111111001,
+	0b100000011001110,
+	0b100111110010111,
+	0b100101010100000,
+}
+
+// qrVersionInfo holds the version information of versions 7 to 10, from
+// the table in the standard.
+var qrVersionInfo = map[int]int{7: 0x07c94, 8: 0x085bc, 9: 0x09a99, 10: 0x0a4d3}
+
+func TestEncodeQR(t *testing.T) {
+	for _, tt := range []struct {
+		length  int
+		version int // 0 for too long
+	}{
+		{0, 1},
+		{14, 1},
+		{15, 2},
+		{26, 2},
+		{27, 3},
+		{42, 3},
+		{62, 4},
+		{84, 5},
+		{106, 6},
+		{122, 7},
+		{123, 8},
+		{152, 8},
+		{180, 9},
+		{181, 10},
+		{213, 10},
+		{214, 0},
+	} {
+		q, err := encodeQR(strings.Repeat("a", tt.length))
+		if tt.version == 0 {
+			if !errors.Is(err, errQRTooLong) {
+				t.Errorf("%d bytes: error = %v, want %v", tt.length, err, errQRTooLong)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d bytes: %v", tt.length, err)
+			continue
+		}
+		if want := 17 + 4*tt.version; q.size != want {
+			t.Errorf("%d bytes: size %d, want %d (version %d)", tt.length, q.size, want, tt.version)
+		}
+
+		// The format information next to the top left finder pattern
+		format := 0
+		for i := 0; i <= 5; i++ {
+			format |= qrBit(q.modules[i][8], i)
+		}
+		format |= qrBit(q.modules[7][8], 6) | qrBit(q.modules[8][8], 7) | qrBit(q.modules[8][7], 8)
+		for i := 9; i < 15; i++ {
+			format |= qrBit(q.modules[8][14-i], i)
+		}
+		if !slices.Contains(qrFormatM[:], format) {
+			t.Errorf("%d bytes: format information %015b isn't one of level M", tt.length, format)
+		}
+
+		if want, ok := qrVersionInfo[tt.version]; ok {
+			info := 0
+			for i := 0; i < 18; i++ {
+				info |= qrBit(q.modules[i/3][q.size-11+i%3], i)
+			}
+			if info != want {
+				t.Errorf("%d bytes: version information %#05x, want %#05x", tt.length, info, want)
+			}
+		}
+	}
+}
+
+func qrBit(dark bool, i int) int {
+	if dark {
+		return 1 << i
+	}
+	return 0
+}
+
+func TestRSRemainder(t *testing.T) {
+	// "HELLO WORLD" at version 1-M, the worked example of the standard
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, rsDivisor(10)); !slices.Equal(got, want) {
+		t.Errorf("error correction = %v, want %v", got, want)
+	}
+}
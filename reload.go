@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// restartSettings are the settings serve only reads when it starts: the
+// folders it serves and the chat it joins.
+var restartSettings = []string{"sources", "twitch_channel", "twitch_user", "twitch_token"}
+
+// fileStamp describes the file at path so that it changes whenever the file
+// is edited, or "" if there is none.
+func fileStamp(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d|%d", info.Size(), info.ModTime().UnixNano())
+}
+
+// changedSettings lists the keys whose values differ between before and
+// after, sorted.
+func changedSettings(before, after map[string]string) []string {
+	keys := map[string]bool{}
+	for key, value := range after {
+		if old, ok := before[key]; !ok || old != value {
+			keys[key] = true
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			keys[key] = true
+		}
+	}
+	return slices.Sorted(maps.Keys(keys))
+}
+
+// watchConfig applies changes to the config file while serving: it reads
+// the file again, and if it is valid generates the slider with the new
+// settings, which tells the connected pages to reload. An invalid or
+// deleted config is logged and the last settings and page stay in use, so
+// a typo doesn't take the slider off the stream.
+func (s *server) watchConfig() {
+	last := fileStamp(configFile)
+	for range time.Tick(watchInterval) {
+		stamp := fileStamp(configFile)
+		if stamp == last {
+			continue
+		}
+		last = stamp
+		if stamp == "" {
+			slog.Warn(msg("serve.config_missing", configFile))
+			continue
+		}
+		cfg, err := readConfig()
+		if err != nil {
+			slog.Error(msg("serve.config_invalid", configFile, err))
+			continue
+		}
+		old := s.config()
+		changed := changedSettings(old.settings, cfg.settings)
+		if len(changed) == 0 {
+			continue // only comments or spacing changed
+		}
+		slog.Info(msg("serve.config_changed", configFile, strings.Join(changed, ", ")))
+		var restart []string
+		for _, key := range changed {
+			if slices.Contains(restartSettings, key) {
+				restart = append(restart, key)
+			}
+		}
+		if len(restart) > 0 {
+			slog.Warn(msg("serve.config_restart", strings.Join(restart, ", ")))
+		}
+		if err := s.regenerate(); err != nil {
+			slog.Error(msg("serve.config_failed", err))
+		}
+	}
+}
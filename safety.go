@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// safetyFile caches the scores the content filter gave, so each image is
+// only sent to it once.
+func safetyFile() string {
+	return filepath.Join(cacheFolder, "safety.json")
+}
+
+// safetyCache maps a hash of the classifier and an image's content hash to
+// the score it gave the image.
+type safetyCache map[string]float64
+
+func loadSafetyCache() (safetyCache, error) {
+	c := safetyCache{}
+	content, err := os.ReadFile(safetyFile())
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, errorf("file.read", safetyFile(), err)
+	}
+	if err := json.Unmarshal(content, &c); err != nil {
+		return nil, errorf("file.parse", safetyFile(), err)
+	}
+	return c, nil
+}
+
+func saveSafetyCache(c safetyCache) error {
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cacheFolder, 0o755); err != nil {
+		return errorf("file.create_folder", cacheFolder, err)
+	}
+	return writeFileAtomic(safetyFile(), content)
+}
+
+// classifier names the configured content filter, or returns "" if there
+// is none. A new one scores every image again.
+func (cfg config) classifier() string {
+	switch {
+	case cfg.safetyCmd != "":
+		return "cmd " + cfg.safetyCmd
+	case cfg.safetyURL != "":
+		return "url " + cfg.safetyURL
+	}
+	return ""
+}
+
+// classify asks the content filter how likely the image at path is to be
+// unsafe for stream, from 0 to 1.
+func classify(path string, cfg config) (float64, error) {
+	var out []byte
+	var err error
+	if cfg.safetyCmd != "" {
+		out, err = runSafetyCmd(cfg.safetyCmd, path)
+	} else {
+		out, err = postSafetyURL(cfg.safetyURL, cfg.safetyAPIKey, path)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return parseScore(out)
+}
+
+// runSafetyCmd runs the safety_cmd command with the image's path as its
+// last argument.
+func runSafetyCmd(command, path string) ([]byte, error) {
+	args, err := splitCommand(command)
+	if err != nil {
+		return nil, fmt.Errorf("safety_cmd: %w", err)
+	}
+	if len(args) == 0 {
+		return nil, errors.New(msg("safety.empty"))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], append(args[1:], path)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if detail := strings.TrimSpace(stderr.String()); detail != "" {
+			err = fmt.Errorf("%w: %s", err, detail)
+		}
+		return nil, errorf("safety.run", args[0], err)
+	}
+	return out, nil
+}
+
+// postSafetyURL posts the image at path to the safety_url service and
+// returns its answer.
+func postSafetyURL(url, key, path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", mime.TypeByExtension(strings.ToLower(filepath.Ext(path))))
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	client := http.Client{Timeout: time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, errorf("safety.url_status", resp.Status)
+	}
+	return body, nil
+}
+
+// parseScore reads what the content filter answered: a number from 0 to 1,
+// or a JSON object with it as "score".
+func parseScore(out []byte) (float64, error) {
+	text := strings.TrimSpace(string(out))
+	score, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		var r struct {
+			Score *float64 `json:"score"`
+		}
+		if json.Unmarshal([]byte(text), &r) != nil || r.Score == nil {
+			return 0, errorf("safety.no_score", text)
+		}
+		score = *r.Score
+	}
+	if score < 0 || score > 1 {
+		return 0, errorf("safety.bad_score", score)
+	}
+	return score, nil
+}
+
+// checkSafety has the content filter score every image of metas (flipbooks
+// aside) and returns the ones below safety_threshold. Flagged images are
+// moved to the incoming folder to wait for review, or with safety_action
+// report only listed. Preview and export runs leave them out without moving
+// anything. Images the filter fails for are left out too.
+//
+// Images a moderator approved after they were flagged aren't checked again.
+func checkSafety(metas []imageMeta, cfg config, md metadata, failed *imageFailures) ([]imageMeta, error) {
+	classifier := cfg.classifier()
+	if classifier == "" {
+		return metas, nil
+	}
+	cache, err := loadSafetyCache()
+	if err != nil {
+		return nil, err
+	}
+	var mu sync.Mutex
+	scored := 0
+	scores := make([]float64, len(metas))
+	errs := make([]error, len(metas))
+	parallel(msg("progress.safety"), len(metas), cfg.workers, func(worker, i int) {
+		m := metas[i]
+		if m.frames > 0 || md.info(m.source).Flagged != nil {
+			return
+		}
+		sum := sha256.Sum256([]byte(classifier + "\n" + m.hash))
+		key := hex.EncodeToString(sum[:16])
+		mu.Lock()
+		score, ok := cache[key]
+		mu.Unlock()
+		if !ok {
+			done := traceSpanOn(worker, traceProcessing, "classify image", "path", m.relPath)
+			score, errs[i] = classify(m.source, cfg)
+			done()
+			if errs[i] != nil {
+				return
+			}
+			mu.Lock()
+			cache[key] = score
+			scored++
+			mu.Unlock()
+		}
+		scores[i] = score
+	})
+	if scored > 0 {
+		if err := saveSafetyCache(cache); err != nil {
+			return nil, err
+		}
+	}
+
+	quarantine := cfg.safetyAction == "quarantine" && cfg.previewOutput == "" && cfg.exportFormat == ""
+	out := metas[:0]
+	var flagged []string
+	for i, m := range metas {
+		if errs[i] != nil {
+			if err := failed.add(m.relPath, "failure.safety", errs[i]); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if scores[i] < cfg.safetyThreshold {
+			out = append(out, m)
+			continue
+		}
+		flagged = append(flagged, fmt.Sprintf("  %s (%.2f)", m.relPath, scores[i]))
+		if cfg.safetyAction == "report" {
+			out = append(out, m)
+			continue
+		}
+		if quarantine {
+			if err := quarantineImage(md, m.source, scores[i]); err != nil {
+				if err := failed.add(m.relPath, "failure.quarantine", err); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if len(flagged) == 0 {
+		return out, nil
+	}
+
+	switch {
+	case cfg.safetyAction == "report":
+		slog.Warn(msg("safety.flagged", countNoun(len(flagged), "count.image"), cfg.safetyThreshold))
+	case quarantine:
+		if err := saveMetadata(md); err != nil {
+			return nil, err
+		}
+		slog.Warn(msg("safety.quarantined", countNoun(len(flagged), "count.image"), cfg.safetyThreshold, incomingFolder))
+	default:
+		slog.Warn(msg("safety.excluded", countNoun(len(flagged), "count.image"), cfg.safetyThreshold))
+	}
+	for _, line := range flagged {
+		slog.Warn(line)
+	}
+	return out, nil
+}
+
+// quarantineImage moves a flagged image to the incoming folder, along with
+// its caption and the score, where it waits for review like a submission.
+func quarantineImage(md metadata, path string, score float64) error {
+	if err := os.MkdirAll(incomingFolder, 0o755); err != nil {
+		return err
+	}
+	info := md.info(path)
+	dest := uniquePath(incomingFolder, filepath.Base(path))
+	if err := os.Rename(path, dest); err != nil {
+		return err
+	}
+	info.Flagged = &score
+	md.set(path, imageInfo{})
+	md.set(dest, info)
+	return nil
+}
@@ -0,0 +1,14 @@
+package main
+
+import "testing"
+
+func TestRunSafetyCmdEmpty(t *testing.T) {
+	for _, command := range []string{"", "   ", "\t"} {
+		if _, err := runSafetyCmd(command, "images/a.png"); err == nil {
+			t.Errorf("runSafetyCmd(%q) succeeded", command)
+		}
+	}
+	if _, err := runSafetyCmd(`"classify.py`, "images/a.png"); err == nil {
+		t.Error("runSafetyCmd with a missing closing quote succeeded")
+	}
+}
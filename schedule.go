@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"time"
+)
+
+// schedule tells external tools (e.g. a chat bot) which tile is in the
+// middle of the screen at any moment. With a schedule the page starts its
+// scroll at a phase derived from the wall clock, so at unix time T the
+// strip is LoopSeconds into its loop at T mod LoopSeconds.
+type schedule struct {
+	Generated     time.Time       `json:"generated"`
+	LoopSeconds   int             `json:"loop_seconds"`
+	ViewportWidth int             `json:"viewport_width"`
+	Tiles         []scheduledTile `json:"tiles"`
+}
+
+// scheduledTile is centered on screen from Start to End seconds into the
+// loop. A tile that is centered across the end of the loop has End < Start.
+type scheduledTile struct {
+	Path   string  `json:"path"`
+	Author string  `json:"author"`
+	Title  string  `json:"title"`
+	Start  float64 `json:"start"`
+	End    float64 `json:"end"`
+}
+
+// tileWidth estimates how wide a tile is shown, from the image size.
+func tileWidth(m imageMeta, cfg config) float64 {
+	var w float64
+	switch {
+	case m.frames > 0:
+		return float64(m.frameWidth)
+	case m.width > 0 && m.height > 0:
+		w = float64(cfg.px(imageHeight)) * float64(m.width) / float64(m.height)
+	default:
+		w = float64(cfg.px(imageHeight))
+	}
+	if cfg.maxImageWidth > 0 && w > float64(cfg.px(cfg.maxImageWidth)) {
+		w = float64(cfg.px(cfg.maxImageWidth))
+	}
+	return w
+}
+
+func buildSchedule(metas []imageMeta, cfg config) schedule {
+	tiles := stripTiles(metas, cfg)
+	loop := loopSeconds(metas, cfg)
+	sch := schedule{Generated: time.Now(), LoopSeconds: loop, ViewportWidth: cfg.scheduleViewport}
+
+	tl := newScrollTimeline(metas, cfg)
+	if tl.distance == 0 {
+		return sch
+	}
+	center := float64(cfg.scheduleViewport) / 2
+	round := func(t float64) float64 { return math.Round(t*100) / 100 }
+
+	var x float64
+	for _, m := range tiles {
+		width := tileWidth(m, cfg) + float64(cfg.px(tileSpacing))
+		sch.Tiles = append(sch.Tiles, scheduledTile{
+			Path:   m.relPath,
+			Author: exportText(m.author),
+			Title:  exportText(m.title),
+			Start:  round(tl.timeAt(x - center)),
+			End:    round(tl.timeAt(x + width - center)),
+		})
+		x += width
+	}
+	return sch
+}
+
+func writeSchedule(path string, sch schedule) error {
+	content, err := json.MarshalIndent(sch, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, content)
+}
+
+// writeClockSync starts the scroll at the phase the schedule expects for
+// the current time.
+func writeClockSync(w *bufio.Writer, metas []imageMeta, cfg config) {
+	mustWrite(w, "    <script>\n")
+	mustWrite(w, fmt.Sprintf("      document.getElementById(\"permas\").style.animationDelay = -((Date.now() / 1000) %% %d) + \"s\";\n", loopSeconds(metas, cfg)))
+	mustWrite(w, "    </script>\n")
+}
+
+// nowShowing implements the "now-showing" command: print the tile that is
+// centered on screen right now, according to the schedule file.
+func nowShowing(args []string) error {
+	cfg, err := readConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.scheduleFile == "" {
+		return errorf("schedule.needs_file", configFile)
+	}
+	content, err := os.ReadFile(cfg.scheduleFile)
+	if err != nil {
+		return errorf("schedule.read_failed", err)
+	}
+	var sch schedule
+	if err := json.Unmarshal(content, &sch); err != nil {
+		return errorf("schedule.parse_failed", cfg.scheduleFile, err)
+	}
+	if sch.LoopSeconds == 0 {
+		return errors.New(msg("schedule.empty"))
+	}
+
+	phase := math.Mod(float64(time.Now().UnixMilli())/1000, float64(sch.LoopSeconds))
+	for _, t := range sch.Tiles {
+		in := t.Start <= phase && phase < t.End
+		if t.End < t.Start {
+			in = phase >= t.Start || phase < t.End
+		}
+		if !in {
+			continue
+		}
+		switch {
+		case t.Author != "" && t.Title != "":
+			fmt.Printf("%s - %s\n", t.Author, t.Title)
+		case t.Author != "":
+			fmt.Println(t.Author)
+		default:
+			fmt.Println(t.Title)
+		}
+		return nil
+	}
+	return errors.New(msg("schedule.none_centered"))
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// selectImages trims metas down to imageLimit using the configured selection
+// strategy:
+//
+//   - newest: the most recently dated images, by date_source
+//   - random: a different random set every run
+//   - rotate: the next max_images images in filename order, continuing
+//     where the previous run stopped, so every image comes up in turn
+//   - least-recent: the images that haven't been shown for the longest,
+//     never shown ones first, so every submission gets its turn even as
+//     images come and go
+//
+// With new_image_runs set, images added within that many generations are
+// always kept, and the strategy only picks the rest.
+func selectImages(metas []imageMeta, cfg config, st *state) []imageMeta {
+	n := imageLimit(cfg)
+	if n <= 0 || len(metas) <= n {
+		return metas
+	}
+	if cfg.newImageRuns <= 0 {
+		return selectFrom(metas, n, cfg, st)
+	}
+
+	ensureHashes(metas, cfg.workers)
+	var fresh, rest []imageMeta
+	for _, m := range metas {
+		if st.isNew(m.hash, cfg.newImageRuns) {
+			fresh = append(fresh, m)
+		} else {
+			rest = append(rest, m)
+		}
+	}
+	if len(fresh) >= n {
+		// More new images than fit: the ones added first, whose guarantee
+		// runs out soonest, win
+		arrived := func(m imageMeta) int {
+			if g, ok := st.Arrived[m.hash]; ok {
+				return g
+			}
+			return st.Generation
+		}
+		rand.Shuffle(len(fresh), func(i, j int) { fresh[i], fresh[j] = fresh[j], fresh[i] })
+		sort.SliceStable(fresh, func(i, j int) bool { return arrived(fresh[i]) < arrived(fresh[j]) })
+		return fresh[:n]
+	}
+	if left := n - len(fresh); len(rest) > left {
+		rest = selectFrom(rest, left, cfg, st)
+	}
+	return append(fresh, rest...)
+}
+
+// imageLimit is the most images to show: max_images, or fewer if
+// target_loop_seconds would otherwise scroll them by too fast to look at,
+// with dwell_seconds for each on top. It is 0 for no limit.
+func imageLimit(cfg config) int {
+	n := cfg.maxImages
+	if cfg.targetLoopSeconds > 0 {
+		fit := int(float64(cfg.targetLoopSeconds) / (minSecondsPerTile + cfg.dwellSeconds))
+		if cfg.heroTile {
+			fit--
+		}
+		if cfg.endCredits {
+			fit--
+		}
+		fit = max(fit, 1)
+		if n <= 0 || fit < n {
+			n = fit
+		}
+	}
+	return n
+}
+
+// selectFrom picks n of metas, which must hold more than n images.
+func selectFrom(metas []imageMeta, n int, cfg config, st *state) []imageMeta {
+	switch cfg.selection {
+	case "newest":
+		dates := make(map[string]time.Time, len(metas))
+		for _, m := range metas {
+			dates[m.source] = sourceDate(m, cfg)
+		}
+		sort.SliceStable(metas, func(i, j int) bool {
+			return dates[metas[i].source].After(dates[metas[j].source])
+		})
+		return metas[:n]
+	case "rotate":
+		sort.Slice(metas, func(i, j int) bool { return metas[i].source < metas[j].source })
+		start := st.RotateCursor % len(metas)
+		out := make([]imageMeta, 0, n)
+		for i := 0; i < n; i++ {
+			out = append(out, metas[(start+i)%len(metas)])
+		}
+		st.RotateCursor = (start + n) % len(metas)
+		return out
+	case "least-recent":
+		// Random among images last shown in the same generation
+		rand.Shuffle(len(metas), func(i, j int) { metas[i], metas[j] = metas[j], metas[i] })
+		ensureHashes(metas, cfg.workers)
+		sort.SliceStable(metas, func(i, j int) bool {
+			return st.LastShown[metas[i].hash].Before(st.LastShown[metas[j].hash])
+		})
+		return metas[:n]
+	default:
+		rand.Shuffle(len(metas), func(i, j int) { metas[i], metas[j] = metas[j], metas[i] })
+		return metas[:n]
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSelectNewestByDateTaken(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 12, 0, 0, 0, time.UTC) }
+	metas := []imageMeta{
+		{source: "images/a.jpg", date: day(3)},
+		{source: "images/b.jpg", date: day(20)},
+		{source: "images/c.jpg", date: day(1)},
+		{source: "images/d.jpg", date: day(11)},
+	}
+	cfg := config{selection: "newest", dateSource: "taken"}
+	got := selectFrom(metas, 2, cfg, &state{})
+	if len(got) != 2 || got[0].source != "images/b.jpg" || got[1].source != "images/d.jpg" {
+		t.Errorf("selected %v, want the images taken on the 20th and 11th", []string{got[0].source, got[1].source})
+	}
+}
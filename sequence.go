@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var frameNumber = regexp.MustCompile(`(\d+)\D*$`)
+
+// findSequences returns the subfolders of root that hold a numbered image
+// sequence (e.g. "01.png", "02.png", ...), with their frames in order.
+func findSequences(root string, filter pathFilter) (map[string][]string, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, errorf("file.read_dir", root, err)
+	}
+	out := map[string][]string{}
+	for _, e := range entries {
+		// Folders mixed in by mix_ratio hold images, not sequences
+		if !e.IsDir() || slices.Contains(filter.folders, e.Name()) {
+			continue
+		}
+		dir := filepath.Join(root, e.Name())
+		frames, err := sequenceFrames(dir, filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(frames) >= 2 {
+			out[dir] = frames
+		}
+	}
+	return out, nil
+}
+
+// sequenceFrames returns the frames in dir sorted by frame number, or nil if
+// any image in dir is not numbered.
+func sequenceFrames(dir string, filter pathFilter) ([]string, error) {
+	files, err := findImages(dir, filter)
+	if err != nil {
+		return nil, err
+	}
+	numbers := make(map[string]int, len(files))
+	for _, f := range files {
+		base := filepath.Base(f)
+		m := frameNumber.FindStringSubmatch(strings.TrimSuffix(base, filepath.Ext(base)))
+		if m == nil {
+			return nil, nil
+		}
+		numbers[f], _ = strconv.Atoi(m[1])
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if numbers[files[i]] != numbers[files[j]] {
+			return numbers[files[i]] < numbers[files[j]]
+		}
+		return files[i] < files[j]
+	})
+	return files, nil
+}
+
+// renderSequence writes the frames side by side into a sprite sheet for the
+// sequence in dir and returns the tile describing it. Every frame takes the
+// aspect ratio of the first one, and the sheet is height pixels tall, as tall
+// as images are shown, so frames map 1:1 onto CSS pixels.
+func renderSequence(dir string, frames []string, height int, limits imageLimits) (imageMeta, error) {
+	imgs := make([]image.Image, 0, len(frames))
+	for _, f := range frames {
+		img, err := decodeImage(f, limits)
+		if err != nil {
+			return imageMeta{}, errorf("file.decode", f, err)
+		}
+		imgs = append(imgs, img)
+	}
+	first := imgs[0].Bounds()
+	frameWidth := first.Dx() * height / first.Dy()
+	if frameWidth < 1 {
+		frameWidth = 1
+	}
+
+	sheet := image.NewRGBA(image.Rect(0, 0, frameWidth*len(imgs), height))
+	draw.Draw(sheet, sheet.Bounds(), image.Transparent, image.Point{}, draw.Src)
+	for i, img := range imgs {
+		drawCover(sheet, image.Rect(i*frameWidth, 0, (i+1)*frameWidth, height), img, nil)
+	}
+
+	path := sequenceFile(dir)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return imageMeta{}, errorf("file.create_folder", filepath.Dir(path), err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return imageMeta{}, errorf("file.create", path, err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, sheet); err != nil {
+		return imageMeta{}, errorf("file.encode", path, err)
+	}
+
+	return sequenceMeta(dir, len(imgs), frameWidth), nil
+}
+
+// sequenceFile is where the sprite sheet of the sequence in dir is rendered
+// to.
+func sequenceFile(dir string) string {
+	return filepath.Join(cacheFolder, "sequences", filepath.Base(dir)+".png")
+}
+
+// sequenceMeta is the tile of the rendered sequence in dir.
+func sequenceMeta(dir string, frames, frameWidth int) imageMeta {
+	author, title := parseAuthorTitle(filepath.Base(dir))
+	return imageMeta{
+		relPath:    filepath.ToSlash(sequenceFile(dir)),
+		source:     dir,
+		author:     author,
+		title:      title,
+		frames:     frames,
+		frameWidth: frameWidth,
+	}
+}
+
+func writeSequenceStyle(w *bufio.Writer, cfg config) {
+	mustWrite(w, "      #permas .flipbook {\n")
+	mustWrite(w, fmt.Sprintf("        height: %dpx;\n", cfg.px(imageHeight)))
+	mustWrite(w, fmt.Sprintf("        border-radius: %dpx;\n", cfg.px(12)))
+	mustWrite(w, fmt.Sprintf("        margin-bottom: %dpx;\n", cfg.px(10)))
+	mustWrite(w, fmt.Sprintf("        outline: %dpx %s %s;\n", cfg.px(5), cfg.theme.imageBorderStyle, cfg.theme.imageBorderColor))
+	mustWrite(w, fmt.Sprintf("        outline-offset: %dpx;\n", cfg.px(16)))
+	mustWrite(w, "        background-repeat: no-repeat;\n")
+	mustWrite(w, "        animation-name: flipbook;\n")
+	mustWrite(w, "        animation-iteration-count: infinite;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      @keyframes flipbook {\n")
+	mustWrite(w, "        to {\n")
+	mustWrite(w, "          background-position: calc(-1 * var(--sheet-width)) 0;\n")
+	mustWrite(w, "        }\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+}
+
+func writeFlipbook(w *bufio.Writer, m imageMeta, cfg config) {
+	style := fmt.Sprintf("width: %dpx; --sheet-width: %dpx; background-image: url(\"%s\"); animation-duration: %gs; animation-timing-function: steps(%d);",
+		m.frameWidth, m.frameWidth*m.frames, filepath.ToSlash(m.relPath), cfg.sequenceFrameSeconds*float64(m.frames), m.frames)
+	mustWrite(w, fmt.Sprintf("          <div class=\"scroller flipbook\" style=\"%s\" role=\"img\"%s></div>\n", html.EscapeString(style), altAttr("aria-label", m, cfg)))
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// server is the state of the serve command.
+type server struct {
+	hub      *eventHub[controlCommand]
+	adminHub *eventHub[imageEntry] // images changed in the admin page or API
+
+	mu  sync.Mutex // held while generating
+	cfg config     // config of the last generation
+
+	metaMu  sync.Mutex // held while changing photo-slider.meta
+	thumbMu sync.Mutex // held while making a thumbnail
+	statsMu sync.Mutex // held while changing photo-slider.stats
+}
+
+// runServe implements the "serve" command: it generates the slider once and
+// serves it over HTTP, so OBS can use a URL source that listens for remote
+// control commands.
+func runServe(args []string) error {
+	fset := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fset.String("addr", "localhost:8080", "address to listen on")
+	verbose := fset.Bool("verbose", false, "also show details such as control commands and webhooks sent")
+	quiet := fset.Bool("quiet", false, "only show warnings and errors")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	// Serve mode runs for hours, so say when things happened
+	if err := setupLogging(*verbose, *quiet, true); err != nil {
+		return err
+	}
+
+	lock, err := acquireLock("serve")
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+
+	s := &server{hub: newEventHub[controlCommand](), adminHub: newEventHub[imageEntry]()}
+	if err := s.regenerate(); err != nil {
+		return err
+	}
+	if cfg := s.config(); cfg.twitchToken != "" && cfg.twitchUser == "" {
+		return errors.New(msg("chat.needs_user"))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		// The variants for other source sizes are only served by name
+		size := r.URL.Query().Get("size")
+		if size == "" {
+			http.ServeFile(w, r, outputFile)
+			return
+		}
+		for _, known := range s.config().sourceSizes {
+			if known.name() == size {
+				http.ServeFile(w, r, sourceSizeFile(size))
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+	handleFiles(mux, s.config().sources, heroFile(s.config()))
+	mux.HandleFunc("GET /thumb/{id}", s.serveThumb)
+	mux.HandleFunc("GET /gallery", s.serveGallery)
+	mux.HandleFunc("GET /control/events", s.hub.serveEvents)
+	mux.HandleFunc("POST /control", func(w http.ResponseWriter, r *http.Request) {
+		if !requireScope(w, r, scopeControl) {
+			return
+		}
+		var cmd controlCommand
+		if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
+			httpError(w, http.StatusBadRequest, msg("api.invalid_json", err))
+			return
+		}
+		if err := cmd.validate(); err != nil {
+			httpError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		pages := s.hub.broadcast(cmd)
+		slog.Debug(msg("serve.control", cmd.Action, pages))
+		writeJSON(w, http.StatusOK, map[string]int{"pages": pages})
+	})
+	s.registerAdmin(mux)
+	s.registerAPI(mux)
+	go s.watchConfig()
+	go s.watchEmpty()
+	go s.watchPlaylists()
+	if s.config().twitchChannel != "" {
+		go s.watchChat()
+	}
+
+	srv := &http.Server{Addr: *addr, Handler: mux}
+	srv.RegisterOnShutdown(func() {
+		s.hub.shutdown()
+		s.adminHub.shutdown()
+	})
+	ctx, stop := notifyShutdown()
+	defer stop()
+	stopped := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		// A second Ctrl+C stops at once
+		stop()
+		slog.Info(msg("serve.stopping"))
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+		close(stopped)
+	}()
+
+	slog.Info(msg("serve.listening", outputFile, *addr))
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-stopped
+	// Let a generation or a change to the metadata or stats finish, so
+	// photo.html, the state and the files they write are complete
+	s.mu.Lock()
+	s.metaMu.Lock()
+	s.statsMu.Lock()
+	slog.Info(msg("serve.stopped"))
+	return nil
+}
+
+// regenerate re-reads the config, generates the slider and tells the
+// connected pages to reload.
+func (s *server) regenerate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cfg, err := readConfig()
+	if err != nil {
+		return err
+	}
+	useLogFile(cfg.logFile, cfg.logMaxSize)
+	cfg.remoteControl = true
+	start := time.Now()
+	if err := generate(cfg); err != nil {
+		return err
+	}
+	slog.Debug(msg("serve.regenerated", time.Since(start).Round(time.Millisecond)))
+	s.cfg = cfg
+	s.hub.broadcast(controlCommand{Action: actionReload})
+	if err := pruneThumbs(cfg.filter); err != nil {
+		slog.Warn(msg("serve.thumbs_failed", err))
+	}
+	return nil
+}
+
+// handleFiles serves the files a page refers to: the images, those of the
+// sources, the page assets in the cache folder and the hero mosaic at hero.
+// Not the config or keys, nor what else is in the cache folder, such as
+// build.json with the path and hash of every image.
+func handleFiles(mux *http.ServeMux, sources []imageSource, hero string) {
+	files := http.FileServer(http.Dir("."))
+	mux.Handle("GET /"+imageFolder+"/", visibleImages(files))
+	for _, dir := range pageAssetFolders() {
+		mux.Handle("GET /"+filepath.ToSlash(dir)+"/", files)
+	}
+	mux.Handle("GET /"+filepath.ToSlash(hero), files)
+	handleSources(mux, files, sources)
+}
+
+// visibleImages serves the images folder through files, without the
+// hidden images: leaving them out of the page isn't enough while their
+// address still works. Nor does it list the folder, which would name them.
+func visibleImages(files http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		md, err := loadMetadata()
+		if err != nil {
+			httpError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if md.info(filepath.FromSlash(strings.TrimPrefix(path.Clean(r.URL.Path), "/"))).Hidden {
+			http.NotFound(w, r)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+func (s *server) config() config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg
+}
+
+// updateMetadata applies change to the stored metadata and saves it, unless
+// change fails.
+func (s *server) updateMetadata(change func(md metadata) error) error {
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+	md, err := loadMetadata()
+	if err != nil {
+		return err
+	}
+	if err := change(md); err != nil {
+		return err
+	}
+	return saveMetadata(md)
+}
+
+// requireScope checks the request's bearer token against the API keys and
+// answers 401 unless it has one of scopes. Keys are re-read on every
+// request, so created and revoked keys apply without a restart.
+func requireScope(w http.ResponseWriter, r *http.Request, scopes ...string) bool {
+	keys, err := loadKeys()
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if ok {
+		for _, scope := range scopes {
+			if authorize(keys, token, scope) {
+				return true
+			}
+		}
+	}
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	httpError(w, http.StatusUnauthorized, msg("api.scope_required", oneOf(scopes...)))
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func httpError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestServedFiles(t *testing.T) {
+	s, _, _ := testAPIServer(t)
+	mux := http.NewServeMux()
+	handleFiles(mux, nil, heroFile(config{}))
+
+	for i, path := range []string{
+		filepath.Join(imageFolder, "shown.png"),
+		filepath.Join(imageFolder, "hidden.png"),
+		filepath.Join(optimizeFolder(), "shown.png"),
+		heroFile(config{}),
+		buildFile(),
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, grayPNG(t, uint8(i)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := s.updateMetadata(func(md metadata) error {
+		md.set(filepath.Join(imageFolder, "hidden.png"), imageInfo{Hidden: true})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		path string
+		want int
+	}{
+		{"/images/shown.png", http.StatusOK},
+		{"/images/hidden.png", http.StatusNotFound},
+		{"/images/", http.StatusNotFound},
+		{"/cache/optimized/shown.png", http.StatusOK},
+		{"/cache/hero.png", http.StatusOK},
+		{"/cache/build.json", http.StatusNotFound},
+		{"/photo-slider.meta", http.StatusNotFound},
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if rec.Code != tc.want {
+			t.Errorf("GET %s answered %d, want %d", tc.path, rec.Code, tc.want)
+		}
+	}
+}
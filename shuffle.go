@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// shuffler puts the tiles of a generation in the order they scroll by.
+// New strategies are added with registerShuffler, usually from an init
+// function in their own file, and picked with the shuffle config option.
+type shuffler interface {
+	shuffle(metas []imageMeta, cfg config, st *state) error
+}
+
+// shufflerFunc lets a plain function be used as a shuffler.
+type shufflerFunc func(metas []imageMeta, cfg config, st *state) error
+
+func (f shufflerFunc) shuffle(metas []imageMeta, cfg config, st *state) error {
+	return f(metas, cfg, st)
+}
+
+var shufflers = map[string]shuffler{}
+
+func registerShuffler(name string, s shuffler) {
+	if _, ok := shufflers[name]; ok {
+		panic("shuffler " + name + " registered twice")
+	}
+	shufflers[name] = s
+}
+
+func shufflerNames() string {
+	names := make([]string, 0, len(shufflers))
+	for name := range shufflers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return oneOf(names...)
+}
+
+func init() {
+	registerShuffler("random", shufflerFunc(shuffleRandom))
+	registerShuffler("spread-author", shufflerFunc(shuffleSpreadAuthor))
+	registerShuffler("least-recent", shufflerFunc(shuffleLeastRecent))
+	registerShuffler("manual", shufflerFunc(shuffleManual))
+}
+
+func shuffleRandom(metas []imageMeta, cfg config, st *state) error {
+	rand.Shuffle(len(metas), func(i, j int) { metas[i], metas[j] = metas[j], metas[i] })
+	return nil
+}
+
+// shuffleSpreadAuthor is random, except that two images by the same author
+// are only next to each other when there is no other way. Each step takes
+// an image by the author with the most images left, skipping the author
+// that was just placed.
+func shuffleSpreadAuthor(metas []imageMeta, cfg config, st *state) error {
+	shuffleRandom(metas, cfg, st)
+	// Images grouped by author, in order of first appearance
+	index := map[string]int{}
+	var groups [][]imageMeta
+	for _, m := range metas {
+		i, ok := index[m.author]
+		if !ok {
+			i = len(groups)
+			index[m.author] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], m)
+	}
+
+	last := -1
+	for i := range metas {
+		pick := -1
+		for g, group := range groups {
+			if len(group) == 0 || (g == last && len(groups) > 1) {
+				continue
+			}
+			if pick < 0 || len(group) > len(groups[pick]) {
+				pick = g
+			}
+		}
+		if pick < 0 {
+			pick = last // only the last author has images left
+		}
+		metas[i] = groups[pick][0]
+		groups[pick] = groups[pick][1:]
+		last = pick
+	}
+	return nil
+}
+
+// shuffleLeastRecent puts the images that haven't been in a generation for
+// the longest (or ever) first, in random order among equals.
+func shuffleLeastRecent(metas []imageMeta, cfg config, st *state) error {
+	shuffleRandom(metas, cfg, st)
+	ensureHashes(metas, cfg.workers)
+	sort.SliceStable(metas, func(i, j int) bool {
+		return st.LastShown[metas[i].hash].Before(st.LastShown[metas[j].hash])
+	})
+	return nil
+}
+
+// shuffleManual follows manual_order_file, which lists file names (or paths
+// relative to the images folder) one per line. Images that aren't listed
+// follow in file name order. A bot can rewrite the file and regenerate to
+// change the order.
+func shuffleManual(metas []imageMeta, cfg config, st *state) error {
+	rank := map[string]int{}
+	if cfg.manualOrderFile != "" {
+		f, err := os.Open(cfg.manualOrderFile)
+		if err != nil {
+			return errorf("shuffle.read_failed", err)
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := filepath.ToSlash(strings.TrimSpace(scanner.Text()))
+			if _, ok := rank[line]; line != "" && !strings.HasPrefix(line, "#") && !ok {
+				rank[line] = len(rank)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return errorf("shuffle.read_failed", err)
+		}
+	}
+	position := func(m imageMeta) (int, bool) {
+		rel, err := filepath.Rel(imageFolder, m.source)
+		if err != nil {
+			rel = m.source
+		}
+		if r, ok := rank[filepath.ToSlash(rel)]; ok {
+			return r, true
+		}
+		r, ok := rank[filepath.Base(m.source)]
+		return r, ok
+	}
+	slices.SortStableFunc(metas, func(a, b imageMeta) int {
+		ra, oka := position(a)
+		rb, okb := position(b)
+		switch {
+		case oka && okb:
+			return ra - rb
+		case oka:
+			return -1
+		case okb:
+			return 1
+		}
+		return strings.Compare(a.source, b.source)
+	})
+	return nil
+}
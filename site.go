@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// siteThumbHeight is the height of the thumbnails on the index page, twice
+// what it shows, for phone screens.
+const siteThumbHeight = 400
+
+// siteGenerator marks the pages export-site writes, so it only ever removes
+// its own pages from the folder.
+const siteGenerator = "photo-slider"
+
+// sitePage is the page of one image of the site.
+type sitePage struct {
+	exportedImage
+	Slug  string // file name without .html
+	Image string // full size, relative to the site folder
+	Thumb string
+	Prev  string // slugs of the neighbouring pages, wrapping around
+	Next  string
+}
+
+// runExportSite implements the "export-site" command, which writes a small
+// static website with the images of the slider: an index page and a page
+// per image, in the colors and font of the theme, to upload anywhere.
+func runExportSite(args []string) error {
+	fset := flag.NewFlagSet("export-site", flag.ContinueOnError)
+	out := fset.String("out", "site", "folder to write the site to")
+	verbose := fset.Bool("verbose", false, "also show details such as which images were reused from the build cache")
+	quiet := fset.Bool("quiet", false, "only show warnings and errors")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if err := setupLogging(*verbose, *quiet, false); err != nil {
+		return err
+	}
+	cfg, err := readConfig()
+	if err != nil {
+		return err
+	}
+	useLogFile(cfg.logFile, cfg.logMaxSize)
+	cfg.exportFormat = "site"
+	cfg.siteFolder = *out
+	return generate(cfg)
+}
+
+// siteSlug turns a file name into the name of its page: lower case, with
+// anything but letters and digits replaced by dashes.
+func siteSlug(path string) string {
+	base := filepath.Base(path)
+	slug := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return '-'
+	}, strings.TrimSuffix(base, filepath.Ext(base)))
+	for strings.Contains(slug, "--") {
+		slug = strings.ReplaceAll(slug, "--", "-")
+	}
+	slug = strings.Trim(slug, "-")
+	if slug == "" {
+		slug = "image"
+	}
+	return slug
+}
+
+// siteKey names the copies of the file shown for an image. It changes with
+// the image and with the watermark, so copies are only made again when they
+// would come out differently.
+func siteKey(hash, full string) string {
+	sum := sha256.Sum256([]byte(hash + "|" + full))
+	return hex.EncodeToString(sum[:8])
+}
+
+// writeSite writes the site for metas to dir. Copies of images no page
+// shows any more, and pages of images that are gone, are removed; other
+// files in dir are left alone.
+func writeSite(dir string, metas []imageMeta, cfg config) error {
+	cfg.hasEmoji = hasEmoji(captionGlyphs(metas, cfg))
+	g := exportGallery(metas, cfg)
+	for _, sub := range []string{"images", "thumbs"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return errorf("file.create_folder", filepath.Join(dir, sub), err)
+		}
+	}
+
+	keep := map[string]bool{}
+	taken := map[string]bool{"index": true}
+	pages := make([]sitePage, 0, len(g.Images))
+	for _, e := range g.Images {
+		p := sitePage{exportedImage: e, Slug: siteSlug(e.Path)}
+		for n := 2; taken[p.Slug]; n++ {
+			p.Slug = siteSlug(e.Path) + "-" + strconv.Itoa(n)
+		}
+		taken[p.Slug] = true
+
+		key := siteKey(e.hash, e.full)
+		p.Image = "images/" + key + strings.ToLower(filepath.Ext(e.full))
+		if _, err := os.Stat(filepath.Join(dir, p.Image)); err != nil {
+			if err := copyFile(e.full, filepath.Join(dir, p.Image)); err != nil {
+				return err
+			}
+		}
+		keep[filepath.Join(dir, p.Image)] = true
+		thumb, err := siteThumb(filepath.Join(dir, "thumbs", key), e, cfg)
+		if err != nil {
+			// The full image does as well, only slower
+			slog.Warn(msg("site.thumb_failed", e.Path, err))
+			thumb = filepath.Join(dir, p.Image)
+		}
+		keep[thumb] = true
+		p.Thumb, _ = filepath.Rel(dir, thumb)
+		p.Thumb = filepath.ToSlash(p.Thumb)
+		pages = append(pages, p)
+	}
+	for i := range pages {
+		pages[i].Prev = pages[(i+len(pages)-1)%len(pages)].Slug
+		pages[i].Next = pages[(i+1)%len(pages)].Slug
+	}
+
+	data := map[string]any{
+		"Lang":    cfg.lang,
+		"Title":   g.Title,
+		"FontURL": fontURL(cfg),
+		"Style":   siteStyle(dir, cfg),
+		"Pages":   pages,
+	}
+	written := map[string]bool{}
+	render := func(name, file string, data map[string]any) error {
+		var b bytes.Buffer
+		if err := siteTemplate.ExecuteTemplate(&b, name, data); err != nil {
+			return err
+		}
+		written[file] = true
+		return writeFileAtomic(filepath.Join(dir, file), b.Bytes())
+	}
+	if err := render("index", "index.html", data); err != nil {
+		return err
+	}
+	for _, p := range pages {
+		data["Page"] = p
+		if err := render("image", p.Slug+".html", data); err != nil {
+			return err
+		}
+	}
+
+	pruneSite(dir, keep, written)
+	slog.Info(msg("site.done", dir, countNoun(len(pages), "count.image")))
+	return nil
+}
+
+// siteThumb makes the index thumbnail of e at base, unless one is there
+// already. Images that are small enough, GIFs and WebPs are shown as they
+// are, like the thumbnails of serve mode.
+func siteThumb(base string, e exportedImage, cfg config) (string, error) {
+	if found, _ := filepath.Glob(base + ".*"); len(found) > 0 {
+		return found[0], nil
+	}
+	ext := strings.ToLower(filepath.Ext(e.full))
+	if ext == ".gif" || ext == ".webp" || e.Height <= siteThumbHeight {
+		return base + ext, copyFile(e.full, base+ext)
+	}
+	return shrinkImage(base, e.full, siteThumbHeight, cfg)
+}
+
+// pruneSite removes the copies in the images and thumbs folders of dir that
+// aren't in keep, and the pages of earlier exports that weren't written
+// this time.
+func pruneSite(dir string, keep, written map[string]bool) {
+	for _, sub := range []string{"images", "thumbs"} {
+		found, _ := filepath.Glob(filepath.Join(dir, sub, "*"))
+		for _, path := range found {
+			if !keep[path] {
+				os.Remove(path)
+			}
+		}
+	}
+	pages, _ := filepath.Glob(filepath.Join(dir, "*.html"))
+	for _, path := range pages {
+		if written[filepath.Base(path)] {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err == nil && bytes.Contains(content, []byte(`<meta name="generator" content="`+siteGenerator+`">`)) {
+			os.Remove(path)
+		}
+	}
+}
+
+// siteStyle is the CSS of the site: the theme's caption colors, border and
+// background, at sizes for reading rather than for a stream.
+func siteStyle(dir string, cfg config) template.CSS {
+	var b bytes.Buffer
+	w := bufio.NewWriter(&b)
+	mustWrite(w, "      body {\n")
+	mustWrite(w, "        margin: 0 auto;\n")
+	mustWrite(w, "        padding: 16px;\n")
+	mustWrite(w, "        max-width: 1200px;\n")
+	mustWrite(w, fmt.Sprintf("        font-family: %s;\n", fontStack(cfg)))
+	mustWrite(w, fmt.Sprintf("        color: %s;\n", cfg.theme.titleTextColor))
+	mustWrite(w, "        background: #111;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	if cfg.theme.background != "transparent" {
+		// A background image is copied next to the pages
+		cfg.backgroundURL = siteBackground(dir, cfg)
+		if cfg.backgroundURL != "" || !isBackgroundImage(cfg.theme.background) {
+			writeBackgroundStyle(w, cfg)
+		}
+	}
+	for _, rule := range []string{
+		"a { color: inherit; }",
+		"h1 { text-align: center; }",
+		"nav { display: flex; justify-content: space-between; margin-bottom: 16px; }",
+		".images { display: grid; grid-template-columns: repeat(auto-fill, minmax(200px, 1fr)); gap: 16px; }",
+		".images a { display: block; text-decoration: none; }",
+		".images img { width: 100%; height: 200px; object-fit: cover; display: block; }",
+		".images .caption { font-size: 60%; }",
+		".full { text-align: center; }",
+		".full img { max-width: 100%; max-height: 80vh; height: auto; }",
+		".caption { text-align: center; margin-top: 8px; overflow-wrap: anywhere; }",
+		".author, .title, .translation { display: block; paint-order: stroke fill; }",
+		".link { text-align: center; margin-top: 8px; }",
+	} {
+		mustWrite(w, "      "+rule+"\n")
+	}
+	mustWrite(w, fmt.Sprintf("      .images img, .full img { border: 3px %s %s; box-sizing: border-box; }\n", cfg.theme.imageBorderStyle, cfg.theme.imageBorderColor))
+	mustWrite(w, fmt.Sprintf("      .author { font-size: 1.5em; font-weight: bold; color: %s; -webkit-text-stroke: 0.2em %s; }\n", cfg.theme.authorTextColor, cfg.theme.authorStrokeColor))
+	mustWrite(w, fmt.Sprintf("      .title { font-size: 1.25em; color: %s; -webkit-text-stroke: 0.2em %s; }\n", cfg.theme.titleTextColor, cfg.theme.titleStrokeColor))
+	mustWrite(w, fmt.Sprintf("      .translation { font-size: 1em; font-style: italic; color: %s; -webkit-text-stroke: 0.2em %s; }\n", cfg.theme.titleTextColor, cfg.theme.titleStrokeColor))
+	w.Flush()
+	return template.CSS(b.String())
+}
+
+// siteBackground copies a background image file into dir and returns its
+// address relative to the pages. Web addresses are used as they are.
+func siteBackground(dir string, cfg config) string {
+	if !isBackgroundImage(cfg.theme.background) {
+		return ""
+	}
+	if strings.Contains(cfg.theme.background, "://") {
+		return cfg.theme.background
+	}
+	name := "background" + strings.ToLower(filepath.Ext(cfg.theme.background))
+	if err := copyFile(cfg.theme.background, filepath.Join(dir, name)); err != nil {
+		slog.Warn(msg("site.background_failed", err))
+		return ""
+	}
+	return name
+}
+
+var siteTemplate = template.Must(template.New("site").Funcs(template.FuncMap{"msg": msg}).Parse(`
+{{define "head"}}<!DOCTYPE html>
+<html lang="{{.Lang}}">
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <meta name="generator" content="` + siteGenerator + `">
+    <title>{{with .Page}}{{if .Title}}{{.Title}} – {{end}}{{end}}{{.Title}}</title>
+    <link rel="preconnect" href="https://fonts.googleapis.com">
+    <link rel="preconnect" href="https://fonts.gstatic.com" crossorigin>
+    <link href="{{.FontURL}}" rel="stylesheet">
+    <style>
+{{.Style}}    </style>
+  </head>
+{{end}}
+
+{{define "caption"}}<div class="caption">
+          {{if .Author}}<span class="author">{{.Author}}</span>{{end}}
+          {{if .Title}}<span class="title">{{.Title}}</span>{{end}}
+          {{if .Translation}}<span class="translation">{{.Translation}}</span>{{end}}
+        </div>{{end}}
+
+{{define "index"}}{{template "head" .}}  <body>
+    <h1>{{.Title}}</h1>
+    <div class="images">
+      {{range .Pages}}
+      <a href="{{.Slug}}.html">
+        <img src="{{.Thumb}}" loading="lazy" alt="{{.Title}}">
+        {{template "caption" .}}
+      </a>
+      {{else}}
+      <p>{{msg "gallery.empty"}}</p>
+      {{end}}
+    </div>
+  </body>
+</html>
+{{end}}
+
+{{define "image"}}{{template "head" .}}  <body>
+    {{with .Page}}
+    <nav>
+      <a id="prev" href="{{.Prev}}.html">&lsaquo; {{msg "gallery.previous"}}</a>
+      <a id="index" href="index.html">{{msg "site.index"}}</a>
+      <a id="next" href="{{.Next}}.html">{{msg "gallery.next"}} &rsaquo;</a>
+    </nav>
+    <div class="full">
+      <a href="{{.Image}}"><img src="{{.Image}}"{{if .Width}} width="{{.Width}}" height="{{.Height}}"{{end}} alt="{{.Title}}"></a>
+    </div>
+    {{template "caption" .}}
+    {{if .Link}}<div class="link"><a href="{{.Link}}" rel="noopener">{{msg "site.artist_link"}}</a></div>{{end}}
+    {{end}}
+    <script>
+      document.addEventListener("keydown", function (e) {
+        var to = { ArrowLeft: "prev", ArrowRight: "next", Escape: "index" }[e.key];
+        if (to) location.href = document.getElementById(to).href;
+      });
+    </script>
+  </body>
+</html>
+{{end}}
+`))
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// sourceSize is a size of the OBS browser source that a variant of the page
+// is laid out for, see source_sizes.
+type sourceSize struct {
+	width, height int
+}
+
+func (s sourceSize) name() string {
+	return fmt.Sprintf("%dx%d", s.width, s.height)
+}
+
+// sourceSizeFile is the variant of outputFile for the size with the given
+// name, e.g. photo-800x150.html.
+func sourceSizeFile(name string) string {
+	ext := filepath.Ext(outputFile)
+	return strings.TrimSuffix(outputFile, ext) + "-" + name + ext
+}
+
+var sourceSizeFilePattern = regexp.MustCompile(`^` + regexp.QuoteMeta(strings.TrimSuffix(outputFile, filepath.Ext(outputFile))) + `-\d+x\d+` + regexp.QuoteMeta(filepath.Ext(outputFile)) + `$`)
+
+// sourceSizeFiles are the variants of the page there are, including ones
+// of sizes no longer configured.
+func sourceSizeFiles() []string {
+	found, _ := filepath.Glob(sourceSizeFile("*"))
+	var out []string
+	for _, path := range found {
+		if sourceSizeFilePattern.MatchString(path) {
+			out = append(out, path)
+		}
+	}
+	return out
+}
+
+// sourceSizeConfig is cfg laid out for a browser source of size s: scaled
+// so the strip fills its height.
+func sourceSizeConfig(cfg config, s sourceSize) config {
+	cfg.scale = float64(s.height) / stripHeight
+	cfg.scheduleViewport = s.width
+	cfg.sourceSize = s.name()
+	return cfg
+}
+
+// writeSourceSizes writes a variant of the page for every source size and
+// removes the variants of sizes that were taken out of the config.
+func writeSourceSizes(metas []imageMeta, cfg config) error {
+	want := map[string]bool{}
+	for _, s := range cfg.sourceSizes {
+		path := sourceSizeFile(s.name())
+		want[path] = true
+		if err := writePage(path, metas, sourceSizeConfig(cfg, s)); err != nil {
+			return err
+		}
+	}
+	for _, path := range sourceSizeFiles() {
+		if !want[path] {
+			os.Remove(path)
+		}
+	}
+	return nil
+}
+
+// sizeURL is where the page for the size with the given name is loaded
+// from, "" being the page for the canvas. Serve mode only serves the
+// variants through the page's own address.
+func sizeURL(name string, cfg config) string {
+	switch {
+	case cfg.remoteControl && name == "":
+		return "/"
+	case cfg.remoteControl:
+		return "/?size=" + name
+	case name == "":
+		return outputFile
+	default:
+		return sourceSizeFile(name)
+	}
+}
+
+// writeSizeDetector switches to the variant of the page laid out for the
+// size closest to the browser source's when it loads, so the same address
+// works for a source of any size. It goes first, so the page doesn't start
+// loading images it is about to leave.
+func writeSizeDetector(w *bufio.Writer, cfg config) {
+	if len(cfg.sourceSizes) == 0 {
+		return
+	}
+	// The page for the canvas is a candidate too
+	sizes := [][]any{{sizeURL("", cfg), cfg.canvasWidth, cfg.canvasHeight}}
+	for _, s := range cfg.sourceSizes {
+		sizes = append(sizes, []any{sizeURL(s.name(), cfg), s.width, s.height})
+	}
+	list, _ := json.Marshal(sizes)
+	own, _ := json.Marshal(sizeURL(cfg.sourceSize, cfg))
+	mustWrite(w, "    <script>\n")
+	mustWrite(w, "      (function () {\n")
+	mustWrite(w, fmt.Sprintf("        var sizes = %s;\n", list))
+	mustWrite(w, "        var width = window.innerWidth, height = window.innerHeight;\n")
+	mustWrite(w, "        if (!width || !height) return;\n")
+	mustWrite(w, "        // Closest in proportion, so 800x150 is as far from 400x150 as from 1600x150\n")
+	mustWrite(w, "        var best = sizes[0], distance = Infinity;\n")
+	mustWrite(w, "        sizes.forEach(function (s) {\n")
+	mustWrite(w, "          var d = Math.abs(Math.log(width / s[1])) + Math.abs(Math.log(height / s[2]));\n")
+	mustWrite(w, "          if (d < distance) {\n")
+	mustWrite(w, "            best = s;\n")
+	mustWrite(w, "            distance = d;\n")
+	mustWrite(w, "          }\n")
+	mustWrite(w, "        });\n")
+	mustWrite(w, fmt.Sprintf("        if (best[0] !== %s) location.replace(best[0]);\n", own))
+	mustWrite(w, "      })();\n")
+	mustWrite(w, "    </script>\n")
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// imageSource is a folder from sources, read along with the images folder,
+// whose images can have their own caption and border colors and a badge.
+type imageSource struct {
+	name   string
+	folder string
+	style  theme  // only the caption and border colors and the border style
+	badge  string // label shown on each of its tiles, empty for none
+}
+
+var sourceNamePattern = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// parseSources reads sources, e.g. "fanart:fanart, memes:submissions/memes".
+// Folders are relative to the program's folder and have to be inside it,
+// since the page links to the images by relative paths.
+func parseSources(value string) ([]imageSource, error) {
+	var sources []imageSource
+	seen := map[string]bool{}
+	for _, item := range splitList(value) {
+		name, folder, ok := strings.Cut(item, ":")
+		name, folder = strings.TrimSpace(name), filepath.Clean(strings.TrimSpace(folder))
+		if !ok || !sourceNamePattern.MatchString(name) || folder == "." {
+			return nil, errorf("sources.invalid", item)
+		}
+		if filepath.IsAbs(folder) || folder == ".." || strings.HasPrefix(folder, ".."+string(filepath.Separator)) {
+			return nil, errorf("sources.outside", folder, name)
+		}
+		if rel, err := filepath.Rel(imageFolder, folder); err == nil && !strings.HasPrefix(rel, "..") {
+			return nil, errorf("sources.in_images", folder, name, imageFolder)
+		}
+		if rel, err := filepath.Rel(cacheFolder, folder); err == nil && !strings.HasPrefix(rel, "..") {
+			return nil, errorf("sources.in_cache", folder, name, cacheFolder)
+		}
+		if seen[name] || seen[folder] {
+			return nil, errorf("sources.twice", name, folder)
+		}
+		seen[name], seen[folder] = true, true
+		sources = append(sources, imageSource{name: name, folder: folder})
+	}
+	return sources, nil
+}
+
+// setSourceOption applies a source.<name>.<option> config key. Sources may
+// be styled before they are listed in sources, so unknown names are only
+// found by applySourceOptions.
+func setSourceOption(cfg *config, key, value string) error {
+	name, option, ok := strings.Cut(strings.TrimPrefix(key, "source."), ".")
+	if !ok || name == "" {
+		return errorf("sources.invalid_option", key)
+	}
+	if cfg.sourceOptions == nil {
+		cfg.sourceOptions = map[string]imageSource{}
+	}
+	s := cfg.sourceOptions[name]
+	switch option {
+	case "badge":
+		s.badge = value
+	case "author_text_color", "author_stroke_color", "title_text_color", "title_stroke_color", "image_border_color", "image_border_style":
+		setStyleOption(&s.style, option, value)
+	default:
+		return errorf("sources.unknown_option", key)
+	}
+	cfg.sourceOptions[name] = s
+	return nil
+}
+
+// applySourceOptions puts the source.<name>.<option> settings into the
+// sources they are for.
+func applySourceOptions(cfg *config) error {
+	for name, options := range cfg.sourceOptions {
+		s := cfg.source(name)
+		if s == nil {
+			return errorf("sources.unlisted", name)
+		}
+		s.style, s.badge = options.style, options.badge
+	}
+	return nil
+}
+
+// source returns the source with the given name, or nil.
+func (cfg config) source(name string) *imageSource {
+	for i := range cfg.sources {
+		if cfg.sources[i].name == name {
+			return &cfg.sources[i]
+		}
+	}
+	return nil
+}
+
+// sourceOf is the name of the source the file at path is in, or "" for the
+// images folder.
+func (cfg config) sourceOf(path string) string {
+	for _, s := range cfg.sources {
+		if rel, err := filepath.Rel(s.folder, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return s.name
+		}
+	}
+	return ""
+}
+
+// findSourceImages lists the images in the folders of sources, filtered
+// like the images folder.
+func findSourceImages(cfg config) ([]string, error) {
+	var out []string
+	for _, s := range cfg.sources {
+		images, err := findImages(s.folder, cfg.filter)
+		if err != nil {
+			return nil, errorf("sources.failed", s.name, err)
+		}
+		out = append(out, images...)
+	}
+	return out, nil
+}
+
+// handleSources serves the folders of sources like the images folder.
+// Sources added while serving are only served after a restart.
+func handleSources(mux *http.ServeMux, files http.Handler, sources []imageSource) {
+	for _, s := range sources {
+		mux.Handle("GET /"+filepath.ToSlash(s.folder)+"/", files)
+	}
+}
+
+// styledSources reports whether a source has colors of its own, which the
+// page then sets through CSS variables, see accentVar.
+func (cfg config) styledSources() bool {
+	for _, s := range cfg.sources {
+		if s.style != (theme{}) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasBadges reports whether a source labels its tiles.
+func (cfg config) hasBadges() bool {
+	for _, s := range cfg.sources {
+		if s.badge != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// tileTheme is the theme a tile is drawn in: the page's, with the colors
+// of its source on top.
+func tileTheme(m imageMeta, cfg config) theme {
+	if s := cfg.source(m.origin); s != nil {
+		return cfg.theme.with(s.style)
+	}
+	return cfg.theme
+}
+
+// sourceClass is the class of the tiles of a source.
+func sourceClass(name string) string {
+	if name == "" {
+		return ""
+	}
+	return "source-" + name
+}
+
+// sourceBadge is the badge of the source of m, or "".
+func sourceBadge(m imageMeta, cfg config) string {
+	if s := cfg.source(m.origin); s != nil {
+		return s.badge
+	}
+	return ""
+}
+
+// writeSourceStyle writes the colors of each styled source as the CSS
+// variables the caption and border rules read, and the style of badges.
+func writeSourceStyle(w *bufio.Writer, cfg config) {
+	for _, s := range cfg.sources {
+		var vars []string
+		add := func(name, value string) {
+			if value != "" {
+				vars = append(vars, fmt.Sprintf("--%s: %s;", name, value))
+			}
+		}
+		add("author-color", s.style.authorTextColor)
+		add("author-stroke", s.style.authorStrokeColor)
+		add("title-color", s.style.titleTextColor)
+		add("title-stroke", s.style.titleStrokeColor)
+		add("border", s.style.imageBorderColor)
+		add("border-style", s.style.imageBorderStyle)
+		if len(vars) == 0 {
+			continue
+		}
+		mustWrite(w, fmt.Sprintf("      #permas .%s {\n", sourceClass(s.name)))
+		for _, v := range vars {
+			mustWrite(w, "        "+v+"\n")
+		}
+		mustWrite(w, "      }\n")
+		mustWrite(w, "\n")
+	}
+	if !cfg.hasBadges() {
+		return
+	}
+	mustWrite(w, "      #permas .image-container {\n")
+	mustWrite(w, "        position: relative;\n")
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+	mustWrite(w, "      #permas .badge {\n")
+	mustWrite(w, "        position: absolute;\n")
+	mustWrite(w, fmt.Sprintf("        top: %dpx;\n", cfg.px(12)))
+	mustWrite(w, fmt.Sprintf("        left: %dpx;\n", cfg.px(12)))
+	mustWrite(w, "        z-index: 1;\n")
+	mustWrite(w, fmt.Sprintf("        padding: %dpx %dpx;\n", cfg.px(4), cfg.px(14)))
+	mustWrite(w, fmt.Sprintf("        border-radius: %dpx;\n", cfg.px(8)))
+	mustWrite(w, fmt.Sprintf("        font-family: %s;\n", fontStack(cfg)))
+	mustWrite(w, fmt.Sprintf("        font-size: %dpx;\n", cfg.px(28)))
+	mustWrite(w, "        font-weight: bold;\n")
+	mustWrite(w, fmt.Sprintf("        color: %s;\n", accentVar("author-color", cfg.theme.authorTextColor, cfg)))
+	mustWrite(w, fmt.Sprintf("        background: %s;\n", accentVar("border", cfg.theme.imageBorderColor, cfg)))
+	mustWrite(w, "      }\n")
+	mustWrite(w, "\n")
+}
+
+// writeBadge writes the badge of the source of m, if it has one.
+func writeBadge(w *bufio.Writer, m imageMeta, cfg config) {
+	if badge := sourceBadge(m, cfg); badge != "" {
+		mustWrite(w, fmt.Sprintf("          <div class=\"badge\">%s</div>\n", html.EscapeString(badge)))
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+const stateFile = "photo-slider.state"
+
+// state is what the generator remembers between runs.
+//
+// Images are identified by a hash of their content rather than their path,
+// so their history survives being renamed or moved.
+type state struct {
+	FirstShown map[string]time.Time `json:"first_shown"` // content hash -> first generation it was in
+	Current    []string             `json:"current"`     // images in the last generation
+	Hashes     map[string]string    `json:"hashes"`      // path -> content hash, for Current
+	LastShown  map[string]time.Time `json:"last_shown"`  // content hash -> last generation it was in
+	Arrived    map[string]int       `json:"arrived"`     // content hash -> generation it was first available in
+	Config     map[string]string    `json:"config"`      // config file settings of the last generation, for -dry-run
+
+	Generation   int `json:"generation"`    // number of generations so far
+	RotateCursor int `json:"rotate_cursor"` // where selection=rotate continues
+}
+
+// isNew reports whether the image with the given hash was added within the
+// last runs generations, counting the current one. Images that were there
+// before the state file (or this feature) are never new.
+func (st *state) isNew(hash string, runs int) bool {
+	g, ok := st.Arrived[hash]
+	if !ok {
+		return st.Generation > 0 // arriving now
+	}
+	return g > 0 && st.Generation-g < runs
+}
+
+// loadState reads the state file. The second result is false if there is
+// no state yet, i.e. this is the first run.
+func loadState() (state, bool, error) {
+	st := state{FirstShown: map[string]time.Time{}, Hashes: map[string]string{}, LastShown: map[string]time.Time{}, Arrived: map[string]int{}}
+	content, err := os.ReadFile(stateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return st, false, nil
+	}
+	if err != nil {
+		return st, false, errorf("state.read_failed", err)
+	}
+	if err := json.Unmarshal(content, &st); err != nil {
+		return st, false, errorf("state.parse_failed", stateFile, err)
+	}
+	if st.FirstShown == nil {
+		st.FirstShown = map[string]time.Time{}
+	}
+	if st.Hashes == nil {
+		st.Hashes = map[string]string{}
+	}
+	if st.LastShown == nil {
+		st.LastShown = map[string]time.Time{}
+	}
+	if st.Arrived == nil {
+		st.Arrived = map[string]int{}
+	}
+	return st, true, nil
+}
+
+func saveState(st state) error {
+	content, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(stateFile, content, 0o644); err != nil {
+		return errorf("state.write_failed", err)
+	}
+	return nil
+}
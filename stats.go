@@ -0,0 +1,204 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+const statsFile = "photo-slider.stats"
+
+// What viewers do with an image, as reported by the gallery and by pages
+// with interactive=true when they are served.
+const (
+	clickOpen = "open" // shown full-screen: the gallery's lightbox, or a tap on a touchscreen
+	clickLink = "link" // the artist's link followed from the gallery
+)
+
+// imageStats counts what viewers did with an image.
+type imageStats struct {
+	Opens      int `json:"opens"`
+	LinkClicks int `json:"link_clicks"`
+}
+
+// clickStats holds the counts of every image by path, like metadata.
+type clickStats map[string]imageStats
+
+func loadStats() (clickStats, error) {
+	st := clickStats{}
+	content, err := os.ReadFile(statsFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, errorf("stats.read_failed", err)
+	}
+	if err := json.Unmarshal(content, &st); err != nil {
+		return nil, errorf("stats.parse_failed", statsFile, err)
+	}
+	return st, nil
+}
+
+func saveStats(st clickStats) error {
+	content, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(statsFile, content)
+}
+
+// recordClick counts event for the image at path.
+func (s *server) recordClick(path, event string) error {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	st, err := loadStats()
+	if err != nil {
+		return err
+	}
+	c := st[filepath.ToSlash(path)]
+	if event == clickOpen {
+		c.Opens++
+	} else {
+		c.LinkClicks++
+	}
+	st[filepath.ToSlash(path)] = c
+	return saveStats(st)
+}
+
+// apiClick counts a click on an image, sent by the browsers of viewers, so
+// it needs no key. Only images in the slider count.
+func (s *server) apiClick(w http.ResponseWriter, r *http.Request) {
+	e, ok := s.apiFind(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		Event string `json:"event"`
+	}
+	// Sent with sendBeacon, which can't set a JSON content type
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&body); err != nil {
+		httpError(w, http.StatusBadRequest, msg("api.invalid_json", err))
+		return
+	}
+	if body.Event != clickOpen && body.Event != clickLink {
+		httpError(w, http.StatusBadRequest, msg("api.unknown_event", body.Event, clickOpen, clickLink))
+		return
+	}
+	if e.Hidden {
+		httpError(w, http.StatusNotFound, fmt.Sprintf("%s: %q", errNoImage, e.ID))
+		return
+	}
+	if err := s.recordClick(e.Path, body.Event); err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// imageReport is an image with its counts, as listed by GET /api/stats and
+// the stats command.
+type imageReport struct {
+	imageEntry
+	imageStats
+}
+
+// statsReport lists the images with their counts, the most opened first.
+func statsReport(filter pathFilter) ([]imageReport, error) {
+	entries, err := listImages(filter)
+	if err != nil {
+		return nil, err
+	}
+	st, err := loadStats()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]imageReport, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, imageReport{imageEntry: e, imageStats: st[e.Path]})
+	}
+	slices.SortStableFunc(out, func(a, b imageReport) int {
+		return cmp.Or(cmp.Compare(b.Opens, a.Opens), cmp.Compare(b.LinkClicks, a.LinkClicks))
+	})
+	return out, nil
+}
+
+func (s *server) apiStats(w http.ResponseWriter, r *http.Request) {
+	if !requireScope(w, r, scopeRead) {
+		return
+	}
+	report, err := statsReport(s.config().filter)
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// runStats implements the "stats" command, which prints how often each
+// image was opened and its artist's link followed, to share with the
+// artists. With -by-author the counts are added up per artist.
+func runStats(args []string) error {
+	fset := flag.NewFlagSet("stats", flag.ContinueOnError)
+	byAuthor := fset.Bool("by-author", false, "add up the counts of each artist's images")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := readConfig()
+	if err != nil {
+		return err
+	}
+	report, err := statsReport(cfg.filter)
+	if err != nil {
+		return err
+	}
+	if *byAuthor {
+		report = statsByAuthor(report)
+	}
+	printed := 0
+	for _, r := range report {
+		if r.Opens == 0 && r.LinkClicks == 0 {
+			continue
+		}
+		name := r.Path
+		if *byAuthor {
+			name = r.Author
+		}
+		fmt.Println(msg("stats.line", countNoun(r.Opens, "count.open"), countNoun(r.LinkClicks, "count.link_click"), name))
+		printed++
+	}
+	if printed == 0 {
+		fmt.Println(msg("stats.none"))
+	}
+	return nil
+}
+
+// statsByAuthor adds up the counts of report per author, keeping its order.
+func statsByAuthor(report []imageReport) []imageReport {
+	index := map[string]int{}
+	var out []imageReport
+	for _, r := range report {
+		author := r.Author
+		if author == "" {
+			author = msg("stats.no_author")
+		}
+		i, ok := index[author]
+		if !ok {
+			i = len(out)
+			index[author] = i
+			out = append(out, imageReport{imageEntry: imageEntry{Author: author}})
+		}
+		out[i].Opens += r.Opens
+		out[i].LinkClicks += r.LinkClicks
+	}
+	slices.SortStableFunc(out, func(a, b imageReport) int {
+		return cmp.Or(cmp.Compare(b.Opens, a.Opens), cmp.Compare(b.LinkClicks, a.LinkClicks))
+	})
+	return out
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"strings"
+)
+
+// theme holds everything that controls how the slider looks. Empty fields
+// mean "not set", so partial themes can be layered on top of each other.
+type theme struct {
+	authorTextColor   string
+	authorStrokeColor string
+	titleTextColor    string
+	titleStrokeColor  string
+	imageBorderColor  string
+	imageBorderStyle  string
+	font              string // Google Fonts family, optionally with a css2 axis spec
+	captionPlacement  string // below, above or none
+	background        string // transparent, a CSS color, a gradient or an image
+	backgroundFit     string // cover, contain or tile, for background images
+}
+
+// customTheme is a theme defined in the config file, optionally built on
+// top of another (built-in or custom) theme.
+type customTheme struct {
+	base  string
+	style theme
+}
+
+const defaultThemeName = "default"
+
+var builtinThemes = map[string]theme{
+	"default": {
+		authorTextColor:   "#ffffff",
+		authorStrokeColor: "#803128",
+		titleTextColor:    "#ffffff",
+		titleStrokeColor:  "#bd685e",
+		imageBorderColor:  "#741d34",
+		imageBorderStyle:  "dashed",
+		font:              "Nunito:ital,wght@1,800",
+		captionPlacement:  "below",
+		background:        "transparent",
+		backgroundFit:     "cover",
+	},
+	"neon": {
+		authorTextColor:   "#ffffff",
+		authorStrokeColor: "#ff00de",
+		titleTextColor:    "#ffffff",
+		titleStrokeColor:  "#00e5ff",
+		imageBorderColor:  "#39ff14",
+		imageBorderStyle:  "solid",
+		font:              "Orbitron:wght@800",
+		captionPlacement:  "below",
+	},
+	"pastel": {
+		authorTextColor:   "#fff5f8",
+		authorStrokeColor: "#f4a7b9",
+		titleTextColor:    "#fffdf5",
+		titleStrokeColor:  "#a7c7e7",
+		imageBorderColor:  "#c3b1e1",
+		imageBorderStyle:  "dotted",
+		font:              "Quicksand:wght@700",
+		captionPlacement:  "below",
+	},
+	"minimal": {
+		authorTextColor:   "#ffffff",
+		authorStrokeColor: "#000000",
+		titleTextColor:    "#ffffff",
+		titleStrokeColor:  "#000000",
+		imageBorderColor:  "#000000",
+		imageBorderStyle:  "none",
+		font:              "Inter:wght@600",
+		captionPlacement:  "below",
+	},
+	"dark": {
+		authorTextColor:   "#e0e0e0",
+		authorStrokeColor: "#111111",
+		titleTextColor:    "#bdbdbd",
+		titleStrokeColor:  "#1e1e1e",
+		imageBorderColor:  "#333333",
+		imageBorderStyle:  "solid",
+		font:              "Nunito:ital,wght@1,800",
+		captionPlacement:  "below",
+	},
+}
+
+// with returns t with every field that is set in o replaced.
+func (t theme) with(o theme) theme {
+	set := func(dst *string, src string) {
+		if src != "" {
+			*dst = src
+		}
+	}
+	set(&t.authorTextColor, o.authorTextColor)
+	set(&t.authorStrokeColor, o.authorStrokeColor)
+	set(&t.titleTextColor, o.titleTextColor)
+	set(&t.titleStrokeColor, o.titleStrokeColor)
+	set(&t.imageBorderColor, o.imageBorderColor)
+	set(&t.imageBorderStyle, o.imageBorderStyle)
+	set(&t.font, o.font)
+	set(&t.captionPlacement, o.captionPlacement)
+	set(&t.background, o.background)
+	set(&t.backgroundFit, o.backgroundFit)
+	return t
+}
+
+// fontFamily is the CSS family name of the theme font.
+func (t theme) fontFamily() string {
+	family, _, _ := strings.Cut(t.font, ":")
+	return family
+}
+
+// setStyleOption applies a style config key to t. It reports false if key
+// is not a style option.
+func setStyleOption(t *theme, key, value string) bool {
+	switch key {
+	case "author_text_color":
+		t.authorTextColor = value
+	case "author_stroke_color":
+		t.authorStrokeColor = value
+	case "title_text_color":
+		t.titleTextColor = value
+	case "title_stroke_color":
+		t.titleStrokeColor = value
+	case "image_border_color":
+		t.imageBorderColor = value
+	case "image_border_style":
+		t.imageBorderStyle = value
+	case "font":
+		t.font = value
+	case "caption_placement":
+		t.captionPlacement = value
+	case "background":
+		t.background = value
+	case "background_fit":
+		t.backgroundFit = value
+	default:
+		return false
+	}
+	return true
+}
+
+// setThemeOption handles "theme.<name>.<option>" config keys.
+func setThemeOption(cfg *config, key, value string) {
+	name, option, ok := strings.Cut(strings.TrimPrefix(key, "theme."), ".")
+	if !ok || name == "" {
+		return
+	}
+	if cfg.customThemes == nil {
+		cfg.customThemes = map[string]customTheme{}
+	}
+	ct := cfg.customThemes[name]
+	if option == "base" {
+		ct.base = value
+	} else {
+		setStyleOption(&ct.style, option, value)
+	}
+	cfg.customThemes[name] = ct
+}
+
+// resolveTheme builds the effective theme: the named theme (and its bases)
+// with the top-level style options from the config applied on top.
+func resolveTheme(cfg config) (theme, error) {
+	name := cfg.themeName
+	if name == "" {
+		name = defaultThemeName
+	}
+	t, err := lookupTheme(cfg, name, 0)
+	if err != nil {
+		return theme{}, err
+	}
+	t = builtinThemes[defaultThemeName].with(t).with(cfg.style)
+	switch t.captionPlacement {
+	case "below", "above", "none":
+	default:
+		return theme{}, errorf("value.expected", "caption_placement", t.captionPlacement, oneOf("below", "above", "none"))
+	}
+	switch t.backgroundFit {
+	case "cover", "contain", "tile":
+	default:
+		return theme{}, errorf("value.expected", "background_fit", t.backgroundFit, oneOf("cover", "contain", "tile"))
+	}
+	return t, nil
+}
+
+func lookupTheme(cfg config, name string, depth int) (theme, error) {
+	if depth > 10 {
+		return theme{}, errorf("theme.nested", name)
+	}
+	if ct, ok := cfg.customThemes[name]; ok {
+		base := ct.base
+		if base == "" {
+			base = defaultThemeName
+		}
+		if base == name {
+			return theme{}, errorf("theme.self_base", name)
+		}
+		t, err := lookupTheme(cfg, base, depth+1)
+		if err != nil {
+			return theme{}, err
+		}
+		return t.with(ct.style), nil
+	}
+	if t, ok := builtinThemes[name]; ok {
+		return t, nil
+	}
+	return theme{}, errorf("theme.unknown", name)
+}
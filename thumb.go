@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultThumbHeight = 200
+	maxThumbHeight     = 1080
+)
+
+// thumbFolder holds the thumbnails served by /thumb.
+func thumbFolder() string {
+	return filepath.Join(cacheFolder, "thumbs")
+}
+
+// thumbKey names the thumbnails of the image at path. It changes whenever
+// the file does, so a replaced image never gets an old thumbnail.
+func thumbKey(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s|%d|%d", filepath.ToSlash(path), info.Size(), info.ModTime().UnixNano()))
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// serveThumb answers GET /thumb/{id}?h=200 with the image scaled to h
+// pixels tall, for the gallery and for tools that don't want to download
+// full-size artwork. Hidden images have none, as they aren't in the
+// gallery either.
+func (s *server) serveThumb(w http.ResponseWriter, r *http.Request) {
+	s.writeThumb(w, r, false)
+}
+
+// serveAdminThumb answers GET /admin/thumb/{id} like serveThumb, hidden
+// images included, for the admin page's image list.
+func (s *server) serveAdminThumb(w http.ResponseWriter, r *http.Request) {
+	s.writeThumb(w, r, true)
+}
+
+func (s *server) writeThumb(w http.ResponseWriter, r *http.Request, hidden bool) {
+	e, err := findImage(s.config().filter, r.PathValue("id"))
+	if err == nil && e.Hidden && !hidden {
+		err = errNoImage
+	}
+	if !lookupOK(w, err) {
+		return
+	}
+	height := defaultThumbHeight
+	if v := r.URL.Query().Get("h"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxThumbHeight {
+			httpError(w, http.StatusBadRequest, msg("api.invalid_height", v, maxThumbHeight))
+			return
+		}
+		height = n
+	}
+	path, err := s.thumbnail(e.Path, height)
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// The URL stays the same when the image is replaced
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeFile(w, r, path)
+}
+
+// thumbnail returns the file to serve for the image at path scaled to
+// height, making it on the first request. Images that are already small
+// enough, GIFs (which would stop moving) and WebPs (which can't be decoded)
+// are served as they are.
+func (s *server) thumbnail(path string, height int) (string, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".gif" || ext == ".webp" {
+		return path, nil
+	}
+	key, err := thumbKey(path)
+	if err != nil {
+		return "", err
+	}
+	base := filepath.Join(thumbFolder(), fmt.Sprintf("%s-%d", key, height))
+
+	// One at a time, so a page full of thumbnails doesn't decode every
+	// image at once
+	s.thumbMu.Lock()
+	defer s.thumbMu.Unlock()
+	if found, _ := filepath.Glob(base + ".*"); len(found) > 0 {
+		return found[0], nil
+	}
+	cfg := s.config()
+	if _, h, err := imageSize(path, false, cfg.limits); err != nil || h <= height {
+		return path, err
+	}
+	return shrinkImage(base, path, height, cfg)
+}
+
+// pruneThumbs removes the thumbnails of images that were deleted or
+// replaced.
+func pruneThumbs(filter pathFilter) error {
+	entries, err := listImages(filter)
+	if err != nil {
+		return err
+	}
+	keep := map[string]bool{}
+	for _, e := range entries {
+		if key, err := thumbKey(e.Path); err == nil {
+			keep[key] = true
+		}
+	}
+	old, _ := filepath.Glob(filepath.Join(thumbFolder(), "*"))
+	for _, p := range old {
+		key, _, _ := strings.Cut(filepath.Base(p), "-")
+		if !keep[key] {
+			os.Remove(p)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestThumbOfHiddenImage(t *testing.T) {
+	s, _, _ := testAPIServer(t)
+	s.cfg.adminPassword = "secret"
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /thumb/{id}", s.serveThumb)
+	s.registerAdmin(mux)
+
+	if err := os.Mkdir(imageFolder, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"shown.png", "hidden.png"} {
+		if err := os.WriteFile(filepath.Join(imageFolder, name), grayPNG(t, uint8(i)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := s.updateMetadata(func(md metadata) error {
+		md.set(filepath.Join(imageFolder, "hidden.png"), imageInfo{Hidden: true})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string, admin bool) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if admin {
+			req.SetBasicAuth("", "secret")
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	for _, tc := range []struct {
+		path  string
+		admin bool
+		want  int
+	}{
+		{"/thumb/shown.png", false, http.StatusOK},
+		{"/thumb/hidden.png", false, http.StatusNotFound},
+		{"/admin/thumb/hidden.png", false, http.StatusUnauthorized},
+		{"/admin/thumb/hidden.png", true, http.StatusOK},
+	} {
+		if got := get(tc.path, tc.admin); got != tc.want {
+			t.Errorf("GET %s answered %d, want %d", tc.path, got, tc.want)
+		}
+	}
+}
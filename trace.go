@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Span categories, shown as the event category in the trace viewer.
+const (
+	traceDiscovery  = "discovery"
+	traceHashing    = "hashing"
+	traceProcessing = "processing"
+	traceRendering  = "rendering"
+)
+
+// traceEvent is a complete ("X") event in the Chrome trace event format,
+// which chrome://tracing and Perfetto open directly.
+type traceEvent struct {
+	Name string            `json:"name"`
+	Cat  string            `json:"cat"`
+	Ph   string            `json:"ph"`
+	TS   int64             `json:"ts"`  // microseconds since the trace started
+	Dur  int64             `json:"dur"` // microseconds
+	PID  int               `json:"pid"`
+	TID  int               `json:"tid"`
+	Args map[string]string `json:"args,omitempty"`
+}
+
+// tracer collects the spans of a run with -trace or -profile.
+type tracer struct {
+	mu     sync.Mutex
+	start  time.Time
+	events []traceEvent
+}
+
+// tracing is nil unless -trace or -profile is given.
+var tracing *tracer
+
+func startTracing() {
+	tracing = &tracer{start: time.Now()}
+}
+
+// traceSpan starts a span and returns the function that ends it. args are
+// key, value pairs shown with the span. Without -trace or -profile it does
+// nothing.
+func traceSpan(cat, name string, args ...string) func() {
+	return traceSpanOn(-1, cat, name, args...)
+}
+
+// traceSpanOn is traceSpan for code running on a worker of parallel. Each
+// worker gets its own row in the timeline, after the main one.
+func traceSpanOn(worker int, cat, name string, args ...string) func() {
+	t := tracing
+	if t == nil {
+		return func() {}
+	}
+	e := traceEvent{Name: name, Cat: cat, Ph: "X", TS: time.Since(t.start).Microseconds(), Dur: -1, PID: 1, TID: worker + 2}
+	if len(args) > 0 {
+		e.Args = make(map[string]string, len(args)/2)
+		for i := 0; i+1 < len(args); i += 2 {
+			e.Args[args[i]] = args[i+1]
+		}
+	}
+	t.mu.Lock()
+	i := len(t.events)
+	t.events = append(t.events, e)
+	t.mu.Unlock()
+	return func() {
+		t.mu.Lock()
+		t.events[i].Dur = time.Since(t.start).Microseconds() - t.events[i].TS
+		t.mu.Unlock()
+	}
+}
+
+// writeTrace saves the collected spans to path. Spans that never ended,
+// because generating failed partway, end now.
+func writeTrace(path string) error {
+	t := tracing
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Since(t.start).Microseconds()
+	for i := range t.events {
+		if t.events[i].Dur < 0 {
+			t.events[i].Dur = now - t.events[i].TS
+		}
+	}
+	content, err := json.Marshal(map[string]any{"traceEvents": t.events, "displayTimeUnit": "ms"})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return errorf("trace.write_failed", err)
+	}
+	return nil
+}
+
+// printProfile shows, for -profile, how long each step of generating took
+// and how large the page came out. Steps within other steps are part of
+// those, and steps that ran more than once are added up.
+func printProfile() {
+	t := tracing
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var names []string
+	took := map[string]time.Duration{}
+	var end int64
+	page, tiles := "", 0
+	for _, e := range t.events {
+		if e.TID != 1 || e.Dur < 0 || e.TS < end {
+			continue
+		}
+		end = e.TS + e.Dur
+		if _, ok := took[e.Name]; !ok {
+			names = append(names, e.Name)
+		}
+		took[e.Name] += time.Duration(e.Dur) * time.Microsecond
+		if e.Name == "write html" {
+			page = e.Args["path"]
+			tiles, _ = strconv.Atoi(e.Args["tiles"])
+		}
+	}
+	total := msg("profile.total")
+	width := len(total)
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+	fmt.Println(msg("profile.title"))
+	for _, name := range names {
+		fmt.Printf("  %-*s %9.1f ms\n", width, name, float64(took[name].Microseconds())/1000)
+	}
+	fmt.Printf("  %-*s %9.1f ms\n", width, total, float64(time.Since(t.start).Microseconds())/1000)
+	if page == "" {
+		return
+	}
+	info, err := os.Stat(page)
+	if err != nil {
+		return
+	}
+	if tiles == 0 {
+		fmt.Println(msg("profile.size", page, megabytes(info.Size())))
+		return
+	}
+	fmt.Println(msg("profile.size_per_image", page, megabytes(info.Size()), countNoun(tiles, "count.image"), info.Size()/int64(tiles)))
+}
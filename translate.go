@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// translationsFile caches the output of translate_cmd, so every caption is
+// only translated once.
+func translationsFile() string {
+	return filepath.Join(cacheFolder, "translations.json")
+}
+
+// translations maps a target language to the translations into it, keyed by
+// the original text.
+type translations map[string]map[string]string
+
+func loadTranslations() (translations, error) {
+	t := translations{}
+	content, err := os.ReadFile(translationsFile())
+	if errors.Is(err, fs.ErrNotExist) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, errorf("file.read", translationsFile(), err)
+	}
+	if err := json.Unmarshal(content, &t); err != nil {
+		return nil, errorf("file.parse", translationsFile(), err)
+	}
+	return t, nil
+}
+
+func saveTranslations(t translations) error {
+	content, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cacheFolder, 0o755); err != nil {
+		return errorf("file.create_folder", cacheFolder, err)
+	}
+	if err := os.WriteFile(translationsFile(), content, 0o644); err != nil {
+		return errorf("file.write", translationsFile(), err)
+	}
+	return nil
+}
+
+// captionText is the plain text of a caption part, as sent for translation.
+func captionText(s string) string {
+	return html.UnescapeString(strings.TrimSpace(strings.ReplaceAll(s, "<br>", " ")))
+}
+
+// translateCaptions fills in the translated title of every image, running
+// translate_cmd for the titles that aren't in the cache yet. The command
+// gets the target language as its last argument and the titles on stdin,
+// one per line, and must print their translations in the same order.
+func translateCaptions(metas []imageMeta, cfg config) error {
+	cache, err := loadTranslations()
+	if err != nil {
+		return err
+	}
+	known := cache[cfg.translateTo]
+	if known == nil {
+		known = map[string]string{}
+		cache[cfg.translateTo] = known
+	}
+
+	var todo []string
+	queued := map[string]bool{}
+	for _, m := range metas {
+		text := captionText(m.title)
+		if _, ok := known[text]; ok || text == "" || queued[text] {
+			continue
+		}
+		queued[text] = true
+		todo = append(todo, text)
+	}
+
+	if len(todo) > 0 {
+		out, err := runTranslate(cfg.translateCmd, cfg.translateTo, todo)
+		if err != nil {
+			return err
+		}
+		for i, text := range todo {
+			known[text] = out[i]
+		}
+		if err := saveTranslations(cache); err != nil {
+			return err
+		}
+		slog.Info(msg("translate.done", countNoun(len(todo), "count.caption"), cfg.translateTo))
+	}
+
+	for i := range metas {
+		metas[i].translation = html.EscapeString(known[captionText(metas[i].title)])
+	}
+	return nil
+}
+
+func runTranslate(command, lang string, texts []string) ([]string, error) {
+	args, err := splitCommand(command)
+	if err != nil {
+		return nil, fmt.Errorf("translate_cmd: %w", err)
+	}
+	if len(args) == 0 {
+		return nil, errors.New(msg("translate.empty"))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], append(args[1:], lang)...)
+	cmd.Stdin = strings.NewReader(strings.Join(texts, "\n") + "\n")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if detail := strings.TrimSpace(stderr.String()); detail != "" {
+			err = fmt.Errorf("%w: %s", err, detail)
+		}
+		return nil, errorf("translate.run", args[0], err)
+	}
+	lines := strings.Split(strings.TrimRight(strings.ReplaceAll(string(out), "\r\n", "\n"), "\n"), "\n")
+	if len(lines) != len(texts) {
+		return nil, errorf("translate.line_count", len(lines), len(texts))
+	}
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return lines, nil
+}
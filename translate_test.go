@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestRunTranslate(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("needs sh")
+	}
+	got, err := runTranslate(`sh -c "echo 'Hallo Welt'"`, "de", []string{"Hello world"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != "Hallo Welt" {
+		t.Errorf("runTranslate = %q, want [\"Hallo Welt\"]", got)
+	}
+
+	_, err = runTranslate(`sh -c "echo 'no API key' >&2; exit 3"`, "de", []string{"Hello"})
+	if err == nil || !strings.HasSuffix(err.Error(), ": exit status 3: no API key") || strings.Contains(err.Error(), "\n") {
+		t.Errorf("runTranslate error = %v, want the exit status and stderr on one line", err)
+	}
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// version is the release this binary was built for, set by the release
+// build with -ldflags "-X main.version=v1.2.3". Builds from source are "dev".
+var version = "dev"
+
+// releasesURL is where update looks for the latest release.
+const releasesURL = "https://api.github.com/repos/Ezelboy1000/photo-slider/releases/latest"
+
+// buildInfo is what "photo-slider version" prints about the binary.
+type buildInfo struct {
+	version  string
+	commit   string // empty if unknown
+	time     string
+	modified bool // built from a checkout with uncommitted changes
+	goVer    string
+}
+
+func readBuildInfo() buildInfo {
+	b := buildInfo{version: version, goVer: runtime.Version()}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	// go install of a release sets its version. Builds in a checkout get a
+	// pseudo-version like v0.0.0-20260101120000-abcdef123456, which isn't one
+	if v := info.Main.Version; b.version == "dev" && !strings.ContainsAny(v, "-+") && v != "(devel)" && v != "" {
+		b.version = v
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			b.commit = s.Value[:min(len(s.Value), 12)]
+		case "vcs.time":
+			b.time = s.Value
+		case "vcs.modified":
+			b.modified = s.Value == "true"
+		}
+	}
+	return b
+}
+
+func (b buildInfo) String() string {
+	details := []string{b.goVer, runtime.GOOS + "/" + runtime.GOARCH}
+	if b.commit != "" {
+		commit := b.commit
+		if b.modified {
+			commit += "+changes"
+		}
+		details = append([]string{msg("version.commit", commit, b.time)}, details...)
+	}
+	return fmt.Sprintf("photo-slider %s (%s)", b.version, strings.Join(details, ", "))
+}
+
+// runVersion implements the "version" command.
+func runVersion(args []string) error {
+	fset := flag.NewFlagSet("version", flag.ContinueOnError)
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	fmt.Println(readBuildInfo())
+	return nil
+}
+
+// release is the part of a GitHub release update uses.
+type release struct {
+	Tag    string         `json:"tag_name"`
+	URL    string         `json:"html_url"`
+	Assets []releaseAsset `json:"assets"`
+}
+
+type releaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// parseVersion splits a version like v1.12.3 into its numbers, ignoring
+// anything after a "-" or "+". It reports false for anything else.
+func parseVersion(v string) ([]int, bool) {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	var nums []int
+	for _, part := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, false
+		}
+		nums = append(nums, n)
+	}
+	return nums, len(nums) > 0
+}
+
+// newerVersion reports whether version a is newer than b.
+func newerVersion(a, b string) bool {
+	x, okA := parseVersion(a)
+	y, okB := parseVersion(b)
+	if !okA || !okB {
+		return false
+	}
+	for i := range max(len(x), len(y)) {
+		var p, q int
+		if i < len(x) {
+			p = x[i]
+		}
+		if i < len(y) {
+			q = y[i]
+		}
+		if p != q {
+			return p > q
+		}
+	}
+	return false
+}
+
+var updateClient = http.Client{Timeout: 5 * time.Minute}
+
+// maxDownload is the largest download update accepts, far more than a
+// release of the program.
+const maxDownload = 200 << 20
+
+// download fetches url, which must answer 200 with at most maxDownload
+// bytes.
+func download(url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "photo-slider/"+version)
+	resp, err := updateClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorf("update.status", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDownload+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxDownload {
+		return nil, errorf("update.too_large", url, maxDownload>>20)
+	}
+	return body, nil
+}
+
+func latestRelease() (release, error) {
+	body, err := download(releasesURL)
+	if err != nil {
+		return release{}, errorf("update.lookup", err)
+	}
+	var r release
+	if err := json.Unmarshal(body, &r); err != nil {
+		return release{}, errorf("update.parse", err)
+	}
+	return r, nil
+}
+
+// platformAsset picks the download of r for this system: the one whose name
+// mentions its OS and processor. Checksum files are never picked.
+func platformAsset(r release) (releaseAsset, bool) {
+	osNames := map[string][]string{"windows": {"windows", "win"}, "darwin": {"darwin", "macos", "mac"}, "linux": {"linux"}}[runtime.GOOS]
+	archNames := map[string][]string{"amd64": {"amd64", "x86_64", "x64"}, "arm64": {"arm64", "aarch64"}, "386": {"386", "x86"}}[runtime.GOARCH]
+	mentions := func(name string, words []string) bool {
+		for _, w := range words {
+			if strings.Contains(name, w) {
+				return true
+			}
+		}
+		return false
+	}
+	var candidates []releaseAsset
+	for _, a := range r.Assets {
+		name := strings.ToLower(a.Name)
+		if strings.Contains(name, "sha256") || strings.Contains(name, "checksum") {
+			continue
+		}
+		if !mentions(name, osNames) && !(runtime.GOOS == "windows" && strings.HasSuffix(name, ".exe")) {
+			continue
+		}
+		if mentions(name, archNames) {
+			return a, true
+		}
+		candidates = append(candidates, a)
+	}
+	// Without a processor in the name, take it if it is the only one
+	if len(candidates) == 1 {
+		return candidates[0], true
+	}
+	return releaseAsset{}, false
+}
+
+// checksum returns the SHA-256 of asset listed in the release's checksum
+// file, or "" if the release has none.
+func checksum(r release, asset string) (string, error) {
+	for _, a := range r.Assets {
+		name := strings.ToLower(a.Name)
+		if !strings.Contains(name, "sha256") && !strings.Contains(name, "checksum") {
+			continue
+		}
+		body, err := download(a.URL)
+		if err != nil {
+			return "", err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == asset {
+				return strings.ToLower(fields[0]), nil
+			}
+		}
+		return "", errorf("update.not_listed", a.Name, asset)
+	}
+	return "", nil
+}
+
+// extractBinary returns the program in a downloaded asset: the asset itself,
+// or the photo-slider file in a .zip or .tar.gz of it.
+func extractBinary(name string, content []byte) ([]byte, error) {
+	isBinary := func(file string) bool {
+		base := strings.ToLower(filepath.Base(file))
+		return base == "photo-slider" || base == "photo-slider.exe"
+	}
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range zr.File {
+			if !isBinary(f.Name) {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			return io.ReadAll(rc)
+		}
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		gz, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		tr := tar.NewReader(gz)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if h.Typeflag == tar.TypeReg && isBinary(h.Name) {
+				return io.ReadAll(tr)
+			}
+		}
+	default:
+		return content, nil
+	}
+	return nil, errorf("update.no_program", name)
+}
+
+// oldBinary is where update moves the running program, which Windows
+// doesn't allow to be overwritten or deleted while it runs.
+func oldBinary(exe string) string {
+	return exe + ".old"
+}
+
+// removeOldBinary deletes the program an earlier update replaced.
+func removeOldBinary() {
+	if exe, err := os.Executable(); err == nil {
+		os.Remove(oldBinary(exe))
+	}
+}
+
+// replaceBinary puts content in place of the running program at exe.
+func replaceBinary(exe string, content []byte) error {
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	tmp := exe + ".new"
+	if err := os.WriteFile(tmp, content, info.Mode().Perm()|0o100); err != nil {
+		return err
+	}
+	os.Remove(oldBinary(exe))
+	if err := os.Rename(exe, oldBinary(exe)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, exe); err != nil {
+		// Put the old program back rather than leave none
+		os.Rename(oldBinary(exe), exe)
+		os.Remove(tmp)
+		return err
+	}
+	if runtime.GOOS != "windows" {
+		os.Remove(oldBinary(exe))
+	}
+	return nil
+}
+
+// runUpdate implements the "update" command, which replaces the program
+// with the latest release on GitHub, for everyone who downloaded it rather
+// than building it.
+func runUpdate(args []string) error {
+	fset := flag.NewFlagSet("update", flag.ContinueOnError)
+	check := fset.Bool("check", false, "only say whether there is a newer release")
+	force := fset.Bool("force", false, "install the latest release even if it isn't newer, or this is a build from source")
+	noChecksum := fset.Bool("no-checksum", false, "install a release that has no checksum file to check the download against")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	current := readBuildInfo().version
+	r, err := latestRelease()
+	if err != nil {
+		return err
+	}
+	_, released := parseVersion(current)
+	newer := newerVersion(r.Tag, current)
+	switch {
+	case *check:
+		if newer || !released {
+			fmt.Println(msg("update.available", r.Tag, current, r.URL))
+		} else {
+			fmt.Println(msg("update.current", current))
+		}
+		return nil
+	case !released && !*force:
+		return errorf("update.source_build", current, r.Tag)
+	case !newer && !*force:
+		fmt.Println(msg("update.current", current))
+		return nil
+	}
+
+	asset, ok := platformAsset(r)
+	if !ok {
+		return errorf("update.no_asset", r.Tag, runtime.GOOS, runtime.GOARCH, r.URL)
+	}
+	want, err := checksum(r, asset.Name)
+	if err != nil {
+		return errorf("update.check", err)
+	}
+	if want == "" && !*noChecksum {
+		return errorf("update.no_checksum", r.Tag, r.URL)
+	}
+	fmt.Println(msg("update.downloading", r.Tag, asset.Name))
+	content, err := download(asset.URL)
+	if err != nil {
+		return err
+	}
+	if want != "" {
+		sum := sha256.Sum256(content)
+		if got := hex.EncodeToString(sum[:]); got != want {
+			return errorf("update.damaged", asset.Name, got, want)
+		}
+	}
+	binary, err := extractBinary(asset.Name, content)
+	if err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	if err := replaceBinary(exe, binary); err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return errorf("update.no_permission", exe)
+		}
+		return errorf("file.replace", exe, err)
+	}
+	fmt.Println(msg("update.done", current, r.Tag))
+	return nil
+}
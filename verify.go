@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// verifyHead is inserted at the top of <head> so it sees every error,
+// including failed image and stylesheet loads.
+const verifyHead = `<script>
+      window.__verify = { errors: [] };
+      window.addEventListener("error", function (e) {
+        var src = e.target && (e.target.src || e.target.href);
+        window.__verify.errors.push(src ? "failed to load " + src : String(e.message));
+      }, true);
+      (function () {
+        var orig = console.error;
+        console.error = function () {
+          window.__verify.errors.push(Array.prototype.join.call(arguments, " "));
+          orig.apply(console, arguments);
+        };
+      })();
+    </script>
+`
+
+// verifyBody is inserted at the end of <body>. Once the page and the images
+// lazy_loading held back have loaded, it writes its findings into
+// #verify-result, which is read back from the DOM.
+const verifyBody = `<script>
+      window.addEventListener("load", function () {
+        var imgs = Array.prototype.slice.call(document.querySelectorAll("#permas img"));
+        // Images lazy_loading holds back are loaded now, so they are checked too
+        var pending = imgs.filter(function (i) {
+          if (i.dataset.src) {
+            i.src = i.dataset.src;
+            i.removeAttribute("data-src");
+          }
+          if (i.loading === "lazy") i.loading = "eager";
+          return !i.complete;
+        }).map(function (i) {
+          return new Promise(function (done) {
+            i.addEventListener("load", done);
+            i.addEventListener("error", done);
+          });
+        });
+        Promise.all(pending).then(function () {
+          var strip = document.getElementById("permas");
+          var first = document.querySelector("#permas .scroll-content");
+          var second = document.querySelector("#permas .scroll-content-duplicate");
+          var out = document.createElement("pre");
+          out.id = "verify-result";
+          out.textContent = JSON.stringify({
+            images: imgs.length,
+            broken: imgs.filter(function (i) { return !i.complete || i.naturalWidth === 0; }).map(function (i) { return i.getAttribute("src"); }),
+            errors: window.__verify.errors,
+            stripWidth: strip ? strip.scrollWidth : 0,
+            firstWidth: first ? first.offsetWidth : 0,
+            secondWidth: second ? second.offsetWidth : 0
+          });
+          document.body.appendChild(out);
+        });
+      });
+    </script>
+`
+
+var verifyResultPattern = regexp.MustCompile(`(?s)<pre id="verify-result">(.*?)</pre>`)
+
+type verifyResult struct {
+	Images      int      `json:"images"`
+	Broken      []string `json:"broken"`
+	Errors      []string `json:"errors"`
+	StripWidth  int      `json:"stripWidth"`
+	FirstWidth  int      `json:"firstWidth"`
+	SecondWidth int      `json:"secondWidth"`
+}
+
+// verifyRender loads the generated page in headless Chrome and checks that
+// every image loads, including those lazy_loading would load later, that
+// the two halves of the strip are the same width (the scroll keyframes
+// move it by exactly -50%) and that nothing was logged as an error. It
+// also saves a screenshot of the page.
+func verifyRender(args []string) error {
+	fset := flag.NewFlagSet("verify-render", flag.ContinueOnError)
+	chrome := fset.String("chrome", "", "path to Chrome/Chromium/Edge (default: search common locations)")
+	screenshot := fset.String("screenshot", previewFile, "where to save a screenshot of the page (empty to skip)")
+	timeout := fset.Duration("timeout", time.Minute, "maximum time to wait for the browser")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	browser, err := findChrome(*chrome)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(outputFile)
+	if err != nil {
+		return errorf("verify.read_failed", outputFile, err)
+	}
+
+	// The probe copy sits next to the output so relative image paths resolve
+	probe := filepath.Join(filepath.Dir(outputFile), ".verify-"+filepath.Base(outputFile))
+	page := strings.Replace(string(content), "<head>\n", "<head>\n    "+verifyHead, 1)
+	page = strings.Replace(page, "  </body>", "    "+verifyBody+"  </body>", 1)
+	if err := os.WriteFile(probe, []byte(page), 0o644); err != nil {
+		return errorf("file.write", probe, err)
+	}
+	defer os.Remove(probe)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	dom, err := runChrome(ctx, browser, "--dump-dom", "--virtual-time-budget=10000", fileURL(probe))
+	if err != nil {
+		return err
+	}
+	m := verifyResultPattern.FindStringSubmatch(dom)
+	if m == nil {
+		return errors.New(msg("verify.not_loaded"))
+	}
+	var res verifyResult
+	if err := json.Unmarshal([]byte(html.UnescapeString(m[1])), &res); err != nil {
+		return errorf("verify.bad_result", err)
+	}
+
+	if *screenshot != "" {
+		if err := captureScreenshot(ctx, browser, outputFile, *screenshot); err != nil {
+			return err
+		}
+		fmt.Println(msg("verify.screenshot_saved", *screenshot))
+	}
+
+	var problems []string
+	for _, src := range res.Broken {
+		problems = append(problems, msg("verify.broken", src))
+	}
+	for _, e := range res.Errors {
+		problems = append(problems, msg("verify.error", e))
+	}
+	if diff := res.FirstWidth - res.SecondWidth; diff < -1 || diff > 1 {
+		problems = append(problems, msg("verify.halves", res.FirstWidth, res.SecondWidth))
+	}
+	if diff := res.StripWidth - 2*res.FirstWidth; diff < -1 || diff > 1 {
+		problems = append(problems, msg("verify.keyframes", res.StripWidth, 2*res.FirstWidth))
+	}
+
+	fmt.Println(msg("verify.checked", outputFile, res.Images, res.StripWidth))
+	if len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Println("  " + p)
+		}
+		return errorf("verify.problems", len(problems))
+	}
+	fmt.Println(msg("verify.ok"))
+	return nil
+}
+
+// savePreview captures the first viewport of the generated page to
+// previewFile.
+func savePreview() error {
+	browser, err := findChrome("")
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	return captureScreenshot(ctx, browser, outputFile, previewFile)
+}
+
+func captureScreenshot(ctx context.Context, browser, page, out string) error {
+	abs, err := filepath.Abs(out)
+	if err != nil {
+		return err
+	}
+	if _, err := runChrome(ctx, browser, "--screenshot="+abs, "--window-size=1920,1080", "--hide-scrollbars", "--virtual-time-budget=1000", fileURL(page)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func runChrome(ctx context.Context, browser string, args ...string) (string, error) {
+	base := []string{"--headless", "--disable-gpu", "--no-first-run", "--no-default-browser-check", "--allow-file-access-from-files"}
+	cmd := exec.CommandContext(ctx, browser, append(base, args...)...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errorf("verify.run", browser, err, stderr.String())
+	}
+	return string(out), nil
+}
+
+// findChrome returns the browser to use: the given path, $CHROME_PATH, or
+// the first Chromium-based browser found in the usual places.
+func findChrome(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	if env := os.Getenv("CHROME_PATH"); env != "" {
+		return env, nil
+	}
+	for _, name := range []string{"chrome", "google-chrome", "google-chrome-stable", "chromium", "chromium-browser", "msedge"} {
+		if p, err := exec.LookPath(name); err == nil {
+			return p, nil
+		}
+	}
+	var candidates []string
+	switch runtime.GOOS {
+	case "windows":
+		for _, dir := range []string{os.Getenv("ProgramFiles"), os.Getenv("ProgramFiles(x86)"), os.Getenv("LocalAppData")} {
+			if dir == "" {
+				continue
+			}
+			candidates = append(candidates,
+				filepath.Join(dir, "Google", "Chrome", "Application", "chrome.exe"),
+				filepath.Join(dir, "Microsoft", "Edge", "Application", "msedge.exe"))
+		}
+	case "darwin":
+		candidates = []string{
+			"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome",
+			"/Applications/Chromium.app/Contents/MacOS/Chromium",
+			"/Applications/Microsoft Edge.app/Contents/MacOS/Microsoft Edge",
+		}
+	}
+	for _, c := range candidates {
+		if _, err := os.Stat(c); err == nil {
+			return c, nil
+		}
+	}
+	return "", errors.New(msg("verify.no_browser"))
+}
+
+func fileURL(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	abs = filepath.ToSlash(abs)
+	if !strings.HasPrefix(abs, "/") {
+		abs = "/" + abs
+	}
+	return (&url.URL{Scheme: "file", Path: abs}).String()
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var watermarkPositions = map[string]struct{}{"top-left": {}, "top-right": {}, "bottom-left": {}, "bottom-right": {}}
+
+func watermarkFolder() string {
+	return filepath.Join(cacheFolder, "watermarked")
+}
+
+// stampWatermarks writes a copy of every image with watermark_image or
+// watermark_text composited onto it to the cache, and points the tile at
+// the copy. The originals are never changed. Flipbooks, GIFs and WebPs
+// (which can't be re-encoded) are shown without a watermark.
+func stampWatermarks(metas []imageMeta, cfg config, failed *imageFailures) error {
+	mark := &watermark{scaled: map[image.Point]*image.NRGBA{}}
+	var id string
+	switch {
+	case cfg.watermarkImage != "":
+		img, err := decodeImage(cfg.watermarkImage, cfg.limits)
+		if err != nil {
+			return errorf("watermark.read_failed", err)
+		}
+		sum, err := fileHash(cfg.watermarkImage)
+		if err != nil {
+			return err
+		}
+		mark.img, id = img, sum
+	case cfg.watermarkText != "":
+		mark.img, mark.text, id = renderText(cfg.watermarkText), true, "text:"+cfg.watermarkText
+	default:
+		return nil
+	}
+	// Changing any setting gives every image a new file
+	id = fmt.Sprintf("%s|%s|%g|%g", id, cfg.watermarkPosition, cfg.watermarkOpacity, cfg.watermarkSize)
+	if cfg.optimize {
+		id += fmt.Sprintf("|%d|%d", optimizeHeight(cfg), cfg.optimizeQuality)
+	}
+
+	ensureHashes(metas, cfg.workers)
+	errs := make([]error, len(metas))
+	parallel(msg("progress.watermarking"), len(metas), cfg.workers, func(worker, i int) {
+		m := &metas[i]
+		// Stamping the optimized copy keeps the stamped one small too
+		src := m.relPath
+		if m.optimized != "" {
+			src = m.optimized
+		}
+		ext := strings.ToLower(filepath.Ext(src))
+		if m.frames > 0 || ext == ".gif" || ext == ".webp" {
+			return
+		}
+		if ext == ".jpeg" {
+			ext = ".jpg"
+		}
+		sum := sha256.Sum256([]byte(m.hash + "|" + id))
+		path := filepath.Join(watermarkFolder(), hex.EncodeToString(sum[:8])+ext)
+		if _, err := os.Stat(path); err != nil {
+			defer traceSpanOn(worker, traceProcessing, "watermark image", "path", m.relPath)()
+			if err := stampImage(path, src, mark, cfg); err != nil {
+				errs[i] = err
+				return
+			}
+		}
+		m.stamped = filepath.ToSlash(path)
+	})
+
+	for i, m := range metas {
+		if errs[i] != nil {
+			if err := failed.add(m.relPath, "failure.watermark", errs[i]); err != nil {
+				return err
+			}
+		}
+	}
+	// Copies of images that are gone or were stamped differently are left
+	// to sweepAssets, as backups of the page may still show them
+	return nil
+}
+
+// watermark is the image stamped onto every tile, with the sizes it has
+// been scaled to so far.
+type watermark struct {
+	img    image.Image
+	text   bool // rendered text, see renderText
+	mu     sync.Mutex
+	scaled map[image.Point]*image.NRGBA
+}
+
+// size returns the watermark scaled to w pixels wide.
+func (wm *watermark) size(w int) *image.NRGBA {
+	b := wm.img.Bounds()
+	if wm.text && b.Dx() < w {
+		// Text is pixel art: only enlarge it by whole steps
+		w = w / b.Dx() * b.Dx()
+	}
+	h := max(1, b.Dy()*w/b.Dx())
+	p := image.Pt(w, h)
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	if wm.scaled[p] == nil {
+		wm.scaled[p] = scaleImage(wm.img, w, h)
+	}
+	return wm.scaled[p]
+}
+
+// stampImage writes the image at src with mark on it to path, in the same
+// format.
+func stampImage(path, src string, mark *watermark, cfg config) error {
+	img, err := decodeImage(src, cfg.limits)
+	if err != nil {
+		return err
+	}
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(out, out.Bounds(), img, b.Min, draw.Src)
+
+	scaled := mark.size(max(1, int(float64(b.Dx())*cfg.watermarkSize)))
+	w, h := scaled.Bounds().Dx(), scaled.Bounds().Dy()
+	margin := min(b.Dx(), b.Dy()) / 50
+	x, y := margin, margin
+	if strings.HasSuffix(cfg.watermarkPosition, "right") {
+		x = b.Dx() - w - margin
+	}
+	if strings.HasPrefix(cfg.watermarkPosition, "bottom") {
+		y = b.Dy() - h - margin
+	}
+	opacity := image.NewUniform(color.Alpha{A: uint8(cfg.watermarkOpacity * 255)})
+	draw.DrawMask(out, image.Rect(x, y, x+w, y+h), scaled, image.Point{}, opacity, image.Point{}, draw.Over)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return errorf("file.create_folder", filepath.Dir(path), err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return errorf("file.create", path, err)
+	}
+	if filepath.Ext(path) == ".jpg" {
+		err = jpeg.Encode(f, out, &jpeg.Options{Quality: 92})
+	} else {
+		err = png.Encode(f, out)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return errorf("file.encode", path, err)
+	}
+	return nil
+}
+
+// scaleImage resizes src to w x h. Shrinking averages the source pixels
+// under each target pixel, so logos stay smooth; enlarging picks the
+// nearest pixel, so rendered text stays crisp.
+func scaleImage(src image.Image, w, h int) *image.NRGBA {
+	sb := src.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := sb.Min.Y + y*sb.Dy()/h
+		y1 := max(y0+1, sb.Min.Y+(y+1)*sb.Dy()/h)
+		for x := 0; x < w; x++ {
+			x0 := sb.Min.X + x*sb.Dx()/w
+			x1 := max(x0+1, sb.Min.X+(x+1)*sb.Dx()/w)
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a, n = r+cr, g+cg, b+cb, a+ca, n+1
+				}
+			}
+			r, g, b, a = r/n, g/n, b/n, a/n
+			if a == 0 {
+				continue
+			}
+			// Average premultiplied, store straight alpha
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(r * 0xffff / a >> 8),
+				G: uint8(g * 0xffff / a >> 8),
+				B: uint8(b * 0xffff / a >> 8),
+				A: uint8(a >> 8),
+			})
+		}
+	}
+	return dst
+}
+
+// renderText draws s in white with a black outline, one pixel per font
+// pixel, using font5x7. Characters outside printable ASCII become '?'.
+func renderText(s string) *image.RGBA {
+	runes := []rune(s)
+	img := image.NewRGBA(image.Rect(0, 0, len(runes)*6+1, 9))
+	lit := func(r rune, col, row int) bool {
+		if r < ' ' || r > '~' {
+			r = '?'
+		}
+		return font5x7[r-' '][col]&(1<<row) != 0
+	}
+	for pass, c := range []color.RGBA{{A: 0xff}, {R: 0xff, G: 0xff, B: 0xff, A: 0xff}} {
+		for i, r := range runes {
+			for col := 0; col < 5; col++ {
+				for row := 0; row < 7; row++ {
+					if !lit(r, col, row) {
+						continue
+					}
+					x, y := 1+i*6+col, 1+row
+					if pass == 0 {
+						// Outline: every neighbour of a lit pixel
+						draw.Draw(img, image.Rect(x-1, y-1, x+2, y+2), image.NewUniform(c), image.Point{}, draw.Src)
+					} else {
+						img.SetRGBA(x, y, c)
+					}
+				}
+			}
+		}
+	}
+	return img
+}
+
+// font5x7 is a 5x7 pixel font for printable ASCII. Each glyph is five
+// columns, left to right, with the top row in the lowest bit.
+var font5x7 = [95][5]byte{
+	{0x00, 0x00, 0x00, 0x00, 0x00}, // space
+	{0x00, 0x00, 0x5f, 0x00, 0x00}, // !
+	{0x00, 0x07, 0x00, 0x07, 0x00}, // "
+	{0x14, 0x7f, 0x14, 0x7f, 0x14}, // #
+	{0x24, 0x2a, 0x7f, 0x2a, 0x12}, // $
+	{0x23, 0x13, 0x08, 0x64, 0x62}, // %
+	{0x36, 0x49, 0x55, 0x22, 0x50}, // &
+	{0x00, 0x05, 0x03, 0x00, 0x00}, // '
+	{0x00, 0x1c, 0x22, 0x41, 0x00}, // (
+	{0x00, 0x41, 0x22, 0x1c, 0x00}, // )
+	{0x08, 0x2a, 0x1c, 0x2a, 0x08}, // *
+	{0x08, 0x08, 0x3e, 0x08, 0x08}, // +
+	{0x00, 0x50, 0x30, 0x00, 0x00}, // ,
+	{0x08, 0x08, 0x08, 0x08, 0x08}, // -
+	{0x00, 0x60, 0x60, 0x00, 0x00}, // .
+	{0x20, 0x10, 0x08, 0x04, 0x02}, // /
+	{0x3e, 0x51, 0x49, 0x45, 0x3e}, // 0
+	{0x00, 0x42, 0x7f, 0x40, 0x00}, // 1
+	{0x42, 0x61, 0x51, 0x49, 0x46}, // 2
+	{0x21, 0x41, 0x45, 0x4b, 0x31}, // 3
+	{0x18, 0x14, 0x12, 0x7f, 0x10}, // 4
+	{0x27, 0x45, 0x45, 0x45, 0x39}, // 5
+	{0x3c, 0x4a, 0x49, 0x49, 0x30}, // 6
+	{0x01, 0x71, 0x09, 0x05, 0x03}, // 7
+	{0x36, 0x49, 0x49, 0x49, 0x36}, // 8
+	{0x06, 0x49, 0x49, 0x29, 0x1e}, // 9
+	{0x00, 0x36, 0x36, 0x00, 0x00}, // :
+	{0x00, 0x56, 0x36, 0x00, 0x00}, // ;
+	{0x08, 0x14, 0x22, 0x41, 0x00}, // <
+	{0x14, 0x14, 0x14, 0x14, 0x14}, // =
+	{0x00, 0x41, 0x22, 0x14, 0x08}, // >
+	{0x02, 0x01, 0x51, 0x09, 0x06}, // ?
+	{0x32, 0x49, 0x79, 0x41, 0x3e}, // @
+	{0x7e, 0x11, 0x11, 0x11, 0x7e}, // A
+	{0x7f, 0x49, 0x49, 0x49, 0x36}, // B
+	{0x3e, 0x41, 0x41, 0x41, 0x22}, // C
+	{0x7f, 0x41, 0x41, 0x22, 0x1c}, // D
+	{0x7f, 0x49, 0x49, 0x49, 0x41}, // E
+	{0x7f, 0x09, 0x09, 0x09, 0x01}, // F
+	{0x3e, 0x41, 0x49, 0x49, 0x7a}, // G
+	{0x7f, 0x08, 0x08, 0x08, 0x7f}, // H
+	{0x00, 0x41, 0x7f, 0x41, 0x00}, // I
+	{0x20, 0x40, 0x41, 0x3f, 0x01}, // J
+	{0x7f, 0x08, 0x14, 0x22, 0x41}, // K
+	{0x7f, 0x40, 0x40, 0x40, 0x40}, // L
+	{0x7f, 0x02, 0x0c, 0x02, 0x7f}, // M
+	{0x7f, 0x04, 0x08, 0x10, 0x7f}, // N
+	{0x3e, 0x41, 0x41, 0x41, 0x3e}, // O
+	{0x7f, 0x09, 0x09, 0x09, 0x06}, // P
+	{0x3e, 0x41, 0x51, 0x21, 0x5e}, // Q
+	{0x7f, 0x09, 0x19, 0x29, 0x46}, // R
+	{0x46, 0x49, 0x49, 0x49, 0x31}, // S
+	{0x01, 0x01, 0x7f, 0x01, 0x01}, // T
+	{0x3f, 0x40, 0x40, 0x40, 0x3f}, // U
+	{0x1f, 0x20, 0x40, 0x20, 0x1f}, // V
+	{0x3f, 0x40, 0x38, 0x40, 0x3f}, // W
+	{0x63, 0x14, 0x08, 0x14, 0x63}, // X
+	{0x07, 0x08, 0x70, 0x08, 0x07}, // Y
+	{0x61, 0x51, 0x49, 0x45, 0x43}, // Z
+	{0x00, 0x7f, 0x41, 0x41, 0x00}, // [
+	{0x02, 0x04, 0x08, 0x10, 0x20}, // backslash
+	{0x00, 0x41, 0x41, 0x7f, 0x00}, // ]
+	{0x04, 0x02, 0x01, 0x02, 0x04}, // ^
+	{0x40, 0x40, 0x40, 0x40, 0x40}, // _
+	{0x00, 0x01, 0x02, 0x04, 0x00}, // `
+	{0x20, 0x54, 0x54, 0x54, 0x78}, // a
+	{0x7f, 0x48, 0x44, 0x44, 0x38}, // b
+	{0x38, 0x44, 0x44, 0x44, 0x20}, // c
+	{0x38, 0x44, 0x44, 0x48, 0x7f}, // d
+	{0x38, 0x54, 0x54, 0x54, 0x18}, // e
+	{0x08, 0x7e, 0x09, 0x01, 0x02}, // f
+	{0x0c, 0x52, 0x52, 0x52, 0x3e}, // g
+	{0x7f, 0x08, 0x04, 0x04, 0x78}, // h
+	{0x00, 0x44, 0x7d, 0x40, 0x00}, // i
+	{0x20, 0x40, 0x44, 0x3d, 0x00}, // j
+	{0x7f, 0x10, 0x28, 0x44, 0x00}, // k
+	{0x00, 0x41, 0x7f, 0x40, 0x00}, // l
+	{0x7c, 0x04, 0x18, 0x04, 0x78}, // m
+	{0x7c, 0x08, 0x04, 0x04, 0x78}, // n
+	{0x38, 0x44, 0x44, 0x44, 0x38}, // o
+	{0x7c, 0x14, 0x14, 0x14, 0x08}, // p
+	{0x08, 0x14, 0x14, 0x18, 0x7c}, // q
+	{0x7c, 0x08, 0x04, 0x04, 0x08}, // r
+	{0x48, 0x54, 0x54, 0x54, 0x20}, // s
+	{0x04, 0x3f, 0x44, 0x40, 0x20}, // t
+	{0x3c, 0x40, 0x40, 0x20, 0x7c}, // u
+	{0x1c, 0x20, 0x40, 0x20, 0x1c}, // v
+	{0x3c, 0x40, 0x30, 0x40, 0x3c}, // w
+	{0x44, 0x28, 0x10, 0x28, 0x44}, // x
+	{0x0c, 0x50, 0x50, 0x50, 0x3c}, // y
+	{0x44, 0x64, 0x54, 0x4c, 0x44}, // z
+	{0x00, 0x08, 0x36, 0x41, 0x00}, // {
+	{0x00, 0x00, 0x7f, 0x00, 0x00}, // |
+	{0x00, 0x41, 0x36, 0x08, 0x00}, // }
+	{0x08, 0x04, 0x08, 0x10, 0x08}, // ~
+}
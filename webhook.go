@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+)
+
+// Image lifecycle events that can be sent to webhooks.
+const (
+	eventRemoved    = "image.removed"
+	eventFirstShown = "image.first_shown"
+	eventApproved   = "image.approved"
+	eventRejected   = "image.rejected"
+)
+
+var allEvents = []string{eventRemoved, eventFirstShown, eventApproved, eventRejected}
+
+type webhookImage struct {
+	Path   string `json:"path"`
+	Author string `json:"author"`
+	Title  string `json:"title"`
+}
+
+type webhookPayload struct {
+	Event  string       `json:"event"`
+	Time   time.Time    `json:"time"`
+	Image  webhookImage `json:"image"`
+	Reason string       `json:"reason,omitempty"` // image.rejected only
+}
+
+func hookImage(m imageMeta) webhookImage {
+	return webhookImage{Path: m.relPath, Author: exportText(m.author), Title: exportText(m.title)}
+}
+
+// wantsEvent reports whether event should be sent. No webhook_events
+// setting means all events.
+func (cfg config) wantsEvent(event string) bool {
+	return len(cfg.webhookEvents) == 0 || slices.Contains(cfg.webhookEvents, event)
+}
+
+// sendEvent posts the event to every configured webhook. Failures are
+// reported but never stop generation.
+func sendEvent(cfg config, event string, img webhookImage) {
+	sendPayload(cfg, webhookPayload{Event: event, Time: time.Now(), Image: img})
+}
+
+func sendPayload(cfg config, payload webhookPayload) {
+	if len(cfg.webhookURLs) == 0 || !cfg.wantsEvent(payload.Event) {
+		return
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	for _, url := range cfg.webhookURLs {
+		resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			slog.Warn(msg("webhook.failed", url, err))
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			slog.Warn(msg("webhook.failed", url, resp.Status))
+			continue
+		}
+		slog.Debug(msg("webhook.sent", payload.Event, url))
+	}
+}
+
+// trackLifecycle compares this generation with the previous one, sends
+// image.removed for images that were deleted since and image.first_shown
+// for images that have never been in a generation before, and records the
+// new generation in st. available is every usable image, shown the ones in
+// this generation. An image that was renamed or moved is recognized by its
+// content and is neither removed nor new. On the first run nothing is sent,
+// so an existing gallery doesn't trigger a notification for every image.
+func trackLifecycle(cfg config, st *state, firstRun bool, available, shown []imageMeta) {
+	ensureHashes(available, cfg.workers)
+	ensureHashes(shown, cfg.workers)
+	present := make(map[string]bool, len(available))
+	for _, m := range available {
+		present[m.hash] = true
+		if _, ok := st.Arrived[m.hash]; !ok {
+			st.Arrived[m.hash] = st.Generation
+		}
+	}
+	for hash := range st.Arrived {
+		if !present[hash] {
+			delete(st.Arrived, hash)
+		}
+	}
+	st.Generation++
+
+	now := time.Now()
+	if !firstRun {
+		for _, path := range st.Current {
+			if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if hash := st.Hashes[path]; hash != "" && present[hash] {
+				continue // renamed or moved
+			}
+			sendEvent(cfg, eventRemoved, hookImage(newImageMeta(path)))
+			delete(st.FirstShown, st.Hashes[path])
+			delete(st.LastShown, st.Hashes[path])
+		}
+	}
+
+	st.Current = st.Current[:0]
+	st.Hashes = make(map[string]string, len(shown))
+	for _, m := range shown {
+		st.Current = append(st.Current, m.relPath)
+		st.Hashes[m.relPath] = m.hash
+		st.LastShown[m.hash] = now
+		if _, ok := st.FirstShown[m.hash]; ok {
+			continue
+		}
+		// State files from before content hashing are keyed by path
+		if t, ok := st.FirstShown[m.relPath]; ok {
+			delete(st.FirstShown, m.relPath)
+			st.FirstShown[m.hash] = t
+			continue
+		}
+		st.FirstShown[m.hash] = now
+		if !firstRun {
+			sendEvent(cfg, eventFirstShown, hookImage(m))
+		}
+	}
+}
+
+// validateEvents checks webhook_events names.
+func validateEvents(events []string) error {
+	for _, e := range events {
+		if !slices.Contains(allEvents, e) {
+			return errorf("webhook.unknown_event", e, oneOf(allEvents...))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress is only shown for steps with at least this many items.
+const progressMin = 20
+
+// parallel calls fn(worker, i) for every i below n, spread over the given
+// number of goroutines. fn stores its results by i, so they come out in the
+// same order as from a plain loop. With a label, progress is shown on the
+// terminal while it runs.
+func parallel(label string, n, workers int, fn func(worker, i int)) {
+	p := newProgress(label, n)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := range max(1, min(workers, n)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(w, i)
+				p.step()
+			}
+		}()
+	}
+	for i := range n {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	p.finish()
+}
+
+// progress shows "label done/total" on a single terminal line.
+type progress struct {
+	mu     sync.Mutex
+	label  string
+	total  int
+	done   int
+	shown  time.Time
+	width  int // of the last line written, to clear it
+	active bool
+}
+
+func newProgress(label string, total int) *progress {
+	p := &progress{label: label, total: total}
+	if label != "" && total >= progressMin && logLevel.Level() <= slog.LevelInfo {
+		if info, err := os.Stderr.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			p.active = true
+		}
+	}
+	return p
+}
+
+func (p *progress) step() {
+	if !p.active {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	if time.Since(p.shown) < 100*time.Millisecond && p.done < p.total {
+		return
+	}
+	p.shown = time.Now()
+	line := fmt.Sprintf("%s %d/%d", p.label, p.done, p.total)
+	p.width = len(line)
+	fmt.Fprint(os.Stderr, "\r"+line)
+}
+
+func (p *progress) finish() {
+	if p.active && p.width > 0 {
+		fmt.Fprint(os.Stderr, "\r"+strings.Repeat(" ", p.width)+"\r")
+	}
+}